@@ -0,0 +1,230 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"liteboard/auth"
+	"liteboard/internal"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func RegisterArchiveRoutes(r *route.RouterGroup) {
+	r.GET("/projects/:id/archive", auth.PermissionCheckMiddleware("project", "read", GetIDFromParam), GetProjectArchive)
+
+	r.POST("/content_lists/:id/archive", auth.PermissionCheckMiddleware("content_list", "write", GetIDFromParam), ArchiveContentList)
+	r.POST("/content_lists/:id/unarchive", auth.PermissionCheckMiddleware("content_list", "write", GetIDFromParam), UnarchiveContentList)
+	r.POST("/content_entries/:id/archive", auth.PermissionCheckMiddleware("content_entry", "write", GetIDFromParam), ArchiveContentEntry)
+	r.POST("/content_entries/:id/unarchive", auth.PermissionCheckMiddleware("content_entry", "write", GetIDFromParam), UnarchiveContentEntry)
+}
+
+// respondArchiveError 将归档状态冲突映射为 409，其余为 500
+func respondArchiveError(c *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, internal.ErrAlreadyArchived), errors.Is(err, internal.ErrNotArchived), errors.Is(err, internal.ErrListArchived):
+		c.JSON(409, internal.NewErrorResponse(err.Error()))
+	default:
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+	}
+}
+
+// GetProjectArchive @Summary Browse archived items
+// @Description Get the archived lists and entries of a project, most recently archived first. Entries archived together with a list carry that list's ID in archived_list_id.
+// @Tags archive
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {object} internal.ArchivedItems
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/archive [get]
+func GetProjectArchive(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	archived, err := internal.GetArchivedItems(db, projectID)
+	if err != nil {
+		hlog.Errorf("GetProjectArchive: GetArchivedItems failed, projectID=%d, error=%v", projectID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, archived)
+}
+
+// ArchiveContentList @Summary Archive content list
+// @Description Archive a list and the entries in it. Archived lists are hidden from the board but keep their entries and history.
+// @Tags archive
+// @Accept json
+// @Produce json
+// @Param id path int true "Content List ID"
+// @Success 200 {object} internal.ContentList
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_lists/{id}/archive [post]
+func ArchiveContentList(ctx context.Context, c *app.RequestContext) {
+	id, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	if _, err := internal.GetContentList(db, id); err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if err := internal.ArchiveContentList(db, id, time.Now().Unix()); err != nil {
+		hlog.Errorf("ArchiveContentList: ArchiveContentList failed, listID=%d, error=%v", id, err)
+		respondArchiveError(c, err)
+		return
+	}
+	cl, err := internal.GetContentList(db, id)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, cl)
+}
+
+// UnarchiveContentList @Summary Unarchive content list
+// @Description Restore an archived list together with the entries that were archived with it, in their original order
+// @Tags archive
+// @Accept json
+// @Produce json
+// @Param id path int true "Content List ID"
+// @Success 200 {object} internal.ContentList
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_lists/{id}/unarchive [post]
+func UnarchiveContentList(ctx context.Context, c *app.RequestContext) {
+	id, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	if _, err := internal.GetContentList(db, id); err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if err := internal.UnarchiveContentList(db, id); err != nil {
+		hlog.Errorf("UnarchiveContentList: UnarchiveContentList failed, listID=%d, error=%v", id, err)
+		respondArchiveError(c, err)
+		return
+	}
+	cl, err := internal.GetContentList(db, id)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, cl)
+}
+
+// ArchiveContentEntry @Summary Archive content entry
+// @Description Archive an entry. It is taken out of its list and hidden from default queries; its list and position are remembered for unarchiving.
+// @Tags archive
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Success 200 {object} internal.ContentEntry
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/archive [post]
+func ArchiveContentEntry(ctx context.Context, c *app.RequestContext) {
+	id, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	if _, err := internal.GetContentEntry(db, id); err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if err := internal.ArchiveContentEntry(db, id, time.Now().Unix()); err != nil {
+		hlog.Errorf("ArchiveContentEntry: ArchiveContentEntry failed, entryID=%d, error=%v", id, err)
+		respondArchiveError(c, err)
+		return
+	}
+	ce, err := internal.GetContentEntry(db, id)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, ce)
+}
+
+// UnarchiveContentEntry @Summary Unarchive content entry
+// @Description Restore an archived entry to its original position in its list. The list policy applies as for any entry added to the list; an entry archived with its list is restored by unarchiving the list.
+// @Tags archive
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Param force query bool false "Admins only: restore the entry even if it violates the list policy"
+// @Success 200 {object} internal.ContentEntry
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/unarchive [post]
+func UnarchiveContentEntry(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	id, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	ce, err := internal.GetContentEntry(db, id)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	list, err := internal.ArchivedEntryList(db, ce)
+	if err != nil {
+		respondArchiveError(c, err)
+		return
+	}
+	if list != nil {
+		policyErr := internal.CheckListPolicy(db, list, []internal.ContentEntry{*ce}, len(list.Items), len(list.Items)+1, user.ID)
+		if !enforceListPolicy(c, user.ID, list, policyErr, "UnarchiveContentEntry") {
+			return
+		}
+	}
+	if err := internal.UnarchiveContentEntry(db, id); err != nil {
+		hlog.Errorf("UnarchiveContentEntry: UnarchiveContentEntry failed, entryID=%d, error=%v", id, err)
+		respondArchiveError(c, err)
+		return
+	}
+	ce, err = internal.GetContentEntry(db, id)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, ce)
+}
@@ -0,0 +1,271 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"liteboard/auth"
+	"liteboard/internal"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+var (
+	blobStore        internal.BlobStore
+	attachmentLimits = internal.DefaultAttachmentLimits
+)
+
+// SetBlobStore sets the storage backend used for attachments
+func SetBlobStore(store internal.BlobStore) {
+	blobStore = store
+}
+
+// SetAttachmentLimits overrides the default upload size and MIME type limits
+func SetAttachmentLimits(limits internal.AttachmentLimits) {
+	attachmentLimits = limits
+}
+
+func RegisterAttachmentRoutes(r *route.RouterGroup) {
+	r.GET("/content_entries/:id/attachments", auth.PermissionCheckMiddleware("content_entry", "read", GetIDFromParam), GetEntryAttachments)
+	r.POST("/content_entries/:id/attachments", auth.PermissionCheckMiddleware("content_entry", "write", GetIDFromParam), UploadAttachment)
+	r.GET("/content_entries/:id/attachments/:attachmentId", auth.PermissionCheckMiddleware("content_entry", "read", GetIDFromParam), DownloadAttachment)
+	r.DELETE("/content_entries/:id/attachments/:attachmentId", auth.PermissionCheckMiddleware("content_entry", "write", GetIDFromParam), DeleteAttachment)
+}
+
+// getAttachmentInEntry 读取路径中的附件，并确认其属于指定条目
+func getAttachmentInEntry(c *app.RequestContext, entryID int64) (*internal.Attachment, bool) {
+	attachmentID, err := strconv.ParseInt(c.Param("attachmentId"), 10, 64)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid attachment id"))
+		return nil, false
+	}
+	a, err := internal.GetAttachment(db, attachmentID)
+	if err != nil || a.EntryID != entryID {
+		c.JSON(404, internal.NewErrorResponse("attachment not found"))
+		return nil, false
+	}
+	return a, true
+}
+
+// respondAttachmentError 将大小超限映射为 413，类型不允许映射为 415，其余为 500
+func respondAttachmentError(c *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, internal.ErrAttachmentTooLarge):
+		c.JSON(413, internal.NewErrorResponse(err.Error()))
+	case errors.Is(err, internal.ErrAttachmentType):
+		c.JSON(415, internal.NewErrorResponse(err.Error()))
+	default:
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+	}
+}
+
+// GetEntryAttachments @Summary Get entry attachments
+// @Description List the attachments of a content entry
+// @Tags attachments
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Success 200 {array} internal.Attachment
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/attachments [get]
+func GetEntryAttachments(ctx context.Context, c *app.RequestContext) {
+	entryID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	attachments, err := internal.GetAttachmentsByEntry(db, entryID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, attachments)
+}
+
+// UploadAttachment @Summary Upload attachment
+// @Description Attach a file to a content entry (multipart form field "file"). Size and MIME type are limited; identical files share storage.
+// @Tags attachments
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Param file formData file true "File"
+// @Success 201 {object} internal.Attachment
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 413 {object} internal.ErrorResponse
+// @Failure 415 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/attachments [post]
+func UploadAttachment(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	if blobStore == nil {
+		c.JSON(500, internal.NewErrorResponse("attachment storage is not configured"))
+		return
+	}
+	entryID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	ce, err := internal.GetContentEntry(db, entryID)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("missing file: "+err.Error()))
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	defer f.Close()
+
+	// 按文件内容识别类型，不轻信客户端声明
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	contentType := internal.DetectAttachmentType(head[:n], fh.Header.Get("Content-Type"))
+	if err := attachmentLimits.CheckAttachment(fh.Size, contentType); err != nil {
+		respondAttachmentError(c, err)
+		return
+	}
+
+	a := internal.Attachment{
+		EntryID:     entryID,
+		ProjectID:   ce.ProjectID,
+		Filename:    filepath.Base(strings.ReplaceAll(fh.Filename, "\\", "/")),
+		ContentType: contentType,
+		Size:        fh.Size,
+		UploaderID:  user.ID,
+		CreatedAt:   time.Now().Unix(),
+	}
+	id, err := internal.CreateAttachmentWithBlob(ctx, db, blobStore, &a, f)
+	if err != nil {
+		hlog.Errorf("UploadAttachment: CreateAttachmentWithBlob failed, entryID=%d, error=%v", entryID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	a.ID = id
+	c.JSON(201, a)
+}
+
+// DownloadAttachment @Summary Download attachment
+// @Description Stream the content of an attachment. Single byte ranges (Range: bytes=start-end) are supported.
+// @Tags attachments
+// @Produce octet-stream
+// @Param id path int true "Content Entry ID"
+// @Param attachmentId path int true "Attachment ID"
+// @Param Range header string false "Byte range"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 416 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/attachments/{attachmentId} [get]
+func DownloadAttachment(ctx context.Context, c *app.RequestContext) {
+	if blobStore == nil {
+		c.JSON(500, internal.NewErrorResponse("attachment storage is not configured"))
+		return
+	}
+	entryID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	a, ok := getAttachmentInEntry(c, entryID)
+	if !ok {
+		return
+	}
+
+	offset, length, partial, err := internal.ParseByteRange(string(c.GetHeader("Range")), a.Size)
+	if err != nil {
+		c.Header("Content-Range", "bytes */"+strconv.FormatInt(a.Size, 10))
+		c.JSON(416, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	body, err := blobStore.Get(ctx, a.Hash, offset, length)
+	if err != nil {
+		hlog.Errorf("DownloadAttachment: Get blob failed, attachmentID=%d, error=%v", a.ID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+
+	c.Header("Content-Type", a.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("ETag", `"`+a.Hash+`"`)
+	if partial {
+		c.Header("Content-Range", "bytes "+strconv.FormatInt(offset, 10)+"-"+strconv.FormatInt(offset+length-1, 10)+"/"+strconv.FormatInt(a.Size, 10))
+		c.SetStatusCode(206)
+	} else {
+		c.SetStatusCode(200)
+	}
+	c.SetBodyStream(body, int(length))
+}
+
+// DeleteAttachment @Summary Delete attachment
+// @Description Remove an attachment from a content entry
+// @Tags attachments
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Param attachmentId path int true "Attachment ID"
+// @Success 200 {object} internal.SuccessResponse
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/attachments/{attachmentId} [delete]
+func DeleteAttachment(ctx context.Context, c *app.RequestContext) {
+	entryID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	a, ok := getAttachmentInEntry(c, entryID)
+	if !ok {
+		return
+	}
+	if err := internal.DeleteAttachment(ctx, db, blobStore, a.ID); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, internal.NewSuccessResponse("deleted"))
+}
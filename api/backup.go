@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"liteboard/auth"
+	"liteboard/internal"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+var (
+	backupDBPath string
+	backupDir    string
+	backupKeep   int
+)
+
+// SetBackupConfig 设置数据库文件、快照目录以及保留的快照数量
+func SetBackupConfig(dbPath, dir string, keep int) {
+	backupDBPath = dbPath
+	backupDir = dir
+	backupKeep = keep
+}
+
+// StartBackupWorker 在后台按间隔写入数据库快照；interval 为 0 时不启用
+func StartBackupWorker(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go internal.RunBackupWorker(context.Background(), backupDBPath, backupDir, backupKeep, interval)
+}
+
+func RegisterBackupRoutes(r *route.RouterGroup) {
+	r.POST("/admin/backup", auth.PermissionMiddleware("admin"), CreateBackup)
+}
+
+// CreateBackup @Summary Back up the database
+// @Description Write a snapshot of the database to the backup directory with SQLite's online backup API while the server keeps running, verify it with an integrity check and rotate old snapshots like the scheduled backups do. Requires the admin group.
+// @Tags admin
+// @Produce json
+// @Success 201 {object} internal.BackupInfo
+// @Failure 403 {string} string "Not an admin"
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/admin/backup [post]
+func CreateBackup(ctx context.Context, c *app.RequestContext) {
+	info, err := internal.SnapshotDatabase(ctx, backupDBPath, backupDir, backupKeep)
+	if err != nil {
+		hlog.Errorf("CreateBackup: SnapshotDatabase failed, dir=%s, error=%v", backupDir, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	hlog.Infof("User %d backed up the database to %s (%d bytes)", actorID(c), info.File, info.Size)
+	c.JSON(201, info)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"liteboard/auth"
+	"liteboard/internal"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func RegisterBatchRoutes(r *route.RouterGroup) {
+	r.POST("/batch", RunBatch)
+}
+
+// BatchRequest is the body of a batch request
+type BatchRequest struct {
+	Operations []internal.BatchOperation `json:"operations"`
+}
+
+// BatchResponse reports the per-operation results of a batch
+type BatchResponse struct {
+	Results     []internal.BatchResult `json:"results"`
+	Error       string                 `json:"error,omitempty"`
+	FailedIndex *int                   `json:"failed_index,omitempty"` // 失败的操作序号，整个批次已回滚
+}
+
+// batchErrorStatus 将批量操作的错误映射为 HTTP 状态码
+func batchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, internal.ErrBatchForbidden), errors.Is(err, internal.ErrTransferForbidden):
+		return 403
+	case errors.Is(err, internal.ErrBatchNotFound):
+		return 404
+	case errors.Is(err, internal.ErrListPolicy):
+		return 409
+	case errors.Is(err, internal.ErrInvalidBatch), errors.Is(err, internal.ErrInvalidListPolicy),
+		errors.Is(err, internal.ErrInvalidTransfer):
+		return 400
+	}
+	return 500
+}
+
+// RunBatch @Summary Run batch operations
+// @Description Run an ordered list of create, update, delete and move operations on projects, lists and entries as one unit. An operation may name what it creates with "ref" and later operations may use "$ref" in place of an ID (id, list_id, target_list_id, target_project_id and data.project_id/data.items). Every operation is permission checked as its single request would be; list policies cannot be forced. Deletes run after all other operations. If any operation fails, everything is rolled back and failed_index names the operation.
+// @Tags batch
+// @Accept json
+// @Produce json
+// @Param request body BatchRequest true "Operations"
+// @Success 200 {object} BatchResponse
+// @Failure 400 {object} BatchResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} BatchResponse
+// @Failure 404 {object} BatchResponse
+// @Failure 409 {object} BatchResponse
+// @Failure 500 {object} BatchResponse
+// @Security Session
+// @Router /api/batch [post]
+func RunBatch(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	var req BatchRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	results, err := internal.RunBatch(ctx, db, blobStore, user.ID, req.Operations)
+	if err != nil {
+		resp := BatchResponse{Results: results, Error: err.Error()}
+		var batchErr *internal.BatchError
+		if errors.As(err, &batchErr) {
+			resp.FailedIndex = &batchErr.Index
+		}
+		status := batchErrorStatus(err)
+		if status == 500 {
+			hlog.Errorf("RunBatch: RunBatch failed, userID=%d, error=%v", user.ID, err)
+		}
+		c.JSON(status, resp)
+		return
+	}
+	c.JSON(200, BatchResponse{Results: results})
+}
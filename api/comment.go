@@ -0,0 +1,269 @@
+package api
+
+import (
+	"context"
+	"liteboard/auth"
+	"liteboard/internal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func RegisterCommentRoutes(r *route.RouterGroup) {
+	r.GET("/content_entries/:id/comments", auth.PermissionCheckMiddleware("content_entry", "read", GetIDFromParam), GetEntryComments)
+	// 评论权限按条目所属项目判断，在处理函数中检查
+	r.POST("/content_entries/:id/comments", CreateEntryComment)
+	// 编辑和删除仅限作者本人，这里只要求可读
+	r.PUT("/content_entries/:id/comments/:commentId", auth.PermissionCheckMiddleware("content_entry", "read", GetIDFromParam), UpdateEntryComment)
+	r.DELETE("/content_entries/:id/comments/:commentId", auth.PermissionCheckMiddleware("content_entry", "read", GetIDFromParam), DeleteEntryComment)
+}
+
+// commentRequest is the body accepted when creating or editing a comment
+type commentRequest struct {
+	ParentID int64  `json:"parent_id"`
+	Body     string `json:"body"`
+}
+
+// getOwnComment 读取路径中的评论，确认其属于该条目且由当前用户发表
+func getOwnComment(c *app.RequestContext, entryID int64, userID int64) (*internal.EntryComment, bool) {
+	commentID, err := strconv.ParseInt(c.Param("commentId"), 10, 64)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid comment id"))
+		return nil, false
+	}
+	ec, err := internal.GetEntryComment(db, commentID)
+	if err != nil || ec.EntryID != entryID || ec.Deleted {
+		c.JSON(404, internal.NewErrorResponse("comment not found"))
+		return nil, false
+	}
+	if ec.AuthorID != userID {
+		c.JSON(403, internal.NewErrorResponse("only the author can change a comment"))
+		return nil, false
+	}
+	return ec, true
+}
+
+// GetEntryComments @Summary Get entry comments
+// @Description Get all comments of a content entry in creation order. Replies reference their parent through parent_id.
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Success 200 {array} internal.EntryComment
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/comments [get]
+func GetEntryComments(ctx context.Context, c *app.RequestContext) {
+	entryID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	comments, err := internal.GetEntryComments(db, entryID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, comments)
+}
+
+// CreateEntryComment @Summary Create entry comment
+// @Description Post a markdown comment on a content entry, optionally as a reply to another comment. @username mentions of project members are recorded. Requires the comment permission on the entry's project or on the entry.
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Param comment body commentRequest true "Comment"
+// @Success 201 {object} internal.EntryComment
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/comments [post]
+func CreateEntryComment(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	entryID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	ce, err := internal.GetContentEntry(db, entryID)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	allowed, err := internal.CanCommentOnEntry(db, user.ID, ce)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if !allowed {
+		c.JSON(403, internal.NewErrorResponse("forbidden"))
+		return
+	}
+
+	var req commentRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		c.JSON(400, internal.NewErrorResponse("comment body is required"))
+		return
+	}
+	if req.ParentID != 0 {
+		parent, err := internal.GetEntryComment(db, req.ParentID)
+		if err != nil || parent.EntryID != entryID {
+			c.JSON(400, internal.NewErrorResponse("parent comment does not belong to this entry"))
+			return
+		}
+	}
+
+	mentions, err := internal.ResolveMentions(db, ce.ProjectID, req.Body)
+	if err != nil {
+		hlog.Errorf("CreateEntryComment: ResolveMentions failed, entryID=%d, error=%v", entryID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+
+	now := time.Now().Unix()
+	ec := internal.EntryComment{
+		EntryID:   entryID,
+		ParentID:  req.ParentID,
+		AuthorID:  user.ID,
+		Body:      req.Body,
+		Mentions:  mentions,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	id, err := internal.CreateEntryComment(db, &ec)
+	if err != nil {
+		hlog.Errorf("CreateEntryComment: CreateEntryComment failed, entryID=%d, error=%v", entryID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	ec.ID = id
+	for _, userID := range mentions {
+		notify(internal.Notification{
+			UserID:    userID,
+			Type:      internal.NotificationMention,
+			ActorID:   user.ID,
+			ProjectID: ce.ProjectID,
+			EntryID:   ce.ID,
+			Message:   user.Username + " mentioned you on \"" + ce.Title + "\"",
+		})
+	}
+	c.JSON(201, ec)
+}
+
+// UpdateEntryComment @Summary Update entry comment
+// @Description Edit the body of a comment. Only the author can edit; mentions are re-resolved.
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Param commentId path int true "Comment ID"
+// @Param comment body commentRequest true "Comment"
+// @Success 200 {object} internal.EntryComment
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/comments/{commentId} [put]
+func UpdateEntryComment(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	entryID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	ec, ok := getOwnComment(c, entryID, user.ID)
+	if !ok {
+		return
+	}
+	ce, err := internal.GetContentEntry(db, entryID)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+
+	var req commentRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		c.JSON(400, internal.NewErrorResponse("comment body is required"))
+		return
+	}
+	mentions, err := internal.ResolveMentions(db, ce.ProjectID, req.Body)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+
+	ec.Body = req.Body
+	ec.Mentions = mentions
+	ec.UpdatedAt = time.Now().Unix()
+	if err := internal.UpdateEntryComment(db, ec.ID, ec); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, ec)
+}
+
+// DeleteEntryComment @Summary Delete entry comment
+// @Description Delete a comment. Only the author can delete; a comment with replies is kept as a deleted placeholder.
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Param commentId path int true "Comment ID"
+// @Success 200 {object} internal.SuccessResponse
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/comments/{commentId} [delete]
+func DeleteEntryComment(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	entryID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	ec, ok := getOwnComment(c, entryID, user.ID)
+	if !ok {
+		return
+	}
+	if err := internal.DeleteEntryComment(db, ec.ID, time.Now().Unix()); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, internal.NewSuccessResponse("deleted"))
+}
@@ -2,9 +2,12 @@ package api
 
 import (
 	"context"
+	"errors"
 	"liteboard/auth"
 	"liteboard/internal"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/common/hlog"
@@ -24,14 +27,18 @@ func RegisterContentRoutes(r *route.RouterGroup) {
 	r.GET("/content_entries/:id", auth.PermissionCheckMiddleware("content_entry", "read", GetIDFromParam), GetContentEntry)
 	r.PUT("/content_entries/:id", auth.PermissionCheckMiddleware("content_entry", "write", GetIDFromParam), UpdateContentEntry)
 	r.DELETE("/content_entries/:id", auth.PermissionCheckMiddleware("content_entry", "admin", GetIDFromParam), DeleteContentEntry)
+
+	r.GET("/me/assigned", GetMyAssignedEntries)
 }
 
 // GetContentLists @Summary Get all content lists
-// @Description Retrieve list of content lists for a project
+// @Description Retrieve list of content lists for a project. Archived lists are left out unless include_archived is true.
 // @Tags content
 // @Accept json
 // @Produce json
 // @Param projectid query int true "Project ID"
+// @Param include_archived query bool false "Also return archived lists"
+// @Param updated_since query int false "Only lists changed at or after this Unix timestamp"
 // @Success 200 {array} internal.ContentList
 // @Failure 400 {object} internal.ErrorResponse
 // @Failure 500 {object} internal.ErrorResponse
@@ -47,12 +54,20 @@ func GetContentLists(ctx context.Context, c *app.RequestContext) {
 		c.JSON(400, internal.NewErrorResponse("invalid projectid"))
 		return
 	}
+	since, err := parseUpdatedSince(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
 	lists, err := internal.GetContentListsByProject(db, projectID)
 	if err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
 		return
 	}
-	c.JSON(200, lists)
+	if c.Query("include_archived") != "true" {
+		lists = internal.ActiveContentLists(lists)
+	}
+	c.JSON(200, internal.UpdatedSince(lists, since))
 }
 
 // CreateContentList @Summary Create content list
@@ -90,6 +105,11 @@ func CreateContentList(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
+	if err := internal.ValidateListPolicy(&cl); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+
 	cl.CreatorID = user.ID
 	id, err := internal.CreateContentList(db, &cl)
 	if err != nil {
@@ -105,6 +125,7 @@ func CreateContentList(ctx context.Context, c *app.RequestContext) {
 		ContentType: "content_list",
 		ContentIDs:  []int64{cl.ID},
 		Action:      "admin",
+		Timestamps:  internal.Timestamps{UpdatedBy: cl.CreatorID},
 	}
 	_, err = internal.CreateDetailPermission(db, &dp)
 	if err != nil {
@@ -119,6 +140,7 @@ func CreateContentList(ctx context.Context, c *app.RequestContext) {
 		ContentType: "content_list",
 		ContentIDs:  []int64{cl.ID},
 		Action:      "read",
+		Timestamps:  internal.Timestamps{UpdatedBy: cl.CreatorID},
 	}
 	_, err = internal.CreateDetailPermission(db, &dpRead)
 	if err != nil {
@@ -128,6 +150,7 @@ func CreateContentList(ctx context.Context, c *app.RequestContext) {
 	}
 
 	hlog.Debugf("CreateContentList: successfully created content list ID=%d", cl.ID)
+	emitWebhook(cl.ProjectID, internal.WebhookListCreated, user.ID, cl)
 	c.JSON(201, cl)
 }
 
@@ -160,39 +183,103 @@ func GetContentList(ctx context.Context, c *app.RequestContext) {
 }
 
 // UpdateContentList @Summary Update content list
-// @Description Update an existing content list
+// @Description Update an existing content list. Fields omitted from the body keep their current values; project_id, creator_id, archived_at and the timestamps cannot be changed here. Entries added to items must satisfy the list policy (max_items, allowed_types, move_permission); changing the policy requires admin permission.
 // @Tags content
 // @Accept json
 // @Produce json
 // @Param id path int true "Content List ID"
-// @Param contentList body internal.ContentList true "Content List"
+// @Param force query bool false "Admins only: apply the update even if it violates the list policy"
+// @Param contentList body internal.ContentListUpdate true "Fields to change"
 // @Success 200 {object} internal.ContentList
 // @Failure 400 {object} internal.ErrorResponse
 // @Failure 401 {object} internal.ErrorResponse
 // @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
 // @Failure 500 {object} internal.ErrorResponse
 // @Security Session
 // @Router /api/content_lists/{id} [put]
 func UpdateContentList(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
 	idStr := c.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		c.JSON(400, internal.NewErrorResponse("invalid id"))
 		return
 	}
-	var cl internal.ContentList
-	if err := c.BindJSON(&cl); err != nil {
+	existing, err := internal.GetContentList(db, id)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	var req internal.ContentListUpdate
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	// 只写入请求中给出的可编辑字段，项目、创建者、归档状态等由服务端维护的字段保持原值
+	cl := *existing
+	req.Apply(&cl)
+	cl.UpdatedBy = user.ID
+	if err := internal.ValidateListPolicy(&cl); err != nil {
 		c.JSON(400, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	if internal.ListPolicyChanged(existing, &cl) {
+		admin, err := internal.IsListAdmin(db, user.ID, existing)
+		if err != nil {
+			c.JSON(500, internal.NewErrorResponse(err.Error()))
+			return
+		}
+		if !admin {
+			c.JSON(403, internal.NewErrorResponse("changing the list policy requires admin permission"))
+			return
+		}
+	}
+	// 新增条目按更新后的策略检查
+	if !enforceListPolicy(c, user.ID, &cl, internal.CheckListUpdate(db, &cl, existing.Items, user.ID), "UpdateContentList") {
+		return
+	}
 	err = internal.UpdateContentList(db, id, &cl)
 	if err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	emitWebhook(cl.ProjectID, internal.WebhookListUpdated, user.ID, cl)
 	c.JSON(200, cl)
 }
 
+// enforceListPolicy 处理列表策略检查结果。违反策略时返回 409；管理员可通过 force=true 强制执行，
+// 强制执行会记录日志。返回 false 表示已写出错误响应
+func enforceListPolicy(c *app.RequestContext, userID int64, cl *internal.ContentList, policyErr error, caller string) bool {
+	if policyErr == nil {
+		return true
+	}
+	if !errors.Is(policyErr, internal.ErrListPolicy) {
+		c.JSON(500, internal.NewErrorResponse(policyErr.Error()))
+		return false
+	}
+	if c.Query("force") != "true" {
+		c.JSON(409, internal.NewErrorResponse(policyErr.Error()))
+		return false
+	}
+	admin, err := internal.IsListAdmin(db, userID, cl)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return false
+	}
+	if !admin {
+		c.JSON(403, internal.NewErrorResponse("only admins can force a list policy override"))
+		return false
+	}
+	hlog.Warnf("%s: list policy overridden with force, listID=%d, userID=%d, violation=%v", caller, cl.ID, userID, policyErr)
+	return true
+}
+
 // DeleteContentList @Summary Delete content list
 // @Description Delete a content list by ID
 // @Tags content
@@ -213,40 +300,253 @@ func DeleteContentList(ctx context.Context, c *app.RequestContext) {
 		c.JSON(400, internal.NewErrorResponse("invalid id"))
 		return
 	}
+	existing, err := internal.GetContentList(db, id)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
 	err = internal.DeleteContentList(db, id)
 	if err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	emitWebhook(existing.ProjectID, internal.WebhookListDeleted, actorID(c), existing)
 	c.JSON(200, internal.NewSuccessResponse("deleted"))
 }
 
 // GetContentEntries @Summary Get all content entries
-// @Description Retrieve list of content entries. Each entry includes creator_id and project_id.
+// @Description Retrieve the content entries the current user can read, through read permission on the entry or on its project. Each entry includes creator_id and project_id.
 // @Tags content
 // @Accept json
 // @Produce json
+// @Param assignee query string false "Assignee user ID, or \"me\" for the current user"
+// @Param due_before query int false "Only entries due before this Unix timestamp"
+// @Param overdue query bool false "Only entries whose due date has passed"
+// @Param labels query string false "Comma-separated label IDs; entries carrying any of them match"
+// @Param include_archived query bool false "Also return archived entries"
+// @Param updated_since query int false "Only entries changed at or after this Unix timestamp"
+// @Param cf.{fieldId} query string false "Only entries whose custom field equals the value"
+// @Param sort query string false "Sort by a custom field: cf.{fieldId} or -cf.{fieldId} for descending"
+// @Param render query string false "Set to html to include sanitized content_html rendered from the markdown content"
 // @Success 200 {array} internal.ContentEntry
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
 // @Failure 500 {object} internal.ErrorResponse
+// @Security Session
 // @Router /api/content_entries [get]
 func GetContentEntries(ctx context.Context, c *app.RequestContext) {
-	entries, err := internal.GetContentEntries(db)
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	filter, err := parseEntryFilter(c, user.ID)
 	if err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	sortFieldID, sortDesc, err := parseEntrySort(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	entries, err := internal.GetReadableEntriesForUser(db, user.ID)
+	if err != nil {
+		hlog.Errorf("GetContentEntries: GetReadableEntriesForUser failed, userID=%d, error=%v", user.ID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	entries = internal.FilterContentEntries(entries, filter)
+	if sortFieldID != 0 {
+		internal.SortContentEntriesByCustomField(entries, sortFieldID, sortDesc)
+	}
+	if err := renderEntries(c, entries); err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
 		return
 	}
 	c.JSON(200, entries)
 }
 
+// parseEntrySort 解析 sort 参数，目前支持 cf.<字段ID>，前缀 - 表示降序
+func parseEntrySort(c *app.RequestContext) (int64, bool, error) {
+	sortParam := c.Query("sort")
+	if sortParam == "" {
+		return 0, false, nil
+	}
+	desc := strings.HasPrefix(sortParam, "-")
+	sortParam = strings.TrimPrefix(sortParam, "-")
+	if !strings.HasPrefix(sortParam, "cf.") {
+		return 0, false, errors.New("invalid sort")
+	}
+	fieldID, err := strconv.ParseInt(strings.TrimPrefix(sortParam, "cf."), 10, 64)
+	if err != nil {
+		return 0, false, errors.New("invalid sort")
+	}
+	return fieldID, desc, nil
+}
+
+// parseEntryFilter 解析条目列表的查询参数，assignee=me 表示 userID
+func parseEntryFilter(c *app.RequestContext, userID int64) (internal.EntryFilter, error) {
+	filter := internal.EntryFilter{Now: time.Now().Unix()}
+
+	if assignee := c.Query("assignee"); assignee != "" {
+		if assignee == "me" {
+			filter.AssigneeID = userID
+		} else {
+			id, err := strconv.ParseInt(assignee, 10, 64)
+			if err != nil {
+				return filter, errors.New("invalid assignee")
+			}
+			filter.AssigneeID = id
+		}
+	}
+
+	if dueBefore := c.Query("due_before"); dueBefore != "" {
+		ts, err := strconv.ParseInt(dueBefore, 10, 64)
+		if err != nil {
+			return filter, errors.New("invalid due_before")
+		}
+		filter.DueBefore = ts
+	}
+
+	if overdue := c.Query("overdue"); overdue != "" {
+		b, err := strconv.ParseBool(overdue)
+		if err != nil {
+			return filter, errors.New("invalid overdue")
+		}
+		filter.Overdue = b
+	}
+
+	if labels := c.Query("labels"); labels != "" {
+		for _, part := range strings.Split(labels, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+			if err != nil {
+				return filter, errors.New("invalid labels")
+			}
+			filter.LabelIDs = append(filter.LabelIDs, id)
+		}
+	}
+
+	if includeArchived := c.Query("include_archived"); includeArchived != "" {
+		b, err := strconv.ParseBool(includeArchived)
+		if err != nil {
+			return filter, errors.New("invalid include_archived")
+		}
+		filter.IncludeArchived = b
+	}
+
+	since, err := parseUpdatedSince(c)
+	if err != nil {
+		return filter, err
+	}
+	filter.UpdatedSince = since
+
+	// cf.<字段ID>=值 按自定义字段过滤
+	var cfErr error
+	c.QueryArgs().VisitAll(func(key, value []byte) {
+		k := string(key)
+		if !strings.HasPrefix(k, "cf.") {
+			return
+		}
+		fieldID, err := strconv.ParseInt(strings.TrimPrefix(k, "cf."), 10, 64)
+		if err != nil {
+			cfErr = errors.New("invalid custom field filter " + k)
+			return
+		}
+		if filter.CustomFields == nil {
+			filter.CustomFields = make(map[int64]string)
+		}
+		filter.CustomFields[fieldID] = string(value)
+	})
+	if cfErr != nil {
+		return filter, cfErr
+	}
+
+	return filter, nil
+}
+
+// GetMyAssignedEntries @Summary Get entries assigned to me
+// @Description Retrieve the entries assigned to the current user across all projects they can read
+// @Tags content
+// @Accept json
+// @Produce json
+// @Param updated_since query int false "Only entries changed at or after this Unix timestamp"
+// @Param render query string false "Set to html to include sanitized content_html rendered from the markdown content"
+// @Success 200 {array} internal.ContentEntry
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/me/assigned [get]
+func GetMyAssignedEntries(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	since, err := parseUpdatedSince(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	entries, err := internal.GetAssignedEntriesForUser(db, user.ID)
+	if err != nil {
+		hlog.Errorf("GetMyAssignedEntries: GetAssignedEntriesForUser failed, userID=%d, error=%v", user.ID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	entries = internal.UpdatedSince(entries, since)
+	if err := renderEntries(c, entries); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, entries)
+}
+
+// renderEntries 在请求带 render=html 时由 markdown 内容生成 content_html，否则清空该字段
+func renderEntries(c *app.RequestContext, entries []internal.ContentEntry) error {
+	for i := range entries {
+		entries[i].ContentHTML = ""
+	}
+	if c.Query("render") != "html" {
+		return nil
+	}
+	return internal.RenderEntryContent(entries)
+}
+
+// renderEntry 是 renderEntries 的单条目版本
+func renderEntry(c *app.RequestContext, ce *internal.ContentEntry) error {
+	entries := []internal.ContentEntry{*ce}
+	if err := renderEntries(c, entries); err != nil {
+		return err
+	}
+	ce.ContentHTML = entries[0].ContentHTML
+	return nil
+}
+
+// respondAssigneeError 将负责人校验错误映射为 400，其余为 500
+func respondAssigneeError(c *app.RequestContext, err error) {
+	if errors.Is(err, internal.ErrInvalidAssignee) {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(500, internal.NewErrorResponse(err.Error()))
+}
+
 // CreateContentEntry @Summary Create content entry
 // @Description Create a new content entry. The creator_id will be automatically set to the current user.
 // @Tags content
 // @Accept json
 // @Produce json
+// @Param list_id query int false "Append the new entry to this list, subject to the list policy"
+// @Param force query bool false "Admins only: add the entry even if it violates the list policy"
 // @Param contentEntry body internal.ContentEntry true "Content Entry (creator_id will be set automatically)"
 // @Success 201 {object} internal.ContentEntry
 // @Failure 400 {object} internal.ErrorResponse
 // @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
 // @Failure 500 {object} internal.ErrorResponse
 // @Router /api/content_entries [post]
 func CreateContentEntry(ctx context.Context, c *app.RequestContext) {
@@ -274,6 +574,40 @@ func CreateContentEntry(ctx context.Context, c *app.RequestContext) {
 	}
 
 	ce.CreatorID = user.ID
+	if err := internal.ValidateAssignees(db, ce.ProjectID, ce.Assignees); err != nil {
+		hlog.Errorf("CreateContentEntry: ValidateAssignees failed, error=%v", err)
+		respondAssigneeError(c, err)
+		return
+	}
+
+	// 指定 list_id 时先检查列表策略，通过后再创建，避免留下孤立条目
+	var list *internal.ContentList
+	if listIDStr := c.Query("list_id"); listIDStr != "" {
+		listID, err := strconv.ParseInt(listIDStr, 10, 64)
+		if err != nil {
+			c.JSON(400, internal.NewErrorResponse("invalid list_id"))
+			return
+		}
+		canWrite, err := internal.HasPermission(db, user.ID, "content_list", listID, "write")
+		if err != nil {
+			c.JSON(500, internal.NewErrorResponse(err.Error()))
+			return
+		}
+		if !canWrite {
+			c.JSON(403, internal.NewErrorResponse("forbidden"))
+			return
+		}
+		list, err = internal.GetContentList(db, listID)
+		if err != nil {
+			c.JSON(404, internal.NewErrorResponse(err.Error()))
+			return
+		}
+		policyErr := internal.CheckListPolicy(db, list, []internal.ContentEntry{ce}, len(list.Items), len(list.Items)+1, user.ID)
+		if !enforceListPolicy(c, user.ID, list, policyErr, "CreateContentEntry") {
+			return
+		}
+	}
+
 	id, err := internal.CreateContentEntry(db, &ce)
 	if err != nil {
 		hlog.Errorf("CreateContentEntry: CreateContentEntry failed, error=%v", err)
@@ -282,12 +616,23 @@ func CreateContentEntry(ctx context.Context, c *app.RequestContext) {
 	}
 	ce.ID = id
 
+	if list != nil {
+		list.Items = append(list.Items, ce.ID)
+		list.UpdatedBy = ce.CreatorID
+		if err := internal.UpdateContentList(db, list.ID, list); err != nil {
+			hlog.Errorf("CreateContentEntry: UpdateContentList failed, listID=%d, error=%v", list.ID, err)
+			c.JSON(500, internal.NewErrorResponse(err.Error()))
+			return
+		}
+	}
+
 	// Give admin permission to creator
 	dp := internal.DetailPermission{
 		UserID:      ce.CreatorID,
 		ContentType: "content_entry",
 		ContentIDs:  []int64{ce.ID},
 		Action:      "admin",
+		Timestamps:  internal.Timestamps{UpdatedBy: ce.CreatorID},
 	}
 	_, err = internal.CreateDetailPermission(db, &dp)
 	if err != nil {
@@ -302,6 +647,7 @@ func CreateContentEntry(ctx context.Context, c *app.RequestContext) {
 		ContentType: "content_entry",
 		ContentIDs:  []int64{ce.ID},
 		Action:      "read",
+		Timestamps:  internal.Timestamps{UpdatedBy: ce.CreatorID},
 	}
 	_, err = internal.CreateDetailPermission(db, &dpRead)
 	if err != nil {
@@ -311,6 +657,7 @@ func CreateContentEntry(ctx context.Context, c *app.RequestContext) {
 	}
 
 	hlog.Debugf("CreateContentEntry: successfully created content entry ID=%d", ce.ID)
+	emitWebhook(ce.ProjectID, internal.WebhookEntryCreated, ce.CreatorID, ce)
 	c.JSON(201, ce)
 }
 
@@ -320,11 +667,13 @@ func CreateContentEntry(ctx context.Context, c *app.RequestContext) {
 // @Accept json
 // @Produce json
 // @Param id path int true "Content Entry ID"
+// @Param render query string false "Set to html to include sanitized content_html rendered from the markdown content"
 // @Success 200 {object} internal.ContentEntry
 // @Failure 400 {object} internal.ErrorResponse
 // @Failure 401 {object} internal.ErrorResponse
 // @Failure 403 {object} internal.ErrorResponse
 // @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
 // @Security Session
 // @Router /api/content_entries/{id} [get]
 func GetContentEntry(ctx context.Context, c *app.RequestContext) {
@@ -339,20 +688,26 @@ func GetContentEntry(ctx context.Context, c *app.RequestContext) {
 		c.JSON(404, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	if err := renderEntry(c, ce); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
 	c.JSON(200, ce)
 }
 
 // UpdateContentEntry @Summary Update content entry
-// @Description Update an existing content entry
+// @Description Update an existing content entry. Fields omitted from the body keep their current values; project_id, creator_id, the archive state and the timestamps cannot be changed here. Assignees added by the update must be able to read the project.
 // @Tags content
 // @Accept json
 // @Produce json
 // @Param id path int true "Content Entry ID"
-// @Param contentEntry body internal.ContentEntry true "Content Entry"
+// @Param render query string false "Set to html to include sanitized content_html in the response"
+// @Param contentEntry body internal.ContentEntryUpdate true "Fields to change"
 // @Success 200 {object} internal.ContentEntry
 // @Failure 400 {object} internal.ErrorResponse
 // @Failure 401 {object} internal.ErrorResponse
 // @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
 // @Failure 500 {object} internal.ErrorResponse
 // @Security Session
 // @Router /api/content_entries/{id} [put]
@@ -363,16 +718,37 @@ func UpdateContentEntry(ctx context.Context, c *app.RequestContext) {
 		c.JSON(400, internal.NewErrorResponse("invalid id"))
 		return
 	}
-	var ce internal.ContentEntry
-	if err := c.BindJSON(&ce); err != nil {
+	existing, err := internal.GetContentEntry(db, id)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	var req internal.ContentEntryUpdate
+	if err := c.BindJSON(&req); err != nil {
 		c.JSON(400, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	// 只写入请求中给出的可编辑字段，项目、创建者、归档状态等由服务端维护的字段保持原值
+	ce := *existing
+	req.Apply(&ce)
+	ce.UpdatedBy = actorID(c)
+	if err := internal.ValidateAssignees(db, ce.ProjectID, internal.AddedAssignees(existing.Assignees, ce.Assignees)); err != nil {
+		respondAssigneeError(c, err)
+		return
+	}
 	err = internal.UpdateContentEntry(db, id, &ce)
 	if err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	if actor := auth.GetUserFromSession(c); actor != nil {
+		notifyEntryChanged(actor, &ce, "updated")
+	}
+	emitWebhook(ce.ProjectID, internal.WebhookEntryUpdated, ce.UpdatedBy, ce)
+	if err := renderEntry(c, &ce); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
 	c.JSON(200, ce)
 }
 
@@ -396,10 +772,21 @@ func DeleteContentEntry(ctx context.Context, c *app.RequestContext) {
 		c.JSON(400, internal.NewErrorResponse("invalid id"))
 		return
 	}
+	existing, err := internal.GetContentEntry(db, id)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	err = internal.DeleteAttachmentsByEntry(ctx, db, blobStore, id)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
 	err = internal.DeleteContentEntry(db, id)
 	if err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	emitWebhook(existing.ProjectID, internal.WebhookEntryDeleted, actorID(c), existing)
 	c.JSON(200, internal.NewSuccessResponse("deleted"))
 }
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"liteboard/auth"
+	"liteboard/internal"
+	"strconv"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func RegisterCustomFieldRoutes(r *route.RouterGroup) {
+	// Project field definitions
+	r.GET("/projects/:id/custom_fields", auth.PermissionCheckMiddleware("project", "read", GetIDFromParam), GetProjectCustomFields)
+	r.POST("/projects/:id/custom_fields", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), CreateCustomField)
+	r.PUT("/projects/:id/custom_fields/:fieldId", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), UpdateCustomField)
+	r.DELETE("/projects/:id/custom_fields/:fieldId", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), DeleteCustomField)
+
+	// Per-entry values
+	r.PUT("/content_entries/:id/custom_fields", auth.PermissionCheckMiddleware("content_entry", "write", GetIDFromParam), SetEntryCustomFields)
+}
+
+// getCustomFieldInProject 读取路径中的字段定义，并确认其属于指定项目
+func getCustomFieldInProject(c *app.RequestContext, projectID int64) (*internal.CustomField, bool) {
+	fieldID, err := strconv.ParseInt(c.Param("fieldId"), 10, 64)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid field id"))
+		return nil, false
+	}
+	f, err := internal.GetCustomField(db, fieldID)
+	if err != nil || f.ProjectID != projectID {
+		c.JSON(404, internal.NewErrorResponse("custom field not found"))
+		return nil, false
+	}
+	return f, true
+}
+
+// respondCustomFieldError 将字段校验错误映射为 400，其余为 500
+func respondCustomFieldError(c *app.RequestContext, err error) {
+	if errors.Is(err, internal.ErrInvalidCustomField) {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(500, internal.NewErrorResponse(err.Error()))
+}
+
+// GetProjectCustomFields @Summary Get project custom fields
+// @Description Get the custom field definitions of a project
+// @Tags custom_fields
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {array} internal.CustomField
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/custom_fields [get]
+func GetProjectCustomFields(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	fields, err := internal.GetCustomFieldsByProject(db, projectID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, fields)
+}
+
+// CreateCustomField @Summary Create custom field
+// @Description Define a custom field on a project. type is one of text, number, date, single_select, multi_select, user.
+// @Tags custom_fields
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param field body internal.CustomField true "Custom Field"
+// @Success 201 {object} internal.CustomField
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/custom_fields [post]
+func CreateCustomField(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	var f internal.CustomField
+	if err := c.BindJSON(&f); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	f.ProjectID = projectID
+	if err := internal.ValidateCustomField(&f); err != nil {
+		respondCustomFieldError(c, err)
+		return
+	}
+	id, err := internal.CreateCustomField(db, &f)
+	if err != nil {
+		hlog.Errorf("CreateCustomField: CreateCustomField failed, projectID=%d, error=%v", projectID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	f.ID = id
+	c.JSON(201, f)
+}
+
+// UpdateCustomField @Summary Update custom field
+// @Description Rename, reorder or change the options of a custom field. The type cannot change; values of removed options are deleted.
+// @Tags custom_fields
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param fieldId path int true "Custom Field ID"
+// @Param field body internal.CustomField true "Custom Field"
+// @Success 200 {object} internal.CustomField
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/custom_fields/{fieldId} [put]
+func UpdateCustomField(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	existing, ok := getCustomFieldInProject(c, projectID)
+	if !ok {
+		return
+	}
+	var f internal.CustomField
+	if err := c.BindJSON(&f); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if f.Type != "" && f.Type != existing.Type {
+		c.JSON(400, internal.NewErrorResponse("custom field type cannot be changed"))
+		return
+	}
+	f.ID = existing.ID
+	f.ProjectID = projectID
+	f.Type = existing.Type
+	if err := internal.ValidateCustomField(&f); err != nil {
+		respondCustomFieldError(c, err)
+		return
+	}
+	if err := internal.UpdateCustomField(db, f.ID, &f); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, f)
+}
+
+// DeleteCustomField @Summary Delete custom field
+// @Description Delete a custom field definition and all of its values
+// @Tags custom_fields
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param fieldId path int true "Custom Field ID"
+// @Success 200 {object} internal.SuccessResponse
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/custom_fields/{fieldId} [delete]
+func DeleteCustomField(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	f, ok := getCustomFieldInProject(c, projectID)
+	if !ok {
+		return
+	}
+	if err := internal.DeleteCustomField(db, f.ID); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, internal.NewSuccessResponse("deleted"))
+}
+
+// SetEntryCustomFields @Summary Set entry custom field values
+// @Description Set custom field values on an entry. A null value clears the field; fields not listed are left unchanged.
+// @Tags custom_fields
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Param values body []internal.CustomFieldValue true "Custom field values"
+// @Success 200 {object} internal.ContentEntry
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/custom_fields [put]
+func SetEntryCustomFields(ctx context.Context, c *app.RequestContext) {
+	entryID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	ce, err := internal.GetContentEntry(db, entryID)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	// 使用 encoding/json 解码，保证数字统一为 float64 以便按字段类型校验
+	var values []internal.CustomFieldValue
+	if err := json.Unmarshal(c.Request.Body(), &values); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+
+	// 先全部校验，避免部分写入
+	type pending struct {
+		field *internal.CustomField
+		value interface{}
+	}
+	updates := make([]pending, 0, len(values))
+	for _, v := range values {
+		f, err := internal.GetCustomField(db, v.FieldID)
+		if err != nil || f.ProjectID != ce.ProjectID {
+			c.JSON(400, internal.NewErrorResponse("custom field "+strconv.FormatInt(v.FieldID, 10)+" does not belong to the entry's project"))
+			return
+		}
+		normalized, err := internal.NormalizeCustomFieldValue(db, f, v.Value)
+		if err != nil {
+			respondCustomFieldError(c, err)
+			return
+		}
+		updates = append(updates, pending{field: f, value: normalized})
+	}
+	for _, u := range updates {
+		if err := internal.SetCustomFieldValue(db, ce.ID, u.field, u.value, actorID(c)); err != nil {
+			respondCustomFieldError(c, err)
+			return
+		}
+	}
+
+	ce, err = internal.GetContentEntry(db, entryID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, ce)
+}
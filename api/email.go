@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"liteboard/auth"
+	"liteboard/internal"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+var (
+	// mailer 为 nil 表示未配置 SMTP，不排队任何邮件
+	mailer      internal.Mailer
+	mailBaseURL string
+)
+
+// SetMailer 设置发送邮件的 Mailer 以及邮件中链接的前缀
+func SetMailer(m internal.Mailer, baseURL string) {
+	mailer = m
+	mailBaseURL = baseURL
+}
+
+// StartMailWorker 在后台定期生成摘要并发送待发邮件
+func StartMailWorker(interval time.Duration) {
+	if mailer == nil {
+		return
+	}
+	go internal.RunMailWorker(context.Background(), db, mailer, mailBaseURL, interval)
+}
+
+func RegisterEmailRoutes(r *route.RouterGroup) {
+	r.GET("/notifications/email", GetEmailPreferences)
+	r.PUT("/notifications/email", UpdateEmailPreferences)
+}
+
+// RegisterUnsubscribeRoutes 注册邮件中的退订链接，无需登录
+func RegisterUnsubscribeRoutes(r *route.RouterGroup) {
+	r.GET("/unsubscribe", UnsubscribeEmail)
+	r.POST("/unsubscribe", UnsubscribeEmail)
+}
+
+// GetEmailPreferences @Summary Get email preferences
+// @Description Return which notification types are emailed immediately, the digest frequency and the email language of the current user
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Success 200 {object} internal.EmailPreferences
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/notifications/email [get]
+func GetEmailPreferences(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	prefs, err := internal.GetEmailPreferences(db, user.ID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, prefs)
+}
+
+// UpdateEmailPreferences @Summary Update email preferences
+// @Description Choose the notification types emailed immediately, the digest frequency (off, daily or weekly) and the email language (en or zh). Emails go to the address of the user's account.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param preferences body internal.EmailPreferences true "Email preferences"
+// @Success 200 {object} internal.EmailPreferences
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/notifications/email [put]
+func UpdateEmailPreferences(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	var prefs internal.EmailPreferences
+	if err := c.BindJSON(&prefs); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if err := internal.SetEmailPreferences(db, user.ID, &prefs); err != nil {
+		if errors.Is(err, internal.ErrInvalidEmailPreferences) {
+			c.JSON(400, internal.NewErrorResponse(err.Error()))
+			return
+		}
+		hlog.Errorf("UpdateEmailPreferences: SetEmailPreferences failed, userID=%d, error=%v", user.ID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, prefs)
+}
+
+// UnsubscribeEmail @Summary Unsubscribe from emails
+// @Description Turn off all emails for the user owning the unsubscribe token. This is the link included in every email and needs no login.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param token query string true "Unsubscribe token"
+// @Success 200 {object} internal.SuccessResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Router /unsubscribe [get]
+func UnsubscribeEmail(ctx context.Context, c *app.RequestContext) {
+	if err := internal.Unsubscribe(db, c.Query("token")); err != nil {
+		if errors.Is(err, internal.ErrUnknownUnsubscribeToken) {
+			c.JSON(404, internal.NewErrorResponse(err.Error()))
+			return
+		}
+		hlog.Errorf("UnsubscribeEmail: Unsubscribe failed, error=%v", err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, internal.NewSuccessResponse("unsubscribed from all emails"))
+}
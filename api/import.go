@@ -0,0 +1,267 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"liteboard/auth"
+	"liteboard/internal"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func RegisterImportRoutes(r *route.RouterGroup) {
+	r.POST("/import/trello", ImportTrelloBoard)
+	r.GET("/projects/:id/export.csv", auth.PermissionCheckMiddleware("project", "read", GetIDFromParam), ExportProjectCSV)
+	r.POST("/projects/:id/import.csv", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), ImportProjectCSV)
+	r.GET("/projects/:id/export", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), ExportProjectArchive)
+	r.POST("/projects/import", ImportProjectArchive)
+}
+
+// readUpload 读取上传的文件：multipart 表单的 file 字段，或直接作为请求体
+func readUpload(c *app.RequestContext) ([]byte, error) {
+	if !strings.HasPrefix(string(c.ContentType()), "multipart/form-data") {
+		return c.Request.Body(), nil
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// ImportTrelloBoard @Summary Import Trello board
+// @Description Create a project owned by the caller from a Trello board JSON export (Menu → Print, export and share → Export as JSON). Lists and cards keep their order, descriptions, start and due dates, labels and archived state; checklists become markdown task lists and attachments become links in the entry content. Comments, members and custom fields are listed in skipped. The import either completes or leaves nothing behind.
+// @Tags import
+// @Accept json
+// @Produce json
+// @Param board body object true "Trello board export"
+// @Success 201 {object} internal.ImportReport
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/import/trello [post]
+func ImportTrelloBoard(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	report, err := internal.ImportTrelloBoard(db, c.Request.Body(), user.ID)
+	if err != nil {
+		if errors.Is(err, internal.ErrInvalidImport) {
+			c.JSON(400, internal.NewErrorResponse(err.Error()))
+			return
+		}
+		hlog.Errorf("ImportTrelloBoard: ImportTrelloBoard failed, userID=%d, error=%v", user.ID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	hlog.Infof("User %d imported Trello board into project %d: %d lists, %d entries, %d skipped",
+		user.ID, report.Project.ID, report.Lists, report.Entries, len(report.Skipped))
+	c.JSON(201, report)
+}
+
+// ExportProjectCSV @Summary Export entries as CSV
+// @Description One row per entry with the columns id, list, title, content, type, creator, created_at and updated_at, list by list in board order. Archived lists and entries are left out. Timestamps are RFC 3339 in UTC.
+// @Tags import
+// @Produce text/csv
+// @Param id path int true "Project ID"
+// @Success 200 {string} string "CSV file"
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/export.csv [get]
+func ExportProjectCSV(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	p, err := internal.GetProject(db, projectID)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	var buf bytes.Buffer
+	if err := internal.WriteProjectCSV(db, projectID, &buf); err != nil {
+		hlog.Errorf("ExportProjectCSV: WriteProjectCSV failed, projectID=%d, error=%v", projectID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": p.Name + ".csv"}))
+	c.Data(200, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// ImportProjectCSV @Summary Import entries from CSV
+// @Description Create an entry for each row of a CSV file, sent as the request body or as the file field of a multipart form. The first row names the columns; map_list, map_title, map_content and map_type pick the column for each field and default to the column of the same name, so an export can be imported again. Lists are found by name and created when missing. Rows without a title or list, or rejected by a list policy, are reported in rows and skipped. With dry_run=true nothing is written and the response previews the result.
+// @Tags import
+// @Accept text/csv
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param dry_run query bool false "Only validate and preview"
+// @Param default_list query string false "List for rows without a list name"
+// @Param map_list query string false "Column holding the list name"
+// @Param map_title query string false "Column holding the title"
+// @Param map_content query string false "Column holding the content"
+// @Param map_type query string false "Column holding the entry type"
+// @Success 200 {object} internal.CSVImportResult "Dry run"
+// @Success 201 {object} internal.CSVImportResult
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/import.csv [post]
+func ImportProjectCSV(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	userID := actorID(c)
+	data, err := readUpload(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("missing file: "+err.Error()))
+		return
+	}
+	opts := internal.CSVImportOptions{
+		Mapping:     map[string]string{},
+		DefaultList: c.Query("default_list"),
+	}
+	opts.DryRun, _ = strconv.ParseBool(c.Query("dry_run"))
+	for _, field := range []string{"list", "title", "content", "type"} {
+		if column := c.Query("map_" + field); column != "" {
+			opts.Mapping[field] = column
+		}
+	}
+	result, err := internal.ImportProjectCSV(db, projectID, userID, data, opts)
+	if err != nil {
+		if errors.Is(err, internal.ErrInvalidImport) {
+			c.JSON(400, internal.NewErrorResponse(err.Error()))
+			return
+		}
+		hlog.Errorf("ImportProjectCSV: ImportProjectCSV failed, projectID=%d, error=%v", projectID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if opts.DryRun {
+		c.JSON(200, result)
+		return
+	}
+	for _, row := range result.Rows {
+		if row.EntryID != 0 {
+			if ce, err := internal.GetContentEntry(db, row.EntryID); err == nil {
+				emitWebhook(projectID, internal.WebhookEntryCreated, userID, ce)
+			}
+		}
+	}
+	c.JSON(201, result)
+}
+
+// ExportProjectArchive @Summary Export project archive
+// @Description Download a versioned archive of the project for backup or to move it to another Liteboard instance: a zip holding project.json (the project, lists, entries, labels, custom fields, comments, relations, pages, permissions and share links, with users identified by email and OpenID) and the attachment files. With format=json only project.json is returned, without attachment files. Contains share link tokens, so it requires project admin.
+// @Tags import
+// @Produce application/zip
+// @Param id path int true "Project ID"
+// @Param format query string false "zip (default) or json"
+// @Success 200 {file} file "Project archive"
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/export [get]
+func ExportProjectArchive(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	format := c.Query("format")
+	if format == "" {
+		format = "zip"
+	}
+	if format != "zip" && format != "json" {
+		c.JSON(400, internal.NewErrorResponse("format must be zip or json"))
+		return
+	}
+	if _, err := internal.GetProject(db, projectID); err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	archive, err := internal.BuildProjectArchive(db, projectID)
+	if err != nil {
+		hlog.Errorf("ExportProjectArchive: BuildProjectArchive failed, projectID=%d, error=%v", projectID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	filename := archive.Project.Name + "-" + time.Unix(archive.ExportedAt, 0).UTC().Format("20060102") + "." + format
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	if format == "json" {
+		c.JSON(200, archive)
+		return
+	}
+	var buf bytes.Buffer
+	if err := internal.WriteProjectArchive(ctx, blobStore, archive, &buf); err != nil {
+		hlog.Errorf("ExportProjectArchive: WriteProjectArchive failed, projectID=%d, error=%v", projectID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.Data(200, "application/zip", buf.Bytes())
+}
+
+// ImportProjectArchive @Summary Import project archive
+// @Description Create a new project owned by the caller from an archive made by the export endpoint, as the request body or the file field of a multipart form. All IDs are remapped, including list items. Users are matched by OpenID, then email; unmatched users are listed in unmatched_users, lose their permissions and assignments, and what they created is attributed to the caller. Attachments are typed by their content and skipped when they exceed the upload size or type limits. The import either completes or leaves nothing behind.
+// @Tags import
+// @Accept application/zip
+// @Produce json
+// @Param archive body string true "Project archive (zip or JSON)"
+// @Success 201 {object} internal.ImportReport
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/import [post]
+func ImportProjectArchive(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	data, err := readUpload(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("missing file: "+err.Error()))
+		return
+	}
+	report, err := internal.ImportProjectArchive(ctx, db, blobStore, attachmentLimits, data, user.ID)
+	if err != nil {
+		if errors.Is(err, internal.ErrInvalidImport) {
+			c.JSON(400, internal.NewErrorResponse(err.Error()))
+			return
+		}
+		hlog.Errorf("ImportProjectArchive: ImportProjectArchive failed, userID=%d, error=%v", user.ID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	hlog.Infof("User %d imported project archive into project %d: %d lists, %d entries, %d unmatched users",
+		user.ID, report.Project.ID, report.Lists, report.Entries, len(report.UnmatchedUsers))
+	c.JSON(201, report)
+}
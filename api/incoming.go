@@ -0,0 +1,293 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"liteboard/auth"
+	"liteboard/internal"
+	"strconv"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func RegisterIncomingWebhookRoutes(r *route.RouterGroup) {
+	r.GET("/projects/:id/incoming_webhooks", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), GetProjectIncomingWebhooks)
+	r.POST("/projects/:id/incoming_webhooks", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), CreateIncomingWebhook)
+	r.PUT("/projects/:id/incoming_webhooks/:hookId", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), UpdateIncomingWebhook)
+	r.DELETE("/projects/:id/incoming_webhooks/:hookId", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), DeleteIncomingWebhook)
+	r.POST("/projects/:id/incoming_webhooks/:hookId/rotate_token", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), RotateIncomingWebhookToken)
+}
+
+// RegisterIncomingHookRoutes 注册外部系统推送的入口，凭 URL 中的令牌鉴权，不需要登录
+func RegisterIncomingHookRoutes(r *route.RouterGroup) {
+	r.POST("/hooks/:token", ReceiveIncomingWebhook)
+}
+
+// IncomingWebhookRequest is the body of incoming webhook create and update requests. On update,
+// fields left out keep their value.
+type IncomingWebhookRequest struct {
+	Name            *string `json:"name"`
+	ListID          *int64  `json:"list_id"`
+	EntryType       *string `json:"entry_type"`
+	TitleTemplate   *string `json:"title_template"`
+	ContentTemplate *string `json:"content_template"`
+	KeyTemplate     *string `json:"key_template"`
+	Active          *bool   `json:"active"`
+}
+
+// apply 将请求中给出的字段写入 w
+func (req *IncomingWebhookRequest) apply(w *internal.IncomingWebhook) {
+	if req.Name != nil {
+		w.Name = *req.Name
+	}
+	if req.ListID != nil {
+		w.ListID = *req.ListID
+	}
+	if req.EntryType != nil {
+		w.EntryType = *req.EntryType
+	}
+	if req.TitleTemplate != nil {
+		w.TitleTemplate = *req.TitleTemplate
+	}
+	if req.ContentTemplate != nil {
+		w.ContentTemplate = *req.ContentTemplate
+	}
+	if req.KeyTemplate != nil {
+		w.KeyTemplate = *req.KeyTemplate
+	}
+	if req.Active != nil {
+		w.Active = *req.Active
+	}
+}
+
+// getIncomingWebhookInProject 读取路径中的 incoming webhook，并确认其属于指定项目
+func getIncomingWebhookInProject(c *app.RequestContext, projectID int64) (*internal.IncomingWebhook, bool) {
+	hookID, err := strconv.ParseInt(c.Param("hookId"), 10, 64)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid incoming webhook id"))
+		return nil, false
+	}
+	w, err := internal.GetIncomingWebhook(db, hookID)
+	if err != nil || w.ProjectID != projectID {
+		c.JSON(404, internal.NewErrorResponse("incoming webhook not found"))
+		return nil, false
+	}
+	return w, true
+}
+
+// respondIncomingWebhookError 将 incoming webhook 相关错误映射为 HTTP 状态码
+func respondIncomingWebhookError(c *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, internal.ErrInvalidIncomingWebhook), errors.Is(err, internal.ErrInvalidIncomingPayload):
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+	case errors.Is(err, internal.ErrIncomingWebhookForbidden):
+		c.JSON(403, internal.NewErrorResponse(err.Error()))
+	case errors.Is(err, internal.ErrIncomingWebhookNotFound):
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+	case errors.Is(err, internal.ErrListPolicy):
+		c.JSON(409, internal.NewErrorResponse(err.Error()))
+	default:
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+	}
+}
+
+// GetProjectIncomingWebhooks @Summary Get incoming webhooks
+// @Description List the incoming webhooks of a project. Tokens are not returned.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {array} internal.IncomingWebhook
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/incoming_webhooks [get]
+func GetProjectIncomingWebhooks(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	webhooks, err := internal.GetIncomingWebhooks(db, projectID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, webhooks)
+}
+
+// CreateIncomingWebhook @Summary Create incoming webhook
+// @Description Create an endpoint at /hooks/{token} that turns posted JSON objects into entries of a list. The templates use Go text/template syntax over the payload fields, e.g. {{.alert.name}}; title_template defaults to {{.title}}. When key_template renders a non-empty key, later payloads with the same key update the same entry instead of creating a new one. The token is only returned in this response.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param webhook body IncomingWebhookRequest true "Incoming webhook"
+// @Success 201 {object} internal.IncomingWebhook
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/incoming_webhooks [post]
+func CreateIncomingWebhook(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	var req IncomingWebhookRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	w := internal.IncomingWebhook{ProjectID: projectID, Active: true, CreatorID: actorID(c)}
+	req.apply(&w)
+	if _, err := internal.CreateIncomingWebhook(db, &w); err != nil {
+		respondIncomingWebhookError(c, err)
+		return
+	}
+	c.JSON(201, w)
+}
+
+// UpdateIncomingWebhook @Summary Update incoming webhook
+// @Description Change the name, mapping or active flag of an incoming webhook. The token is unchanged.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param hookId path int true "Incoming webhook ID"
+// @Param webhook body IncomingWebhookRequest true "Fields to change"
+// @Success 200 {object} internal.IncomingWebhook
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/incoming_webhooks/{hookId} [put]
+func UpdateIncomingWebhook(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	w, ok := getIncomingWebhookInProject(c, projectID)
+	if !ok {
+		return
+	}
+	var req IncomingWebhookRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	req.apply(w)
+	if err := internal.UpdateIncomingWebhook(db, w.ID, w); err != nil {
+		respondIncomingWebhookError(c, err)
+		return
+	}
+	c.JSON(200, w)
+}
+
+// DeleteIncomingWebhook @Summary Delete incoming webhook
+// @Description Delete an incoming webhook. Entries it created are kept.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param hookId path int true "Incoming webhook ID"
+// @Success 200 {object} internal.SuccessResponse
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/incoming_webhooks/{hookId} [delete]
+func DeleteIncomingWebhook(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	w, ok := getIncomingWebhookInProject(c, projectID)
+	if !ok {
+		return
+	}
+	if err := internal.DeleteIncomingWebhook(db, w.ID); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, internal.NewSuccessResponse("incoming webhook deleted"))
+}
+
+// RotateIncomingWebhookToken @Summary Rotate incoming webhook token
+// @Description Replace the token in the webhook URL. The old URL stops working immediately.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param hookId path int true "Incoming webhook ID"
+// @Success 200 {object} internal.IncomingWebhook
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/incoming_webhooks/{hookId}/rotate_token [post]
+func RotateIncomingWebhookToken(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	w, ok := getIncomingWebhookInProject(c, projectID)
+	if !ok {
+		return
+	}
+	token, err := internal.RotateIncomingWebhookToken(db, w.ID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	w.Token = token
+	c.JSON(200, w)
+}
+
+// ReceiveIncomingWebhook @Summary Receive incoming webhook
+// @Description Endpoint for external systems. The body must be a JSON object; it is mapped onto an entry by the webhook's templates. Returns 201 when an entry was created and 200 when an entry with the same key was updated. Entries with the same key that were archived or moved to another project are not updated; a new entry is created instead. Returns 403 once the webhook's creator can no longer write to the project.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param token path string true "Incoming webhook token"
+// @Param payload body object true "Any JSON object"
+// @Success 200 {object} internal.ContentEntry
+// @Success 201 {object} internal.ContentEntry
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Router /hooks/{token} [post]
+func ReceiveIncomingWebhook(ctx context.Context, c *app.RequestContext) {
+	ce, created, err := internal.ReceiveIncomingWebhook(db, c.Param("token"), c.Request.Body())
+	if err != nil {
+		if !errors.Is(err, internal.ErrIncomingWebhookNotFound) && !errors.Is(err, internal.ErrInvalidIncomingPayload) && !errors.Is(err, internal.ErrIncomingWebhookForbidden) {
+			hlog.Errorf("ReceiveIncomingWebhook: ReceiveIncomingWebhook failed, error=%v", err)
+		}
+		respondIncomingWebhookError(c, err)
+		return
+	}
+	if created {
+		emitWebhook(ce.ProjectID, internal.WebhookEntryCreated, ce.CreatorID, ce)
+		c.JSON(201, ce)
+		return
+	}
+	emitWebhook(ce.ProjectID, internal.WebhookEntryUpdated, ce.UpdatedBy, ce)
+	c.JSON(200, ce)
+}
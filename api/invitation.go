@@ -0,0 +1,282 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"liteboard/auth"
+	"liteboard/internal"
+	"net/url"
+	"strconv"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/hertz-contrib/sessions"
+)
+
+func RegisterInvitationRoutes(r *route.RouterGroup) {
+	r.GET("/projects/:id/invitations", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), GetProjectInvitations)
+	r.POST("/projects/:id/invitations", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), CreateInvitation)
+	r.POST("/projects/:id/invitations/:invitationId/resend", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), ResendInvitation)
+	r.DELETE("/projects/:id/invitations/:invitationId", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), RevokeInvitation)
+}
+
+// RegisterInviteLinkRoutes 注册邀请邮件中的接受链接，未登录时先跳转登录
+func RegisterInviteLinkRoutes(r *route.RouterGroup) {
+	r.GET("/invite", AcceptInvitationLink)
+}
+
+// getInvitationInProject 读取路径中的邀请，并确认其属于指定项目
+func getInvitationInProject(c *app.RequestContext, projectID int64) (*internal.Invitation, bool) {
+	invitationID, err := strconv.ParseInt(c.Param("invitationId"), 10, 64)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid invitation id"))
+		return nil, false
+	}
+	inv, err := internal.GetInvitation(db, invitationID)
+	if err != nil || inv.ProjectID != projectID {
+		c.JSON(404, internal.NewErrorResponse("invitation not found"))
+		return nil, false
+	}
+	return inv, true
+}
+
+// respondInvitationError 将邀请相关错误映射为 HTTP 状态码
+func respondInvitationError(c *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, internal.ErrInvalidInvitation):
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+	case errors.Is(err, internal.ErrInvitationNotFound):
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+	case errors.Is(err, internal.ErrInvitationExists), errors.Is(err, internal.ErrInvitationClosed):
+		c.JSON(409, internal.NewErrorResponse(err.Error()))
+	default:
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+	}
+}
+
+// sendInvitation 以邀请人的邮件语言排队邀请邮件；未配置 SMTP 时不发送，被邀请人仍可凭邮箱登录后自动加入
+func sendInvitation(inv *internal.Invitation, token string, inviter *auth.User) {
+	if mailer == nil {
+		hlog.Debugf("sendInvitation: no mailer configured, invitation %d not emailed", inv.ID)
+		return
+	}
+	locale := internal.DefaultMailLocale
+	if prefs, err := internal.GetEmailPreferences(db, inviter.ID); err == nil {
+		locale = prefs.Locale
+	}
+	m, err := internal.InvitationMail(inv, token, mailBaseURL, locale, inviter.Username, projectName(inv.ProjectID))
+	if err == nil {
+		err = internal.QueueEmail(db, m)
+	}
+	if err != nil {
+		hlog.Errorf("sendInvitation: queue email failed, invitationID=%d, error=%v", inv.ID, err)
+	}
+}
+
+// AcceptInvitationsOnLogin 在用户登录时接受发往其已验证邮箱的邀请，并通知邀请人
+func AcceptInvitationsOnLogin(user *auth.User, verifiedEmails []string) {
+	accepted, err := internal.AcceptInvitationsForEmails(db, user.ID, verifiedEmails)
+	if err != nil {
+		hlog.Errorf("AcceptInvitationsOnLogin: AcceptInvitationsForEmails failed, userID=%d, error=%v", user.ID, err)
+	}
+	for _, inv := range accepted {
+		hlog.Infof("User %d joined project %d via invitation %d", user.ID, inv.ProjectID, inv.ID)
+		notifyInvitationAccepted(user, &inv)
+	}
+}
+
+// notifyInvitationAccepted 通知邀请人有人接受了邀请，并发送权限变更事件
+func notifyInvitationAccepted(user *auth.User, inv *internal.Invitation) {
+	emitPermissionWebhook(inv.ProjectID, internal.WebhookPermissionGranted, user.ID, user.ID, inv.PermissionLevel)
+	notify(internal.Notification{
+		UserID:    inv.InviterID,
+		Type:      internal.NotificationProjectJoined,
+		ActorID:   user.ID,
+		ProjectID: inv.ProjectID,
+		Message:   user.Username + " accepted your invitation to " + projectName(inv.ProjectID),
+	})
+}
+
+// GetProjectInvitations @Summary Get project invitations
+// @Description List the email invitations of a project with their status (pending, accepted, revoked or expired)
+// @Tags share
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {array} internal.Invitation
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/invitations [get]
+func GetProjectInvitations(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	invitations, err := internal.GetInvitations(db, projectID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, invitations)
+}
+
+// CreateInvitation @Summary Invite by email
+// @Description Invite someone who may not have an account yet. A one-time accept link is emailed to the address, and the invitation is also accepted automatically when someone logs in with that address verified.
+// @Tags share
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param invitation body object{email=string,permission_level=string} true "Invitation"
+// @Success 201 {object} internal.Invitation
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/invitations [post]
+func CreateInvitation(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	var req struct {
+		Email           string `json:"email"`
+		PermissionLevel string `json:"permission_level"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	inv := &internal.Invitation{ProjectID: projectID, Email: req.Email, PermissionLevel: req.PermissionLevel, InviterID: user.ID}
+	token, err := internal.CreateInvitation(db, inv)
+	if err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+	sendInvitation(inv, token, user)
+	c.JSON(201, inv)
+}
+
+// ResendInvitation @Summary Resend invitation
+// @Description Email a new accept link for a pending or expired invitation and restart its expiry. Earlier links stop working.
+// @Tags share
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param invitationId path int true "Invitation ID"
+// @Success 200 {object} internal.Invitation
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/invitations/{invitationId}/resend [post]
+func ResendInvitation(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	inv, ok := getInvitationInProject(c, projectID)
+	if !ok {
+		return
+	}
+	inv, token, err := internal.RenewInvitation(db, inv.ID)
+	if err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+	sendInvitation(inv, token, user)
+	c.JSON(200, inv)
+}
+
+// RevokeInvitation @Summary Revoke invitation
+// @Description Withdraw an invitation that has not been accepted yet
+// @Tags share
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param invitationId path int true "Invitation ID"
+// @Success 200 {object} internal.SuccessResponse
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/invitations/{invitationId} [delete]
+func RevokeInvitation(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	inv, ok := getInvitationInProject(c, projectID)
+	if !ok {
+		return
+	}
+	if err := internal.RevokeInvitation(db, inv.ID); err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+	c.JSON(200, internal.NewSuccessResponse("invitation revoked"))
+}
+
+// AcceptInvitationLink @Summary Accept invitation
+// @Description Accept link from an invitation email. Logged-out visitors are sent to login first and brought back afterwards; on success the browser is redirected to the project board.
+// @Tags share
+// @Param token query string true "Invitation token"
+// @Success 302 {string} string "Redirect to the project board"
+// @Failure 404 {string} string "Unknown invitation"
+// @Failure 409 {string} string "Invitation already used, revoked or expired"
+// @Router /invite [get]
+func AcceptInvitationLink(ctx context.Context, c *app.RequestContext) {
+	token := c.Query("token")
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		sess := sessions.Default(c)
+		sess.Set(auth.ReturnToSessionKey, "/invite?token="+url.QueryEscape(token))
+		if err := sess.Save(); err != nil {
+			c.String(500, "Failed to save session")
+			return
+		}
+		c.Redirect(302, []byte("/auth/login"))
+		return
+	}
+	inv, err := internal.AcceptInvitation(db, token, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, internal.ErrInvitationNotFound):
+			c.String(404, "Invitation not found")
+		case errors.Is(err, internal.ErrInvitationClosed):
+			c.String(409, "This invitation has already been used, was revoked or has expired")
+		default:
+			hlog.Errorf("AcceptInvitationLink: AcceptInvitation failed, userID=%d, error=%v", user.ID, err)
+			c.String(500, "Failed to accept invitation")
+		}
+		return
+	}
+	hlog.Infof("User %d joined project %d via invitation %d", user.ID, inv.ProjectID, inv.ID)
+	notifyInvitationAccepted(user, inv)
+	c.Redirect(302, []byte("/board.html?project="+strconv.FormatInt(inv.ProjectID, 10)))
+}
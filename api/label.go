@@ -0,0 +1,332 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"liteboard/auth"
+	"liteboard/internal"
+	"strconv"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func RegisterLabelRoutes(r *route.RouterGroup) {
+	// Project label catalog
+	r.GET("/projects/:id/labels", auth.PermissionCheckMiddleware("project", "read", GetIDFromParam), GetProjectLabels)
+	r.POST("/projects/:id/labels", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), CreateLabel)
+	r.PUT("/projects/:id/labels/:labelId", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), UpdateLabel)
+	r.DELETE("/projects/:id/labels/:labelId", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), DeleteLabel)
+	r.POST("/projects/:id/labels/:labelId/merge", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), MergeLabel)
+
+	// Label assignment on entries
+	r.POST("/content_entries/:id/labels/:labelId", auth.PermissionCheckMiddleware("content_entry", "write", GetIDFromParam), AddEntryLabel)
+	r.DELETE("/content_entries/:id/labels/:labelId", auth.PermissionCheckMiddleware("content_entry", "write", GetIDFromParam), RemoveEntryLabel)
+}
+
+// getLabelInProject 读取路径中的标签，并确认其属于指定项目
+func getLabelInProject(c *app.RequestContext, projectID int64) (*internal.Label, bool) {
+	labelID, err := strconv.ParseInt(c.Param("labelId"), 10, 64)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid label id"))
+		return nil, false
+	}
+	l, err := internal.GetLabel(db, labelID)
+	if err != nil || l.ProjectID != projectID {
+		c.JSON(404, internal.NewErrorResponse("label not found"))
+		return nil, false
+	}
+	return l, true
+}
+
+// respondLabelError 将标签校验错误映射为 400/409，其余为 500
+func respondLabelError(c *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, internal.ErrInvalidLabel):
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+	case errors.Is(err, internal.ErrLabelExists):
+		c.JSON(409, internal.NewErrorResponse(err.Error()))
+	default:
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+	}
+}
+
+// GetProjectLabels @Summary Get project labels
+// @Description Get the label catalog of a project
+// @Tags labels
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {array} internal.Label
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/labels [get]
+func GetProjectLabels(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	labels, err := internal.GetLabelsByProject(db, projectID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, labels)
+}
+
+// CreateLabel @Summary Create label
+// @Description Add a label to the project catalog. Color defaults to #808080.
+// @Tags labels
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param label body internal.Label true "Label"
+// @Success 201 {object} internal.Label
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/labels [post]
+func CreateLabel(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	var l internal.Label
+	if err := c.BindJSON(&l); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	l.ProjectID = projectID
+	if err := internal.ValidateLabel(&l); err != nil {
+		respondLabelError(c, err)
+		return
+	}
+	if err := internal.CheckLabelNameAvailable(db, projectID, l.Name, 0); err != nil {
+		respondLabelError(c, err)
+		return
+	}
+	id, err := internal.CreateLabel(db, &l)
+	if err != nil {
+		hlog.Errorf("CreateLabel: CreateLabel failed, projectID=%d, error=%v", projectID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	l.ID = id
+	c.JSON(201, l)
+}
+
+// UpdateLabel @Summary Update label
+// @Description Rename or recolor a label. Entries keep the label.
+// @Tags labels
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param labelId path int true "Label ID"
+// @Param label body internal.Label true "Label"
+// @Success 200 {object} internal.Label
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/labels/{labelId} [put]
+func UpdateLabel(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	existing, ok := getLabelInProject(c, projectID)
+	if !ok {
+		return
+	}
+	var l internal.Label
+	if err := c.BindJSON(&l); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	l.ID = existing.ID
+	l.ProjectID = projectID
+	if err := internal.ValidateLabel(&l); err != nil {
+		respondLabelError(c, err)
+		return
+	}
+	if err := internal.CheckLabelNameAvailable(db, projectID, l.Name, l.ID); err != nil {
+		respondLabelError(c, err)
+		return
+	}
+	if err := internal.UpdateLabel(db, l.ID, &l); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, l)
+}
+
+// DeleteLabel @Summary Delete label
+// @Description Delete a label and remove it from all entries
+// @Tags labels
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param labelId path int true "Label ID"
+// @Success 200 {object} internal.SuccessResponse
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/labels/{labelId} [delete]
+func DeleteLabel(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	l, ok := getLabelInProject(c, projectID)
+	if !ok {
+		return
+	}
+	if err := internal.DeleteLabel(db, l.ID, actorID(c)); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, internal.NewSuccessResponse("deleted"))
+}
+
+// MergeLabel @Summary Merge labels
+// @Description Move every assignment of the label onto target_id and delete the label
+// @Tags labels
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param labelId path int true "Label ID to merge away"
+// @Param request body object{target_id=int} true "Merge target"
+// @Success 200 {object} internal.Label
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/labels/{labelId}/merge [post]
+func MergeLabel(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	source, ok := getLabelInProject(c, projectID)
+	if !ok {
+		return
+	}
+	var req struct {
+		TargetID int64 `json:"target_id"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	target, err := internal.GetLabel(db, req.TargetID)
+	if err != nil || target.ProjectID != projectID {
+		c.JSON(404, internal.NewErrorResponse("target label not found"))
+		return
+	}
+	if err := internal.MergeLabels(db, source.ID, target.ID, actorID(c)); err != nil {
+		respondLabelError(c, err)
+		return
+	}
+	hlog.Infof("Label %d merged into label %d in project %d", source.ID, target.ID, projectID)
+	c.JSON(200, target)
+}
+
+// AddEntryLabel @Summary Add label to entry
+// @Description Attach a label from the entry's project to the entry
+// @Tags labels
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Param labelId path int true "Label ID"
+// @Success 200 {object} internal.ContentEntry
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/labels/{labelId} [post]
+func AddEntryLabel(ctx context.Context, c *app.RequestContext) {
+	entryID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	ce, err := internal.GetContentEntry(db, entryID)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	l, ok := getLabelInProject(c, ce.ProjectID)
+	if !ok {
+		return
+	}
+	if err := internal.AddEntryLabel(db, ce.ID, l.ID, actorID(c)); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	ce, err = internal.GetContentEntry(db, entryID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, ce)
+}
+
+// RemoveEntryLabel @Summary Remove label from entry
+// @Description Detach a label from the entry
+// @Tags labels
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Param labelId path int true "Label ID"
+// @Success 200 {object} internal.ContentEntry
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/labels/{labelId} [delete]
+func RemoveEntryLabel(ctx context.Context, c *app.RequestContext) {
+	entryID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	labelID, err := strconv.ParseInt(c.Param("labelId"), 10, 64)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid label id"))
+		return
+	}
+	if err := internal.RemoveEntryLabel(db, entryID, labelID, actorID(c)); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	ce, err := internal.GetContentEntry(db, entryID)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, ce)
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"liteboard/auth"
+	"liteboard/internal"
+	"strconv"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func RegisterNotificationRoutes(r *route.RouterGroup) {
+	r.GET("/notifications", GetNotifications)
+	r.POST("/notifications/read_all", MarkAllNotificationsRead)
+	r.POST("/notifications/:id/read", MarkNotificationRead)
+	r.GET("/notifications/preferences", GetNotificationPreferences)
+	r.PUT("/notifications/preferences", UpdateNotificationPreferences)
+}
+
+// notify 保存一条通知，并按用户设置排队邮件；失败只记录日志，不影响触发通知的请求
+func notify(n internal.Notification) {
+	if err := internal.Notify(db, &n); err != nil {
+		hlog.Errorf("notify: Notify failed, userID=%d, type=%s, error=%v", n.UserID, n.Type, err)
+	}
+	if mailer == nil {
+		return
+	}
+	if err := internal.QueueNotificationEmail(db, &n, mailBaseURL); err != nil {
+		hlog.Errorf("notify: QueueNotificationEmail failed, userID=%d, type=%s, error=%v", n.UserID, n.Type, err)
+	}
+}
+
+// notifyEntryChanged 通知条目的创建者其条目被他人修改
+func notifyEntryChanged(actor *auth.User, ce *internal.ContentEntry, what string) {
+	notify(internal.Notification{
+		UserID:    ce.CreatorID,
+		Type:      internal.NotificationEntryChanged,
+		ActorID:   actor.ID,
+		ProjectID: ce.ProjectID,
+		EntryID:   ce.ID,
+		Message:   actor.Username + " " + what + " \"" + ce.Title + "\"",
+	})
+}
+
+// projectName 返回项目名称，用于通知文本
+func projectName(projectID int64) string {
+	if p, err := internal.GetProject(db, projectID); err == nil {
+		return p.Name
+	}
+	return "project #" + strconv.FormatInt(projectID, 10)
+}
+
+// respondNotificationError 将通知相关错误映射为 HTTP 状态码
+func respondNotificationError(c *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, internal.ErrNotificationNotFound):
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+	case errors.Is(err, internal.ErrInvalidNotificationType):
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+	default:
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+	}
+}
+
+// GetNotifications @Summary Get my notifications
+// @Description Retrieve the current user's notifications, newest first, with the number of unread ones
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param unread query bool false "Only return unread notifications"
+// @Param limit query int false "Maximum number of notifications to return"
+// @Success 200 {object} internal.NotificationList
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/notifications [get]
+func GetNotifications(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	unreadOnly := false
+	if s := c.Query("unread"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			c.JSON(400, internal.NewErrorResponse("invalid unread"))
+			return
+		}
+		unreadOnly = b
+	}
+	limit := 0
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			c.JSON(400, internal.NewErrorResponse("invalid limit"))
+			return
+		}
+		limit = n
+	}
+	notifications, unread, err := internal.GetNotifications(db, user.ID, unreadOnly, limit)
+	if err != nil {
+		hlog.Errorf("GetNotifications: GetNotifications failed, userID=%d, error=%v", user.ID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, internal.NotificationList{Notifications: notifications, Unread: unread})
+}
+
+// MarkNotificationRead @Summary Mark notification read
+// @Description Mark one of the current user's notifications as read
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param id path int true "Notification ID"
+// @Success 200 {object} internal.SuccessResponse
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/notifications/{id}/read [post]
+func MarkNotificationRead(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	id, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	if err := internal.MarkNotificationRead(db, user.ID, id); err != nil {
+		respondNotificationError(c, err)
+		return
+	}
+	c.JSON(200, internal.NewSuccessResponse("notification marked as read"))
+}
+
+// MarkAllNotificationsRead @Summary Mark all notifications read
+// @Description Mark every notification of the current user as read
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Success 200 {object} internal.SuccessResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/notifications/read_all [post]
+func MarkAllNotificationsRead(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	if err := internal.MarkAllNotificationsRead(db, user.ID); err != nil {
+		hlog.Errorf("MarkAllNotificationsRead: MarkAllNotificationsRead failed, userID=%d, error=%v", user.ID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, internal.NewSuccessResponse("all notifications marked as read"))
+}
+
+// GetNotificationPreferences @Summary Get notification preferences
+// @Description Return whether each notification type (project_access, project_joined, entry_changed, mention) is enabled for the current user
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]bool
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/notifications/preferences [get]
+func GetNotificationPreferences(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	prefs, err := internal.GetNotificationPreferences(db, user.ID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, prefs)
+}
+
+// UpdateNotificationPreferences @Summary Update notification preferences
+// @Description Turn notification types on or off for the current user. Types left out of the body keep their setting.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param preferences body map[string]bool true "Notification type to enabled"
+// @Success 200 {object} map[string]bool
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/notifications/preferences [put]
+func UpdateNotificationPreferences(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	var prefs map[string]bool
+	if err := c.BindJSON(&prefs); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if err := internal.SetNotificationPreferences(db, user.ID, prefs); err != nil {
+		respondNotificationError(c, err)
+		return
+	}
+	updated, err := internal.GetNotificationPreferences(db, user.ID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, updated)
+}
@@ -0,0 +1,365 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"liteboard/auth"
+	"liteboard/internal"
+	"strconv"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func RegisterPageRoutes(r *route.RouterGroup) {
+	// Wiki pages inherit the permissions of their project
+	r.GET("/projects/:id/pages", auth.PermissionCheckMiddleware("project", "read", GetIDFromParam), GetProjectPages)
+	r.GET("/projects/:id/pages/tree", auth.PermissionCheckMiddleware("project", "read", GetIDFromParam), GetPageTree)
+	r.POST("/projects/:id/pages", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), CreatePage)
+	r.GET("/projects/:id/pages/:pageId", auth.PermissionCheckMiddleware("project", "read", GetIDFromParam), GetPage)
+	r.PUT("/projects/:id/pages/:pageId", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), UpdatePage)
+	r.DELETE("/projects/:id/pages/:pageId", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), DeletePage)
+	r.GET("/projects/:id/pages/:pageId/backlinks", auth.PermissionCheckMiddleware("project", "read", GetIDFromParam), GetPageBacklinks)
+
+	// Pages mentioning an entry
+	r.GET("/content_entries/:id/pages", auth.PermissionCheckMiddleware("content_entry", "read", GetIDFromParam), GetEntryBacklinks)
+}
+
+// getPageInProject 读取路径中的页面，并确认其属于指定项目
+func getPageInProject(c *app.RequestContext, projectID int64) (*internal.Page, bool) {
+	pageID, err := strconv.ParseInt(c.Param("pageId"), 10, 64)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid page id"))
+		return nil, false
+	}
+	p, err := internal.GetPage(db, pageID)
+	if err != nil || p.ProjectID != projectID {
+		c.JSON(404, internal.NewErrorResponse("page not found"))
+		return nil, false
+	}
+	return p, true
+}
+
+// respondPageError 将页面校验错误映射为 400/409，其余为 500
+func respondPageError(c *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, internal.ErrInvalidPage):
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+	case errors.Is(err, internal.ErrPageExists):
+		c.JSON(409, internal.NewErrorResponse(err.Error()))
+	default:
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+	}
+}
+
+// GetProjectPages @Summary Get project pages
+// @Description Get the wiki pages of a project, optionally only the one with a given slug
+// @Tags pages
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param slug query string false "Only the page with this slug"
+// @Success 200 {array} internal.Page
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/pages [get]
+func GetProjectPages(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	pages, err := internal.GetPagesByProject(db, projectID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if slug := c.Query("slug"); slug != "" {
+		matched := []internal.Page{}
+		for _, p := range pages {
+			if p.Slug == slug {
+				matched = append(matched, p)
+			}
+		}
+		pages = matched
+	}
+	c.JSON(200, pages)
+}
+
+// GetPageTree @Summary Get page tree
+// @Description Get the wiki pages of a project nested by parent, without their bodies
+// @Tags pages
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {array} internal.PageNode
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/pages/tree [get]
+func GetPageTree(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	pages, err := internal.GetPagesByProject(db, projectID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, internal.BuildPageTree(pages))
+}
+
+// CreatePage @Summary Create page
+// @Description Create a wiki page. The slug defaults to one derived from the title; parent_id places the page under another page of the project. The body is markdown and may link pages with [[Title]] or [[slug|text]] and entries with #<entry id>.
+// @Tags pages
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param page body internal.Page true "Page"
+// @Success 201 {object} internal.Page
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/pages [post]
+func CreatePage(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	var p internal.Page
+	if err := c.BindJSON(&p); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	p.ID = 0
+	p.ProjectID = projectID
+	p.AuthorID = user.ID
+	p.ContentHTML = ""
+	if err := internal.PreparePage(db, &p); err != nil {
+		respondPageError(c, err)
+		return
+	}
+	id, err := internal.CreatePage(db, &p)
+	if err != nil {
+		hlog.Errorf("CreatePage: CreatePage failed, projectID=%d, error=%v", projectID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	p.ID = id
+	c.JSON(201, p)
+}
+
+// GetPage @Summary Get page
+// @Description Get a wiki page
+// @Tags pages
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param pageId path int true "Page ID"
+// @Param render query string false "Set to html to include sanitized content_html with page and entry links resolved"
+// @Success 200 {object} internal.Page
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/pages/{pageId} [get]
+func GetPage(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	p, ok := getPageInProject(c, projectID)
+	if !ok {
+		return
+	}
+	if c.Query("render") == "html" {
+		if err := internal.RenderPageContent(db, p); err != nil {
+			c.JSON(500, internal.NewErrorResponse(err.Error()))
+			return
+		}
+	}
+	c.JSON(200, p)
+}
+
+// UpdatePage @Summary Update page
+// @Description Update a wiki page. Omitted fields keep their values; set parent_id to 0 to move the page to the top level.
+// @Tags pages
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param pageId path int true "Page ID"
+// @Param page body internal.Page true "Page"
+// @Success 200 {object} internal.Page
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/pages/{pageId} [put]
+func UpdatePage(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	existing, ok := getPageInProject(c, projectID)
+	if !ok {
+		return
+	}
+	p := *existing
+	if err := json.Unmarshal(c.Request.Body(), &p); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	p.ID = existing.ID
+	p.ProjectID = projectID
+	p.AuthorID = existing.AuthorID
+	p.ContentHTML = ""
+	if err := internal.PreparePage(db, &p); err != nil {
+		respondPageError(c, err)
+		return
+	}
+	if err := internal.UpdatePage(db, p.ID, &p); err != nil {
+		hlog.Errorf("UpdatePage: UpdatePage failed, pageID=%d, error=%v", p.ID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, p)
+}
+
+// DeletePage @Summary Delete page
+// @Description Delete a wiki page. Its child pages move up to its parent.
+// @Tags pages
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param pageId path int true "Page ID"
+// @Success 200 {object} internal.SuccessResponse
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/pages/{pageId} [delete]
+func DeletePage(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	p, ok := getPageInProject(c, projectID)
+	if !ok {
+		return
+	}
+	if err := internal.DeleteProjectPage(db, p); err != nil {
+		hlog.Errorf("DeletePage: DeleteProjectPage failed, pageID=%d, error=%v", p.ID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, internal.NewSuccessResponse("deleted"))
+}
+
+// GetPageBacklinks @Summary Get page backlinks
+// @Description Get the pages of the project that link to this page with [[...]]
+// @Tags pages
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param pageId path int true "Page ID"
+// @Success 200 {array} internal.Page
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/pages/{pageId}/backlinks [get]
+func GetPageBacklinks(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	p, ok := getPageInProject(c, projectID)
+	if !ok {
+		return
+	}
+	pages, err := internal.GetPageBacklinks(db, p)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, pages)
+}
+
+// GetEntryBacklinks @Summary Get pages mentioning an entry
+// @Description Get the wiki pages of the entry's project that mention it as #<entry id>. Requires read on the entry and on the project.
+// @Tags pages
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Success 200 {array} internal.Page
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/pages [get]
+func GetEntryBacklinks(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	id, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	ce, err := internal.GetContentEntry(db, id)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	// 页面权限继承自项目
+	canRead, err := internal.HasPermission(db, user.ID, "project", ce.ProjectID, "read")
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if !canRead {
+		c.JSON(403, internal.NewErrorResponse("read permission on the project is required"))
+		return
+	}
+	pages, err := internal.GetEntryBacklinks(db, ce)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, pages)
+}
@@ -31,16 +31,23 @@ func RegisterPermissionRoutes(r *route.RouterGroup) {
 // @Tags permissions
 // @Accept json
 // @Produce json
+// @Param updated_since query int false "Only detail permissions changed at or after this Unix timestamp"
 // @Success 200 {array} internal.DetailPermission
+// @Failure 400 {object} internal.ErrorResponse
 // @Failure 500 {object} internal.ErrorResponse
 // @Router /api/detail_permissions [get]
 func GetDetailPermissions(ctx context.Context, c *app.RequestContext) {
+	since, err := parseUpdatedSince(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
 	dps, err := internal.GetDetailPermissions(db)
 	if err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
 		return
 	}
-	c.JSON(200, dps)
+	c.JSON(200, internal.UpdatedSince(dps, since))
 }
 
 // CreateDetailPermission @Summary Create detail permission
@@ -59,12 +66,14 @@ func CreateDetailPermission(ctx context.Context, c *app.RequestContext) {
 		c.JSON(400, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	dp.UpdatedBy = actorID(c)
 	id, err := internal.CreateDetailPermission(db, &dp)
 	if err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
 		return
 	}
 	dp.ID = id
+	emitDetailPermissionWebhooks(&dp, internal.WebhookPermissionGranted, dp.UpdatedBy)
 	c.JSON(201, dp)
 }
 
@@ -122,11 +131,19 @@ func UpdateDetailPermission(ctx context.Context, c *app.RequestContext) {
 		c.JSON(400, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	dp.UpdatedBy = actorID(c)
+	previous, err := internal.GetDetailPermission(db, id)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
 	err = internal.UpdateDetailPermission(db, id, &dp)
 	if err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	emitDetailPermissionWebhooks(previous, internal.WebhookPermissionRevoked, dp.UpdatedBy)
+	emitDetailPermissionWebhooks(&dp, internal.WebhookPermissionGranted, dp.UpdatedBy)
 	c.JSON(200, dp)
 }
 
@@ -150,11 +167,17 @@ func DeleteDetailPermission(ctx context.Context, c *app.RequestContext) {
 		c.JSON(400, internal.NewErrorResponse("invalid id"))
 		return
 	}
+	previous, err := internal.GetDetailPermission(db, id)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
 	err = internal.DeleteDetailPermission(db, id)
 	if err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	emitDetailPermissionWebhooks(previous, internal.WebhookPermissionRevoked, actorID(c))
 	c.JSON(200, internal.NewSuccessResponse("deleted"))
 }
 
@@ -2,6 +2,8 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"liteboard/auth"
 	"liteboard/internal"
 	"strconv"
@@ -18,20 +20,45 @@ func GetIDFromParam(c *app.RequestContext) (int64, error) {
 	return strconv.ParseInt(idStr, 10, 64)
 }
 
+// actorID 返回当前登录用户的 ID，用于记录 updated_by；未登录时为 0
+func actorID(c *app.RequestContext) int64 {
+	if user := auth.GetUserFromSession(c); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// parseUpdatedSince 解析 updated_since 参数（Unix 时间戳），未提供时为 0，表示不过滤
+func parseUpdatedSince(c *app.RequestContext) (int64, error) {
+	raw := c.Query("updated_since")
+	if raw == "" {
+		return 0, nil
+	}
+	since, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || since < 0 {
+		return 0, errors.New("invalid updated_since")
+	}
+	return since, nil
+}
+
 func RegisterProjectRoutes(r *route.RouterGroup) {
 	r.GET("/projects", GetProjects)
 	r.POST("/projects", CreateProject)
 	r.GET("/projects/:id", auth.PermissionCheckMiddleware("project", "read", GetIDFromParam), GetProject)
 	r.PUT("/projects/:id", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), UpdateProject)
 	r.DELETE("/projects/:id", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), DeleteProject)
+	r.POST("/projects/:id/clone", auth.PermissionCheckMiddleware("project", "read", GetIDFromParam), CloneProject)
 }
 
 // GetProjects @Summary Get all projects
-// @Description Retrieve list of projects
+// @Description Retrieve list of projects. With templates=true only template projects are returned, for the template picker.
 // @Tags projects
 // @Accept json
 // @Produce json
+// @Param templates query bool false "Only return template projects"
+// @Param updated_since query int false "Only projects changed at or after this Unix timestamp"
 // @Success 200 {array} internal.Project
+// @Failure 400 {object} internal.ErrorResponse
 // @Failure 401 {object} internal.ErrorResponse
 // @Failure 500 {object} internal.ErrorResponse
 // @Router /api/projects [get]
@@ -53,26 +80,41 @@ func GetProjects(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 	hlog.Debugf("GetProjects: user authenticated, ID=%d, Username=%s", user.ID, user.Username)
+	since, err := parseUpdatedSince(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
 
-	projects, err := internal.GetProjectsForUser(db, user.ID)
+	var projects []internal.Project
+	if c.Query("templates") == "true" {
+		projects, err = internal.GetTemplatesForUser(db, user.ID)
+	} else {
+		projects, err = internal.GetProjectsForUser(db, user.ID)
+	}
 	if err != nil {
 		hlog.Errorf("GetProjects: GetProjectsForUser failed, userID=%d, error=%v", user.ID, err)
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	projects = internal.UpdatedSince(projects, since)
 	hlog.Debugf("GetProjects: successfully retrieved %d projects for user %d", len(projects), user.ID)
 	c.JSON(200, projects)
 }
 
 // CreateProject @Summary Create project
-// @Description Create a new project
+// @Description Create a new project. With template_id the project is cloned from a template project the caller can read, taking name and description from the body.
 // @Tags projects
 // @Accept json
 // @Produce json
+// @Param template_id query int false "Template project to start from"
+// @Param include_entries query bool false "With template_id: also copy the template's entries"
 // @Param project body internal.Project true "Project"
 // @Success 201 {object} internal.Project
 // @Failure 400 {object} internal.ErrorResponse
 // @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
 // @Failure 500 {object} internal.ErrorResponse
 // @Router /api/projects [post]
 func CreateProject(ctx context.Context, c *app.RequestContext) {
@@ -101,6 +143,11 @@ func CreateProject(ctx context.Context, c *app.RequestContext) {
 	}
 	hlog.Debugf("CreateProject: project data bound, Name=%s", p.Name)
 
+	if templateIDStr := c.Query("template_id"); templateIDStr != "" {
+		createProjectFromTemplate(c, user.ID, templateIDStr, &p)
+		return
+	}
+
 	p.CreatorID = user.ID
 	id, err := internal.CreateProject(db, &p)
 	if err != nil {
@@ -117,6 +164,7 @@ func CreateProject(ctx context.Context, c *app.RequestContext) {
 		ContentType: "project",
 		ContentIDs:  []int64{p.ID},
 		Action:      "admin",
+		Timestamps:  internal.Timestamps{UpdatedBy: p.CreatorID},
 	}
 	_, err = internal.CreateDetailPermission(db, &dp)
 	if err != nil {
@@ -132,6 +180,7 @@ func CreateProject(ctx context.Context, c *app.RequestContext) {
 		ContentType: "project",
 		ContentIDs:  []int64{p.ID},
 		Action:      "read",
+		Timestamps:  internal.Timestamps{UpdatedBy: p.CreatorID},
 	}
 	_, err = internal.CreateDetailPermission(db, &dpRead)
 	if err != nil {
@@ -144,6 +193,87 @@ func CreateProject(ctx context.Context, c *app.RequestContext) {
 	c.JSON(201, p)
 }
 
+// createProjectFromTemplate 从模板项目克隆出新项目
+func createProjectFromTemplate(c *app.RequestContext, userID int64, templateIDStr string, p *internal.Project) {
+	templateID, err := strconv.ParseInt(templateIDStr, 10, 64)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid template_id"))
+		return
+	}
+	canRead, err := internal.HasPermission(db, userID, "project", templateID, "read")
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	template, err := internal.GetProject(db, templateID)
+	if !canRead || err != nil || !template.IsTemplate {
+		c.JSON(404, internal.NewErrorResponse("template not found"))
+		return
+	}
+	opts := internal.CloneOptions{
+		Name:           p.Name,
+		Description:    p.Description,
+		IncludeEntries: c.Query("include_entries") == "true",
+		IsTemplate:     p.IsTemplate,
+	}
+	if opts.Name == "" {
+		opts.Name = template.Name
+	}
+	created, err := internal.CloneProject(db, templateID, userID, opts)
+	if err != nil {
+		hlog.Errorf("CreateProject: CloneProject failed, templateID=%d, error=%v", templateID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(201, created)
+}
+
+// CloneProject @Summary Clone project
+// @Description Deep-copy a project into a new project owned by the caller: lists with their policies, labels, custom fields and optionally entries with their labels and custom field values. Archived items, entries the caller cannot read, comments, attachments and relations are not copied; assignees and user field values are cleared. The clone either completes or leaves nothing behind.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param options body internal.CloneOptions false "Clone options"
+// @Success 201 {object} internal.Project
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/clone [post]
+func CloneProject(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	id, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	var opts internal.CloneOptions
+	if len(c.Request.Body()) > 0 {
+		if err := json.Unmarshal(c.Request.Body(), &opts); err != nil {
+			c.JSON(400, internal.NewErrorResponse(err.Error()))
+			return
+		}
+	}
+	if _, err := internal.GetProject(db, id); err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	p, err := internal.CloneProject(db, id, user.ID, opts)
+	if err != nil {
+		hlog.Errorf("CloneProject: CloneProject failed, projectID=%d, error=%v", id, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(201, p)
+}
+
 // GetProject @Summary Get project by ID
 // @Description Retrieve a project by ID
 // @Tags projects
@@ -173,7 +303,7 @@ func GetProject(ctx context.Context, c *app.RequestContext) {
 }
 
 // UpdateProject @Summary Update project
-// @Description Update an existing project
+// @Description Update an existing project. Fields omitted from the body keep their current values.
 // @Tags projects
 // @Accept json
 // @Produce json
@@ -183,6 +313,7 @@ func GetProject(ctx context.Context, c *app.RequestContext) {
 // @Failure 400 {object} internal.ErrorResponse
 // @Failure 401 {object} internal.ErrorResponse
 // @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
 // @Failure 500 {object} internal.ErrorResponse
 // @Security Session
 // @Router /api/projects/{id} [put]
@@ -193,16 +324,25 @@ func UpdateProject(ctx context.Context, c *app.RequestContext) {
 		c.JSON(400, internal.NewErrorResponse("invalid id"))
 		return
 	}
-	var p internal.Project
-	if err := c.BindJSON(&p); err != nil {
+	existing, err := internal.GetProject(db, id)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	// 在现有项目上解码，请求中未出现的字段（如 is_template）保持原值
+	p := *existing
+	if err := json.Unmarshal(c.Request.Body(), &p); err != nil {
 		c.JSON(400, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	p.ID = id
+	p.UpdatedBy = actorID(c)
 	err = internal.UpdateProject(db, id, &p)
 	if err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	emitWebhook(id, internal.WebhookProjectUpdated, p.UpdatedBy, p)
 	c.JSON(200, p)
 }
 
@@ -226,10 +366,17 @@ func DeleteProject(ctx context.Context, c *app.RequestContext) {
 		c.JSON(400, internal.NewErrorResponse("invalid id"))
 		return
 	}
+	err = internal.DeleteAttachmentsByProject(ctx, db, blobStore, id)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
 	err = internal.DeleteProject(db, id)
 	if err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	// 项目的 webhook 保留，以便投递 project.deleted 事件
+	emitWebhook(id, internal.WebhookProjectDeleted, actorID(c), map[string]int64{"id": id})
 	c.JSON(200, internal.NewSuccessResponse("deleted"))
 }
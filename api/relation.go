@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"liteboard/auth"
+	"liteboard/internal"
+	"strconv"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+// maxRelationDepth 关系图查询允许的最大深度
+const maxRelationDepth = 5
+
+func RegisterRelationRoutes(r *route.RouterGroup) {
+	r.GET("/content_entries/:id/relations", auth.PermissionCheckMiddleware("content_entry", "read", GetIDFromParam), GetEntryRelations)
+	r.POST("/content_entries/:id/relations", auth.PermissionCheckMiddleware("content_entry", "write", GetIDFromParam), CreateEntryRelation)
+	r.DELETE("/content_entries/:id/relations/:relationId", auth.PermissionCheckMiddleware("content_entry", "write", GetIDFromParam), DeleteEntryRelation)
+}
+
+// CreateRelationRequest is the body for adding a relation from the entry in the path
+type CreateRelationRequest struct {
+	TargetID int64  `json:"target_id"`
+	Type     string `json:"type"`
+}
+
+// respondRelationError 将校验错误映射为 400，重复和成环映射为 409，其余为 500
+func respondRelationError(c *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, internal.ErrInvalidRelation):
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+	case errors.Is(err, internal.ErrRelationExists), errors.Is(err, internal.ErrRelationCycle):
+		c.JSON(409, internal.NewErrorResponse(err.Error()))
+	default:
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+	}
+}
+
+// GetEntryRelations @Summary Get entry relations
+// @Description Get the relation graph around an entry. depth (default 1, max 5) is the number of hops to follow; entries the caller cannot read are left out together with their relations.
+// @Tags relations
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Param depth query int false "Number of hops to follow"
+// @Success 200 {object} internal.RelationGraph
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/relations [get]
+func GetEntryRelations(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	entryID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	depth := 1
+	if s := c.Query("depth"); s != "" {
+		depth, err = strconv.Atoi(s)
+		if err != nil || depth < 1 || depth > maxRelationDepth {
+			c.JSON(400, internal.NewErrorResponse("depth must be between 1 and "+strconv.Itoa(maxRelationDepth)))
+			return
+		}
+	}
+
+	canRead := func(id int64) (bool, error) {
+		return internal.HasPermission(db, user.ID, "content_entry", id, "read")
+	}
+	graph, err := internal.GetRelationGraph(db, entryID, depth, canRead)
+	if err != nil {
+		hlog.Errorf("GetEntryRelations: GetRelationGraph failed, entryID=%d, error=%v", entryID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, graph)
+}
+
+// CreateEntryRelation @Summary Add entry relation
+// @Description Relate the entry to another entry, possibly in another project. type is blocks, relates_to or duplicates. Requires write on the entry and read on the target; blocks cycles are rejected.
+// @Tags relations
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Param relation body CreateRelationRequest true "Relation"
+// @Success 201 {object} internal.EntryRelation
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/relations [post]
+func CreateEntryRelation(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	entryID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	var req CreateRelationRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+
+	r := internal.EntryRelation{
+		SourceID:  entryID,
+		TargetID:  req.TargetID,
+		Type:      req.Type,
+		CreatorID: user.ID,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := internal.ValidateRelation(&r); err != nil {
+		respondRelationError(c, err)
+		return
+	}
+	// 目标条目必须存在且当前用户可读，否则不暴露其存在
+	canRead, err := internal.HasPermission(db, user.ID, "content_entry", r.TargetID, "read")
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if !canRead {
+		c.JSON(404, internal.NewErrorResponse("target entry not found"))
+		return
+	}
+	if _, err := internal.GetContentEntry(db, r.TargetID); err != nil {
+		c.JSON(404, internal.NewErrorResponse("target entry not found"))
+		return
+	}
+	if err := internal.CheckRelationAllowed(db, &r); err != nil {
+		respondRelationError(c, err)
+		return
+	}
+
+	id, err := internal.CreateEntryRelation(db, &r)
+	if err != nil {
+		hlog.Errorf("CreateEntryRelation: CreateEntryRelation failed, entryID=%d, error=%v", entryID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	r.ID = id
+	c.JSON(201, r)
+}
+
+// DeleteEntryRelation @Summary Remove entry relation
+// @Description Remove a relation that has the entry at either end
+// @Tags relations
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Param relationId path int true "Relation ID"
+// @Success 200 {object} internal.SuccessResponse
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/relations/{relationId} [delete]
+func DeleteEntryRelation(ctx context.Context, c *app.RequestContext) {
+	entryID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	relationID, err := strconv.ParseInt(c.Param("relationId"), 10, 64)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid relation id"))
+		return
+	}
+	r, err := internal.GetEntryRelation(db, relationID)
+	if err != nil || (r.SourceID != entryID && r.TargetID != entryID) {
+		c.JSON(404, internal.NewErrorResponse("relation not found"))
+		return
+	}
+	if err := internal.DeleteEntryRelation(db, r.ID); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, internal.NewSuccessResponse("deleted"))
+}
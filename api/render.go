@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"liteboard/internal"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+// maxMarkdownPreviewSize 预览接口接受的 markdown 最大字节数
+const maxMarkdownPreviewSize = 1 << 20
+
+// RenderMarkdownRequest is the body of the markdown preview endpoint
+type RenderMarkdownRequest struct {
+	Markdown string `json:"markdown"`
+}
+
+// RenderMarkdownResponse carries the sanitized HTML
+type RenderMarkdownResponse struct {
+	HTML string `json:"html"`
+}
+
+func RegisterRenderRoutes(r *route.RouterGroup) {
+	r.POST("/render/markdown", RenderMarkdown)
+}
+
+// RenderMarkdown @Summary Render markdown
+// @Description Render CommonMark/GFM markdown to sanitized HTML, for previews before saving
+// @Tags render
+// @Accept json
+// @Produce json
+// @Param request body RenderMarkdownRequest true "Markdown source"
+// @Success 200 {object} RenderMarkdownResponse
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 413 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/render/markdown [post]
+func RenderMarkdown(ctx context.Context, c *app.RequestContext) {
+	var req RenderMarkdownRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if len(req.Markdown) > maxMarkdownPreviewSize {
+		c.JSON(413, internal.NewErrorResponse("markdown too large"))
+		return
+	}
+	html, err := internal.RenderMarkdown(req.Markdown)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, RenderMarkdownResponse{HTML: html})
+}
@@ -47,6 +47,11 @@ func RegisterShareRoutes(r *route.RouterGroup) {
 // @Security Session
 // @Router /api/projects/{id}/permissions [post]
 func AddProjectPermission(ctx context.Context, c *app.RequestContext) {
+	actor := auth.GetUserFromSession(c)
+	if actor == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
 	projectIDStr := c.Param("id")
 	projectID, err := strconv.ParseInt(projectIDStr, 10, 64)
 	if err != nil {
@@ -64,7 +69,7 @@ func AddProjectPermission(ctx context.Context, c *app.RequestContext) {
 	}
 
 	// Validate permission level
-	if req.PermissionLevel != "read" && req.PermissionLevel != "write" && req.PermissionLevel != "admin" {
+	if internal.GetPermissionLevel(req.PermissionLevel) == internal.PermissionNone {
 		c.JSON(400, internal.NewErrorResponse("invalid permission level"))
 		return
 	}
@@ -93,8 +98,9 @@ func AddProjectPermission(ctx context.Context, c *app.RequestContext) {
 					newContentIDsJson, _ := json.Marshal(contentIDs)
 
 					updateCond := dbhelper.Cond().Eq("id", data["id"].(int64)).Build()
-					upd := dbhelper.Cond().Eq("content_ids", string(newContentIDsJson)).Build()
+					upd := dbhelper.Cond().Eq("content_ids", string(newContentIDsJson)).Eq("updated_at", time.Now().Unix()).Eq("updated_by", actor.ID).Build()
 					db.Update("detail_permission", updateCond, upd)
+					internal.RecordPermissionChange(db, data["id"].(int64), req.UserID, "project", internal.ChangeUpsert)
 				}
 				break
 			}
@@ -116,6 +122,7 @@ func AddProjectPermission(ctx context.Context, c *app.RequestContext) {
 			ContentType: "project",
 			ContentIDs:  []int64{projectID},
 			Action:      req.PermissionLevel,
+			Timestamps:  internal.Timestamps{UpdatedBy: actor.ID},
 		}
 		_, err = internal.CreateDetailPermission(db, &dp)
 		if err != nil {
@@ -143,8 +150,11 @@ func AddProjectPermission(ctx context.Context, c *app.RequestContext) {
 			newContentIDsJson, _ := json.Marshal(contentIDs)
 
 			updateCond := dbhelper.Cond().Eq("id", data["id"].(int64)).Build()
-			upd := dbhelper.Cond().Eq("content_ids", string(newContentIDsJson)).Build()
+			upd := dbhelper.Cond().Eq("content_ids", string(newContentIDsJson)).Eq("updated_at", time.Now().Unix()).Eq("updated_by", actor.ID).Build()
 			_, err = db.Update("detail_permission", updateCond, upd)
+			if err == nil {
+				err = internal.RecordPermissionChange(db, data["id"].(int64), req.UserID, "project", internal.ChangeUpsert)
+			}
 			if err != nil {
 				c.JSON(500, internal.NewErrorResponse(err.Error()))
 				return
@@ -152,6 +162,14 @@ func AddProjectPermission(ctx context.Context, c *app.RequestContext) {
 		}
 	}
 
+	emitPermissionWebhook(projectID, internal.WebhookPermissionGranted, actor.ID, req.UserID, req.PermissionLevel)
+	notify(internal.Notification{
+		UserID:    req.UserID,
+		Type:      internal.NotificationProjectAccess,
+		ActorID:   actor.ID,
+		ProjectID: projectID,
+		Message:   actor.Username + " gave you " + req.PermissionLevel + " access to " + projectName(projectID),
+	})
 	c.JSON(200, internal.NewSuccessResponse("permission added"))
 }
 
@@ -176,53 +194,12 @@ func GetProjectPermissions(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	// Get all permissions for this project
-	cond := dbhelper.Cond().Eq("content_type", "project").Build()
-	rows, err := db.Query("detail_permission", cond)
+	permissions, err := internal.GetProjectPermissions(db, projectID)
 	if err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
 		return
 	}
 
-	permMap := make(map[int64]string) // userID -> permission level
-
-	for _, data := range rows.All() {
-		contentIDsJson := data["content_ids"].(string)
-		var contentIDs []int64
-		json.Unmarshal([]byte(contentIDsJson), &contentIDs)
-
-		for _, id := range contentIDs {
-			if id == projectID {
-				userID := data["user_id"].(int64)
-				action := data["action"].(string)
-
-				// Keep the highest permission level
-				if existing, ok := permMap[userID]; ok {
-					if internal.GetPermissionLevel(action) > internal.GetPermissionLevel(existing) {
-						permMap[userID] = action
-					}
-				} else {
-					permMap[userID] = action
-				}
-			}
-		}
-	}
-
-	// Get user details
-	permissions := make([]internal.ProjectPermission, 0)
-	for userID, permLevel := range permMap {
-		userInternal, err := auth.GetUserInternalByID(userID)
-		if err != nil {
-			continue
-		}
-		permissions = append(permissions, internal.ProjectPermission{
-			UserID:          userID,
-			Username:        userInternal.Username,
-			Email:           userInternal.Email,
-			PermissionLevel: permLevel,
-		})
-	}
-
 	c.JSON(200, permissions)
 }
 
@@ -241,6 +218,11 @@ func GetProjectPermissions(ctx context.Context, c *app.RequestContext) {
 // @Security Session
 // @Router /api/projects/{id}/permissions/{userId} [delete]
 func RemoveProjectPermission(ctx context.Context, c *app.RequestContext) {
+	actor := auth.GetUserFromSession(c)
+	if actor == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
 	projectIDStr := c.Param("id")
 	projectID, err := strconv.ParseInt(projectIDStr, 10, 64)
 	if err != nil {
@@ -280,15 +262,18 @@ func RemoveProjectPermission(ctx context.Context, c *app.RequestContext) {
 			// Delete the entire permission entry
 			deleteCond := dbhelper.Cond().Eq("id", data["id"].(int64)).Build()
 			db.Delete("detail_permission", deleteCond)
+			internal.RecordPermissionChange(db, data["id"].(int64), userID, "project", internal.ChangeDelete)
 		} else {
 			// Update with new list
 			newContentIDsJson, _ := json.Marshal(newContentIDs)
 			updateCond := dbhelper.Cond().Eq("id", data["id"].(int64)).Build()
-			upd := dbhelper.Cond().Eq("content_ids", string(newContentIDsJson)).Build()
+			upd := dbhelper.Cond().Eq("content_ids", string(newContentIDsJson)).Eq("updated_at", time.Now().Unix()).Eq("updated_by", actor.ID).Build()
 			db.Update("detail_permission", updateCond, upd)
+			internal.RecordPermissionChange(db, data["id"].(int64), userID, "project", internal.ChangeUpsert)
 		}
 	}
 
+	emitPermissionWebhook(projectID, internal.WebhookPermissionRevoked, actor.ID, userID, "")
 	c.JSON(200, internal.NewSuccessResponse("permission removed"))
 }
 
@@ -324,7 +309,7 @@ func GenerateShareToken(ctx context.Context, c *app.RequestContext) {
 	}
 
 	// Validate permission level
-	if req.PermissionLevel != "read" && req.PermissionLevel != "write" {
+	if req.PermissionLevel != "read" && req.PermissionLevel != "comment" && req.PermissionLevel != "write" {
 		c.JSON(400, internal.NewErrorResponse("invalid permission level"))
 		return
 	}
@@ -352,6 +337,7 @@ func GenerateShareToken(ctx context.Context, c *app.RequestContext) {
 		PermissionLevel: req.PermissionLevel,
 		CreatedAt:       now,
 		ExpiresAt:       expiresAt,
+		CreatorID:       actorID(c),
 	}
 
 	id, err := internal.CreateShareToken(db, st)
@@ -500,6 +486,7 @@ func JoinViaShareToken(ctx context.Context, c *app.RequestContext) {
 			ContentType: "project",
 			ContentIDs:  []int64{st.ProjectID},
 			Action:      req.PermissionLevel,
+			Timestamps:  internal.Timestamps{UpdatedBy: user.ID},
 		}
 		_, err = internal.CreateDetailPermission(db, &dp)
 		if err != nil {
@@ -527,8 +514,11 @@ func JoinViaShareToken(ctx context.Context, c *app.RequestContext) {
 			newContentIDsJson, _ := json.Marshal(contentIDs)
 
 			updateCond := dbhelper.Cond().Eq("id", data["id"].(int64)).Build()
-			upd := dbhelper.Cond().Eq("content_ids", string(newContentIDsJson)).Build()
+			upd := dbhelper.Cond().Eq("content_ids", string(newContentIDsJson)).Eq("updated_at", time.Now().Unix()).Eq("updated_by", user.ID).Build()
 			_, err = db.Update("detail_permission", updateCond, upd)
+			if err == nil {
+				err = internal.RecordPermissionChange(db, data["id"].(int64), user.ID, "project", internal.ChangeUpsert)
+			}
 			if err != nil {
 				c.JSON(500, internal.NewErrorResponse(err.Error()))
 				return
@@ -537,6 +527,14 @@ func JoinViaShareToken(ctx context.Context, c *app.RequestContext) {
 	}
 
 	hlog.Infof("User %d joined project %d via share token with %s permission", user.ID, st.ProjectID, st.PermissionLevel)
+	emitPermissionWebhook(st.ProjectID, internal.WebhookPermissionGranted, user.ID, user.ID, st.PermissionLevel)
+	notify(internal.Notification{
+		UserID:    st.CreatorID,
+		Type:      internal.NotificationProjectJoined,
+		ActorID:   user.ID,
+		ProjectID: st.ProjectID,
+		Message:   user.Username + " joined " + projectName(st.ProjectID) + " via your share link",
+	})
 	c.JSON(200, internal.NewSuccessResponseWithData("joined project", map[string]interface{}{
 		"project_id": st.ProjectID,
 	}))
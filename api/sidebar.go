@@ -0,0 +1,384 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"liteboard/auth"
+	"liteboard/internal"
+	"strconv"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func RegisterSidebarRoutes(r *route.RouterGroup) {
+	// Project sidebar: readers see it, writers edit it
+	r.GET("/projects/:id/sidebar", auth.PermissionCheckMiddleware("project", "read", GetIDFromParam), GetProjectSidebar)
+	r.POST("/projects/:id/sidebar/items", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), CreateProjectSidebarItem)
+	r.PUT("/projects/:id/sidebar/items/:itemId", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), UpdateProjectSidebarItem)
+	r.DELETE("/projects/:id/sidebar/items/:itemId", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), DeleteProjectSidebarItem)
+	r.PUT("/projects/:id/sidebar/order", auth.PermissionCheckMiddleware("project", "write", GetIDFromParam), ReorderProjectSidebar)
+
+	// Personal sidebar of the logged-in user
+	r.GET("/user/sidebar", GetUserSidebar)
+	r.POST("/user/sidebar/items", CreateUserSidebarItem)
+	r.PUT("/user/sidebar/items/:itemId", UpdateUserSidebarItem)
+	r.DELETE("/user/sidebar/items/:itemId", DeleteUserSidebarItem)
+	r.PUT("/user/sidebar/order", ReorderUserSidebar)
+}
+
+// sidebarLoader 读取请求对应的侧边栏，返回 false 表示已写出错误响应
+type sidebarLoader func(c *app.RequestContext, userID int64) (*internal.Sidebar, bool)
+
+func loadProjectSidebar(c *app.RequestContext, userID int64) (*internal.Sidebar, bool) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return nil, false
+	}
+	s, err := internal.GetProjectSidebar(db, projectID)
+	if err != nil {
+		hlog.Errorf("loadProjectSidebar: GetProjectSidebar failed, projectID=%d, error=%v", projectID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return nil, false
+	}
+	return s, true
+}
+
+func loadUserSidebar(c *app.RequestContext, userID int64) (*internal.Sidebar, bool) {
+	s, err := internal.GetUserSidebar(db, userID)
+	if err != nil {
+		hlog.Errorf("loadUserSidebar: GetUserSidebar failed, userID=%d, error=%v", userID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return nil, false
+	}
+	return s, true
+}
+
+// getSidebarItemInSidebar 读取路径中的侧边栏项，并确认其属于指定侧边栏
+func getSidebarItemInSidebar(c *app.RequestContext, sidebarID int64) (*internal.SidebarItem, bool) {
+	itemID, err := strconv.ParseInt(c.Param("itemId"), 10, 64)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid item id"))
+		return nil, false
+	}
+	si, err := internal.GetSidebarItem(db, itemID)
+	if err != nil || si.SidebarID != sidebarID {
+		c.JSON(404, internal.NewErrorResponse("sidebar item not found"))
+		return nil, false
+	}
+	return si, true
+}
+
+// respondSidebarError 将侧边栏校验错误映射为 400，其余为 500
+func respondSidebarError(c *app.RequestContext, err error) {
+	if errors.Is(err, internal.ErrInvalidSidebarItem) {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(500, internal.NewErrorResponse(err.Error()))
+}
+
+func getSidebar(c *app.RequestContext, load sidebarLoader) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	s, ok := load(c, user.ID)
+	if !ok {
+		return
+	}
+	items, err := internal.VisibleSidebarItems(db, user.ID, s.Items)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	s.Items = items
+	c.JSON(200, s)
+}
+
+func createSidebarItem(c *app.RequestContext, load sidebarLoader) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	s, ok := load(c, user.ID)
+	if !ok {
+		return
+	}
+	var si internal.SidebarItem
+	if err := c.BindJSON(&si); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	si.ID = 0
+	si.SidebarID = s.ID
+	if err := internal.ValidateSidebarItem(db, &si, user.ID); err != nil {
+		respondSidebarError(c, err)
+		return
+	}
+	id, err := internal.CreateSidebarItem(db, &si)
+	if err != nil {
+		hlog.Errorf("createSidebarItem: CreateSidebarItem failed, sidebarID=%d, error=%v", s.ID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	si.ID = id
+	c.JSON(201, si)
+}
+
+func updateSidebarItem(c *app.RequestContext, load sidebarLoader) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	s, ok := load(c, user.ID)
+	if !ok {
+		return
+	}
+	existing, ok := getSidebarItemInSidebar(c, s.ID)
+	if !ok {
+		return
+	}
+	si := *existing
+	if err := json.Unmarshal(c.Request.Body(), &si); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	si.ID = existing.ID
+	si.SidebarID = s.ID
+	if err := internal.ValidateSidebarItem(db, &si, user.ID); err != nil {
+		respondSidebarError(c, err)
+		return
+	}
+	if err := internal.UpdateSidebarItem(db, si.ID, &si); err != nil {
+		hlog.Errorf("updateSidebarItem: UpdateSidebarItem failed, itemID=%d, error=%v", si.ID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, si)
+}
+
+func deleteSidebarItem(c *app.RequestContext, load sidebarLoader) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	s, ok := load(c, user.ID)
+	if !ok {
+		return
+	}
+	si, ok := getSidebarItemInSidebar(c, s.ID)
+	if !ok {
+		return
+	}
+	if err := internal.DeleteSidebarItemTree(db, s.ID, si.ID); err != nil {
+		hlog.Errorf("deleteSidebarItem: DeleteSidebarItemTree failed, itemID=%d, error=%v", si.ID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, internal.NewSuccessResponse("deleted"))
+}
+
+func reorderSidebar(c *app.RequestContext, load sidebarLoader) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	s, ok := load(c, user.ID)
+	if !ok {
+		return
+	}
+	var moves []internal.SidebarItemOrder
+	if err := json.Unmarshal(c.Request.Body(), &moves); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if err := internal.ReorderSidebarItems(db, s.ID, moves); err != nil {
+		hlog.Errorf("reorderSidebar: ReorderSidebarItems failed, sidebarID=%d, error=%v", s.ID, err)
+		respondSidebarError(c, err)
+		return
+	}
+	getSidebar(c, load)
+}
+
+// GetProjectSidebar @Summary Get project sidebar
+// @Description Get the project's sidebar. Items are ordered by parent and order; items pointing at pages, boards or lists the viewer cannot read are left out together with everything nested below them.
+// @Tags sidebar
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {object} internal.Sidebar
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/sidebar [get]
+func GetProjectSidebar(ctx context.Context, c *app.RequestContext) {
+	getSidebar(c, loadProjectSidebar)
+}
+
+// CreateProjectSidebarItem @Summary Create project sidebar item
+// @Description Add an item to the project's sidebar. target_type is page, board, list (with target_id) or url (with url, http(s) or a path starting with /). parent_id nests the item under another item of the sidebar.
+// @Tags sidebar
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param item body internal.SidebarItem true "Sidebar item"
+// @Success 201 {object} internal.SidebarItem
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/sidebar/items [post]
+func CreateProjectSidebarItem(ctx context.Context, c *app.RequestContext) {
+	createSidebarItem(c, loadProjectSidebar)
+}
+
+// UpdateProjectSidebarItem @Summary Update project sidebar item
+// @Description Update an item of the project's sidebar. Omitted fields keep their values.
+// @Tags sidebar
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param itemId path int true "Sidebar Item ID"
+// @Param item body internal.SidebarItem true "Sidebar item"
+// @Success 200 {object} internal.SidebarItem
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/sidebar/items/{itemId} [put]
+func UpdateProjectSidebarItem(ctx context.Context, c *app.RequestContext) {
+	updateSidebarItem(c, loadProjectSidebar)
+}
+
+// DeleteProjectSidebarItem @Summary Delete project sidebar item
+// @Description Delete an item of the project's sidebar and the items nested below it
+// @Tags sidebar
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param itemId path int true "Sidebar Item ID"
+// @Success 200 {object} internal.SuccessResponse
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/sidebar/items/{itemId} [delete]
+func DeleteProjectSidebarItem(ctx context.Context, c *app.RequestContext) {
+	deleteSidebarItem(c, loadProjectSidebar)
+}
+
+// ReorderProjectSidebar @Summary Reorder project sidebar
+// @Description Set the parent and order of several items of the project's sidebar at once. Either all changes are applied or none. Returns the sidebar.
+// @Tags sidebar
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param order body []internal.SidebarItemOrder true "New positions"
+// @Success 200 {object} internal.Sidebar
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/sidebar/order [put]
+func ReorderProjectSidebar(ctx context.Context, c *app.RequestContext) {
+	reorderSidebar(c, loadProjectSidebar)
+}
+
+// GetUserSidebar @Summary Get user sidebar
+// @Description Get the logged-in user's personal sidebar. Items are ordered by parent and order; items pointing at pages, boards or lists the viewer cannot read are left out together with everything nested below them.
+// @Tags sidebar
+// @Accept json
+// @Produce json
+// @Success 200 {object} internal.Sidebar
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/user/sidebar [get]
+func GetUserSidebar(ctx context.Context, c *app.RequestContext) {
+	getSidebar(c, loadUserSidebar)
+}
+
+// CreateUserSidebarItem @Summary Create user sidebar item
+// @Description Add an item to the logged-in user's personal sidebar. target_type is page, board, list (with target_id) or url (with url, http(s) or a path starting with /). parent_id nests the item under another item of the sidebar.
+// @Tags sidebar
+// @Accept json
+// @Produce json
+// @Param item body internal.SidebarItem true "Sidebar item"
+// @Success 201 {object} internal.SidebarItem
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/user/sidebar/items [post]
+func CreateUserSidebarItem(ctx context.Context, c *app.RequestContext) {
+	createSidebarItem(c, loadUserSidebar)
+}
+
+// UpdateUserSidebarItem @Summary Update user sidebar item
+// @Description Update an item of the logged-in user's personal sidebar. Omitted fields keep their values.
+// @Tags sidebar
+// @Accept json
+// @Produce json
+// @Param itemId path int true "Sidebar Item ID"
+// @Param item body internal.SidebarItem true "Sidebar item"
+// @Success 200 {object} internal.SidebarItem
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/user/sidebar/items/{itemId} [put]
+func UpdateUserSidebarItem(ctx context.Context, c *app.RequestContext) {
+	updateSidebarItem(c, loadUserSidebar)
+}
+
+// DeleteUserSidebarItem @Summary Delete user sidebar item
+// @Description Delete an item of the logged-in user's personal sidebar and the items nested below it
+// @Tags sidebar
+// @Accept json
+// @Produce json
+// @Param itemId path int true "Sidebar Item ID"
+// @Success 200 {object} internal.SuccessResponse
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/user/sidebar/items/{itemId} [delete]
+func DeleteUserSidebarItem(ctx context.Context, c *app.RequestContext) {
+	deleteSidebarItem(c, loadUserSidebar)
+}
+
+// ReorderUserSidebar @Summary Reorder user sidebar
+// @Description Set the parent and order of several items of the logged-in user's personal sidebar at once. Either all changes are applied or none. Returns the sidebar.
+// @Tags sidebar
+// @Accept json
+// @Produce json
+// @Param order body []internal.SidebarItemOrder true "New positions"
+// @Success 200 {object} internal.Sidebar
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/user/sidebar/order [put]
+func ReorderUserSidebar(ctx context.Context, c *app.RequestContext) {
+	reorderSidebar(c, loadUserSidebar)
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"liteboard/auth"
+	"liteboard/internal"
+	"strconv"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func RegisterSyncRoutes(r *route.RouterGroup) {
+	r.GET("/sync", Sync)
+}
+
+// Sync @Summary Delta sync
+// @Description Return the creates, updates and deletes of projects, content lists, content entries and the caller's own detail permissions after the since cursor, oldest first. Each object appears once per page with its current state; objects the caller could read that were deleted or whose permission was revoked, including by a move, are tombstones (op=delete); objects the caller never could read are left out. Pass the returned cursor as since to fetch the next page while has_more is true. full_resync is set when since is 0, older than the retained change log (30 days) or unknown, and when the caller's project access changed; the client then reloads everything through the regular endpoints and continues from the returned cursor.
+// @Tags sync
+// @Accept json
+// @Produce json
+// @Param since query int false "Cursor returned by the previous sync; 0 or omitted requests a full resync"
+// @Param limit query int false "Maximum number of changes per page (default 500, max 1000)"
+// @Success 200 {object} internal.SyncPage
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/sync [get]
+func Sync(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	var since int64
+	if s := c.Query("since"); s != "" {
+		var err error
+		since, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || since < 0 {
+			c.JSON(400, internal.NewErrorResponse("invalid since"))
+			return
+		}
+	}
+	limit := internal.DefaultSyncLimit
+	if s := c.Query("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > internal.MaxSyncLimit {
+			c.JSON(400, internal.NewErrorResponse("limit must be between 1 and "+strconv.Itoa(internal.MaxSyncLimit)))
+			return
+		}
+	}
+
+	page, err := internal.GetChanges(db, user.ID, since, limit)
+	if err != nil {
+		hlog.Errorf("Sync: GetChanges failed, userID=%d, since=%d, error=%v", user.ID, since, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, page)
+}
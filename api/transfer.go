@@ -0,0 +1,265 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"liteboard/auth"
+	"liteboard/internal"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func RegisterTransferRoutes(r *route.RouterGroup) {
+	r.POST("/content_entries/:id/copy", auth.PermissionCheckMiddleware("content_entry", "read", GetIDFromParam), CopyContentEntry)
+	r.POST("/content_entries/:id/move", auth.PermissionCheckMiddleware("content_entry", "write", GetIDFromParam), MoveContentEntry)
+	r.POST("/content_lists/:id/move", auth.PermissionCheckMiddleware("content_list", "write", GetIDFromParam), MoveContentList)
+}
+
+// TransferEntryRequest is the body for copying or moving an entry
+type TransferEntryRequest struct {
+	TargetListID     int64  `json:"target_list_id"`
+	Position         *int   `json:"position"`          // 插入位置，省略时追加到末尾
+	PermissionPolicy string `json:"permission_policy"` // keep、destination 或 owner，默认 keep
+}
+
+// MoveListRequest is the body for moving a list to another project
+type MoveListRequest struct {
+	TargetProjectID  int64  `json:"target_project_id"`
+	PermissionPolicy string `json:"permission_policy"` // keep、destination 或 owner，默认 keep
+}
+
+// respondTransferError 将无效的复制/移动请求映射为 400，缺少内容权限映射为 403，其余为 500
+func respondTransferError(c *app.RequestContext, err error) {
+	if errors.Is(err, internal.ErrInvalidTransfer) {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if errors.Is(err, internal.ErrTransferForbidden) {
+		c.JSON(403, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(500, internal.NewErrorResponse(err.Error()))
+}
+
+// bindTransferEntryRequest 解析请求并检查目标列表：调用者需要目标项目的写权限，且条目需满足目标列表的策略。
+// 返回 false 表示已写出错误响应
+func bindTransferEntryRequest(c *app.RequestContext, userID int64, ce *internal.ContentEntry, caller string) (*TransferEntryRequest, bool) {
+	var req TransferEntryRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return nil, false
+	}
+	policy, err := internal.ValidatePermissionPolicy(req.PermissionPolicy)
+	if err != nil {
+		respondTransferError(c, err)
+		return nil, false
+	}
+	req.PermissionPolicy = policy
+	if req.Position == nil {
+		end := -1
+		req.Position = &end
+	}
+	target, err := internal.GetContentList(db, req.TargetListID)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse("target list not found"))
+		return nil, false
+	}
+	canWrite, err := internal.HasPermission(db, userID, "project", target.ProjectID, "write")
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return nil, false
+	}
+	if !canWrite {
+		c.JSON(403, internal.NewErrorResponse("write permission on the target project is required"))
+		return nil, false
+	}
+	if containsEntry(target, ce.ID) {
+		// 同一列表内调整顺序不改变条目数
+		return &req, true
+	}
+	policyErr := internal.CheckListPolicy(db, target, []internal.ContentEntry{*ce}, len(target.Items), len(target.Items)+1, userID)
+	if !enforceListPolicy(c, userID, target, policyErr, caller) {
+		return nil, false
+	}
+	return &req, true
+}
+
+func containsEntry(cl *internal.ContentList, entryID int64) bool {
+	for _, id := range cl.Items {
+		if id == entryID {
+			return true
+		}
+	}
+	return false
+}
+
+// CopyContentEntry @Summary Copy content entry
+// @Description Copy an entry into a list, possibly in another project. Labels and custom field values are mapped to those of the same name in the destination; attachments are shared; comments and relations are not copied. Requires read on the entry and write on the destination project. permission_policy (keep, destination, owner) decides who else gets access to the copy.
+// @Tags content
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Param force query bool false "Admins only: copy even if the target list policy is violated"
+// @Param request body TransferEntryRequest true "Copy target"
+// @Success 201 {object} internal.ContentEntry
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/copy [post]
+func CopyContentEntry(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	id, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	ce, err := internal.GetContentEntry(db, id)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	req, ok := bindTransferEntryRequest(c, user.ID, ce, "CopyContentEntry")
+	if !ok {
+		return
+	}
+	newID, err := internal.CopyContentEntry(db, id, req.TargetListID, *req.Position, user.ID, req.PermissionPolicy)
+	if err != nil {
+		hlog.Errorf("CopyContentEntry: CopyContentEntry failed, entryID=%d, targetListID=%d, error=%v", id, req.TargetListID, err)
+		respondTransferError(c, err)
+		return
+	}
+	copied, err := internal.GetContentEntry(db, newID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(201, copied)
+}
+
+// MoveContentEntry @Summary Move content entry
+// @Description Move an entry to a position in a list, possibly in another project, keeping its ID and history. Both parent lists are updated together. Across projects the project is rewritten, labels and custom field values are mapped by name, assignees without access are dropped and detail permissions follow permission_policy (keep, destination, owner). Requires write on the entry and on the destination project.
+// @Tags content
+// @Accept json
+// @Produce json
+// @Param id path int true "Content Entry ID"
+// @Param force query bool false "Admins only: move even if the target list policy is violated"
+// @Param request body TransferEntryRequest true "Move target"
+// @Success 200 {object} internal.ContentEntry
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 409 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_entries/{id}/move [post]
+func MoveContentEntry(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	id, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	ce, err := internal.GetContentEntry(db, id)
+	if err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	req, ok := bindTransferEntryRequest(c, user.ID, ce, "MoveContentEntry")
+	if !ok {
+		return
+	}
+	if err := internal.MoveContentEntry(db, id, req.TargetListID, *req.Position, user.ID, req.PermissionPolicy); err != nil {
+		hlog.Errorf("MoveContentEntry: MoveContentEntry failed, entryID=%d, targetListID=%d, error=%v", id, req.TargetListID, err)
+		respondTransferError(c, err)
+		return
+	}
+	moved, err := internal.GetContentEntry(db, id)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	notifyEntryChanged(user, moved, "moved")
+	emitWebhook(moved.ProjectID, internal.WebhookEntryMoved, user.ID, moved)
+	if ce.ProjectID != moved.ProjectID {
+		// 移到其他项目时，原项目也会收到事件
+		emitWebhook(ce.ProjectID, internal.WebhookEntryMoved, user.ID, moved)
+	}
+	c.JSON(200, moved)
+}
+
+// MoveContentList @Summary Move content list to another project
+// @Description Move a list with all of its entries to another project. Entries are rewritten as in the entry move; the list's and entries' detail permissions follow permission_policy (keep, destination, owner). Requires write on the list, on each of its entries and on the destination project; the response lists the entries that fail.
+// @Tags content
+// @Accept json
+// @Produce json
+// @Param id path int true "Content List ID"
+// @Param request body MoveListRequest true "Move target"
+// @Success 200 {object} internal.ContentList
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/content_lists/{id}/move [post]
+func MoveContentList(ctx context.Context, c *app.RequestContext) {
+	user := auth.GetUserFromSession(c)
+	if user == nil {
+		c.JSON(401, internal.NewErrorResponse("not logged in"))
+		return
+	}
+	id, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid id"))
+		return
+	}
+	var req MoveListRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	policy, err := internal.ValidatePermissionPolicy(req.PermissionPolicy)
+	if err != nil {
+		respondTransferError(c, err)
+		return
+	}
+	if _, err := internal.GetContentList(db, id); err != nil {
+		c.JSON(404, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	canWrite, err := internal.HasPermission(db, user.ID, "project", req.TargetProjectID, "write")
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if !canWrite {
+		c.JSON(403, internal.NewErrorResponse("write permission on the target project is required"))
+		return
+	}
+	if err := internal.MoveContentList(db, id, req.TargetProjectID, user.ID, policy); err != nil {
+		hlog.Errorf("MoveContentList: MoveContentList failed, listID=%d, targetProjectID=%d, error=%v", id, req.TargetProjectID, err)
+		respondTransferError(c, err)
+		return
+	}
+	cl, err := internal.GetContentList(db, id)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, cl)
+}
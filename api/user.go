@@ -23,16 +23,23 @@ func RegisterUserRoutes(r *route.RouterGroup) {
 // @Tags users
 // @Accept json
 // @Produce json
+// @Param updated_since query int false "Only users changed at or after this Unix timestamp"
 // @Success 200 {array} internal.User
+// @Failure 400 {object} internal.ErrorResponse
 // @Failure 500 {object} internal.ErrorResponse
 // @Router /api/users [get]
 func GetUsers(ctx context.Context, c *app.RequestContext) {
+	since, err := parseUpdatedSince(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
 	users, err := internal.GetUsers(db)
 	if err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
 		return
 	}
-	c.JSON(200, users)
+	c.JSON(200, internal.UpdatedSince(users, since))
 }
 
 // CreateUser @Summary Create user
@@ -52,6 +59,7 @@ func CreateUser(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 	u.Groups = []string{"user"}
+	u.UpdatedBy = actorID(c)
 	id, err := internal.CreateUser(db, &u)
 	if err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
@@ -115,6 +123,7 @@ func UpdateUser(ctx context.Context, c *app.RequestContext) {
 		c.JSON(400, internal.NewErrorResponse(err.Error()))
 		return
 	}
+	u.UpdatedBy = actorID(c)
 	err = internal.UpdateUser(db, id, &u)
 	if err != nil {
 		c.JSON(500, internal.NewErrorResponse(err.Error()))
@@ -0,0 +1,348 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"liteboard/auth"
+	"liteboard/internal"
+	"strconv"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+// webhookWake 在有新投递时唤醒后台 worker，容量为 1，多次唤醒合并为一次
+var webhookWake = make(chan struct{}, 1)
+
+// StartWebhookWorker 在后台发送 webhook 投递，新事件立即发送，失败的按退避时间每 interval 检查一次
+func StartWebhookWorker(interval time.Duration) {
+	client := internal.NewWebhookClient(10 * time.Second)
+	go internal.RunWebhookWorker(context.Background(), db, client, interval, webhookWake)
+}
+
+func RegisterWebhookRoutes(r *route.RouterGroup) {
+	r.GET("/projects/:id/webhooks", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), GetProjectWebhooks)
+	r.POST("/projects/:id/webhooks", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), CreateWebhook)
+	r.PUT("/projects/:id/webhooks/:webhookId", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), UpdateWebhook)
+	r.DELETE("/projects/:id/webhooks/:webhookId", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), DeleteWebhook)
+	r.GET("/projects/:id/webhooks/:webhookId/deliveries", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), GetWebhookDeliveries)
+	r.POST("/projects/:id/webhooks/:webhookId/deliveries/:deliveryId/redeliver", auth.PermissionCheckMiddleware("project", "admin", GetIDFromParam), RedeliverWebhookDelivery)
+}
+
+// WebhookRequest is the body of webhook create and update requests. On update, fields left out
+// keep their value.
+type WebhookRequest struct {
+	URL    *string  `json:"url"`
+	Secret *string  `json:"secret"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// emitWebhook 为项目的 webhook 排队事件并唤醒 worker；失败只记录日志，不影响触发事件的请求
+func emitWebhook(projectID int64, event string, actorID int64, data interface{}) {
+	if projectID == 0 {
+		return
+	}
+	queued, err := internal.QueueWebhookEvent(db, projectID, event, actorID, data)
+	if err != nil {
+		hlog.Errorf("emitWebhook: QueueWebhookEvent failed, projectID=%d, event=%s, error=%v", projectID, event, err)
+	}
+	if queued > 0 {
+		wakeWebhookWorker()
+	}
+}
+
+func wakeWebhookWorker() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// emitDetailPermissionWebhooks 为项目类型的权限记录逐个项目发送权限变更事件
+func emitDetailPermissionWebhooks(dp *internal.DetailPermission, event string, actorID int64) {
+	if dp.ContentType != "project" {
+		return
+	}
+	level := dp.Action
+	if event == internal.WebhookPermissionRevoked {
+		level = ""
+	}
+	for _, projectID := range dp.ContentIDs {
+		emitPermissionWebhook(projectID, event, actorID, dp.UserID, level)
+	}
+}
+
+// emitPermissionWebhook 发送项目权限变更事件
+func emitPermissionWebhook(projectID int64, event string, actorID int64, userID int64, level string) {
+	emitWebhook(projectID, event, actorID, map[string]interface{}{
+		"user_id":          userID,
+		"permission_level": level,
+	})
+}
+
+// getWebhookInProject 读取路径中的 webhook，并确认其属于指定项目
+func getWebhookInProject(c *app.RequestContext, projectID int64) (*internal.Webhook, bool) {
+	webhookID, err := strconv.ParseInt(c.Param("webhookId"), 10, 64)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid webhook id"))
+		return nil, false
+	}
+	w, err := internal.GetWebhook(db, webhookID)
+	if err != nil || w.ProjectID != projectID {
+		c.JSON(404, internal.NewErrorResponse("webhook not found"))
+		return nil, false
+	}
+	return w, true
+}
+
+// respondWebhookError 将 webhook 校验错误映射为 400，其余为 500
+func respondWebhookError(c *app.RequestContext, err error) {
+	if errors.Is(err, internal.ErrInvalidWebhook) {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(500, internal.NewErrorResponse(err.Error()))
+}
+
+// GetProjectWebhooks @Summary Get project webhooks
+// @Description List the webhooks of a project. Secrets are not returned.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {array} internal.Webhook
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/webhooks [get]
+func GetProjectWebhooks(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	webhooks, err := internal.GetWebhooks(db, projectID)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, webhooks)
+}
+
+// CreateWebhook @Summary Create webhook
+// @Description Register a URL that receives the project's events as JSON POSTs. Each delivery is signed in the X-Liteboard-Signature header with sha256= and the hex HMAC-SHA256 of the body keyed with the secret. events filters by name (e.g. entry.created) or prefix (entry.*); empty means all events. Failed deliveries are retried with exponential backoff.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param webhook body WebhookRequest true "Webhook"
+// @Success 201 {object} internal.Webhook
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/webhooks [post]
+func CreateWebhook(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	var req WebhookRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	w := internal.Webhook{ProjectID: projectID, Events: req.Events, Active: true, CreatorID: actorID(c)}
+	if req.URL != nil {
+		w.URL = *req.URL
+	}
+	if req.Secret != nil {
+		w.Secret = *req.Secret
+	}
+	if req.Active != nil {
+		w.Active = *req.Active
+	}
+	if _, err := internal.CreateWebhook(db, &w); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+	c.JSON(201, w)
+}
+
+// UpdateWebhook @Summary Update webhook
+// @Description Change the URL, secret, event filter or active flag of a webhook
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param webhookId path int true "Webhook ID"
+// @Param webhook body WebhookRequest true "Fields to change"
+// @Success 200 {object} internal.Webhook
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/webhooks/{webhookId} [put]
+func UpdateWebhook(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	w, ok := getWebhookInProject(c, projectID)
+	if !ok {
+		return
+	}
+	var req WebhookRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	if req.URL != nil {
+		w.URL = *req.URL
+	}
+	if req.Secret != nil {
+		w.Secret = *req.Secret
+	}
+	if req.Events != nil {
+		w.Events = req.Events
+	}
+	if req.Active != nil {
+		w.Active = *req.Active
+	}
+	if err := internal.UpdateWebhook(db, w.ID, w); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+	c.JSON(200, w)
+}
+
+// DeleteWebhook @Summary Delete webhook
+// @Description Delete a webhook and its delivery log
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param webhookId path int true "Webhook ID"
+// @Success 200 {object} internal.SuccessResponse
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/webhooks/{webhookId} [delete]
+func DeleteWebhook(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	w, ok := getWebhookInProject(c, projectID)
+	if !ok {
+		return
+	}
+	if err := internal.DeleteWebhook(db, w.ID); err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, internal.NewSuccessResponse("webhook deleted"))
+}
+
+// GetWebhookDeliveries @Summary Get webhook deliveries
+// @Description The delivery log of a webhook, newest first, with status, attempts and the last response code and body
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param webhookId path int true "Webhook ID"
+// @Param limit query int false "Maximum number of deliveries to return"
+// @Success 200 {array} internal.WebhookDelivery
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/webhooks/{webhookId}/deliveries [get]
+func GetWebhookDeliveries(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	w, ok := getWebhookInProject(c, projectID)
+	if !ok {
+		return
+	}
+	limit := 0
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			c.JSON(400, internal.NewErrorResponse("invalid limit"))
+			return
+		}
+		limit = n
+	}
+	deliveries, err := internal.GetWebhookDeliveries(db, w.ID, limit)
+	if err != nil {
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(200, deliveries)
+}
+
+// RedeliverWebhookDelivery @Summary Redeliver webhook delivery
+// @Description Send the payload of an earlier delivery again. The redelivery is logged as a new delivery.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param webhookId path int true "Webhook ID"
+// @Param deliveryId path int true "Delivery ID"
+// @Success 202 {object} internal.WebhookDelivery
+// @Failure 400 {object} internal.ErrorResponse
+// @Failure 401 {object} internal.ErrorResponse
+// @Failure 403 {object} internal.ErrorResponse
+// @Failure 404 {object} internal.ErrorResponse
+// @Failure 500 {object} internal.ErrorResponse
+// @Security Session
+// @Router /api/projects/{id}/webhooks/{webhookId}/deliveries/{deliveryId}/redeliver [post]
+func RedeliverWebhookDelivery(ctx context.Context, c *app.RequestContext) {
+	projectID, err := GetIDFromParam(c)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid project id"))
+		return
+	}
+	w, ok := getWebhookInProject(c, projectID)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.ParseInt(c.Param("deliveryId"), 10, 64)
+	if err != nil {
+		c.JSON(400, internal.NewErrorResponse("invalid delivery id"))
+		return
+	}
+	d, err := internal.GetWebhookDelivery(db, deliveryID)
+	if err != nil || d.WebhookID != w.ID {
+		c.JSON(404, internal.NewErrorResponse("delivery not found"))
+		return
+	}
+	redelivery, err := internal.RedeliverWebhookDelivery(db, d.ID)
+	if err != nil {
+		hlog.Errorf("RedeliverWebhookDelivery: RedeliverWebhookDelivery failed, deliveryID=%d, error=%v", d.ID, err)
+		c.JSON(500, internal.NewErrorResponse(err.Error()))
+		return
+	}
+	wakeWebhookWorker()
+	c.JSON(202, redelivery)
+}
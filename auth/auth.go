@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"strconv"
+	"time"
 
 	"liteboard/internal"
 
@@ -207,7 +208,9 @@ func GetUserInternalByID(id int64) (*UserInternal, error) {
 }
 
 func CreateUserInternal(ui *UserInternal) (int64, error) {
-	cond := dbhelper.Cond().Eq("username", ui.Username).Eq("email", ui.Email).Eq("openid", ui.OpenID).Eq("password_hash", ui.PasswordHash).Build()
+	now := time.Now().Unix()
+	cond := dbhelper.Cond().Eq("username", ui.Username).Eq("email", ui.Email).Eq("openid", ui.OpenID).Eq("password_hash", ui.PasswordHash).
+		Eq("created_at", now).Eq("updated_at", now).Build()
 	return db.Insert("user", cond)
 }
 
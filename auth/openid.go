@@ -8,6 +8,8 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Kaguya154/dbhelper"
 	"github.com/cloudwego/hertz/pkg/app"
@@ -20,8 +22,19 @@ var (
 	githubClientID     string
 	githubClientSecret string
 	githubRedirectURI  string
+
+	// loginHook 在用户登录成功后调用，参数为用户和 GitHub 上已验证的邮箱
+	loginHook func(user *User, verifiedEmails []string)
 )
 
+// ReturnToSessionKey 保存登录后要跳转的站内地址
+const ReturnToSessionKey = "return_to"
+
+// SetLoginHook 设置登录成功后的回调，例如按邮箱接受邀请
+func SetLoginHook(hook func(user *User, verifiedEmails []string)) {
+	loginHook = hook
+}
+
 func init() {
 	err := godotenv.Load(".env")
 	if err != nil {
@@ -148,8 +161,16 @@ func GitHubCallbackHandler(ctx context.Context, c *app.RequestContext) {
 
 	user := NewUserFromInternal(userInternal)
 	hlog.Debugf("User logged in: ID=%d, Username=%s, Groups=%v", user.ID, user.Username, user.Groups)
+	if loginHook != nil {
+		loginHook(user, fetchVerifiedEmails(client, accessToken))
+	}
 	session := sessions.Default(c)
 	session.Set("user", user)
+	redirect := "/dashboard"
+	if returnTo, ok := session.Get(ReturnToSessionKey).(string); ok && strings.HasPrefix(returnTo, "/") && !strings.HasPrefix(returnTo, "//") {
+		redirect = returnTo
+	}
+	session.Delete(ReturnToSessionKey)
 	err = session.Save()
 	if err != nil {
 		hlog.Errorf("Failed to save session: %v", err)
@@ -157,7 +178,41 @@ func GitHubCallbackHandler(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	c.Redirect(302, []byte("/dashboard")) // Redirect to home
+	c.Redirect(302, []byte(redirect)) // Redirect to home
+}
+
+// fetchVerifiedEmails 返回 GitHub 账号下已验证的邮箱（需要 user:email 权限），失败时返回空
+func fetchVerifiedEmails(client *http.Client, accessToken string) []string {
+	req, err := http.NewRequest("GET", "https://api.github.com/user/emails", nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("Authorization", "token "+accessToken)
+	resp, err := client.Do(req)
+	if err != nil {
+		hlog.Errorf("Failed to get user emails: %v", err)
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		hlog.Errorf("Failed to get user emails, status: %d", resp.StatusCode)
+		return nil
+	}
+	var emails []struct {
+		Email    string `json:"email"`
+		Verified bool   `json:"verified"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
+		hlog.Errorf("Failed to parse user emails: %v", err)
+		return nil
+	}
+	verified := make([]string, 0, len(emails))
+	for _, e := range emails {
+		if e.Verified {
+			verified = append(verified, e.Email)
+		}
+	}
+	return verified
 }
 
 func CreateUserInternalIfNotExist(openid, username, email, avatarURL string, groups []string) (*UserInternal, error) {
@@ -178,7 +233,7 @@ func CreateUserInternalIfNotExist(openid, username, email, avatarURL string, gro
 		}
 
 		cond := dbhelper.Cond().Eq("id", u.ID).Build()
-		upd := dbhelper.Cond().Eq("groups", string(groupsJson)).Eq("avatar_url", avatarURL).Build()
+		upd := dbhelper.Cond().Eq("groups", string(groupsJson)).Eq("avatar_url", avatarURL).Eq("updated_at", time.Now().Unix()).Build()
 		_, err = db.Update("user", cond, upd)
 		if err != nil {
 			hlog.Errorf("Failed to update user groups: %v", err)
@@ -210,6 +265,8 @@ func CreateUserInternalIfNotExist(openid, username, email, avatarURL string, gro
 		Eq("password_hash", "").
 		Eq("groups", string(groupsJson)).
 		Eq("avatar_url", avatarURL).
+		Eq("created_at", time.Now().Unix()).
+		Eq("updated_at", time.Now().Unix()).
 		Build()
 
 	id, err := db.Insert("user", cond)
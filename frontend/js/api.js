@@ -55,13 +55,25 @@ const API = {
             return API.request(`/api/projects/${id}`);
         },
 
-        async create(projectData) {
-            return API.request('/api/projects', {
+        async getTemplates() {
+            return API.request('/api/projects?templates=true');
+        },
+
+        async create(projectData, templateId) {
+            const query = templateId ? `?template_id=${templateId}` : '';
+            return API.request(`/api/projects${query}`, {
                 method: 'POST',
                 body: JSON.stringify(projectData),
             });
         },
 
+        async clone(id, options) {
+            return API.request(`/api/projects/${id}/clone`, {
+                method: 'POST',
+                body: JSON.stringify(options || {}),
+            });
+        },
+
         async update(id, projectData) {
             return API.request(`/api/projects/${id}`, {
                 method: 'PUT',
@@ -107,6 +119,18 @@ const API = {
                 method: 'DELETE',
             });
         },
+
+        async archive(id) {
+            return API.request(`/api/content_lists/${id}/archive`, {
+                method: 'POST',
+            });
+        },
+
+        async unarchive(id) {
+            return API.request(`/api/content_lists/${id}/unarchive`, {
+                method: 'POST',
+            });
+        },
     },
 
     /**
@@ -118,11 +142,12 @@ const API = {
         },
 
         async getById(id) {
-            return API.request(`/api/content_entries/${id}`);
+            return API.request(`/api/content_entries/${id}?render=html`);
         },
 
-        async create(entryData) {
-            return API.request('/api/content_entries', {
+        async create(entryData, listId) {
+            const query = listId ? `?list_id=${listId}` : '';
+            return API.request(`/api/content_entries${query}`, {
                 method: 'POST',
                 body: JSON.stringify(entryData),
             });
@@ -135,6 +160,32 @@ const API = {
             });
         },
 
+        async move(id, target) {
+            return API.request(`/api/content_entries/${id}/move`, {
+                method: 'POST',
+                body: JSON.stringify(target),
+            });
+        },
+
+        async copy(id, target) {
+            return API.request(`/api/content_entries/${id}/copy`, {
+                method: 'POST',
+                body: JSON.stringify(target),
+            });
+        },
+
+        async archive(id) {
+            return API.request(`/api/content_entries/${id}/archive`, {
+                method: 'POST',
+            });
+        },
+
+        async unarchive(id) {
+            return API.request(`/api/content_entries/${id}/unarchive`, {
+                method: 'POST',
+            });
+        },
+
         async delete(id) {
             return API.request(`/api/content_entries/${id}`, {
                 method: 'DELETE',
@@ -188,6 +239,151 @@ const API = {
         },
     },
 
+    /**
+     * Wiki Page API
+     */
+    pages: {
+        async getByProject(projectId) {
+            return API.request(`/api/projects/${projectId}/pages`);
+        },
+
+        async getTree(projectId) {
+            return API.request(`/api/projects/${projectId}/pages/tree`);
+        },
+
+        async get(projectId, pageId) {
+            return API.request(`/api/projects/${projectId}/pages/${pageId}?render=html`);
+        },
+
+        async create(projectId, data) {
+            return API.request(`/api/projects/${projectId}/pages`, {
+                method: 'POST',
+                body: JSON.stringify(data),
+            });
+        },
+
+        async update(projectId, pageId, data) {
+            return API.request(`/api/projects/${projectId}/pages/${pageId}`, {
+                method: 'PUT',
+                body: JSON.stringify(data),
+            });
+        },
+
+        async delete(projectId, pageId) {
+            return API.request(`/api/projects/${projectId}/pages/${pageId}`, {
+                method: 'DELETE',
+            });
+        },
+
+        async getBacklinks(projectId, pageId) {
+            return API.request(`/api/projects/${projectId}/pages/${pageId}/backlinks`);
+        },
+    },
+
+    /**
+     * Sidebar API. Pass a project ID for the project sidebar, or null for the personal one.
+     */
+    sidebar: {
+        base(projectId) {
+            return projectId ? `/api/projects/${projectId}/sidebar` : '/api/user/sidebar';
+        },
+
+        async get(projectId) {
+            return API.request(API.sidebar.base(projectId));
+        },
+
+        async createItem(projectId, data) {
+            return API.request(`${API.sidebar.base(projectId)}/items`, {
+                method: 'POST',
+                body: JSON.stringify(data),
+            });
+        },
+
+        async updateItem(projectId, itemId, data) {
+            return API.request(`${API.sidebar.base(projectId)}/items/${itemId}`, {
+                method: 'PUT',
+                body: JSON.stringify(data),
+            });
+        },
+
+        async deleteItem(projectId, itemId) {
+            return API.request(`${API.sidebar.base(projectId)}/items/${itemId}`, {
+                method: 'DELETE',
+            });
+        },
+
+        async reorder(projectId, order) {
+            return API.request(`${API.sidebar.base(projectId)}/order`, {
+                method: 'PUT',
+                body: JSON.stringify(order),
+            });
+        },
+    },
+
+    /**
+     * Batch API
+     */
+    batch: {
+        async run(operations) {
+            return API.request('/api/batch', {
+                method: 'POST',
+                body: JSON.stringify({ operations }),
+            });
+        },
+    },
+
+    /**
+     * Sync API
+     */
+    sync: {
+        async changes(since = 0, limit = 500) {
+            return API.request(`/api/sync?since=${since}&limit=${limit}`);
+        },
+    },
+
+    /**
+     * Notification API
+     */
+    notifications: {
+        async list(unreadOnly = false) {
+            return API.request(`/api/notifications${unreadOnly ? '?unread=true' : ''}`);
+        },
+
+        async markRead(id) {
+            return API.request(`/api/notifications/${id}/read`, {
+                method: 'POST',
+            });
+        },
+
+        async markAllRead() {
+            return API.request('/api/notifications/read_all', {
+                method: 'POST',
+            });
+        },
+
+        async getPreferences() {
+            return API.request('/api/notifications/preferences');
+        },
+
+        async updatePreferences(prefs) {
+            return API.request('/api/notifications/preferences', {
+                method: 'PUT',
+                body: JSON.stringify(prefs),
+            });
+        },
+
+        async getEmailPreferences() {
+            return API.request('/api/notifications/email');
+        },
+
+        async updateEmailPreferences(prefs) {
+            return API.request('/api/notifications/email', {
+                method: 'PUT',
+                body: JSON.stringify(prefs),
+            });
+        },
+    },
+
     /**
      * Share Token API
      */
@@ -218,4 +414,162 @@ const API = {
             });
         },
     },
+
+    /**
+     * Invitation API
+     */
+    invitations: {
+        async list(projectId) {
+            return API.request(`/api/projects/${projectId}/invitations`);
+        },
+
+        async create(projectId, email, permissionLevel) {
+            return API.request(`/api/projects/${projectId}/invitations`, {
+                method: 'POST',
+                body: JSON.stringify({
+                    email: email,
+                    permission_level: permissionLevel,
+                }),
+            });
+        },
+
+        async resend(projectId, invitationId) {
+            return API.request(`/api/projects/${projectId}/invitations/${invitationId}/resend`, {
+                method: 'POST',
+            });
+        },
+
+        async revoke(projectId, invitationId) {
+            return API.request(`/api/projects/${projectId}/invitations/${invitationId}`, {
+                method: 'DELETE',
+            });
+        },
+    },
+
+    /**
+     * Webhook API
+     */
+    webhooks: {
+        async list(projectId) {
+            return API.request(`/api/projects/${projectId}/webhooks`);
+        },
+
+        async create(projectId, webhook) {
+            return API.request(`/api/projects/${projectId}/webhooks`, {
+                method: 'POST',
+                body: JSON.stringify(webhook),
+            });
+        },
+
+        async update(projectId, webhookId, webhook) {
+            return API.request(`/api/projects/${projectId}/webhooks/${webhookId}`, {
+                method: 'PUT',
+                body: JSON.stringify(webhook),
+            });
+        },
+
+        async delete(projectId, webhookId) {
+            return API.request(`/api/projects/${projectId}/webhooks/${webhookId}`, {
+                method: 'DELETE',
+            });
+        },
+
+        async deliveries(projectId, webhookId) {
+            return API.request(`/api/projects/${projectId}/webhooks/${webhookId}/deliveries`);
+        },
+
+        async redeliver(projectId, webhookId, deliveryId) {
+            return API.request(`/api/projects/${projectId}/webhooks/${webhookId}/deliveries/${deliveryId}/redeliver`, {
+                method: 'POST',
+            });
+        },
+    },
+
+    /**
+     * Incoming Webhook API
+     */
+    incomingWebhooks: {
+        async list(projectId) {
+            return API.request(`/api/projects/${projectId}/incoming_webhooks`);
+        },
+
+        async create(projectId, webhook) {
+            return API.request(`/api/projects/${projectId}/incoming_webhooks`, {
+                method: 'POST',
+                body: JSON.stringify(webhook),
+            });
+        },
+
+        async update(projectId, hookId, webhook) {
+            return API.request(`/api/projects/${projectId}/incoming_webhooks/${hookId}`, {
+                method: 'PUT',
+                body: JSON.stringify(webhook),
+            });
+        },
+
+        async delete(projectId, hookId) {
+            return API.request(`/api/projects/${projectId}/incoming_webhooks/${hookId}`, {
+                method: 'DELETE',
+            });
+        },
+
+        async rotateToken(projectId, hookId) {
+            return API.request(`/api/projects/${projectId}/incoming_webhooks/${hookId}/rotate_token`, {
+                method: 'POST',
+            });
+        },
+    },
+
+    /**
+     * Import API
+     */
+    import: {
+        async trello(board) {
+            return API.request('/api/import/trello', {
+                method: 'POST',
+                body: typeof board === 'string' ? board : JSON.stringify(board),
+            });
+        },
+
+        exportCsvUrl(projectId) {
+            return `/api/projects/${projectId}/export.csv`;
+        },
+
+        async csv(projectId, csvText, options = {}) {
+            const params = new URLSearchParams();
+            if (options.dryRun) params.set('dry_run', 'true');
+            if (options.defaultList) params.set('default_list', options.defaultList);
+            for (const [field, column] of Object.entries(options.mapping || {})) {
+                params.set(`map_${field}`, column);
+            }
+            return API.request(`/api/projects/${projectId}/import.csv?${params}`, {
+                method: 'POST',
+                headers: { 'Content-Type': 'text/csv' },
+                body: csvText,
+            });
+        },
+
+        exportProjectUrl(projectId, format = 'zip') {
+            return `/api/projects/${projectId}/export?format=${format}`;
+        },
+
+        async project(file) {
+            return API.request('/api/projects/import', {
+                method: 'POST',
+                headers: { 'Content-Type': file.type || 'application/zip' },
+                body: file,
+            });
+        },
+    },
+
+    /**
+     * Admin API
+     */
+    admin: {
+        async backup() {
+            return API.request('/api/admin/backup', {
+                method: 'POST',
+            });
+        },
+    },
 };
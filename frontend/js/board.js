@@ -198,6 +198,7 @@ const Board = {
                            value="${this.escapeHtml(list.title)}" 
                            data-list-id="${list.id}"
                            readonly>
+                    <button class="btn-archive-list" data-list-id="${list.id}" title="Archive list">⌄</button>
                     <button class="btn-delete-list" data-list-id="${list.id}" title="Delete list">×</button>
                 </div>
                 <div class="list-cards" data-list-id="${list.id}">
@@ -218,7 +219,7 @@ const Board = {
                  data-card-id="${card.id}" 
                  data-list-id="${listId}">
                 <div class="card-title">${this.escapeHtml(card.title || card.content)}</div>
-                ${card.content && card.title !== card.content ? `<div class="card-content">${this.escapeHtml(card.content)}</div>` : ''}
+                ${card.content && card.title !== card.content ? `<div class="card-content">${this.renderContent(card)}</div>` : ''}
             </div>
         `;
     },
@@ -250,6 +251,14 @@ const Board = {
             });
         });
 
+        // Archive list buttons
+        document.querySelectorAll('.btn-archive-list').forEach(btn => {
+            btn.addEventListener('click', (e) => {
+                const listId = e.target.dataset.listId;
+                this.archiveList(listId);
+            });
+        });
+
         // Add card buttons
         document.querySelectorAll('.add-card-btn').forEach(btn => {
             btn.addEventListener('click', (e) => {
@@ -382,6 +391,18 @@ const Board = {
         }
     },
 
+    /**
+     * Archive list together with its cards
+     */
+    async archiveList(listId) {
+        try {
+            await API.lists.archive(listId);
+            await this.loadBoard();
+        } catch (error) {
+            alert('Failed to archive list: ' + error.message);
+        }
+    },
+
     /**
      * Card modal controls
      */
@@ -446,18 +467,8 @@ const Board = {
                 await API.entries.update(cardId, cardData);
             } else {
                 // Create new card
-                const newCard = await API.entries.create(cardData);
-                
-                // Add card ID to list's items array
-                const list = this.lists.find(l => l.id == listId);
-                if (list) {
-                    // items is now an array of IDs, not objects
-                    if (!list.items) {
-                        list.items = [];
-                    }
-                    list.items.push(newCard.id);
-                    await API.lists.update(listId, list);
-                }
+                // The server appends the new card to the list, enforcing the list policy
+                await API.entries.create(cardData, listId);
             }
 
             this.closeCardModal();
@@ -538,28 +549,8 @@ const Board = {
         }
 
         try {
-            // Items are now arrays of IDs, not objects
-            const sourceList = this.lists.find(l => l.id == sourceListId);
-            const cardIdNum = parseInt(cardId);
-            
-            // Check if card exists in source list
-            if (!sourceList.items.includes(cardIdNum)) return;
-
-            // Remove from source list
-            sourceList.items = sourceList.items.filter(id => id != cardIdNum);
-            
-            // Add to target list
-            const targetList = this.lists.find(l => l.id == targetListId);
-            if (!targetList.items) {
-                targetList.items = [];
-            }
-            targetList.items.push(cardIdNum);
-
-            // Update both lists
-            await Promise.all([
-                API.lists.update(sourceListId, sourceList),
-                API.lists.update(targetListId, targetList),
-            ]);
+            // The server updates both lists together and enforces the target list policy
+            await API.entries.move(cardId, { target_list_id: parseInt(targetListId) });
 
             // Refresh board
             await this.loadBoard();
@@ -569,6 +560,13 @@ const Board = {
         }
     },
 
+    /**
+     * Card body as HTML: the server-sanitized markdown rendering when available, escaped text otherwise
+     */
+    renderContent(card) {
+        return card.content_html || this.escapeHtml(card.content);
+    },
+
     /**
      * Escape HTML to prevent XSS
      */
@@ -207,9 +207,24 @@ const Dashboard = {
     openModal() {
         this.elements.modal.classList.add('active');
         this.elements.form.reset();
+        this.loadTemplates();
         document.getElementById('project-name').focus();
     },
 
+    /**
+     * Fill the template picker with the template projects the user can read
+     */
+    async loadTemplates() {
+        const select = document.getElementById('project-template');
+        try {
+            const templates = await API.projects.getTemplates();
+            select.innerHTML = '<option value="">Blank project</option>' +
+                templates.map(t => `<option value="${t.id}">${this.escapeHtml(t.name)}</option>`).join('');
+        } catch (error) {
+            console.error('Failed to load templates:', error);
+        }
+    },
+
     /**
      * Close modal
      */
@@ -226,6 +241,7 @@ const Dashboard = {
         
         const name = document.getElementById('project-name').value.trim();
         const description = document.getElementById('project-description').value.trim();
+        const templateId = document.getElementById('project-template').value;
 
         if (!name) {
             alert('Please enter a project name');
@@ -238,7 +254,7 @@ const Dashboard = {
             submitBtn.disabled = true;
             submitBtn.textContent = 'Creating...';
 
-            await API.projects.create({ name, description });
+            await API.projects.create({ name, description }, templateId);
             
             this.closeModal();
             await this.loadProjects();
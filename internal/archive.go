@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+var (
+	// ErrAlreadyArchived is returned when archiving a list or entry that is already archived.
+	ErrAlreadyArchived = errors.New("already archived")
+	// ErrNotArchived is returned when unarchiving a list or entry that is not archived.
+	ErrNotArchived = errors.New("not archived")
+	// ErrListArchived is returned when unarchiving an entry whose list is still archived.
+	ErrListArchived = errors.New("the entry's list is archived, unarchive the list instead")
+)
+
+// ArchiveContentEntry archives the entry and takes it out of its list, remembering the list and
+// position so UnarchiveContentEntry can put it back.
+func ArchiveContentEntry(db types.Conn, id int64, now int64) error {
+	ce, err := GetContentEntry(db, id)
+	if err != nil {
+		return err
+	}
+	if ce.ArchivedAt != 0 {
+		return ErrAlreadyArchived
+	}
+	lists, err := GetContentListsByProject(db, ce.ProjectID)
+	if err != nil {
+		return err
+	}
+	var listID int64
+	position := 0
+	for _, cl := range lists {
+		idx := indexOfID(cl.Items, id)
+		if idx < 0 {
+			continue
+		}
+		listID, position = cl.ID, idx
+		cl.Items = removeID(cl.Items, id)
+		if err := UpdateContentList(db, cl.ID, &cl); err != nil {
+			return err
+		}
+		break
+	}
+	return setEntryArchive(db, id, now, listID, position)
+}
+
+// ArchivedEntryList returns the list an archived entry goes back to when unarchived, or nil if
+// it was in no list or the list has since been deleted.
+func ArchivedEntryList(db types.Conn, ce *ContentEntry) (*ContentList, error) {
+	if ce.ArchivedAt == 0 {
+		return nil, ErrNotArchived
+	}
+	if ce.ArchivedListID == 0 {
+		return nil, nil
+	}
+	cl, err := GetContentList(db, ce.ArchivedListID)
+	if err != nil {
+		return nil, nil
+	}
+	if cl.ArchivedAt != 0 {
+		return nil, ErrListArchived
+	}
+	return cl, nil
+}
+
+// UnarchiveContentEntry restores an archived entry to its original position in its list. The
+// position is clamped to the current length of the list.
+func UnarchiveContentEntry(db types.Conn, id int64) error {
+	ce, err := GetContentEntry(db, id)
+	if err != nil {
+		return err
+	}
+	cl, err := ArchivedEntryList(db, ce)
+	if err != nil {
+		return err
+	}
+	if cl != nil && !containsID(cl.Items, id) {
+		cl.Items = insertID(cl.Items, id, ce.ArchivedPosition)
+		if err := UpdateContentList(db, cl.ID, cl); err != nil {
+			return err
+		}
+	}
+	return setEntryArchive(db, id, 0, 0, 0)
+}
+
+// ArchiveContentList archives the list together with the entries it holds. The entries stay in
+// the list's items, so unarchiving the list restores them in place.
+func ArchiveContentList(db types.Conn, id int64, now int64) error {
+	cl, err := GetContentList(db, id)
+	if err != nil {
+		return err
+	}
+	if cl.ArchivedAt != 0 {
+		return ErrAlreadyArchived
+	}
+	for i, entryID := range cl.Items {
+		ce, err := GetContentEntry(db, entryID)
+		if err != nil || ce.ArchivedAt != 0 {
+			continue
+		}
+		if err := setEntryArchive(db, entryID, now, cl.ID, i); err != nil {
+			return err
+		}
+	}
+	return setListArchive(db, id, now)
+}
+
+// UnarchiveContentList unarchives the list and the entries that were archived along with it.
+// Entries archived on their own before the list was archived stay archived.
+func UnarchiveContentList(db types.Conn, id int64) error {
+	cl, err := GetContentList(db, id)
+	if err != nil {
+		return err
+	}
+	if cl.ArchivedAt == 0 {
+		return ErrNotArchived
+	}
+	for _, entryID := range cl.Items {
+		ce, err := GetContentEntry(db, entryID)
+		if err != nil || ce.ArchivedAt != cl.ArchivedAt || ce.ArchivedListID != cl.ID {
+			continue
+		}
+		if err := setEntryArchive(db, entryID, 0, 0, 0); err != nil {
+			return err
+		}
+	}
+	return setListArchive(db, id, 0)
+}
+
+// GetArchivedItems returns the archived lists and entries of a project, most recently archived first.
+func GetArchivedItems(db types.Conn, projectID int64) (*ArchivedItems, error) {
+	archived := &ArchivedItems{Lists: []ContentList{}, Entries: []ContentEntry{}}
+	lists, err := GetContentListsByProject(db, projectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, cl := range lists {
+		if cl.ArchivedAt != 0 {
+			archived.Lists = append(archived.Lists, cl)
+		}
+	}
+	entries, err := GetContentEntries(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, ce := range entries {
+		if ce.ProjectID == projectID && ce.ArchivedAt != 0 {
+			archived.Entries = append(archived.Entries, ce)
+		}
+	}
+	sort.SliceStable(archived.Lists, func(i, j int) bool { return archived.Lists[i].ArchivedAt > archived.Lists[j].ArchivedAt })
+	sort.SliceStable(archived.Entries, func(i, j int) bool { return archived.Entries[i].ArchivedAt > archived.Entries[j].ArchivedAt })
+	return archived, nil
+}
+
+// ActiveContentLists drops archived lists.
+func ActiveContentLists(lists []ContentList) []ContentList {
+	active := make([]ContentList, 0, len(lists))
+	for _, cl := range lists {
+		if cl.ArchivedAt == 0 {
+			active = append(active, cl)
+		}
+	}
+	return active
+}
+
+func setEntryArchive(db types.Conn, id int64, archivedAt int64, listID int64, position int) error {
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	upd := dbhelper.Cond().Eq("archived_at", archivedAt).Eq("archived_list_id", listID).Eq("archived_position", position).Eq("updated_at", time.Now().Unix()).Build()
+	if _, err := db.Update("content_entry", cond, upd); err != nil {
+		return err
+	}
+	return RecordChange(db, "content_entry", id, ChangeUpsert)
+}
+
+func setListArchive(db types.Conn, id int64, archivedAt int64) error {
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	upd := dbhelper.Cond().Eq("archived_at", archivedAt).Eq("updated_at", time.Now().Unix()).Build()
+	if _, err := db.Update("content_list", cond, upd); err != nil {
+		return err
+	}
+	return RecordChange(db, "content_list", id, ChangeUpsert)
+}
+
+func indexOfID(ids []int64, id int64) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestArchiveEntryRestoresPosition(t *testing.T) {
+	db := newTestDB(t)
+
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: 1})
+	e2, _ := CreateContentEntry(db, &ContentEntry{Title: "E2", ProjectID: 1})
+	e3, _ := CreateContentEntry(db, &ContentEntry{Title: "E3", ProjectID: 1})
+	listID, _ := CreateContentList(db, &ContentList{Title: "Done", ProjectID: 1, Items: []int64{e1, e2, e3}})
+
+	if err := ArchiveContentEntry(db, e2, 100); err != nil {
+		t.Fatalf("归档条目失败: %v", err)
+	}
+	if err := ArchiveContentEntry(db, e2, 100); !errors.Is(err, ErrAlreadyArchived) {
+		t.Fatalf("重复归档应报错, got %v", err)
+	}
+	cl, _ := GetContentList(db, listID)
+	if len(cl.Items) != 2 || cl.Items[0] != e1 || cl.Items[1] != e3 {
+		t.Fatalf("归档后条目应移出列表: %v", cl.Items)
+	}
+	entries, _ := GetContentEntries(db)
+	if len(FilterContentEntries(entries, EntryFilter{})) != 2 {
+		t.Fatal("默认查询不应返回已归档条目")
+	}
+	if len(FilterContentEntries(entries, EntryFilter{IncludeArchived: true})) != 3 {
+		t.Fatal("include_archived 应返回已归档条目")
+	}
+
+	if err := UnarchiveContentEntry(db, e2); err != nil {
+		t.Fatalf("取消归档失败: %v", err)
+	}
+	cl, _ = GetContentList(db, listID)
+	if len(cl.Items) != 3 || cl.Items[1] != e2 {
+		t.Fatalf("取消归档应放回原位置: %v", cl.Items)
+	}
+	if err := UnarchiveContentEntry(db, e2); !errors.Is(err, ErrNotArchived) {
+		t.Fatalf("未归档的条目取消归档应报错, got %v", err)
+	}
+}
+
+func TestArchiveListArchivesEntries(t *testing.T) {
+	db := newTestDB(t)
+
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: 1})
+	e2, _ := CreateContentEntry(db, &ContentEntry{Title: "E2", ProjectID: 1})
+	e3, _ := CreateContentEntry(db, &ContentEntry{Title: "E3", ProjectID: 1})
+	listID, _ := CreateContentList(db, &ContentList{Title: "Done", ProjectID: 1, Items: []int64{e1, e2, e3}})
+	CreateContentList(db, &ContentList{Title: "Doing", ProjectID: 1})
+
+	// e3 先单独归档，列表取消归档时不应恢复
+	ArchiveContentEntry(db, e3, 50)
+	if err := ArchiveContentList(db, listID, 100); err != nil {
+		t.Fatalf("归档列表失败: %v", err)
+	}
+
+	archived, err := GetArchivedItems(db, 1)
+	if err != nil {
+		t.Fatalf("查询归档失败: %v", err)
+	}
+	if len(archived.Lists) != 1 || len(archived.Entries) != 3 || archived.Entries[2].ID != e3 {
+		t.Fatalf("归档内容错误: %+v", archived)
+	}
+	lists, _ := GetContentListsByProject(db, 1)
+	if active := ActiveContentLists(lists); len(active) != 1 || active[0].Title != "Doing" {
+		t.Fatalf("已归档列表不应出现在看板中: %+v", active)
+	}
+
+	e1Entry, _ := GetContentEntry(db, e1)
+	if err := UnarchiveContentEntry(db, e1Entry.ID); !errors.Is(err, ErrListArchived) {
+		t.Fatalf("列表仍归档时不能单独取消归档其条目, got %v", err)
+	}
+
+	if err := UnarchiveContentList(db, listID); err != nil {
+		t.Fatalf("取消归档列表失败: %v", err)
+	}
+	cl, _ := GetContentList(db, listID)
+	if cl.ArchivedAt != 0 || len(cl.Items) != 2 || cl.Items[0] != e1 || cl.Items[1] != e2 {
+		t.Fatalf("列表应恢复原有条目: %+v", cl)
+	}
+	for _, id := range []int64{e1, e2} {
+		if ce, _ := GetContentEntry(db, id); ce.ArchivedAt != 0 {
+			t.Fatalf("条目 %d 应随列表取消归档", id)
+		}
+	}
+	if ce, _ := GetContentEntry(db, e3); ce.ArchivedAt == 0 {
+		t.Fatal("单独归档的条目应保持归档")
+	}
+}
@@ -0,0 +1,411 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+var (
+	// ErrAttachmentTooLarge is returned when an upload exceeds AttachmentLimits.MaxSize.
+	ErrAttachmentTooLarge = errors.New("attachment too large")
+	// ErrAttachmentType is returned when the upload's MIME type is not allowed.
+	ErrAttachmentType = errors.New("attachment type not allowed")
+	// ErrInvalidRange is returned when a Range header cannot be satisfied.
+	ErrInvalidRange = errors.New("invalid range")
+)
+
+// AttachmentLimits restricts what may be uploaded. AllowedTypes entries are either full MIME
+// types ("application/pdf") or type wildcards ("image/*").
+type AttachmentLimits struct {
+	MaxSize      int64
+	AllowedTypes []string
+}
+
+// DefaultAttachmentLimits allows screenshots, logs and common documents up to 10 MiB.
+var DefaultAttachmentLimits = AttachmentLimits{
+	MaxSize: 10 << 20,
+	AllowedTypes: []string{
+		"image/*",
+		"text/*",
+		"application/pdf",
+		"application/json",
+		"application/zip",
+		"application/gzip",
+		"application/x-gzip",
+		"application/octet-stream",
+	},
+}
+
+// DetectAttachmentType sniffs the MIME type from the first bytes of the file. The declared type
+// is only used when sniffing gives no better answer than text/plain or octet-stream and the
+// declared type is compatible with it. Parameters such as charset are dropped.
+func DetectAttachmentType(head []byte, declared string) string {
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	declared, _, _ = mime.ParseMediaType(declared)
+	if declared == "" {
+		return sniffed
+	}
+	switch sniffed {
+	case "application/octet-stream":
+		// 二进制内容不能声明为文本或图片，否则可能被浏览器按 HTML/SVG 解析
+		if !strings.HasPrefix(declared, "text/") && !strings.HasPrefix(declared, "image/") {
+			return declared
+		}
+	case "text/plain":
+		if strings.HasPrefix(declared, "text/") && declared != "text/html" {
+			return declared
+		}
+	}
+	return sniffed
+}
+
+// CheckAttachment validates size and MIME type against the limits.
+func (l AttachmentLimits) CheckAttachment(size int64, contentType string) error {
+	if l.MaxSize > 0 && size > l.MaxSize {
+		return fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes", ErrAttachmentTooLarge, size, l.MaxSize)
+	}
+	for _, allowed := range l.AllowedTypes {
+		if allowed == contentType {
+			return nil
+		}
+		if strings.HasSuffix(allowed, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(allowed, "*")) {
+			// text/html 和 image/svg+xml 可执行脚本，不作为附件接受
+			if contentType != "text/html" && contentType != "image/svg+xml" {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrAttachmentType, contentType)
+}
+
+// blobState tracks one blob while it is being uploaded or released. pins counts the uploads that
+// have not yet created their attachment row, uploads counts every upload since the state was
+// created, watchers counts the callers holding the state and deleting is set while releaseBlobs
+// removes the blob from the store.
+type blobState struct {
+	pins     int
+	uploads  int
+	watchers int
+	deleting bool
+}
+
+// blobMu guards blobStates and is never held across a database call, so it cannot deadlock with a
+// transaction.
+var (
+	blobMu     sync.Mutex
+	blobCond   = sync.NewCond(&blobMu)
+	blobStates = map[string]*blobState{}
+)
+
+// watchBlob returns the state of hash with the caller counted as a watcher. blobMu must be held.
+func watchBlob(hash string) *blobState {
+	st, ok := blobStates[hash]
+	if !ok {
+		st = &blobState{}
+		blobStates[hash] = st
+	}
+	st.watchers++
+	return st
+}
+
+// unwatchBlob drops the caller's interest in hash. blobMu must be held.
+func unwatchBlob(hash string, st *blobState) {
+	st.watchers--
+	forgetBlob(hash, st)
+}
+
+// forgetBlob removes the state of hash once nothing uses it. blobMu must be held.
+func forgetBlob(hash string, st *blobState) {
+	if st.watchers == 0 && st.pins == 0 && !st.deleting {
+		delete(blobStates, hash)
+	}
+}
+
+// pinBlob keeps releaseBlobs from deleting the blob until unpinBlob, waiting for a delete already
+// under way to finish first.
+func pinBlob(hash string) {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+	st := watchBlob(hash)
+	for st.deleting {
+		blobCond.Wait()
+	}
+	st.pins++
+	st.uploads++
+	unwatchBlob(hash, st)
+}
+
+func unpinBlob(hash string) {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+	st := blobStates[hash]
+	st.pins--
+	forgetBlob(hash, st)
+}
+
+// StoreAttachmentBlob hashes the content of r and uploads it to the store unless a blob with the
+// same hash already exists. r is read twice, so it must be seekable. Returns the hex SHA-256 hash,
+// which is also the blob key. A blob nothing refers to may be released again at any time; use
+// CreateAttachmentWithBlob to store a blob for a new attachment.
+func StoreAttachmentBlob(ctx context.Context, store BlobStore, r io.ReadSeeker, size int64, contentType string) (string, error) {
+	hash, err := hashBlob(r)
+	if err != nil {
+		return "", err
+	}
+	pinBlob(hash)
+	defer unpinBlob(hash)
+	return hash, putBlob(ctx, store, hash, r, size, contentType)
+}
+
+// CreateAttachmentWithBlob stores the content of r like StoreAttachmentBlob and creates the
+// attachment row for it, setting a.Hash. The blob cannot be released by a concurrent delete of
+// another attachment with the same content until the row exists.
+func CreateAttachmentWithBlob(ctx context.Context, db types.Conn, store BlobStore, a *Attachment, r io.ReadSeeker) (int64, error) {
+	hash, err := hashBlob(r)
+	if err != nil {
+		return 0, err
+	}
+	pinBlob(hash)
+	defer unpinBlob(hash)
+	if err := putBlob(ctx, store, hash, r, a.Size, a.ContentType); err != nil {
+		return 0, err
+	}
+	a.Hash = hash
+	return CreateAttachment(db, a)
+}
+
+func hashBlob(r io.ReadSeeker) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func putBlob(ctx context.Context, store BlobStore, hash string, r io.ReadSeeker, size int64, contentType string) error {
+	exists, err := store.Exists(ctx, hash)
+	if err != nil || exists {
+		return err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return store.Put(ctx, hash, r, size, contentType)
+}
+
+// ParseByteRange parses a single-range HTTP Range header against a resource of the given size
+// and returns the offset and length to serve. ok is false when the header is empty or asks for
+// several ranges, in which case the whole resource should be served.
+func ParseByteRange(header string, size int64) (offset, length int64, ok bool, err error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, size, false, nil
+	}
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found {
+		return 0, 0, false, fmt.Errorf("%w: %s", ErrInvalidRange, header)
+	}
+	if strings.Contains(spec, ",") {
+		return 0, size, false, nil
+	}
+	startStr, endStr, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, fmt.Errorf("%w: %s", ErrInvalidRange, header)
+	}
+
+	if startStr == "" {
+		// bytes=-N 表示最后 N 个字节
+		n, perr := strconv.ParseInt(endStr, 10, 64)
+		if perr != nil || n <= 0 || size == 0 {
+			return 0, 0, false, fmt.Errorf("%w: %s", ErrInvalidRange, header)
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, nil
+	}
+
+	start, perr := strconv.ParseInt(startStr, 10, 64)
+	if perr != nil || start < 0 || start >= size {
+		return 0, 0, false, fmt.Errorf("%w: %s", ErrInvalidRange, header)
+	}
+	end := size - 1
+	if endStr != "" {
+		end, perr = strconv.ParseInt(endStr, 10, 64)
+		if perr != nil || end < start {
+			return 0, 0, false, fmt.Errorf("%w: %s", ErrInvalidRange, header)
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, true, nil
+}
+
+// Attachment CRUD
+
+func CreateAttachment(db types.Conn, a *Attachment) (int64, error) {
+	cond := dbhelper.Cond().Eq("entry_id", a.EntryID).Eq("project_id", a.ProjectID).Eq("filename", a.Filename).
+		Eq("content_type", a.ContentType).Eq("size", a.Size).Eq("hash", a.Hash).Eq("uploader_id", a.UploaderID).
+		Eq("created_at", a.CreatedAt).Build()
+	return db.Insert("attachment", cond)
+}
+
+func GetAttachment(db types.Conn, id int64) (*Attachment, error) {
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	rows, err := db.Query("attachment", cond)
+	if err != nil {
+		return nil, err
+	}
+	if rows.Count() == 0 {
+		return nil, errors.New("attachment not found")
+	}
+	a := attachmentFromRow(rows.All()[0])
+	return &a, nil
+}
+
+func GetAttachmentsByEntry(db types.Conn, entryID int64) ([]Attachment, error) {
+	return queryAttachments(db, "entry_id", entryID)
+}
+
+// DeleteAttachment removes an attachment and, if no other attachment shares its content,
+// the blob as well.
+func DeleteAttachment(ctx context.Context, db types.Conn, store BlobStore, id int64) error {
+	a, err := GetAttachment(db, id)
+	if err != nil {
+		return err
+	}
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	if _, err := db.Delete("attachment", cond); err != nil {
+		return err
+	}
+	return releaseBlobs(ctx, db, store, []string{a.Hash})
+}
+
+// DeleteAttachmentsByEntry removes every attachment of an entry and the blobs no longer referenced.
+func DeleteAttachmentsByEntry(ctx context.Context, db types.Conn, store BlobStore, entryID int64) error {
+	return deleteAttachments(ctx, db, store, "entry_id", entryID)
+}
+
+// DeleteAttachmentsByProject removes every attachment in a project and the blobs no longer referenced.
+func DeleteAttachmentsByProject(ctx context.Context, db types.Conn, store BlobStore, projectID int64) error {
+	return deleteAttachments(ctx, db, store, "project_id", projectID)
+}
+
+func deleteAttachments(ctx context.Context, db types.Conn, store BlobStore, column string, id int64) error {
+	hashes, err := deleteAttachmentRows(db, column, id)
+	if err != nil {
+		return err
+	}
+	return releaseBlobs(ctx, db, store, hashes)
+}
+
+// deleteAttachmentRows removes the attachment rows whose column equals id and returns their hashes,
+// leaving the blobs to releaseBlobs.
+func deleteAttachmentRows(db types.Conn, column string, id int64) ([]string, error) {
+	attachments, err := queryAttachments(db, column, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		return nil, nil
+	}
+	cond := dbhelper.Cond().Eq(column, id).Build()
+	if _, err := db.Delete("attachment", cond); err != nil {
+		return nil, err
+	}
+	hashes := make([]string, 0, len(attachments))
+	for _, a := range attachments {
+		hashes = append(hashes, a.Hash)
+	}
+	return hashes, nil
+}
+
+// releaseBlobs deletes the blobs whose hash is no longer referenced by any attachment. A blob is
+// kept if an upload of the same content started while its references were being checked.
+func releaseBlobs(ctx context.Context, db types.Conn, store BlobStore, hashes []string) error {
+	if store == nil {
+		return nil
+	}
+	done := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		if done[hash] {
+			continue
+		}
+		done[hash] = true
+		if err := releaseBlob(ctx, db, store, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func releaseBlob(ctx context.Context, db types.Conn, store BlobStore, hash string) error {
+	blobMu.Lock()
+	st := watchBlob(hash)
+	uploads := st.uploads
+	blobMu.Unlock()
+
+	cond := dbhelper.Cond().Eq("hash", hash).Build()
+	rows, err := db.Query("attachment", cond)
+
+	blobMu.Lock()
+	for st.deleting {
+		blobCond.Wait()
+	}
+	if err != nil || rows.Count() > 0 || st.pins > 0 || st.uploads != uploads {
+		unwatchBlob(hash, st)
+		blobMu.Unlock()
+		return err
+	}
+	st.deleting = true
+	blobMu.Unlock()
+
+	err = store.Delete(ctx, hash)
+
+	blobMu.Lock()
+	st.deleting = false
+	unwatchBlob(hash, st)
+	blobCond.Broadcast()
+	blobMu.Unlock()
+	return err
+}
+
+func queryAttachments(db types.Conn, column string, id int64) ([]Attachment, error) {
+	cond := dbhelper.Cond().Eq(column, id).Build()
+	rows, err := db.Query("attachment", cond)
+	if err != nil {
+		return []Attachment{}, err
+	}
+	attachments := make([]Attachment, 0)
+	for _, data := range rows.All() {
+		attachments = append(attachments, attachmentFromRow(data))
+	}
+	return attachments, nil
+}
+
+func attachmentFromRow(data map[string]interface{}) Attachment {
+	return Attachment{
+		ID:          data["id"].(int64),
+		EntryID:     asInt64(data["entry_id"]),
+		ProjectID:   asInt64(data["project_id"]),
+		Filename:    asString(data["filename"]),
+		ContentType: asString(data["content_type"]),
+		Size:        asInt64(data["size"]),
+		Hash:        asString(data["hash"]),
+		UploaderID:  asInt64(data["uploader_id"]),
+		CreatedAt:   asInt64(data["created_at"]),
+	}
+}
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+func TestParseByteRange(t *testing.T) {
+	cases := []struct {
+		header         string
+		offset, length int64
+		ok, invalid    bool
+	}{
+		{"", 0, 100, false, false},
+		{"bytes=0-9", 0, 10, true, false},
+		{"bytes=90-", 90, 10, true, false},
+		{"bytes=-10", 90, 10, true, false},
+		{"bytes=50-200", 50, 50, true, false},
+		{"bytes=0-1,5-6", 0, 100, false, false},
+		{"bytes=100-", 0, 0, false, true},
+		{"bytes=9-1", 0, 0, false, true},
+		{"items=0-1", 0, 0, false, true},
+	}
+	for _, tc := range cases {
+		offset, length, ok, err := ParseByteRange(tc.header, 100)
+		if tc.invalid {
+			if !errors.Is(err, ErrInvalidRange) {
+				t.Errorf("%q 应被拒绝, got %v", tc.header, err)
+			}
+			continue
+		}
+		if err != nil || offset != tc.offset || length != tc.length || ok != tc.ok {
+			t.Errorf("%q: got (%d, %d, %v, %v)", tc.header, offset, length, ok, err)
+		}
+	}
+}
+
+func TestCheckAttachment(t *testing.T) {
+	limits := AttachmentLimits{MaxSize: 100, AllowedTypes: []string{"image/*", "text/*"}}
+
+	png := DetectAttachmentType([]byte("\x89PNG\r\n\x1a\n"), "text/plain")
+	if png != "image/png" {
+		t.Fatalf("应按内容识别为 PNG, got %s", png)
+	}
+	if err := limits.CheckAttachment(10, png); err != nil {
+		t.Fatalf("PNG 应被允许: %v", err)
+	}
+	if err := limits.CheckAttachment(101, png); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Fatalf("超限文件应被拒绝, got %v", err)
+	}
+
+	html := DetectAttachmentType([]byte("<html><script>alert(1)</script>"), "text/plain")
+	if err := limits.CheckAttachment(10, html); !errors.Is(err, ErrAttachmentType) {
+		t.Fatalf("HTML 应被拒绝, got %s %v", html, err)
+	}
+	if got := DetectAttachmentType([]byte("level=info msg=ok"), "text/x-log; charset=utf-8"); got != "text/x-log" {
+		t.Fatalf("文本应使用声明的类型, got %s", got)
+	}
+}
+
+func TestAttachmentDedupAndCleanup(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+
+	data := "same screenshot"
+	h1, err := StoreAttachmentBlob(ctx, store, strings.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	h2, _ := StoreAttachmentBlob(ctx, store, strings.NewReader(data), int64(len(data)), "text/plain")
+	if h1 != h2 {
+		t.Fatalf("相同内容应得到相同哈希")
+	}
+
+	a1, _ := CreateAttachment(db, &Attachment{EntryID: 1, ProjectID: 1, Filename: "a.txt", Hash: h1})
+	CreateAttachment(db, &Attachment{EntryID: 2, ProjectID: 2, Filename: "b.txt", Hash: h1})
+
+	if err := DeleteAttachment(ctx, db, store, a1); err != nil {
+		t.Fatalf("删除附件失败: %v", err)
+	}
+	if ok, _ := store.Exists(ctx, h1); !ok {
+		t.Fatalf("仍被引用的 blob 不应删除")
+	}
+
+	if err := DeleteAttachmentsByProject(ctx, db, store, 2); err != nil {
+		t.Fatalf("按项目删除附件失败: %v", err)
+	}
+	if ok, _ := store.Exists(ctx, h1); ok {
+		t.Fatalf("不再被引用的 blob 应被删除")
+	}
+}
+
+// uploadDuringCheck 在查询附件引用之后、返回结果之前执行 upload，模拟并发上传
+type uploadDuringCheck struct {
+	*Database
+	upload func()
+}
+
+func (c *uploadDuringCheck) Query(table string, cond *types.Condition) (types.Rows, error) {
+	rows, err := c.Database.Query(table, cond)
+	if table == "attachment" && c.upload != nil {
+		c.upload()
+		c.upload = nil
+	}
+	return rows, err
+}
+
+func TestReleaseKeepsBlobOfConcurrentUpload(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建存储失败: %v", err)
+	}
+	data := "same content"
+	first := &Attachment{EntryID: 1, ProjectID: 1, Filename: "a.txt", Size: int64(len(data))}
+	id, err := CreateAttachmentWithBlob(ctx, db, store, first, strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+
+	// 删除第一个附件时，另一个相同内容的上传在引用检查后完成
+	conn := &uploadDuringCheck{Database: db, upload: func() {
+		second := &Attachment{EntryID: 2, ProjectID: 1, Filename: "b.txt", Size: int64(len(data))}
+		if _, err := CreateAttachmentWithBlob(ctx, db, store, second, strings.NewReader(data)); err != nil {
+			t.Errorf("并发上传失败: %v", err)
+		}
+	}}
+	if err := DeleteAttachment(ctx, conn, store, id); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if ok, _ := store.Exists(ctx, first.Hash); !ok {
+		t.Fatal("仍被新附件引用的内容不应删除")
+	}
+
+	// 上传进行中时也不删除
+	pinBlob(first.Hash)
+	DeleteAttachmentsByEntry(ctx, db, store, 2)
+	if ok, _ := store.Exists(ctx, first.Hash); !ok {
+		t.Fatal("上传进行中的内容不应删除")
+	}
+	unpinBlob(first.Hash)
+	if err := releaseBlobs(ctx, db, store, []string{first.Hash}); err != nil {
+		t.Fatalf("释放失败: %v", err)
+	}
+	if ok, _ := store.Exists(ctx, first.Hash); ok {
+		t.Fatal("不再引用的内容应删除")
+	}
+	if len(blobStates) != 0 {
+		t.Fatalf("不应残留状态: %v", blobStates)
+	}
+}
@@ -0,0 +1,327 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// backupFilePrefix and backupFileSuffix name the snapshots written to the backup directory.
+	backupFilePrefix = "liteboard-"
+	backupFileSuffix = ".db"
+	// backupTimeFormat names snapshots down to the microsecond, so snapshots taken in the same
+	// second do not overwrite each other and names still sort by time.
+	backupTimeFormat = "20060102-150405.000000"
+	// backupStepPages is the number of pages copied per backup step; the source is unlocked
+	// between steps so the server keeps serving writes during a long backup.
+	backupStepPages = 256
+)
+
+var (
+	// ErrInvalidBackup is returned when a file is not a readable, intact Liteboard database.
+	ErrInvalidBackup = errors.New("invalid backup")
+	// ErrDatabaseInUse is returned when the database to restore over is open in another process.
+	ErrDatabaseInUse = errors.New("database is in use")
+)
+
+// snapshotMu keeps scheduled and on-demand snapshots from writing the same file at once.
+var snapshotMu sync.Mutex
+
+// BackupDatabase copies the SQLite database at srcPath to destPath with SQLite's online backup
+// API, so it is safe while the server is running. The copy is written next to destPath, checked
+// with VerifyBackup and only then renamed into place.
+func BackupDatabase(ctx context.Context, srcPath, destPath string) (*BackupInfo, error) {
+	tmp := destPath + ".tmp"
+	os.Remove(tmp)
+	if err := copyDatabase(ctx, srcPath, tmp); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if _, err := VerifyBackup(tmp); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, destPath); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return VerifyBackup(destPath)
+}
+
+// SnapshotDatabase writes a timestamped backup of the database to dir and then deletes all but
+// the newest keep snapshots there. keep <= 0 keeps every snapshot.
+func SnapshotDatabase(ctx context.Context, dbPath, dir string, keep int) (*BackupInfo, error) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	name := backupFilePrefix + time.Now().UTC().Format(backupTimeFormat) + backupFileSuffix
+	info, err := BackupDatabase(ctx, dbPath, filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	if keep > 0 {
+		if err := pruneSnapshots(dir, keep); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// RunBackupWorker takes a snapshot every interval until ctx is cancelled. The first snapshot is
+// taken one interval after start, so frequent restarts do not rotate good snapshots away.
+func RunBackupWorker(ctx context.Context, dbPath, dir string, keep int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := SnapshotDatabase(ctx, dbPath, dir, keep)
+		if err != nil {
+			if ctx.Err() == nil {
+				hlog.Errorf("RunBackupWorker: SnapshotDatabase failed, dir=%s, error=%v", dir, err)
+			}
+			continue
+		}
+		hlog.Infof("Database snapshot written to %s (%d bytes)", info.File, info.Size)
+	}
+}
+
+// VerifyBackup opens a backup read-only, runs PRAGMA integrity_check and reads its schema version.
+// Files that are not SQLite databases, fail the check or lack the Liteboard tables are rejected
+// with ErrInvalidBackup.
+func VerifyBackup(path string) (*BackupInfo, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		return nil, fmt.Errorf("%w: %s is a directory", ErrInvalidBackup, path)
+	}
+	conn, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	rows, err := conn.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: integrity check failed: %s", ErrInvalidBackup, strings.Join(problems, "; "))
+	}
+
+	var tables int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('project', 'user', 'content_entry')").Scan(&tables); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if tables != 3 {
+		return nil, fmt.Errorf("%w: not a Liteboard database", ErrInvalidBackup)
+	}
+	info := &BackupInfo{File: path, Size: st.Size(), CreatedAt: st.ModTime().Unix()}
+	if err := conn.QueryRow("PRAGMA user_version").Scan(&info.SchemaVersion); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	return info, nil
+}
+
+// RestoreDatabase replaces the database at dbPath with a backup. The backup must pass VerifyBackup
+// and must not come from a newer schema than this build; older schemas are migrated when the server
+// next starts. The current database, with its journal files, is moved aside to
+// <dbPath>.before-restore-<time>, whose path is returned. The server must not be running: the
+// restore holds an exclusive lock on the current database while it swaps the files and fails with
+// ErrDatabaseInUse if another connection has it open.
+func RestoreDatabase(ctx context.Context, backupPath, dbPath string) (*BackupInfo, string, error) {
+	info, err := VerifyBackup(backupPath)
+	if err != nil {
+		return nil, "", err
+	}
+	if info.SchemaVersion > SchemaVersion {
+		return nil, "", fmt.Errorf("%w: backup has schema version %d, this build supports up to %d", ErrInvalidBackup, info.SchemaVersion, SchemaVersion)
+	}
+	unlock, err := lockDatabase(ctx, dbPath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer unlock()
+
+	// 整体移走当前数据库及其日志文件，恢复失败时再移回
+	previous := dbPath + ".before-restore-" + time.Now().UTC().Format(backupTimeFormat)
+	var moved []string
+	for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+		if _, err := os.Stat(dbPath + suffix); err != nil {
+			continue
+		}
+		if err := os.Rename(dbPath+suffix, previous+suffix); err != nil {
+			restoreMoved(dbPath, previous, moved)
+			return nil, "", err
+		}
+		moved = append(moved, suffix)
+	}
+	if err := copyDatabase(ctx, backupPath, dbPath); err != nil {
+		for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+			os.Remove(dbPath + suffix)
+		}
+		restoreMoved(dbPath, previous, moved)
+		return nil, "", err
+	}
+	if len(moved) == 0 {
+		previous = ""
+	}
+	return info, previous, nil
+}
+
+// lockDatabase takes an exclusive lock on the database at path and returns the function releasing
+// it. A database in WAL mode keeps its -wal and -shm files while any connection has it open, and a
+// database in rollback journal mode cannot be locked while another connection is writing to it;
+// both are reported as ErrDatabaseInUse. A missing database needs no lock.
+func lockDatabase(ctx context.Context, path string) (func(), error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return func() {}, nil
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(path + suffix); err == nil {
+			return nil, fmt.Errorf("%w: %s exists; stop the server before restoring", ErrDatabaseInUse, path+suffix)
+		}
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=0")
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "BEGIN EXCLUSIVE"); err != nil {
+		conn.Close()
+		db.Close()
+		return nil, fmt.Errorf("%w: %v; stop the server before restoring", ErrDatabaseInUse, err)
+	}
+	return func() {
+		conn.ExecContext(context.Background(), "ROLLBACK")
+		conn.Close()
+		db.Close()
+	}, nil
+}
+
+func restoreMoved(dbPath, previous string, moved []string) {
+	for _, suffix := range moved {
+		os.Rename(previous+suffix, dbPath+suffix)
+	}
+}
+
+// copyDatabase copies srcPath to destPath page by page with the online backup API. A write to the
+// source by another connection during the copy makes SQLite restart it, so the result is always a
+// consistent snapshot.
+func copyDatabase(ctx context.Context, srcPath, destPath string) error {
+	if _, err := os.Stat(srcPath); err != nil {
+		return err
+	}
+	src, err := sql.Open("sqlite3", "file:"+srcPath+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dest, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	return destConn.Raw(func(destDriver interface{}) error {
+		return srcConn.Raw(func(srcDriver interface{}) error {
+			destSQLite, ok := destDriver.(*sqlite3.SQLiteConn)
+			srcSQLite, ok2 := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("backup requires the sqlite3 driver")
+			}
+			b, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := b.Step(backupStepPages)
+				if err != nil {
+					b.Finish()
+					return err
+				}
+				if done {
+					return b.Finish()
+				}
+				select {
+				case <-ctx.Done():
+					b.Finish()
+					return ctx.Err()
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+		})
+	})
+}
+
+// pruneSnapshots deletes the oldest snapshots in dir beyond the newest keep. Snapshot names sort by
+// the time they were taken; other files in dir are left alone.
+func pruneSnapshots(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasPrefix(name, backupFilePrefix) && strings.HasSuffix(name, backupFileSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for len(names) > keep {
+		if err := os.Remove(filepath.Join(dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// newTestDBFile 创建带有 Liteboard 主要表的数据库文件，project 表中有一行名为 name 的项目
+func newTestDBFile(t *testing.T, path, name string, version int) {
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer conn.Close()
+	for _, stmt := range []string{
+		"CREATE TABLE project (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)",
+		"CREATE TABLE user (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT)",
+		"CREATE TABLE content_entry (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT)",
+		"INSERT INTO project (name) VALUES ('" + name + "')",
+		"PRAGMA user_version = " + strconv.Itoa(version),
+	} {
+		if _, err := conn.Exec(stmt); err != nil {
+			t.Fatalf("建表失败: %v", err)
+		}
+	}
+}
+
+func projectName(t *testing.T, path string) string {
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer conn.Close()
+	var name string
+	if err := conn.QueryRow("SELECT name FROM project").Scan(&name); err != nil {
+		t.Fatalf("读取项目失败: %v", err)
+	}
+	return name
+}
+
+func TestBackupAndRestoreDatabase(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "liteboard.db")
+	newTestDBFile(t, dbPath, "live", SchemaVersion)
+
+	backupPath := filepath.Join(dir, "copy.db")
+	info, err := BackupDatabase(ctx, dbPath, backupPath)
+	if err != nil {
+		t.Fatalf("备份失败: %v", err)
+	}
+	if info.File != backupPath || info.SchemaVersion != SchemaVersion || info.Size == 0 {
+		t.Fatalf("备份信息不正确: %+v", info)
+	}
+	if projectName(t, backupPath) != "live" {
+		t.Fatal("备份内容不正确")
+	}
+	if _, err := os.Stat(backupPath + ".tmp"); !os.IsNotExist(err) {
+		t.Fatal("不应留下临时文件")
+	}
+
+	snapshots := filepath.Join(dir, "snapshots")
+	snap, err := SnapshotDatabase(ctx, dbPath, snapshots, 2)
+	if err != nil || filepath.Dir(snap.File) != snapshots {
+		t.Fatalf("快照失败: %v %+v", err, snap)
+	}
+	for _, name := range []string{"liteboard-20200101-000000.db", "liteboard-20210101-000000.db", "notes.txt"} {
+		os.WriteFile(filepath.Join(snapshots, name), []byte("x"), 0o644)
+	}
+	if err := pruneSnapshots(snapshots, 2); err != nil {
+		t.Fatalf("轮换失败: %v", err)
+	}
+	files, _ := os.ReadDir(snapshots)
+	if len(files) != 3 || files[0].Name() != "liteboard-20210101-000000.db" || files[2].Name() != "notes.txt" {
+		t.Fatalf("应只删除最旧的快照: %v", files)
+	}
+	// 同一秒内的快照不会互相覆盖
+	second, err := SnapshotDatabase(ctx, dbPath, snapshots, 2)
+	if err != nil || second.File == snap.File {
+		t.Fatalf("快照文件名应唯一: %v %+v", err, second)
+	}
+	if files, _ := os.ReadDir(snapshots); len(files) != 3 {
+		t.Fatalf("应保留最新的两份快照: %v", files)
+	}
+
+	// 损坏的文件和其他 SQLite 数据库不能通过校验
+	garbage := filepath.Join(dir, "garbage.db")
+	os.WriteFile(garbage, []byte("not a database at all, just some text"), 0o644)
+	if _, err := VerifyBackup(garbage); !errors.Is(err, ErrInvalidBackup) {
+		t.Fatalf("应拒绝非数据库文件, got %v", err)
+	}
+	other := filepath.Join(dir, "other.db")
+	conn, _ := sql.Open("sqlite3", other)
+	conn.Exec("CREATE TABLE note (id INTEGER)")
+	conn.Close()
+	if _, err := VerifyBackup(other); !errors.Is(err, ErrInvalidBackup) {
+		t.Fatalf("应拒绝其他应用的数据库, got %v", err)
+	}
+
+	newer := filepath.Join(dir, "newer.db")
+	newTestDBFile(t, newer, "future", SchemaVersion+1)
+	if _, _, err := RestoreDatabase(ctx, newer, dbPath); !errors.Is(err, ErrInvalidBackup) {
+		t.Fatalf("应拒绝更新版本的备份, got %v", err)
+	}
+	if projectName(t, dbPath) != "live" {
+		t.Fatal("恢复失败时不应改动数据库")
+	}
+
+	old := filepath.Join(dir, "old.db")
+	newTestDBFile(t, old, "restored", 0)
+
+	// 服务仍在使用数据库时拒绝恢复：另一连接正在写入，或存在 WAL 模式的 -wal/-shm 文件
+	live, _ := sql.Open("sqlite3", dbPath)
+	liveConn, _ := live.Conn(ctx)
+	if _, err := liveConn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		t.Fatalf("开始写事务失败: %v", err)
+	}
+	if _, _, err := RestoreDatabase(ctx, old, dbPath); !errors.Is(err, ErrDatabaseInUse) {
+		t.Fatalf("数据库正在写入时应拒绝恢复, got %v", err)
+	}
+	liveConn.ExecContext(ctx, "ROLLBACK")
+	liveConn.Close()
+	live.Close()
+	os.WriteFile(dbPath+"-shm", nil, 0o644)
+	if _, _, err := RestoreDatabase(ctx, old, dbPath); !errors.Is(err, ErrDatabaseInUse) {
+		t.Fatalf("存在 -shm 文件时应拒绝恢复, got %v", err)
+	}
+	os.Remove(dbPath + "-shm")
+	if projectName(t, dbPath) != "live" {
+		t.Fatal("拒绝恢复时不应改动数据库")
+	}
+
+	restored, previous, err := RestoreDatabase(ctx, old, dbPath)
+	if err != nil || restored.SchemaVersion != 0 {
+		t.Fatalf("恢复失败: %v %+v", err, restored)
+	}
+	if projectName(t, dbPath) != "restored" || projectName(t, previous) != "live" {
+		t.Fatal("应恢复备份内容并保留原数据库")
+	}
+}
@@ -0,0 +1,577 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Kaguya154/dbhelper/types"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// MaxBatchOperations limits the number of operations in one batch.
+const MaxBatchOperations = 200
+
+var (
+	// ErrInvalidBatch is returned when a batch or one of its operations is malformed.
+	ErrInvalidBatch = errors.New("invalid batch operation")
+	// ErrBatchForbidden is returned when the user lacks permission for an operation.
+	ErrBatchForbidden = errors.New("permission denied")
+	// ErrBatchNotFound is returned when an operation refers to an object that does not exist.
+	ErrBatchNotFound = errors.New("not found")
+)
+
+// BatchError identifies the operation that made a batch fail.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// batchContentTypes maps batch object types to permission content types.
+var batchContentTypes = map[string]string{
+	"project": "project",
+	"list":    "content_list",
+	"entry":   "content_entry",
+}
+
+// batchRefFields are the keys inside Data whose values may be references.
+var batchRefFields = []string{"project_id", "items"}
+
+type batchDelete struct {
+	index int
+	typ   string
+	id    int64
+}
+
+type batchRunner struct {
+	db      types.Conn
+	userID  int64
+	refs    map[string]int64
+	deleted map[string]bool
+	deletes []batchDelete
+	// hashes of the deleted attachments, whose blobs are released once the batch has succeeded
+	hashes []string
+}
+
+// RunBatch runs the operations in order in a single transaction: if any operation fails, the writes
+// of all earlier ones are rolled back and the returned error is a *BatchError. Each operation is
+// checked against the user's permissions as the equivalent single request would be. Deletes are
+// validated in place but carried out after every other operation has succeeded, and attachment
+// blobs are only released once the whole batch has committed, so a failing batch never loses data.
+// Later operations may not use an object deleted earlier in the batch. The results cover the
+// operations attempted, the last one carrying the error on failure.
+func RunBatch(ctx context.Context, db types.Conn, store BlobStore, userID int64, ops []BatchOperation) ([]BatchResult, error) {
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("%w: no operations", ErrInvalidBatch)
+	}
+	if len(ops) > MaxBatchOperations {
+		return nil, fmt.Errorf("%w: at most %d operations are allowed", ErrInvalidBatch, MaxBatchOperations)
+	}
+
+	results := make([]BatchResult, 0, len(ops))
+	var hashes []string
+	err := runInTx(db, "RunBatch", func(db types.Conn) error {
+		r := &batchRunner{db: db, userID: userID,
+			refs: map[string]int64{}, deleted: map[string]bool{}}
+		for i := range ops {
+			op := &ops[i]
+			id, err := r.apply(i, op)
+			res := BatchResult{Index: i, Op: op.Op, Type: op.Type, ID: id}
+			if err != nil {
+				res.Error = err.Error()
+				results = append(results, res)
+				return &BatchError{Index: i, Err: err}
+			}
+			results = append(results, res)
+		}
+		for _, d := range r.deletes {
+			if err := r.delete(d); err != nil {
+				results[d.index].Error = err.Error()
+				return &BatchError{Index: d.index, Err: err}
+			}
+		}
+		hashes = r.hashes
+		return nil
+	})
+	if err != nil {
+		return results, err
+	}
+	if err := releaseBlobs(ctx, db, store, hashes); err != nil {
+		// 批量操作已生效，未释放的文件只占用空间
+		hlog.Errorf("RunBatch: releaseBlobs failed, error=%v", err)
+	}
+	return results, nil
+}
+
+func (r *batchRunner) apply(index int, op *BatchOperation) (int64, error) {
+	if _, ok := batchContentTypes[op.Type]; !ok {
+		return 0, fmt.Errorf("%w: unknown type %q", ErrInvalidBatch, op.Type)
+	}
+	if op.Ref != "" && op.Op != "create" {
+		return 0, fmt.Errorf("%w: ref is only allowed on create", ErrInvalidBatch)
+	}
+	if op.Op == "create" {
+		if op.Ref != "" {
+			if _, dup := r.refs[op.Ref]; dup {
+				return 0, fmt.Errorf("%w: duplicate ref %q", ErrInvalidBatch, op.Ref)
+			}
+		}
+		id, err := r.create(op)
+		if err != nil {
+			return 0, err
+		}
+		if op.Ref != "" {
+			r.refs[op.Ref] = id
+		}
+		return id, nil
+	}
+
+	id, err := r.resolveID(op.ID, "id")
+	if err != nil {
+		return 0, err
+	}
+	if err := r.usable(op.Type, id); err != nil {
+		return 0, err
+	}
+	switch op.Op {
+	case "update":
+		return id, r.update(op, id)
+	case "delete":
+		if err := r.require(op.Type, id, "admin"); err != nil {
+			return 0, err
+		}
+		if err := r.exists(op.Type, id); err != nil {
+			return 0, err
+		}
+		r.deleted[op.Type+":"+fmt.Sprint(id)] = true
+		r.deletes = append(r.deletes, batchDelete{index: index, typ: op.Type, id: id})
+		return id, nil
+	case "move":
+		return id, r.move(op, id)
+	}
+	return 0, fmt.Errorf("%w: unknown op %q", ErrInvalidBatch, op.Op)
+}
+
+func (r *batchRunner) create(op *BatchOperation) (int64, error) {
+	data, err := r.resolveData(op.Data)
+	if err != nil {
+		return 0, err
+	}
+	switch op.Type {
+	case "project":
+		var p Project
+		if err := json.Unmarshal(data, &p); err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidBatch, err)
+		}
+		p.CreatorID = r.userID
+		id, err := CreateProject(r.db, &p)
+		if err != nil {
+			return 0, err
+		}
+		return id, r.grantCreator("project", id)
+
+	case "list":
+		var cl ContentList
+		if err := json.Unmarshal(data, &cl); err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidBatch, err)
+		}
+		if err := r.usable("project", cl.ProjectID); err != nil {
+			return 0, err
+		}
+		if err := r.require("project", cl.ProjectID, "write"); err != nil {
+			return 0, err
+		}
+		if err := ValidateListPolicy(&cl); err != nil {
+			return 0, err
+		}
+		cl.CreatorID = r.userID
+		if err := r.checkItems(&cl); err != nil {
+			return 0, err
+		}
+		if err := CheckListUpdate(r.db, &cl, nil, r.userID); err != nil {
+			return 0, err
+		}
+		id, err := CreateContentList(r.db, &cl)
+		if err != nil {
+			return 0, err
+		}
+		return id, r.grantCreator("content_list", id)
+
+	case "entry":
+		var ce ContentEntry
+		if err := json.Unmarshal(data, &ce); err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidBatch, err)
+		}
+		if err := r.usable("project", ce.ProjectID); err != nil {
+			return 0, err
+		}
+		if err := r.require("project", ce.ProjectID, "write"); err != nil {
+			return 0, err
+		}
+		ce.CreatorID = r.userID
+		if err := ValidateAssignees(r.db, ce.ProjectID, ce.Assignees); err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidBatch, err)
+		}
+		var cl *ContentList
+		if len(op.ListID) > 0 {
+			listID, err := r.resolveID(op.ListID, "list_id")
+			if err != nil {
+				return 0, err
+			}
+			if cl, err = r.writableList(listID); err != nil {
+				return 0, err
+			}
+			if cl.ProjectID != ce.ProjectID {
+				return 0, fmt.Errorf("%w: list %d is not in project %d", ErrInvalidBatch, listID, ce.ProjectID)
+			}
+			if err := CheckListPolicy(r.db, cl, []ContentEntry{ce}, len(cl.Items), len(cl.Items)+1, r.userID); err != nil {
+				return 0, err
+			}
+		}
+		id, err := CreateContentEntry(r.db, &ce)
+		if err != nil {
+			return 0, err
+		}
+		if err := r.grantCreator("content_entry", id); err != nil {
+			return 0, err
+		}
+		if cl != nil {
+			cl.Items = insertID(cl.Items, id, positionOf(op))
+			cl.UpdatedBy = r.userID
+			if err := UpdateContentList(r.db, cl.ID, cl); err != nil {
+				return 0, err
+			}
+		}
+		return id, nil
+	}
+	return 0, fmt.Errorf("%w: unknown type %q", ErrInvalidBatch, op.Type)
+}
+
+// update applies Data onto the stored object, so omitted fields keep their values. Lists and
+// entries only take the fields of ContentListUpdate and ContentEntryUpdate.
+func (r *batchRunner) update(op *BatchOperation, id int64) error {
+	if err := r.require(op.Type, id, "write"); err != nil {
+		return err
+	}
+	data, err := r.resolveData(op.Data)
+	if err != nil {
+		return err
+	}
+	switch op.Type {
+	case "project":
+		existing, err := GetProject(r.db, id)
+		if err != nil {
+			return fmt.Errorf("%w: project %d", ErrBatchNotFound, id)
+		}
+		p := *existing
+		if err := json.Unmarshal(data, &p); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBatch, err)
+		}
+		p.UpdatedBy = r.userID
+		return UpdateProject(r.db, id, &p)
+
+	case "list":
+		existing, err := GetContentList(r.db, id)
+		if err != nil {
+			return fmt.Errorf("%w: list %d", ErrBatchNotFound, id)
+		}
+		var upd ContentListUpdate
+		if err := json.Unmarshal(data, &upd); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBatch, err)
+		}
+		cl := *existing
+		upd.Apply(&cl)
+		if err := ValidateListPolicy(&cl); err != nil {
+			return err
+		}
+		if ListPolicyChanged(existing, &cl) {
+			admin, err := IsListAdmin(r.db, r.userID, existing)
+			if err != nil {
+				return err
+			}
+			if !admin {
+				return fmt.Errorf("%w: only list admins can change the list policy", ErrBatchForbidden)
+			}
+		}
+		if err := r.checkItems(&cl); err != nil {
+			return err
+		}
+		if err := CheckListUpdate(r.db, &cl, existing.Items, r.userID); err != nil {
+			return err
+		}
+		cl.UpdatedBy = r.userID
+		return UpdateContentList(r.db, id, &cl)
+
+	case "entry":
+		existing, err := GetContentEntry(r.db, id)
+		if err != nil {
+			return fmt.Errorf("%w: entry %d", ErrBatchNotFound, id)
+		}
+		var upd ContentEntryUpdate
+		if err := json.Unmarshal(data, &upd); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBatch, err)
+		}
+		ce := *existing
+		upd.Apply(&ce)
+		if err := ValidateAssignees(r.db, ce.ProjectID, AddedAssignees(existing.Assignees, ce.Assignees)); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBatch, err)
+		}
+		ce.UpdatedBy = r.userID
+		return UpdateContentEntry(r.db, id, &ce)
+	}
+	return fmt.Errorf("%w: unknown type %q", ErrInvalidBatch, op.Type)
+}
+
+func (r *batchRunner) move(op *BatchOperation, id int64) error {
+	policy, err := ValidatePermissionPolicy(op.PermissionPolicy)
+	if err != nil {
+		return err
+	}
+	if err := r.require(op.Type, id, "write"); err != nil {
+		return err
+	}
+	switch op.Type {
+	case "entry":
+		targetID, err := r.resolveID(op.TargetListID, "target_list_id")
+		if err != nil {
+			return err
+		}
+		if err := r.usable("list", targetID); err != nil {
+			return err
+		}
+		target, err := GetContentList(r.db, targetID)
+		if err != nil {
+			return fmt.Errorf("%w: list %d", ErrBatchNotFound, targetID)
+		}
+		if err := r.require("project", target.ProjectID, "write"); err != nil {
+			return err
+		}
+		ce, err := GetContentEntry(r.db, id)
+		if err != nil {
+			return fmt.Errorf("%w: entry %d", ErrBatchNotFound, id)
+		}
+		if !containsID(target.Items, id) {
+			if err := CheckListPolicy(r.db, target, []ContentEntry{*ce}, len(target.Items), len(target.Items)+1, r.userID); err != nil {
+				return err
+			}
+		}
+		return moveContentEntry(r.db, id, targetID, positionOf(op), r.userID, policy)
+
+	case "list":
+		targetID, err := r.resolveID(op.TargetProjectID, "target_project_id")
+		if err != nil {
+			return err
+		}
+		if err := r.usable("project", targetID); err != nil {
+			return err
+		}
+		if err := r.require("project", targetID, "write"); err != nil {
+			return err
+		}
+		return moveContentList(r.db, id, targetID, r.userID, policy)
+	}
+	return fmt.Errorf("%w: %s cannot be moved", ErrInvalidBatch, op.Type)
+}
+
+// delete removes an object together with the rows that belong to it.
+func (r *batchRunner) delete(d batchDelete) error {
+	switch d.typ {
+	case "project":
+		if err := r.deleteAttachments("project_id", d.id); err != nil {
+			return err
+		}
+		return DeleteProject(r.db, d.id)
+	case "list":
+		return DeleteContentList(r.db, d.id)
+	case "entry":
+		ce, err := GetContentEntry(r.db, d.id)
+		if err != nil {
+			return err
+		}
+		lists, err := GetContentListsByProject(r.db, ce.ProjectID)
+		if err != nil {
+			return err
+		}
+		for _, cl := range lists {
+			if !containsID(cl.Items, d.id) {
+				continue
+			}
+			cl.Items = removeID(cl.Items, d.id)
+			cl.UpdatedBy = r.userID
+			if err := UpdateContentList(r.db, cl.ID, &cl); err != nil {
+				return err
+			}
+		}
+		if err := r.deleteAttachments("entry_id", d.id); err != nil {
+			return err
+		}
+		return DeleteContentEntry(r.db, d.id)
+	}
+	return nil
+}
+
+// deleteAttachments removes attachment rows, keeping their blobs until the batch has committed.
+func (r *batchRunner) deleteAttachments(column string, id int64) error {
+	hashes, err := deleteAttachmentRows(r.db, column, id)
+	if err != nil {
+		return err
+	}
+	r.hashes = append(r.hashes, hashes...)
+	return nil
+}
+
+// checkItems makes sure every item of a list is an existing entry of the list's project.
+func (r *batchRunner) checkItems(cl *ContentList) error {
+	for _, entryID := range cl.Items {
+		if err := r.usable("entry", entryID); err != nil {
+			return err
+		}
+		ce, err := GetContentEntry(r.db, entryID)
+		if err != nil {
+			return fmt.Errorf("%w: entry %d", ErrBatchNotFound, entryID)
+		}
+		if ce.ProjectID != cl.ProjectID {
+			return fmt.Errorf("%w: entry %d is not in project %d", ErrInvalidBatch, entryID, cl.ProjectID)
+		}
+	}
+	return nil
+}
+
+func (r *batchRunner) writableList(id int64) (*ContentList, error) {
+	if err := r.usable("list", id); err != nil {
+		return nil, err
+	}
+	if err := r.require("list", id, "write"); err != nil {
+		return nil, err
+	}
+	cl, err := GetContentList(r.db, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: list %d", ErrBatchNotFound, id)
+	}
+	return cl, nil
+}
+
+func (r *batchRunner) require(typ string, id int64, action string) error {
+	ok, err := HasPermission(r.db, r.userID, batchContentTypes[typ], id, action)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s permission on %s %d is required", ErrBatchForbidden, action, typ, id)
+	}
+	return nil
+}
+
+func (r *batchRunner) exists(typ string, id int64) error {
+	var err error
+	switch typ {
+	case "project":
+		_, err = GetProject(r.db, id)
+	case "list":
+		_, err = GetContentList(r.db, id)
+	case "entry":
+		_, err = GetContentEntry(r.db, id)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s %d", ErrBatchNotFound, typ, id)
+	}
+	return nil
+}
+
+// usable rejects objects deleted by an earlier operation of the batch.
+func (r *batchRunner) usable(typ string, id int64) error {
+	if r.deleted[typ+":"+fmt.Sprint(id)] {
+		return fmt.Errorf("%w: %s %d is deleted earlier in this batch", ErrInvalidBatch, typ, id)
+	}
+	return nil
+}
+
+func (r *batchRunner) grantCreator(contentType string, id int64) error {
+	for _, action := range []string{"admin", "read"} {
+		if err := grantDetailPermission(r.db, r.userID, contentType, id, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveID reads a number or a "$name" reference.
+func (r *batchRunner) resolveID(raw json.RawMessage, field string) (int64, error) {
+	if len(raw) == 0 {
+		return 0, fmt.Errorf("%w: %s is required", ErrInvalidBatch, field)
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return 0, fmt.Errorf("%w: %s: %v", ErrInvalidBatch, field, err)
+	}
+	return r.resolveValue(v, field)
+}
+
+func (r *batchRunner) resolveValue(v interface{}, field string) (int64, error) {
+	switch v := v.(type) {
+	case float64:
+		return int64(v), nil
+	case string:
+		if !strings.HasPrefix(v, "$") {
+			return 0, fmt.Errorf("%w: %s must be a number or a $reference", ErrInvalidBatch, field)
+		}
+		id, ok := r.refs[v[1:]]
+		if !ok {
+			return 0, fmt.Errorf("%w: unknown reference %q", ErrInvalidBatch, v)
+		}
+		return id, nil
+	}
+	return 0, fmt.Errorf("%w: %s must be a number or a $reference", ErrInvalidBatch, field)
+}
+
+// resolveData replaces references in the project_id and items fields of Data with IDs.
+func (r *batchRunner) resolveData(raw json.RawMessage) (json.RawMessage, error) {
+	if len(raw) == 0 {
+		return json.RawMessage("{}"), nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("%w: data must be an object: %v", ErrInvalidBatch, err)
+	}
+	for _, key := range batchRefFields {
+		v, ok := fields[key]
+		if !ok || v == nil {
+			continue
+		}
+		if items, isList := v.([]interface{}); isList {
+			ids := make([]int64, len(items))
+			for i, item := range items {
+				id, err := r.resolveValue(item, key)
+				if err != nil {
+					return nil, err
+				}
+				ids[i] = id
+			}
+			fields[key] = ids
+			continue
+		}
+		id, err := r.resolveValue(v, key)
+		if err != nil {
+			return nil, err
+		}
+		fields[key] = id
+	}
+	return json.Marshal(fields)
+}
+
+func positionOf(op *BatchOperation) int {
+	if op.Position == nil {
+		return -1
+	}
+	return *op.Position
+}
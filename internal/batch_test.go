@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/Kaguya154/dbhelper"
+)
+
+func batchOps(t *testing.T, src string) []BatchOperation {
+	t.Helper()
+	var ops []BatchOperation
+	if err := json.Unmarshal([]byte(src), &ops); err != nil {
+		t.Fatalf("解析批量操作失败: %v", err)
+	}
+	return ops
+}
+
+func TestRunBatchResolvesReferences(t *testing.T) {
+	db := newTestDB(t)
+
+	ops := batchOps(t, `[
+		{"op": "create", "type": "project", "ref": "p", "data": {"name": "Board"}},
+		{"op": "create", "type": "list", "ref": "todo", "data": {"title": "Todo", "project_id": "$p"}},
+		{"op": "create", "type": "list", "ref": "done", "data": {"title": "Done", "project_id": "$p"}},
+		{"op": "create", "type": "entry", "ref": "e1", "list_id": "$todo", "data": {"title": "E1", "project_id": "$p"}},
+		{"op": "create", "type": "entry", "ref": "e2", "list_id": "$todo", "position": 0, "data": {"title": "E2", "project_id": "$p"}},
+		{"op": "update", "type": "entry", "id": "$e1", "data": {"content": "body"}},
+		{"op": "move", "type": "entry", "id": "$e1", "target_list_id": "$done"}
+	]`)
+	results, err := RunBatch(context.Background(), db, nil, 1, ops)
+	if err != nil {
+		t.Fatalf("批量操作失败: %v", err)
+	}
+	if len(results) != len(ops) {
+		t.Fatalf("每个操作都应有结果: %+v", results)
+	}
+	projectID, todoID, doneID, e1, e2 := results[0].ID, results[1].ID, results[2].ID, results[3].ID, results[4].ID
+
+	todo, _ := GetContentList(db, todoID)
+	done, _ := GetContentList(db, doneID)
+	if todo.ProjectID != projectID || len(todo.Items) != 1 || todo.Items[0] != e2 {
+		t.Fatalf("Todo 应只剩 E2: %+v", todo)
+	}
+	if len(done.Items) != 1 || done.Items[0] != e1 {
+		t.Fatalf("E1 应移动到 Done: %+v", done)
+	}
+	entry, _ := GetContentEntry(db, e1)
+	if entry.Title != "E1" || entry.Content != "body" || entry.CreatorID != 1 {
+		t.Fatalf("update 应只修改提供的字段: %+v", entry)
+	}
+	if ok, _ := HasPermission(db, 1, "project", projectID, "admin"); !ok {
+		t.Fatal("创建者应获得新项目的 admin 权限")
+	}
+}
+
+func TestRunBatchRollsBackOnFailure(t *testing.T) {
+	db := newTestDB(t)
+
+	projectID, _ := CreateProject(db, &Project{Name: "Board"})
+	grant(t, db, 1, "project", projectID, "write")
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: projectID})
+	grant(t, db, 1, "content_entry", e1, "admin")
+	listID, _ := CreateContentList(db, &ContentList{Title: "L", ProjectID: projectID, Items: []int64{e1}})
+
+	// 用户 1 没有列表的写权限，第 3 个操作失败
+	ops := batchOps(t, `[
+		{"op": "create", "type": "entry", "ref": "e", "data": {"title": "New", "project_id": 1}},
+		{"op": "delete", "type": "entry", "id": 1},
+		{"op": "update", "type": "list", "id": 1, "data": {"title": "Renamed"}}
+	]`)
+	results, err := RunBatch(context.Background(), db, nil, 1, ops)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 2 || !errors.Is(err, ErrBatchForbidden) {
+		t.Fatalf("应报告第 3 个操作无权限, got %v", err)
+	}
+	if len(results) != 3 || results[2].Error == "" {
+		t.Fatalf("结果应包含失败的操作: %+v", results)
+	}
+
+	entries, _ := GetContentEntries(db)
+	cl, _ := GetContentList(db, listID)
+	if len(entries) != 1 || entries[0].ID != e1 || cl.Title != "L" || len(cl.Items) != 1 {
+		t.Fatalf("失败的批次不应留下任何修改: entries=%+v list=%+v", entries, cl)
+	}
+
+	_, err = RunBatch(context.Background(), db, nil, 1, batchOps(t, `[
+		{"op": "delete", "type": "entry", "id": 1},
+		{"op": "update", "type": "entry", "id": 1, "data": {"title": "x"}}
+	]`))
+	if !errors.Is(err, ErrInvalidBatch) {
+		t.Fatalf("不应允许使用本批次已删除的对象, got %v", err)
+	}
+	if _, err := RunBatch(context.Background(), db, nil, 1, batchOps(t, `[{"op": "update", "type": "entry", "id": "$missing"}]`)); !errors.Is(err, ErrInvalidBatch) {
+		t.Fatalf("未知引用应被拒绝, got %v", err)
+	}
+
+	if _, err := RunBatch(context.Background(), db, nil, 1, batchOps(t, `[{"op": "delete", "type": "entry", "id": 1}]`)); err != nil {
+		t.Fatalf("删除条目失败: %v", err)
+	}
+	cl, _ = GetContentList(db, listID)
+	if _, err := GetContentEntry(db, e1); err == nil || len(cl.Items) != 0 {
+		t.Fatalf("删除条目后应从列表中移除: %+v", cl)
+	}
+}
+
+func TestRunBatchRestoresDeletedEntries(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建存储失败: %v", err)
+	}
+	projectID, _ := CreateProject(db, &Project{Name: "Board"})
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: projectID})
+	e2, _ := CreateContentEntry(db, &ContentEntry{Title: "E2", ProjectID: projectID})
+	grant(t, db, 1, "content_entry", e1, "admin")
+	grant(t, db, 1, "content_entry", e2, "admin")
+	labelID, _ := CreateLabel(db, &Label{Name: "Bug", ProjectID: projectID})
+	AddEntryLabel(db, e1, labelID, 1)
+	CreateEntryComment(db, &EntryComment{EntryID: e1, AuthorID: 1, Body: "note"})
+	CreateEntryRelation(db, &EntryRelation{SourceID: e1, TargetID: e2, Type: RelationBlocks, CreatorID: 1})
+	content := []byte("hello")
+	hash, _ := StoreAttachmentBlob(ctx, store, bytes.NewReader(content), int64(len(content)), "text/plain")
+	attachmentID, _ := CreateAttachment(db, &Attachment{EntryID: e1, ProjectID: projectID, Filename: "a.txt", Hash: hash})
+
+	// 第二个删除在写入时失败
+	trigger := "CREATE TRIGGER keep_e2 BEFORE DELETE ON content_entry WHEN OLD.id = " + strconv.FormatInt(e2, 10) + " BEGIN SELECT RAISE(ABORT, 'locked'); END"
+	if _, err := db.Exec(dbhelper.Cond().Raw(trigger).Build()); err != nil {
+		t.Fatalf("创建触发器失败: %v", err)
+	}
+	ops := batchOps(t, `[{"op": "delete", "type": "entry", "id": 1}, {"op": "delete", "type": "entry", "id": 2}]`)
+	_, err = RunBatch(ctx, db, store, 1, ops)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 {
+		t.Fatalf("应报告第 2 个删除失败, got %v", err)
+	}
+	ce, err := GetContentEntry(db, e1)
+	if err != nil || ce.Title != "E1" || len(ce.Labels) != 1 {
+		t.Fatalf("第一个条目应恢复: %v %+v", err, ce)
+	}
+	if comments, _ := GetEntryComments(db, e1); len(comments) != 1 {
+		t.Fatalf("评论应恢复: %+v", comments)
+	}
+	if relations, _ := db.Query("entry_relation", dbhelper.Cond().Eq("source_id", e1).Build()); relations.Count() != 1 {
+		t.Fatal("关联应恢复")
+	}
+	if a, err := GetAttachment(db, attachmentID); err != nil || a.Hash != hash {
+		t.Fatalf("附件应以原 ID 恢复: %v %+v", err, a)
+	}
+	if ok, _ := store.Exists(ctx, hash); !ok {
+		t.Fatal("失败的批次不应删除附件内容")
+	}
+
+	db.Exec(dbhelper.Cond().Raw("DROP TRIGGER keep_e2").Build())
+	if _, err := RunBatch(ctx, db, store, 1, ops); err != nil {
+		t.Fatalf("删除条目失败: %v", err)
+	}
+	if ok, _ := store.Exists(ctx, hash); ok {
+		t.Fatal("批次成功后应释放附件内容")
+	}
+}
+
+func TestRunBatchValidatesOnlyAddedAssignees(t *testing.T) {
+	db := newTestDB(t)
+	projectID, _ := CreateProject(db, &Project{Name: "Board"})
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: projectID, Assignees: []int64{7}})
+	grant(t, db, 1, "content_entry", e1, "write")
+	grant(t, db, 8, "project", projectID, "read")
+
+	// 用户 7 已失去项目权限，不影响其他修改
+	if _, err := RunBatch(context.Background(), db, nil, 1, batchOps(t, `[{"op": "update", "type": "entry", "id": 1, "data": {"title": "Renamed", "assignees": [7, 8]}}]`)); err != nil {
+		t.Fatalf("保留原负责人的更新应成功: %v", err)
+	}
+	if ce, _ := GetContentEntry(db, e1); ce.Title != "Renamed" || len(ce.Assignees) != 2 {
+		t.Fatalf("更新未生效: %+v", ce)
+	}
+	if _, err := RunBatch(context.Background(), db, nil, 1, batchOps(t, `[{"op": "update", "type": "entry", "id": 1, "data": {"assignees": [7, 8, 9]}}]`)); !errors.Is(err, ErrInvalidBatch) {
+		t.Fatalf("新增无权限的负责人应被拒绝, got %v", err)
+	}
+}
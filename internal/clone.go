@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+// CloneProject deep-copies a project into a new project owned by ownerID: labels, custom field
+// definitions, lists with their policies and, if requested, the entries with their labels and
+// custom field values. Archived lists and entries, entries ownerID cannot read, comments,
+// attachments and relations are not copied, and assignees and user field values are cleared
+// because those users may have no access to the new project. If any step fails, nothing is
+// created (see runInTx).
+func CloneProject(db types.Conn, srcID int64, ownerID int64, opts CloneOptions) (*Project, error) {
+	src, err := GetProject(db, srcID)
+	if err != nil {
+		return nil, err
+	}
+	var p *Project
+	err = runInTx(db, "CloneProject", func(db types.Conn) error {
+		p, err = cloneProject(db, src, ownerID, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func cloneProject(db types.Conn, src *Project, ownerID int64, opts CloneOptions) (*Project, error) {
+	p := &Project{
+		Name:        opts.Name,
+		Description: src.Description,
+		CreatorID:   ownerID,
+		IsTemplate:  opts.IsTemplate,
+	}
+	if p.Name == "" {
+		p.Name = src.Name + " (copy)"
+	}
+	if opts.Description != "" {
+		p.Description = opts.Description
+	}
+	id, err := CreateProject(db, p)
+	if err != nil {
+		return nil, err
+	}
+	p.ID = id
+
+	// 与 CreateProject 接口一致，创建者获得项目的 admin 和 read 权限
+	for _, action := range []string{"admin", "read"} {
+		if _, err := CreateDetailPermission(db, &DetailPermission{UserID: ownerID, ContentType: "project", ContentIDs: []int64{p.ID}, Action: action}); err != nil {
+			return nil, err
+		}
+	}
+
+	labels, err := GetLabelsByProject(db, src.ID)
+	if err != nil {
+		return nil, err
+	}
+	labelMap := make(map[int64]int64, len(labels))
+	for _, l := range labels {
+		l.ProjectID = p.ID
+		newID, err := CreateLabel(db, &l)
+		if err != nil {
+			return nil, err
+		}
+		labelMap[l.ID] = newID
+	}
+
+	fields, err := GetCustomFieldsByProject(db, src.ID)
+	if err != nil {
+		return nil, err
+	}
+	fieldMap := make(map[int64]CustomField, len(fields))
+	for _, f := range fields {
+		oldID := f.ID
+		f.ProjectID = p.ID
+		f.ID, err = CreateCustomField(db, &f)
+		if err != nil {
+			return nil, err
+		}
+		fieldMap[oldID] = f
+	}
+
+	lists, err := GetContentListsByProject(db, src.ID)
+	if err != nil {
+		return nil, err
+	}
+	entryMap := make(map[int64]int64)
+	for _, cl := range ActiveContentLists(lists) {
+		items := make([]int64, 0, len(cl.Items))
+		if opts.IncludeEntries {
+			for _, oldID := range cl.Items {
+				newID, ok := entryMap[oldID]
+				if !ok {
+					newID, err = cloneEntry(db, oldID, p.ID, ownerID, labelMap, fieldMap)
+					if err != nil {
+						return nil, err
+					}
+					if newID == 0 {
+						continue
+					}
+					entryMap[oldID] = newID
+				}
+				items = append(items, newID)
+			}
+		}
+		cl.ID = 0
+		cl.Items = items
+		cl.ProjectID = p.ID
+		cl.CreatorID = ownerID
+		listID, err := CreateContentList(db, &cl)
+		if err != nil {
+			return nil, err
+		}
+		// 权限不从项目继承到列表和条目，与创建接口一致地授予 owner
+		for _, action := range []string{"admin", "read"} {
+			if err := grantDetailPermission(db, ownerID, "content_list", listID, action); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return p, nil
+}
+
+// cloneEntry copies one entry into the project and returns its new ID, or 0 if the source entry
+// no longer exists, is archived or is not readable by ownerID.
+func cloneEntry(db types.Conn, srcID, projectID, ownerID int64, labelMap map[int64]int64, fieldMap map[int64]CustomField) (int64, error) {
+	readable, err := HasPermission(db, ownerID, "content_entry", srcID, "read")
+	if err != nil || !readable {
+		return 0, err
+	}
+	ce, err := GetContentEntry(db, srcID)
+	if err != nil || ce.ArchivedAt != 0 {
+		return 0, nil
+	}
+	clone := ContentEntry{
+		Type:      ce.Type,
+		Title:     ce.Title,
+		Content:   ce.Content,
+		CreatorID: ownerID,
+		ProjectID: projectID,
+		StartAt:   ce.StartAt,
+		DueAt:     ce.DueAt,
+	}
+	id, err := CreateContentEntry(db, &clone)
+	if err != nil {
+		return 0, err
+	}
+	for _, action := range []string{"admin", "read"} {
+		if err := grantDetailPermission(db, ownerID, "content_entry", id, action); err != nil {
+			return 0, err
+		}
+	}
+	for _, labelID := range ce.Labels {
+		if newLabelID, ok := labelMap[labelID]; ok {
+			if _, err := addEntryLabel(db, id, newLabelID); err != nil {
+				return 0, err
+			}
+		}
+	}
+	for _, v := range ce.CustomFields {
+		f, ok := fieldMap[v.FieldID]
+		// 用户字段与负责人一样清空
+		if !ok || f.Type == CustomFieldTypeUser {
+			continue
+		}
+		if err := setCustomFieldValue(db, id, &f, v.Value); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// GetTemplatesForUser returns the template projects the user can read.
+func GetTemplatesForUser(db types.Conn, userID int64) ([]Project, error) {
+	projects, err := GetProjectsForUser(db, userID)
+	if err != nil {
+		return []Project{}, err
+	}
+	templates := make([]Project, 0)
+	for _, p := range projects {
+		if p.IsTemplate {
+			templates = append(templates, p)
+		}
+	}
+	return templates, nil
+}
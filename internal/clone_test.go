@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/Kaguya154/dbhelper"
+)
+
+func TestCloneProjectRemapsIDs(t *testing.T) {
+	db := newTestDB(t)
+
+	srcID, _ := CreateProject(db, &Project{Name: "Base", Description: "desc", CreatorID: 1, IsTemplate: true})
+	labelID, _ := CreateLabel(db, &Label{ProjectID: srcID, Name: "bug", Color: "#ff0000"})
+	field := CustomField{ProjectID: srcID, Name: "Priority", Type: CustomFieldTypeSingleSelect, Options: []string{"high", "low"}}
+	field.ID, _ = CreateCustomField(db, &field)
+
+	e1, _ := CreateContentEntry(db, &ContentEntry{Type: "task", Title: "E1", ProjectID: srcID, Assignees: []int64{1}})
+	e2, _ := CreateContentEntry(db, &ContentEntry{Type: "task", Title: "E2", ProjectID: srcID})
+	e3, _ := CreateContentEntry(db, &ContentEntry{Type: "task", Title: "E3", ProjectID: srcID})
+	private, _ := CreateContentEntry(db, &ContentEntry{Type: "task", Title: "Private", ProjectID: srcID})
+	for _, id := range []int64{e1, e2, e3} {
+		grant(t, db, 2, "content_entry", id, "read")
+	}
+	AddEntryLabel(db, e1, labelID, 1)
+	SetCustomFieldValue(db, e1, &field, "high", 1)
+	owner := CustomField{ProjectID: srcID, Name: "Owner", Type: CustomFieldTypeUser}
+	owner.ID, _ = CreateCustomField(db, &owner)
+	SetCustomFieldValue(db, e1, &owner, int64(1), 1)
+	CreateContentList(db, &ContentList{Title: "Backlog", ProjectID: srcID, Items: []int64{e2, private, e1}})
+	CreateContentList(db, &ContentList{Title: "Doing", ProjectID: srcID, Items: []int64{e3}, MaxItems: 2})
+	ArchiveContentEntry(db, e3, 100)
+
+	p, err := CloneProject(db, srcID, 2, CloneOptions{IncludeEntries: true})
+	if err != nil {
+		t.Fatalf("克隆项目失败: %v", err)
+	}
+	if p.Name != "Base (copy)" || p.Description != "desc" || p.CreatorID != 2 || p.IsTemplate {
+		t.Fatalf("新项目属性错误: %+v", p)
+	}
+	if ok, _ := HasPermission(db, 2, "project", p.ID, "admin"); !ok {
+		t.Fatal("调用者应获得新项目的 admin 权限")
+	}
+
+	labels, _ := GetLabelsByProject(db, p.ID)
+	fields, _ := GetCustomFieldsByProject(db, p.ID)
+	if len(labels) != 1 || labels[0].ID == labelID || len(fields) != 2 || fields[0].ID == field.ID {
+		t.Fatalf("标签和自定义字段应复制为新记录: %+v %+v", labels, fields)
+	}
+
+	lists, _ := GetContentListsByProject(db, p.ID)
+	if len(lists) != 2 {
+		t.Fatalf("应复制 2 个列表, got %d", len(lists))
+	}
+	backlog, doing := lists[0], lists[1]
+	if doing.MaxItems != 2 || len(doing.Items) != 0 {
+		t.Fatalf("列表策略应保留，已归档条目不应复制: %+v", doing)
+	}
+	if len(backlog.Items) != 2 {
+		t.Fatalf("Backlog 应只复制调用者可读的 2 个条目: %v", backlog.Items)
+	}
+	first, _ := GetContentEntry(db, backlog.Items[0])
+	second, _ := GetContentEntry(db, backlog.Items[1])
+	if first.Title != "E2" || second.Title != "E1" || first.ProjectID != p.ID || backlog.Items[1] == e1 {
+		t.Fatalf("Items 应按原顺序映射到新条目: %+v %+v", first, second)
+	}
+	if len(second.Assignees) != 0 || len(second.Labels) != 1 || second.Labels[0] != labels[0].ID {
+		t.Fatalf("克隆条目应清空负责人并映射标签: %+v", second)
+	}
+	if CustomFieldValueOf(second, fields[0].ID) != "high" || CustomFieldValueOf(second, fields[1].ID) != nil {
+		t.Fatalf("自定义字段值应映射到新字段，用户字段应清空: %+v", second.CustomFields)
+	}
+	for _, action := range []string{"read", "write"} {
+		if ok, _ := HasPermission(db, 2, "content_entry", second.ID, action); !ok {
+			t.Fatalf("调用者应能%s克隆的条目", action)
+		}
+		if ok, _ := HasPermission(db, 2, "content_list", backlog.ID, action); !ok {
+			t.Fatalf("调用者应能%s克隆的列表", action)
+		}
+	}
+	second.Title = "E1 edited"
+	if err := UpdateContentEntry(db, second.ID, second); err != nil {
+		t.Fatalf("更新克隆的条目失败: %v", err)
+	}
+
+	structure, err := CloneProject(db, srcID, 2, CloneOptions{Name: "Empty"})
+	if err != nil {
+		t.Fatalf("克隆结构失败: %v", err)
+	}
+	lists, _ = GetContentListsByProject(db, structure.ID)
+	if structure.Name != "Empty" || len(lists) != 2 || len(lists[0].Items) != 0 {
+		t.Fatalf("不含条目的克隆只应复制结构: %+v %+v", structure, lists)
+	}
+}
+
+func TestCloneProjectRollsBackOnFailure(t *testing.T) {
+	db := newTestDB(t)
+
+	srcID, _ := CreateProject(db, &Project{Name: "Base", CreatorID: 1})
+	CreateLabel(db, &Label{ProjectID: srcID, Name: "bug"})
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: srcID})
+	CreateContentList(db, &ContentList{Title: "Backlog", ProjectID: srcID, Items: []int64{e1}})
+
+	// 删除 content_list 表，使克隆在写入列表时失败
+	if _, err := db.Exec(dbhelper.Cond().Raw("DROP TABLE content_list").Build()); err != nil {
+		t.Fatalf("删除表失败: %v", err)
+	}
+	if _, err := CloneProject(db, srcID, 2, CloneOptions{IncludeEntries: true}); err == nil {
+		t.Fatal("写入列表失败时克隆应报错")
+	}
+
+	projects, _ := GetProjects(db)
+	entries, _ := GetContentEntries(db)
+	labels, _ := GetLabelsByProject(db, srcID+1)
+	if len(projects) != 1 || len(entries) != 1 || len(labels) != 0 {
+		t.Fatalf("克隆失败后不应留下任何记录: projects=%d entries=%d labels=%d", len(projects), len(entries), len(labels))
+	}
+	if dps, _ := GetDetailPermissions(db); len(dps) != 0 {
+		t.Fatalf("克隆失败后不应留下权限记录: %+v", dps)
+	}
+}
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+var (
+	// mentionPattern matches @username where username follows GitHub's rules.
+	mentionPattern = regexp.MustCompile(`(?:^|[^\w@/.])@([A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?)`)
+	// codeBlockPattern and codeSpanPattern strip markdown code so that @ inside code is not a mention.
+	codeBlockPattern = regexp.MustCompile("(?s)```.*?```")
+	codeSpanPattern  = regexp.MustCompile("`[^`\n]*`")
+)
+
+// ParseMentions returns the distinct usernames mentioned with @ in a markdown body, in order of
+// first appearance. Mentions inside code spans and fenced code blocks are ignored.
+func ParseMentions(body string) []string {
+	text := codeBlockPattern.ReplaceAllString(body, " ")
+	text = codeSpanPattern.ReplaceAllString(text, " ")
+
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		key := strings.ToLower(m[1])
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// ResolveMentions maps the @usernames in body to the IDs of project members. Names that do not
+// belong to a member are ignored; matching is case-insensitive.
+func ResolveMentions(db types.Conn, projectID int64, body string) ([]int64, error) {
+	names := ParseMentions(body)
+	if len(names) == 0 {
+		return []int64{}, nil
+	}
+	members, err := GetProjectPermissions(db, projectID)
+	if err != nil {
+		return []int64{}, err
+	}
+	byName := make(map[string]int64, len(members))
+	for _, m := range members {
+		byName[strings.ToLower(m.Username)] = m.UserID
+	}
+	ids := make([]int64, 0, len(names))
+	for _, name := range names {
+		if id, ok := byName[strings.ToLower(name)]; ok {
+			ids = append(ids, id)
+		}
+	}
+	return normalizeIDs(ids), nil
+}
+
+// CanCommentOnEntry reports whether userID may comment on the entry, through comment permission
+// on its project or on the entry itself.
+func CanCommentOnEntry(db types.Conn, userID int64, ce *ContentEntry) (bool, error) {
+	ok, err := HasPermission(db, userID, "project", ce.ProjectID, "comment")
+	if err != nil || ok {
+		return ok, err
+	}
+	return HasPermission(db, userID, "content_entry", ce.ID, "comment")
+}
+
+// EntryComment CRUD
+
+func CreateEntryComment(db types.Conn, ec *EntryComment) (int64, error) {
+	mentionsJson, _ := json.Marshal(normalizeIDs(ec.Mentions))
+	cond := dbhelper.Cond().Eq("entry_id", ec.EntryID).Eq("parent_id", ec.ParentID).Eq("author_id", ec.AuthorID).Eq("body", ec.Body).
+		Eq("mentions", string(mentionsJson)).Eq("deleted", 0).Eq("created_at", ec.CreatedAt).Eq("updated_at", ec.UpdatedAt).Build()
+	return db.Insert("entry_comment", cond)
+}
+
+func GetEntryComment(db types.Conn, id int64) (*EntryComment, error) {
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	rows, err := db.Query("entry_comment", cond)
+	if err != nil {
+		return nil, err
+	}
+	if rows.Count() == 0 {
+		return nil, errors.New("comment not found")
+	}
+	ec := entryCommentFromRow(rows.All()[0])
+	return &ec, nil
+}
+
+func UpdateEntryComment(db types.Conn, id int64, updates *EntryComment) error {
+	mentionsJson, _ := json.Marshal(normalizeIDs(updates.Mentions))
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	upd := dbhelper.Cond().Eq("body", updates.Body).Eq("mentions", string(mentionsJson)).Eq("updated_at", updates.UpdatedAt).Build()
+	_, err := db.Update("entry_comment", cond, upd)
+	return err
+}
+
+// DeleteEntryComment removes a comment. A comment that still has replies is blanked and marked
+// deleted instead, so the thread stays intact.
+func DeleteEntryComment(db types.Conn, id int64, now int64) error {
+	replyCond := dbhelper.Cond().Eq("parent_id", id).Build()
+	replies, err := db.Query("entry_comment", replyCond)
+	if err != nil {
+		return err
+	}
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	if replies.Count() > 0 {
+		upd := dbhelper.Cond().Eq("body", "").Eq("mentions", "[]").Eq("deleted", 1).Eq("updated_at", now).Build()
+		_, err = db.Update("entry_comment", cond, upd)
+		return err
+	}
+	_, err = db.Delete("entry_comment", cond)
+	return err
+}
+
+// GetEntryComments returns all comments of an entry in creation order. Clients build the thread
+// tree from ParentID.
+func GetEntryComments(db types.Conn, entryID int64) ([]EntryComment, error) {
+	cond := dbhelper.Cond().Eq("entry_id", entryID).Build()
+	rows, err := db.Query("entry_comment", cond)
+	if err != nil {
+		return []EntryComment{}, err
+	}
+	comments := make([]EntryComment, 0)
+	for _, data := range rows.All() {
+		comments = append(comments, entryCommentFromRow(data))
+	}
+	return comments, nil
+}
+
+// DeleteEntryCommentsByEntry removes every comment of an entry.
+func DeleteEntryCommentsByEntry(db types.Conn, entryID int64) error {
+	cond := dbhelper.Cond().Eq("entry_id", entryID).Build()
+	_, err := db.Delete("entry_comment", cond)
+	return err
+}
+
+func entryCommentFromRow(data map[string]interface{}) EntryComment {
+	ec := EntryComment{
+		ID:        data["id"].(int64),
+		EntryID:   data["entry_id"].(int64),
+		ParentID:  asInt64(data["parent_id"]),
+		AuthorID:  data["author_id"].(int64),
+		Body:      asString(data["body"]),
+		Deleted:   asInt64(data["deleted"]) != 0,
+		CreatedAt: asInt64(data["created_at"]),
+		UpdatedAt: asInt64(data["updated_at"]),
+	}
+	if mentionsJson := asString(data["mentions"]); mentionsJson != "" {
+		json.Unmarshal([]byte(mentionsJson), &ec.Mentions)
+	}
+	ec.Mentions = normalizeIDs(ec.Mentions)
+	return ec
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	body := "@alice please check, cc @Bob and @alice again.\n" +
+		"Not a mention: mail@example.com, `@code`\n" +
+		"```\n@fenced\n```\n(@carol-d)"
+	got := ParseMentions(body)
+	want := []string{"alice", "Bob", "carol-d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("解析提及失败: got=%v want=%v", got, want)
+	}
+}
+
+func TestResolveMentionsOnlyProjectMembers(t *testing.T) {
+	db := newTestDB(t)
+
+	alice, _ := CreateUser(db, &User{Username: "alice"})
+	bob, _ := CreateUser(db, &User{Username: "bob"})
+	CreateUser(db, &User{Username: "mallory"})
+	grant(t, db, alice, "project", 1, "write")
+	grant(t, db, bob, "project", 1, "comment")
+
+	ids, err := ResolveMentions(db, 1, "@Alice @bob @mallory @nobody")
+	if err != nil {
+		t.Fatalf("解析提及失败: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []int64{alice, bob}) {
+		t.Fatalf("只应解析项目成员: got=%v", ids)
+	}
+}
+
+func TestCanCommentOnEntryThroughProject(t *testing.T) {
+	db := newTestDB(t)
+
+	bob, _ := CreateUser(db, &User{Username: "bob"})
+	carol, _ := CreateUser(db, &User{Username: "carol"})
+	grant(t, db, bob, "project", 1, "comment")
+	grant(t, db, carol, "project", 1, "read")
+	// 条目由其他用户创建，bob 在条目上没有单独授权
+	entryID, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: 1, CreatorID: 99})
+	ce, _ := GetContentEntry(db, entryID)
+
+	if ok, err := CanCommentOnEntry(db, bob, ce); err != nil || !ok {
+		t.Fatalf("项目评论者应能评论他人的条目: %v", err)
+	}
+	if ok, _ := CanCommentOnEntry(db, carol, ce); ok {
+		t.Fatal("只读成员不应能评论")
+	}
+	grant(t, db, carol, "content_entry", entryID, "comment")
+	if ok, _ := CanCommentOnEntry(db, carol, ce); !ok {
+		t.Fatal("条目级评论授权应仍然有效")
+	}
+}
+
+func TestDeleteEntryCommentKeepsThread(t *testing.T) {
+	db := newTestDB(t)
+
+	root, _ := CreateEntryComment(db, &EntryComment{EntryID: 1, AuthorID: 1, Body: "root"})
+	reply, _ := CreateEntryComment(db, &EntryComment{EntryID: 1, ParentID: root, AuthorID: 2, Body: "reply"})
+
+	if err := DeleteEntryComment(db, root, 100); err != nil {
+		t.Fatalf("删除评论失败: %v", err)
+	}
+	ec, err := GetEntryComment(db, root)
+	if err != nil || !ec.Deleted || ec.Body != "" {
+		t.Fatalf("有回复的评论应保留为占位: %+v, %v", ec, err)
+	}
+
+	if err := DeleteEntryComment(db, reply, 100); err != nil {
+		t.Fatalf("删除回复失败: %v", err)
+	}
+	if _, err := GetEntryComment(db, reply); err == nil {
+		t.Fatalf("无回复的评论应被直接删除")
+	}
+
+	comments, _ := GetEntryComments(db, 1)
+	if len(comments) != 1 {
+		t.Fatalf("评论数量错误: %+v", comments)
+	}
+}
@@ -11,8 +11,14 @@ import (
 // Project CRUD
 
 func CreateProject(db types.Conn, p *Project) (int64, error) {
-	cond := dbhelper.Cond().Eq("name", p.Name).Eq("description", p.Description).Eq("creator_id", p.CreatorID).Build()
-	return db.Insert("project", cond)
+	p.stampCreated(p.CreatorID)
+	cond := dbhelper.Cond().Eq("name", p.Name).Eq("description", p.Description).Eq("creator_id", p.CreatorID).Eq("is_template", boolToInt(p.IsTemplate)).
+		Eq("created_at", p.CreatedAt).Eq("updated_at", p.UpdatedAt).Eq("updated_by", p.UpdatedBy).Build()
+	id, err := db.Insert("project", cond)
+	if err != nil {
+		return 0, err
+	}
+	return id, RecordChange(db, "project", id, ChangeUpsert)
 }
 
 func GetProject(db types.Conn, id int64) (*Project, error) {
@@ -24,34 +30,64 @@ func GetProject(db types.Conn, id int64) (*Project, error) {
 	if rows.Count() == 0 {
 		return nil, errors.New("project not found")
 	}
-	data := rows.All()[0]
-	p := &Project{
+	p := projectFromRow(rows.All()[0])
+	return &p, nil
+}
+
+func UpdateProject(db types.Conn, id int64, updates *Project) error {
+	updates.stampUpdated()
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	upd := dbhelper.Cond().Eq("name", updates.Name).Eq("description", updates.Description).Eq("creator_id", updates.CreatorID).Eq("is_template", boolToInt(updates.IsTemplate)).
+		Eq("updated_at", updates.UpdatedAt).Eq("updated_by", updates.UpdatedBy).Build()
+	if _, err := db.Update("project", cond, upd); err != nil {
+		return err
+	}
+	return RecordChange(db, "project", id, ChangeUpsert)
+}
+
+func projectFromRow(data map[string]interface{}) Project {
+	return Project{
 		ID:          data["id"].(int64),
 		Name:        data["name"].(string),
 		Description: data["description"].(string),
 		CreatorID:   data["creator_id"].(int64),
+		IsTemplate:  asInt64(data["is_template"]) != 0,
+		Timestamps:  timestampsFromRow(data),
 	}
-	return p, nil
-}
-
-func UpdateProject(db types.Conn, id int64, updates *Project) error {
-	cond := dbhelper.Cond().Eq("id", id).Build()
-	upd := dbhelper.Cond().Eq("name", updates.Name).Eq("description", updates.Description).Eq("creator_id", updates.CreatorID).Build()
-	_, err := db.Update("project", cond, upd)
-	return err
 }
 
 func DeleteProject(db types.Conn, id int64) error {
+	// Delete the label catalog, custom field definitions, wiki pages and sidebar first
+	err := DeleteLabelsByProject(db, id)
+	if err != nil {
+		return err
+	}
+	err = DeleteCustomFieldsByProject(db, id)
+	if err != nil {
+		return err
+	}
+	err = DeletePagesByProject(db, id)
+	if err != nil {
+		return err
+	}
+	err = DeleteProjectSidebar(db, id)
+	if err != nil {
+		return err
+	}
 	cond := dbhelper.Cond().Eq("id", id).Build()
-	_, err := db.Delete("project", cond)
-	return err
+	if _, err := db.Delete("project", cond); err != nil {
+		return err
+	}
+	return RecordChange(db, "project", id, ChangeDelete)
 }
 
 // User CRUD
 
 func CreateUser(db types.Conn, u *User) (int64, error) {
+	u.stampCreated(0)
 	groupsJson, _ := json.Marshal(u.Groups)
-	cond := dbhelper.Cond().Eq("username", u.Username).Eq("email", u.Email).Eq("groups", string(groupsJson)).Build()
+	cond := dbhelper.Cond().Eq("username", u.Username).Eq("email", u.Email).Eq("groups", string(groupsJson)).
+		Eq("created_at", u.CreatedAt).Eq("updated_at", u.UpdatedAt).Eq("updated_by", u.UpdatedBy).Build()
 	return db.Insert("user", cond)
 }
 
@@ -64,22 +100,29 @@ func GetUser(db types.Conn, id int64) (*User, error) {
 	if rows.Count() == 0 {
 		return nil, errors.New("user not found")
 	}
-	data := rows.All()[0]
-	u := &User{
-		ID:       data["id"].(int64),
-		Username: data["username"].(string),
-		Email:    data["email"].(string),
+	u := userFromRow(rows.All()[0])
+	return &u, nil
+}
+
+func userFromRow(data map[string]interface{}) User {
+	u := User{
+		ID:         data["id"].(int64),
+		Username:   data["username"].(string),
+		Email:      data["email"].(string),
+		Timestamps: timestampsFromRow(data),
 	}
 	if groupsData, ok := data["groups"].(string); ok {
 		json.Unmarshal([]byte(groupsData), &u.Groups)
 	}
-	return u, nil
+	return u
 }
 
 func UpdateUser(db types.Conn, id int64, updates *User) error {
+	updates.stampUpdated()
 	groupsJson, _ := json.Marshal(updates.Groups)
 	cond := dbhelper.Cond().Eq("id", id).Build()
-	upd := dbhelper.Cond().Eq("username", updates.Username).Eq("email", updates.Email).Eq("groups", string(groupsJson)).Build()
+	upd := dbhelper.Cond().Eq("username", updates.Username).Eq("email", updates.Email).Eq("groups", string(groupsJson)).
+		Eq("updated_at", updates.UpdatedAt).Eq("updated_by", updates.UpdatedBy).Build()
 	_, err := db.Update("user", cond, upd)
 	return err
 }
@@ -93,7 +136,7 @@ func DeleteUser(db types.Conn, id int64) error {
 // Page CRUD
 
 func CreatePage(db types.Conn, p *Page) (int64, error) {
-	cond := dbhelper.Cond().Eq("title", p.Title).Eq("author_id", p.AuthorID).Build()
+	cond := dbhelper.Cond().Eq("project_id", p.ProjectID).Eq("parent_id", p.ParentID).Eq("title", p.Title).Eq("slug", p.Slug).Eq("body", p.Body).Eq("author_id", p.AuthorID).Build()
 	return db.Insert("page", cond)
 }
 
@@ -106,22 +149,29 @@ func GetPage(db types.Conn, id int64) (*Page, error) {
 	if rows.Count() == 0 {
 		return nil, errors.New("page not found")
 	}
-	data := rows.All()[0]
-	p := &Page{
-		ID:       data["id"].(int64),
-		Title:    data["title"].(string),
-		AuthorID: data["author_id"].(int64),
-	}
-	return p, nil
+	p := pageFromRow(rows.All()[0])
+	return &p, nil
 }
 
 func UpdatePage(db types.Conn, id int64, updates *Page) error {
 	cond := dbhelper.Cond().Eq("id", id).Build()
-	upd := dbhelper.Cond().Eq("title", updates.Title).Eq("author_id", updates.AuthorID).Build()
+	upd := dbhelper.Cond().Eq("parent_id", updates.ParentID).Eq("title", updates.Title).Eq("slug", updates.Slug).Eq("body", updates.Body).Eq("author_id", updates.AuthorID).Build()
 	_, err := db.Update("page", cond, upd)
 	return err
 }
 
+func pageFromRow(data map[string]interface{}) Page {
+	return Page{
+		ID:        data["id"].(int64),
+		ProjectID: asInt64(data["project_id"]),
+		ParentID:  asInt64(data["parent_id"]),
+		Title:     data["title"].(string),
+		Slug:      asString(data["slug"]),
+		Body:      asString(data["body"]),
+		AuthorID:  data["author_id"].(int64),
+	}
+}
+
 func DeletePage(db types.Conn, id int64) error {
 	cond := dbhelper.Cond().Eq("id", id).Build()
 	_, err := db.Delete("page", cond)
@@ -131,8 +181,10 @@ func DeletePage(db types.Conn, id int64) error {
 // UserInternal CRUD (shares table with User)
 
 func CreateUserInternal(db types.Conn, u *UserInternal) (int64, error) {
+	u.stampCreated(0)
 	groupsJSON, _ := json.Marshal(u.Groups)
-	cond := dbhelper.Cond().Eq("username", u.Username).Eq("email", u.Email).Eq("openid", u.OpenID).Eq("password_hash", u.PasswordHash).Eq("groups", string(groupsJSON)).Build()
+	cond := dbhelper.Cond().Eq("username", u.Username).Eq("email", u.Email).Eq("openid", u.OpenID).Eq("password_hash", u.PasswordHash).Eq("groups", string(groupsJSON)).
+		Eq("created_at", u.CreatedAt).Eq("updated_at", u.UpdatedAt).Eq("updated_by", u.UpdatedBy).Build()
 	return db.Insert("user", cond)
 }
 
@@ -152,13 +204,16 @@ func GetUserInternal(db types.Conn, id int64) (*UserInternal, error) {
 		Email:        data["email"].(string),
 		OpenID:       data["openid"].(string),
 		PasswordHash: data["password_hash"].(string),
+		Timestamps:   timestampsFromRow(data),
 	}
 	return u, nil
 }
 
 func UpdateUserInternal(db types.Conn, id int64, updates *UserInternal) error {
+	updates.stampUpdated()
 	cond := dbhelper.Cond().Eq("id", id).Build()
-	upd := dbhelper.Cond().Eq("username", updates.Username).Eq("email", updates.Email).Eq("openid", updates.OpenID).Eq("password_hash", updates.PasswordHash).Build()
+	upd := dbhelper.Cond().Eq("username", updates.Username).Eq("email", updates.Email).Eq("openid", updates.OpenID).Eq("password_hash", updates.PasswordHash).
+		Eq("updated_at", updates.UpdatedAt).Eq("updated_by", updates.UpdatedBy).Build()
 	_, err := db.Update("user", cond, upd)
 	return err
 }
@@ -172,14 +227,14 @@ func DeleteUserInternal(db types.Conn, id int64) error {
 // Sidebar CRUD
 
 func CreateSidebar(db types.Conn, s *Sidebar) (int64, error) {
-	cond := dbhelper.Cond().Eq("name", s.Name).Eq("description", s.Description).Build()
+	cond := dbhelper.Cond().Eq("project_id", s.ProjectID).Eq("user_id", s.UserID).Eq("name", s.Name).Eq("description", s.Description).Build()
 	id, err := db.Insert("sidebar", cond)
 	if err != nil {
 		return 0, err
 	}
 	// Insert items
 	for _, item := range s.Items {
-		item.ParentID = id
+		item.SidebarID = id
 		_, err := CreateSidebarItem(db, &item)
 		if err != nil {
 			return 0, err
@@ -197,30 +252,23 @@ func GetSidebar(db types.Conn, id int64) (*Sidebar, error) {
 	if rows.Count() == 0 {
 		return nil, errors.New("sidebar not found")
 	}
-	data := rows.All()[0]
-	s := &Sidebar{
-		ID:          data["id"].(int64),
-		Name:        data["name"].(string),
-		Description: data["description"].(string),
-	}
+	s := sidebarFromRow(rows.All()[0])
 	// Get items
-	itemCond := dbhelper.Cond().Eq("parent_id", id).Build()
-	itemRows, err := db.Query("sidebar_item", itemCond)
+	s.Items, err = GetSidebarItems(db, id)
 	if err != nil {
 		return nil, err
 	}
-	for _, itemData := range itemRows.All() {
-		item := SidebarItem{
-			ID:       itemData["id"].(int64),
-			ParentID: itemData["parent_id"].(int64),
-			Name:     itemData["name"].(string),
-			Icon:     itemData["icon"].(string),
-			URL:      itemData["url"].(string),
-			Order:    int(itemData["order_num"].(int64)),
-		}
-		s.Items = append(s.Items, item)
+	return &s, nil
+}
+
+func sidebarFromRow(data map[string]interface{}) Sidebar {
+	return Sidebar{
+		ID:          data["id"].(int64),
+		ProjectID:   asInt64(data["project_id"]),
+		UserID:      asInt64(data["user_id"]),
+		Name:        asString(data["name"]),
+		Description: asString(data["description"]),
 	}
-	return s, nil
 }
 
 func UpdateSidebar(db types.Conn, id int64, updates *Sidebar) error {
@@ -231,13 +279,13 @@ func UpdateSidebar(db types.Conn, id int64, updates *Sidebar) error {
 		return err
 	}
 	// Delete old items and insert new ones
-	itemCond := dbhelper.Cond().Eq("parent_id", id).Build()
+	itemCond := dbhelper.Cond().Eq("sidebar_id", id).Build()
 	_, err = db.Delete("sidebar_item", itemCond)
 	if err != nil {
 		return err
 	}
 	for _, item := range updates.Items {
-		item.ParentID = id
+		item.SidebarID = id
 		_, err := CreateSidebarItem(db, &item)
 		if err != nil {
 			return err
@@ -248,7 +296,7 @@ func UpdateSidebar(db types.Conn, id int64, updates *Sidebar) error {
 
 func DeleteSidebar(db types.Conn, id int64) error {
 	// Delete items first
-	itemCond := dbhelper.Cond().Eq("parent_id", id).Build()
+	itemCond := dbhelper.Cond().Eq("sidebar_id", id).Build()
 	_, err := db.Delete("sidebar_item", itemCond)
 	if err != nil {
 		return err
@@ -261,7 +309,7 @@ func DeleteSidebar(db types.Conn, id int64) error {
 // SidebarItem CRUD
 
 func CreateSidebarItem(db types.Conn, si *SidebarItem) (int64, error) {
-	cond := dbhelper.Cond().Eq("parent_id", si.ParentID).Eq("name", si.Name).Eq("icon", si.Icon).Eq("url", si.URL).Eq("order_num", si.Order).Build()
+	cond := dbhelper.Cond().Eq("sidebar_id", si.SidebarID).Eq("parent_id", si.ParentID).Eq("name", si.Name).Eq("icon", si.Icon).Eq("url", si.URL).Eq("order_num", si.Order).Eq("target_type", si.TargetType).Eq("target_id", si.TargetID).Build()
 	return db.Insert("sidebar_item", cond)
 }
 
@@ -274,21 +322,40 @@ func GetSidebarItem(db types.Conn, id int64) (*SidebarItem, error) {
 	if rows.Count() == 0 {
 		return nil, errors.New("sidebar item not found")
 	}
-	data := rows.All()[0]
-	si := &SidebarItem{
-		ID:       data["id"].(int64),
-		ParentID: data["parent_id"].(int64),
-		Name:     data["name"].(string),
-		Icon:     data["icon"].(string),
-		URL:      data["url"].(string),
-		Order:    int(data["order_num"].(int64)),
+	si := sidebarItemFromRow(rows.All()[0])
+	return &si, nil
+}
+
+func GetSidebarItems(db types.Conn, sidebarID int64) ([]SidebarItem, error) {
+	cond := dbhelper.Cond().Eq("sidebar_id", sidebarID).Build()
+	rows, err := db.Query("sidebar_item", cond)
+	if err != nil {
+		return nil, err
+	}
+	items := []SidebarItem{}
+	for _, data := range rows.All() {
+		items = append(items, sidebarItemFromRow(data))
+	}
+	return items, nil
+}
+
+func sidebarItemFromRow(data map[string]interface{}) SidebarItem {
+	return SidebarItem{
+		ID:         data["id"].(int64),
+		SidebarID:  asInt64(data["sidebar_id"]),
+		ParentID:   asInt64(data["parent_id"]),
+		Name:       asString(data["name"]),
+		Icon:       asString(data["icon"]),
+		URL:        asString(data["url"]),
+		Order:      int(asInt64(data["order_num"])),
+		TargetType: asString(data["target_type"]),
+		TargetID:   asInt64(data["target_id"]),
 	}
-	return si, nil
 }
 
 func UpdateSidebarItem(db types.Conn, id int64, updates *SidebarItem) error {
 	cond := dbhelper.Cond().Eq("id", id).Build()
-	upd := dbhelper.Cond().Eq("parent_id", updates.ParentID).Eq("name", updates.Name).Eq("icon", updates.Icon).Eq("url", updates.URL).Eq("order_num", updates.Order).Build()
+	upd := dbhelper.Cond().Eq("parent_id", updates.ParentID).Eq("name", updates.Name).Eq("icon", updates.Icon).Eq("url", updates.URL).Eq("order_num", updates.Order).Eq("target_type", updates.TargetType).Eq("target_id", updates.TargetID).Build()
 	_, err := db.Update("sidebar_item", cond, upd)
 	return err
 }
@@ -302,9 +369,17 @@ func DeleteSidebarItem(db types.Conn, id int64) error {
 // ContentList CRUD
 
 func CreateContentList(db types.Conn, cl *ContentList) (int64, error) {
+	cl.stampCreated(cl.CreatorID)
 	itemsJson, _ := json.Marshal(cl.Items)
-	cond := dbhelper.Cond().Eq("type", cl.Type).Eq("title", cl.Title).Eq("items", string(itemsJson)).Eq("creator_id", cl.CreatorID).Eq("project_id", cl.ProjectID).Build()
-	return db.Insert("content_list", cond)
+	allowedTypesJson, _ := json.Marshal(normalizeStrings(cl.AllowedTypes))
+	cond := dbhelper.Cond().Eq("type", cl.Type).Eq("title", cl.Title).Eq("items", string(itemsJson)).Eq("creator_id", cl.CreatorID).Eq("project_id", cl.ProjectID).
+		Eq("max_items", cl.MaxItems).Eq("allowed_types", string(allowedTypesJson)).Eq("move_permission", cl.MovePermission).
+		Eq("created_at", cl.CreatedAt).Eq("updated_at", cl.UpdatedAt).Eq("updated_by", cl.UpdatedBy).Build()
+	id, err := db.Insert("content_list", cond)
+	if err != nil {
+		return 0, err
+	}
+	return id, RecordChange(db, "content_list", id, ChangeUpsert)
 }
 
 func GetContentList(db types.Conn, id int64) (*ContentList, error) {
@@ -316,38 +391,76 @@ func GetContentList(db types.Conn, id int64) (*ContentList, error) {
 	if rows.Count() == 0 {
 		return nil, errors.New("content list not found")
 	}
-	data := rows.All()[0]
-	cl := &ContentList{
-		ID:        data["id"].(int64),
-		Type:      data["type"].(string),
-		Title:     data["title"].(string),
-		CreatorID: data["creator_id"].(int64),
-		ProjectID: data["project_id"].(int64),
-	}
-	itemsJson := data["items"].(string)
-	json.Unmarshal([]byte(itemsJson), &cl.Items)
-	return cl, nil
+	cl := contentListFromRow(rows.All()[0])
+	return &cl, nil
 }
 
 func UpdateContentList(db types.Conn, id int64, updates *ContentList) error {
+	updates.stampUpdated()
 	itemsJson, _ := json.Marshal(updates.Items)
+	allowedTypesJson, _ := json.Marshal(normalizeStrings(updates.AllowedTypes))
 	cond := dbhelper.Cond().Eq("id", id).Build()
-	upd := dbhelper.Cond().Eq("type", updates.Type).Eq("title", updates.Title).Eq("items", string(itemsJson)).Eq("creator_id", updates.CreatorID).Eq("project_id", updates.ProjectID).Build()
-	_, err := db.Update("content_list", cond, upd)
-	return err
+	upd := dbhelper.Cond().Eq("type", updates.Type).Eq("title", updates.Title).Eq("items", string(itemsJson)).Eq("creator_id", updates.CreatorID).Eq("project_id", updates.ProjectID).
+		Eq("max_items", updates.MaxItems).Eq("allowed_types", string(allowedTypesJson)).Eq("move_permission", updates.MovePermission).
+		Eq("updated_at", updates.UpdatedAt).Eq("updated_by", updates.UpdatedBy).Build()
+	if _, err := db.Update("content_list", cond, upd); err != nil {
+		return err
+	}
+	return RecordChange(db, "content_list", id, ChangeUpsert)
+}
+
+// contentListFromRow builds a ContentList from a content_list row
+func contentListFromRow(data map[string]interface{}) ContentList {
+	cl := ContentList{
+		ID:             data["id"].(int64),
+		Type:           data["type"].(string),
+		Title:          data["title"].(string),
+		CreatorID:      data["creator_id"].(int64),
+		ProjectID:      data["project_id"].(int64),
+		MaxItems:       int(asInt64(data["max_items"])),
+		MovePermission: asString(data["move_permission"]),
+		ArchivedAt:     asInt64(data["archived_at"]),
+		Timestamps:     timestampsFromRow(data),
+	}
+	if itemsJson, ok := data["items"].(string); ok && itemsJson != "" {
+		json.Unmarshal([]byte(itemsJson), &cl.Items)
+	}
+	if cl.Items == nil {
+		cl.Items = make([]int64, 0)
+	}
+	if allowedTypesJson := asString(data["allowed_types"]); allowedTypesJson != "" {
+		json.Unmarshal([]byte(allowedTypesJson), &cl.AllowedTypes)
+	}
+	cl.AllowedTypes = normalizeStrings(cl.AllowedTypes)
+	return cl
 }
 
 func DeleteContentList(db types.Conn, id int64) error {
+	// 删除前读出所属项目，记录到变更日志
+	projectID, err := changeProjectID(db, "content_list", id)
+	if err != nil {
+		return err
+	}
 	cond := dbhelper.Cond().Eq("id", id).Build()
-	_, err := db.Delete("content_list", cond)
-	return err
+	if _, err := db.Delete("content_list", cond); err != nil {
+		return err
+	}
+	return recordChange(db, changeRecord{objectType: "content_list", objectID: id, op: ChangeDelete, projectID: projectID})
 }
 
 // ContentEntry CRUD
 
 func CreateContentEntry(db types.Conn, ce *ContentEntry) (int64, error) {
-	cond := dbhelper.Cond().Eq("type", ce.Type).Eq("title", ce.Title).Eq("content", ce.Content).Eq("creator_id", ce.CreatorID).Eq("project_id", ce.ProjectID).Build()
-	return db.Insert("content_entry", cond)
+	ce.stampCreated(ce.CreatorID)
+	assigneesJson, _ := json.Marshal(normalizeIDs(ce.Assignees))
+	cond := dbhelper.Cond().Eq("type", ce.Type).Eq("title", ce.Title).Eq("content", ce.Content).Eq("creator_id", ce.CreatorID).Eq("project_id", ce.ProjectID).
+		Eq("assignees", string(assigneesJson)).Eq("start_at", ce.StartAt).Eq("due_at", ce.DueAt).
+		Eq("created_at", ce.CreatedAt).Eq("updated_at", ce.UpdatedAt).Eq("updated_by", ce.UpdatedBy).Build()
+	id, err := db.Insert("content_entry", cond)
+	if err != nil {
+		return 0, err
+	}
+	return id, RecordChange(db, "content_entry", id, ChangeUpsert)
 }
 
 func GetContentEntry(db types.Conn, id int64) (*ContentEntry, error) {
@@ -359,37 +472,128 @@ func GetContentEntry(db types.Conn, id int64) (*ContentEntry, error) {
 	if rows.Count() == 0 {
 		return nil, errors.New("content entry not found")
 	}
-	data := rows.All()[0]
-	ce := &ContentEntry{
+	ce := contentEntryFromRow(rows.All()[0])
+	ce.Labels, err = GetEntryLabelIDs(db, id)
+	if err != nil {
+		return nil, err
+	}
+	entries := []ContentEntry{ce}
+	if err := attachCustomFields(db, entries); err != nil {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+func UpdateContentEntry(db types.Conn, id int64, updates *ContentEntry) error {
+	updates.stampUpdated()
+	assigneesJson, _ := json.Marshal(normalizeIDs(updates.Assignees))
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	upd := dbhelper.Cond().Eq("type", updates.Type).Eq("title", updates.Title).Eq("content", updates.Content).Eq("creator_id", updates.CreatorID).Eq("project_id", updates.ProjectID).
+		Eq("assignees", string(assigneesJson)).Eq("start_at", updates.StartAt).Eq("due_at", updates.DueAt).
+		Eq("updated_at", updates.UpdatedAt).Eq("updated_by", updates.UpdatedBy).Build()
+	if _, err := db.Update("content_entry", cond, upd); err != nil {
+		return err
+	}
+	return RecordChange(db, "content_entry", id, ChangeUpsert)
+}
+
+// TouchContentEntry marks an entry as changed by userID after a change to data kept outside its
+// row, such as its labels or custom field values, so that updated_since and sync pick it up.
+func TouchContentEntry(db types.Conn, id int64, userID int64) error {
+	var t Timestamps
+	t.stampUpdated()
+	t.UpdatedBy = userID
+	upd := dbhelper.Cond().Eq("updated_at", t.UpdatedAt).Eq("updated_by", t.UpdatedBy).Build()
+	if _, err := db.Update("content_entry", dbhelper.Cond().Eq("id", id).Build(), upd); err != nil {
+		return err
+	}
+	return RecordChange(db, "content_entry", id, ChangeUpsert)
+}
+
+// contentEntryFromRow maps a content_entry row, tolerating columns added by later migrations.
+func contentEntryFromRow(data map[string]interface{}) ContentEntry {
+	ce := ContentEntry{
 		ID:        data["id"].(int64),
 		Type:      data["type"].(string),
 		Title:     data["title"].(string),
 		Content:   data["content"].(string),
 		CreatorID: data["creator_id"].(int64),
 		ProjectID: data["project_id"].(int64),
+		StartAt:   asInt64(data["start_at"]),
+		DueAt:     asInt64(data["due_at"]),
+		Labels:    make([]int64, 0),
+
+		ArchivedAt:       asInt64(data["archived_at"]),
+		ArchivedListID:   asInt64(data["archived_list_id"]),
+		ArchivedPosition: int(asInt64(data["archived_position"])),
+		Timestamps:       timestampsFromRow(data),
+
+		CustomFields: make([]CustomFieldValue, 0),
+	}
+	if assigneesJson := asString(data["assignees"]); assigneesJson != "" {
+		json.Unmarshal([]byte(assigneesJson), &ce.Assignees)
 	}
-	return ce, nil
+	ce.Assignees = normalizeIDs(ce.Assignees)
+	return ce
 }
 
-func UpdateContentEntry(db types.Conn, id int64, updates *ContentEntry) error {
-	cond := dbhelper.Cond().Eq("id", id).Build()
-	upd := dbhelper.Cond().Eq("type", updates.Type).Eq("title", updates.Title).Eq("content", updates.Content).Eq("creator_id", updates.CreatorID).Eq("project_id", updates.ProjectID).Build()
-	_, err := db.Update("content_entry", cond, upd)
-	return err
+// normalizeIDs drops duplicate and non-positive IDs while keeping order, and never returns nil.
+func normalizeIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id <= 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+	return out
 }
 
 func DeleteContentEntry(db types.Conn, id int64) error {
+	// 删除前读出所属项目，记录到变更日志
+	projectID, err := changeProjectID(db, "content_entry", id)
+	if err != nil {
+		return err
+	}
+	// Detach labels, custom field values, comments and relations first
+	labelCond := dbhelper.Cond().Eq("entry_id", id).Build()
+	_, err = db.Delete("content_entry_label", labelCond)
+	if err != nil {
+		return err
+	}
+	err = DeleteCustomFieldValuesByEntry(db, id)
+	if err != nil {
+		return err
+	}
+	err = DeleteEntryCommentsByEntry(db, id)
+	if err != nil {
+		return err
+	}
+	err = DeleteEntryRelationsByEntry(db, id)
+	if err != nil {
+		return err
+	}
 	cond := dbhelper.Cond().Eq("id", id).Build()
-	_, err := db.Delete("content_entry", cond)
-	return err
+	if _, err := db.Delete("content_entry", cond); err != nil {
+		return err
+	}
+	return recordChange(db, changeRecord{objectType: "content_entry", objectID: id, op: ChangeDelete, projectID: projectID})
 }
 
 // DetailPermission CRUD
 
 func CreateDetailPermission(db types.Conn, dp *DetailPermission) (int64, error) {
+	dp.stampCreated(0)
 	contentIDsJson, _ := json.Marshal(dp.ContentIDs)
-	cond := dbhelper.Cond().Eq("user_id", dp.UserID).Eq("content_type", dp.ContentType).Eq("content_ids", string(contentIDsJson)).Eq("action", dp.Action).Build()
-	return db.Insert("detail_permission", cond)
+	cond := dbhelper.Cond().Eq("user_id", dp.UserID).Eq("content_type", dp.ContentType).Eq("content_ids", string(contentIDsJson)).Eq("action", dp.Action).
+		Eq("created_at", dp.CreatedAt).Eq("updated_at", dp.UpdatedAt).Eq("updated_by", dp.UpdatedBy).Build()
+	id, err := db.Insert("detail_permission", cond)
+	if err != nil {
+		return 0, err
+	}
+	return id, RecordPermissionChange(db, id, dp.UserID, dp.ContentType, ChangeUpsert)
 }
 
 func GetDetailPermission(db types.Conn, id int64) (*DetailPermission, error) {
@@ -401,30 +605,67 @@ func GetDetailPermission(db types.Conn, id int64) (*DetailPermission, error) {
 	if rows.Count() == 0 {
 		return nil, errors.New("detail permission not found")
 	}
-	data := rows.All()[0]
-	dp := &DetailPermission{
+	dp := detailPermissionFromRow(rows.All()[0])
+	return &dp, nil
+}
+
+func detailPermissionFromRow(data map[string]interface{}) DetailPermission {
+	dp := DetailPermission{
 		ID:          data["id"].(int64),
 		UserID:      data["user_id"].(int64),
 		ContentType: data["content_type"].(string),
 		Action:      data["action"].(string),
+		Timestamps:  timestampsFromRow(data),
+	}
+	if contentIDsJson, ok := data["content_ids"].(string); ok {
+		json.Unmarshal([]byte(contentIDsJson), &dp.ContentIDs)
 	}
-	contentIDsJson := data["content_ids"].(string)
-	json.Unmarshal([]byte(contentIDsJson), &dp.ContentIDs)
-	return dp, nil
+	return dp
 }
 
 func UpdateDetailPermission(db types.Conn, id int64, updates *DetailPermission) error {
+	// 修改前读出原权限，被移除的列表和条目需要在变更日志中记为撤销
+	previous, err := GetDetailPermission(db, id)
+	if err != nil {
+		previous = &DetailPermission{ID: id}
+	}
+	updates.stampUpdated()
 	contentIDsJson, _ := json.Marshal(updates.ContentIDs)
 	cond := dbhelper.Cond().Eq("id", id).Build()
-	upd := dbhelper.Cond().Eq("user_id", updates.UserID).Eq("content_type", updates.ContentType).Eq("content_ids", string(contentIDsJson)).Eq("action", updates.Action).Build()
-	_, err := db.Update("detail_permission", cond, upd)
-	return err
+	upd := dbhelper.Cond().Eq("user_id", updates.UserID).Eq("content_type", updates.ContentType).Eq("content_ids", string(contentIDsJson)).Eq("action", updates.Action).
+		Eq("updated_at", updates.UpdatedAt).Eq("updated_by", updates.UpdatedBy).Build()
+	if _, err := db.Update("detail_permission", cond, upd); err != nil {
+		return err
+	}
+	removed := previous.ContentIDs
+	if previous.UserID == updates.UserID && previous.ContentType == updates.ContentType {
+		removed = make([]int64, 0)
+		for _, contentID := range previous.ContentIDs {
+			if !containsID(updates.ContentIDs, contentID) {
+				removed = append(removed, contentID)
+			}
+		}
+	}
+	if err := recordAccessRevoked(db, previous.UserID, previous.ContentType, removed); err != nil {
+		return err
+	}
+	return RecordPermissionChange(db, id, updates.UserID, updates.ContentType, ChangeUpsert)
 }
 
 func DeleteDetailPermission(db types.Conn, id int64) error {
+	// 删除前读出所属用户，供变更日志判断谁需要收到删除记录
+	dp, err := GetDetailPermission(db, id)
+	if err != nil {
+		dp = &DetailPermission{ID: id}
+	}
 	cond := dbhelper.Cond().Eq("id", id).Build()
-	_, err := db.Delete("detail_permission", cond)
-	return err
+	if _, err := db.Delete("detail_permission", cond); err != nil {
+		return err
+	}
+	if err := recordAccessRevoked(db, dp.UserID, dp.ContentType, dp.ContentIDs); err != nil {
+		return err
+	}
+	return RecordPermissionChange(db, id, dp.UserID, dp.ContentType, ChangeDelete)
 }
 
 // Permission CRUD
@@ -518,13 +759,7 @@ func GetProjects(db types.Conn) ([]Project, error) {
 	}
 	projects := make([]Project, 0)
 	for _, data := range rows.All() {
-		p := Project{
-			ID:          data["id"].(int64),
-			Name:        data["name"].(string),
-			Description: data["description"].(string),
-			CreatorID:   data["creator_id"].(int64),
-		}
-		projects = append(projects, p)
+		projects = append(projects, projectFromRow(data))
 	}
 	return projects, nil
 }
@@ -537,15 +772,7 @@ func GetUsers(db types.Conn) ([]User, error) {
 	}
 	users := make([]User, 0)
 	for _, data := range rows.All() {
-		u := User{
-			ID:       data["id"].(int64),
-			Username: data["username"].(string),
-			Email:    data["email"].(string),
-		}
-		if groupsData, ok := data["groups"].(string); ok {
-			json.Unmarshal([]byte(groupsData), &u.Groups)
-		}
-		users = append(users, u)
+		users = append(users, userFromRow(data))
 	}
 	return users, nil
 }
@@ -559,19 +786,7 @@ func GetContentListsByProject(db types.Conn, projectID int64) ([]ContentList, er
 	}
 	lists := make([]ContentList, 0)
 	for _, data := range rows.All() {
-		cl := ContentList{
-			ID:        data["id"].(int64),
-			Type:      data["type"].(string),
-			Title:     data["title"].(string),
-			CreatorID: data["creator_id"].(int64),
-			ProjectID: data["project_id"].(int64),
-		}
-		if itemsJson, ok := data["items"].(string); ok && itemsJson != "" {
-			json.Unmarshal([]byte(itemsJson), &cl.Items)
-		} else {
-			cl.Items = make([]int64, 0)
-		}
-		lists = append(lists, cl)
+		lists = append(lists, contentListFromRow(data))
 	}
 	return lists, nil
 }
@@ -584,16 +799,7 @@ func GetDetailPermissions(db types.Conn) ([]DetailPermission, error) {
 	}
 	dps := make([]DetailPermission, 0)
 	for _, data := range rows.All() {
-		dp := DetailPermission{
-			ID:          data["id"].(int64),
-			UserID:      data["user_id"].(int64),
-			ContentType: data["content_type"].(string),
-			Action:      data["action"].(string),
-		}
-		if contentIDsJson, ok := data["content_ids"].(string); ok {
-			json.Unmarshal([]byte(contentIDsJson), &dp.ContentIDs)
-		}
-		dps = append(dps, dp)
+		dps = append(dps, detailPermissionFromRow(data))
 	}
 	return dps, nil
 }
@@ -627,15 +833,13 @@ func GetContentEntries(db types.Conn) ([]ContentEntry, error) {
 	}
 	entries := make([]ContentEntry, 0)
 	for _, data := range rows.All() {
-		ce := ContentEntry{
-			ID:        data["id"].(int64),
-			Type:      data["type"].(string),
-			Title:     data["title"].(string),
-			Content:   data["content"].(string),
-			CreatorID: data["creator_id"].(int64),
-			ProjectID: data["project_id"].(int64),
-		}
-		entries = append(entries, ce)
+		entries = append(entries, contentEntryFromRow(data))
+	}
+	if err := attachLabels(db, entries); err != nil {
+		return []ContentEntry{}, err
+	}
+	if err := attachCustomFields(db, entries); err != nil {
+		return []ContentEntry{}, err
 	}
 	return entries, nil
 }
@@ -649,6 +853,7 @@ func CreateShareToken(db types.Conn, st *ShareToken) (int64, error) {
 		Eq("permission_level", st.PermissionLevel).
 		Eq("created_at", st.CreatedAt).
 		Eq("expires_at", st.ExpiresAt).
+		Eq("creator_id", st.CreatorID).
 		Build()
 	return db.Insert("share_token", cond)
 }
@@ -662,16 +867,8 @@ func GetShareToken(db types.Conn, token string) (*ShareToken, error) {
 	if rows.Count() == 0 {
 		return nil, errors.New("share token not found")
 	}
-	data := rows.All()[0]
-	st := &ShareToken{
-		ID:              data["id"].(int64),
-		Token:           data["token"].(string),
-		ProjectID:       data["project_id"].(int64),
-		PermissionLevel: data["permission_level"].(string),
-		CreatedAt:       data["created_at"].(int64),
-		ExpiresAt:       data["expires_at"].(int64),
-	}
-	return st, nil
+	st := shareTokenFromRow(rows.All()[0])
+	return &st, nil
 }
 
 func DeleteShareToken(db types.Conn, id int64) error {
@@ -688,15 +885,19 @@ func GetShareTokensByProjectID(db types.Conn, projectID int64) ([]ShareToken, er
 	}
 	tokens := make([]ShareToken, 0)
 	for _, data := range rows.All() {
-		st := ShareToken{
-			ID:              data["id"].(int64),
-			Token:           data["token"].(string),
-			ProjectID:       data["project_id"].(int64),
-			PermissionLevel: data["permission_level"].(string),
-			CreatedAt:       data["created_at"].(int64),
-			ExpiresAt:       data["expires_at"].(int64),
-		}
-		tokens = append(tokens, st)
+		tokens = append(tokens, shareTokenFromRow(data))
 	}
 	return tokens, nil
 }
+
+func shareTokenFromRow(data map[string]interface{}) ShareToken {
+	return ShareToken{
+		ID:              data["id"].(int64),
+		Token:           data["token"].(string),
+		ProjectID:       data["project_id"].(int64),
+		PermissionLevel: data["permission_level"].(string),
+		CreatedAt:       data["created_at"].(int64),
+		ExpiresAt:       data["expires_at"].(int64),
+		CreatorID:       asInt64(data["creator_id"]),
+	}
+}
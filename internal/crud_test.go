@@ -21,9 +21,9 @@ func setupDB(t *testing.T) types.Conn {
 	tables := []string{
 		"CREATE TABLE project (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, description TEXT)",
 		"CREATE TABLE user (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT, email TEXT, openid TEXT, password_hash TEXT)",
-		"CREATE TABLE page (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT, author_id INTEGER)",
-		"CREATE TABLE sidebar (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, description TEXT)",
-		"CREATE TABLE sidebar_item (id INTEGER PRIMARY KEY AUTOINCREMENT, parent_id INTEGER, name TEXT, icon TEXT, url TEXT, order_num INTEGER)",
+		"CREATE TABLE page (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER, parent_id INTEGER DEFAULT 0, title TEXT, slug TEXT, body TEXT, author_id INTEGER)",
+		"CREATE TABLE sidebar (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER DEFAULT 0, user_id INTEGER DEFAULT 0, name TEXT, description TEXT)",
+		"CREATE TABLE sidebar_item (id INTEGER PRIMARY KEY AUTOINCREMENT, sidebar_id INTEGER DEFAULT 0, parent_id INTEGER, name TEXT, icon TEXT, url TEXT, order_num INTEGER, target_type TEXT DEFAULT '', target_id INTEGER DEFAULT 0)",
 		"CREATE TABLE content_list (id INTEGER PRIMARY KEY AUTOINCREMENT, type TEXT, title TEXT, items TEXT)",
 		"CREATE TABLE content_entry (id INTEGER PRIMARY KEY AUTOINCREMENT, type TEXT, title TEXT, content TEXT)",
 		"CREATE TABLE detail_permission (id INTEGER PRIMARY KEY AUTOINCREMENT, content_type TEXT, content_ids TEXT, action TEXT)",
@@ -0,0 +1,300 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+// MaxCSVImportRows limits the number of data rows in one CSV import.
+const MaxCSVImportRows = 5000
+
+// CSVExportColumns are the columns of a project CSV export, in order.
+var CSVExportColumns = []string{"id", "list", "title", "content", "type", "creator", "created_at", "updated_at"}
+
+// csvImportFields are the entry fields a CSV import can fill.
+var csvImportFields = []string{"list", "title", "content", "type"}
+
+// WriteProjectCSV writes a CSV export of the project: a header row and one row per entry, list by
+// list in board order. Archived lists and entries are left out; entries in no list come last with
+// an empty list name. Timestamps are RFC 3339 in UTC.
+func WriteProjectCSV(db types.Conn, projectID int64, w io.Writer) error {
+	lists, err := GetContentListsByProject(db, projectID)
+	if err != nil {
+		return err
+	}
+	entries, err := GetContentEntries(db)
+	if err != nil {
+		return err
+	}
+	users, err := GetUsers(db)
+	if err != nil {
+		return err
+	}
+	usernames := make(map[int64]string, len(users))
+	for _, u := range users {
+		usernames[u.ID] = u.Username
+	}
+	byID := make(map[int64]ContentEntry)
+	for _, ce := range entries {
+		if ce.ProjectID == projectID && ce.ArchivedAt == 0 {
+			byID[ce.ID] = ce
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(CSVExportColumns); err != nil {
+		return err
+	}
+	written := make(map[int64]bool, len(byID))
+	writeEntry := func(listName string, ce ContentEntry) error {
+		written[ce.ID] = true
+		return cw.Write([]string{
+			strconv.FormatInt(ce.ID, 10),
+			listName,
+			ce.Title,
+			ce.Content,
+			ce.Type,
+			usernames[ce.CreatorID],
+			formatCSVTime(ce.CreatedAt),
+			formatCSVTime(ce.UpdatedAt),
+		})
+	}
+	for _, cl := range ActiveContentLists(lists) {
+		for _, id := range cl.Items {
+			ce, ok := byID[id]
+			if !ok || written[id] {
+				continue
+			}
+			if err := writeEntry(cl.Title, ce); err != nil {
+				return err
+			}
+		}
+	}
+	// 不在任何列表中的条目（归档列表中的除外）按 ID 排在最后
+	for _, cl := range lists {
+		if cl.ArchivedAt != 0 {
+			for _, id := range cl.Items {
+				written[id] = true
+			}
+		}
+	}
+	for _, ce := range entries {
+		if _, ok := byID[ce.ID]; ok && !written[ce.ID] {
+			if err := writeEntry("", ce); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvImportRow is a parsed data row of a CSV import.
+type csvImportRow struct {
+	result CSVRowResult
+	entry  ContentEntry
+}
+
+// ImportProjectCSV creates an entry in the project for each valid data row of a CSV file, in file
+// order, appending it to the list named in the row. Lists that do not exist (or are archived) are
+// created. Rows without a title or list, or that a list policy rejects, are reported and skipped.
+// With DryRun nothing is written. The writes are rolled back if any of them fails (see runInTx).
+func ImportProjectCSV(db types.Conn, projectID int64, userID int64, data []byte, opts CSVImportOptions) (*CSVImportResult, error) {
+	records, columns, err := readImportCSV(data, opts.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	lists, err := GetContentListsByProject(db, projectID)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]*ContentList)
+	for _, cl := range ActiveContentLists(lists) {
+		key := strings.ToLower(strings.TrimSpace(cl.Title))
+		if _, ok := existing[key]; !ok {
+			cl := cl
+			existing[key] = &cl
+		}
+	}
+
+	result := &CSVImportResult{DryRun: opts.DryRun, CreatedLists: []string{}, Rows: []CSVRowResult{}}
+	counts := make(map[string]int) // 每个列表导入后的条目数，用于检查 WIP 上限
+	created := make(map[string]string)
+	var rows []csvImportRow
+	for i, record := range records {
+		cell := func(field string) string {
+			idx, ok := columns[field]
+			if !ok || idx >= len(record) {
+				return ""
+			}
+			return record[idx]
+		}
+		row := csvImportRow{
+			result: CSVRowResult{Row: i + 2, List: strings.TrimSpace(cell("list")), Title: strings.TrimSpace(cell("title"))},
+		}
+		if row.result.List == "" {
+			row.result.List = strings.TrimSpace(opts.DefaultList)
+		}
+		row.entry = ContentEntry{Type: strings.TrimSpace(cell("type")), Title: row.result.Title, Content: cell("content"), CreatorID: userID, ProjectID: projectID}
+		switch key := strings.ToLower(row.result.List); {
+		case row.result.Title == "":
+			row.result.Error = "title is required"
+		case row.result.List == "":
+			row.result.Error = "list is required"
+		case existing[key] != nil:
+			cl := existing[key]
+			if _, ok := counts[key]; !ok {
+				counts[key] = len(cl.Items)
+			}
+			if err := CheckListPolicy(db, cl, []ContentEntry{row.entry}, counts[key], counts[key]+1, userID); err != nil {
+				if !errors.Is(err, ErrListPolicy) {
+					return nil, err
+				}
+				row.result.Error = err.Error()
+			} else {
+				counts[key]++
+			}
+		default:
+			if _, ok := created[key]; !ok {
+				created[key] = row.result.List
+				result.CreatedLists = append(result.CreatedLists, row.result.List)
+			}
+		}
+		if row.result.Error != "" {
+			result.Failed++
+		} else {
+			result.Created++
+		}
+		rows = append(rows, row)
+	}
+
+	if !opts.DryRun && result.Created > 0 {
+		err = runInTx(db, "ImportProjectCSV", func(db types.Conn) error {
+			return writeImportCSV(db, projectID, userID, rows, existing, result.CreatedLists)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, row := range rows {
+		result.Rows = append(result.Rows, row.result)
+	}
+	return result, nil
+}
+
+// writeImportCSV creates the new lists and the entries of the valid rows and fills in their IDs.
+func writeImportCSV(db types.Conn, projectID, userID int64, rows []csvImportRow, existing map[string]*ContentList, newLists []string) error {
+	changed := make(map[string]*ContentList)
+	for _, name := range newLists {
+		cl := &ContentList{Title: name, Items: []int64{}, CreatorID: userID, ProjectID: projectID}
+		id, err := CreateContentList(db, cl)
+		if err != nil {
+			return err
+		}
+		cl.ID = id
+		for _, action := range []string{"admin", "read"} {
+			if err := grantDetailPermission(db, userID, "content_list", id, action); err != nil {
+				return err
+			}
+		}
+		key := strings.ToLower(name)
+		existing[key] = cl
+		changed[key] = cl
+	}
+	var order []string
+	for i := range rows {
+		row := &rows[i]
+		if row.result.Error != "" {
+			continue
+		}
+		id, err := CreateContentEntry(db, &row.entry)
+		if err != nil {
+			return err
+		}
+		row.entry.ID = id
+		row.result.EntryID = id
+		for _, action := range []string{"admin", "read"} {
+			if err := grantDetailPermission(db, userID, "content_entry", id, action); err != nil {
+				return err
+			}
+		}
+		key := strings.ToLower(row.result.List)
+		cl := existing[key]
+		if _, ok := changed[key]; !ok {
+			changed[key] = cl
+		}
+		if !containsString(order, key) {
+			order = append(order, key)
+		}
+		cl.Items = append(cl.Items, id)
+	}
+	for _, key := range order {
+		cl := changed[key]
+		cl.UpdatedBy = userID
+		if err := UpdateContentList(db, cl.ID, cl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readImportCSV parses a CSV file and returns its data rows and the column index of each mapped
+// field. A UTF-8 byte order mark, as written by spreadsheet programs, is ignored.
+func readImportCSV(data []byte, mapping map[string]string) ([][]string, map[string]int, error) {
+	for field := range mapping {
+		if !containsString(csvImportFields, field) {
+			return nil, nil, fmt.Errorf("%w: unknown field %q, expected one of %s", ErrInvalidImport, field, strings.Join(csvImportFields, ", "))
+		}
+	}
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.FieldsPerRecord = -1 // 允许行的列数不一致，缺少的列视为空
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("%w: missing header row", ErrInvalidImport)
+	}
+	if len(records)-1 > MaxCSVImportRows {
+		return nil, nil, fmt.Errorf("%w: more than %d rows", ErrInvalidImport, MaxCSVImportRows)
+	}
+	headers := make(map[string]int)
+	for i, h := range records[0] {
+		key := strings.ToLower(strings.TrimSpace(h))
+		if _, ok := headers[key]; !ok {
+			headers[key] = i
+		}
+	}
+	columns := make(map[string]int)
+	for _, field := range csvImportFields {
+		header, mapped := mapping[field]
+		if !mapped {
+			header = field
+		}
+		idx, ok := headers[strings.ToLower(strings.TrimSpace(header))]
+		if !ok {
+			if mapped || field == "title" {
+				return nil, nil, fmt.Errorf("%w: column %q not found", ErrInvalidImport, header)
+			}
+			continue
+		}
+		columns[field] = idx
+	}
+	return records[1:], columns, nil
+}
+
+func formatCSVTime(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
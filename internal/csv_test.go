@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestProjectCSVExportImport(t *testing.T) {
+	db := newTestDB(t)
+	CreateUser(db, &User{Username: "alice"})
+	projectID, _ := CreateProject(db, &Project{Name: "Sheet", CreatorID: 1})
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "Write spec", Content: "line 1\nline \"2\"", Type: "task", CreatorID: 1, ProjectID: projectID})
+	e2, _ := CreateContentEntry(db, &ContentEntry{Title: "Old", CreatorID: 1, ProjectID: projectID})
+	e3, _ := CreateContentEntry(db, &ContentEntry{Title: "Loose", CreatorID: 1, ProjectID: projectID})
+	todo, _ := CreateContentList(db, &ContentList{Title: "Todo", ProjectID: projectID, Items: []int64{e1, e2}})
+	doing, _ := CreateContentList(db, &ContentList{Title: "Doing", ProjectID: projectID, MaxItems: 1, AllowedTypes: []string{"task"}})
+	ArchiveContentEntry(db, e2, 100)
+
+	var buf bytes.Buffer
+	if err := WriteProjectCSV(db, projectID, &buf); err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(buf.Bytes())).ReadAll()
+	if err != nil {
+		t.Fatalf("导出的 CSV 无法解析: %v", err)
+	}
+	if len(records) != 3 || strings.Join(records[0], ",") != strings.Join(CSVExportColumns, ",") {
+		t.Fatalf("导出行不正确: %v", records)
+	}
+	if records[1][1] != "Todo" || records[1][2] != "Write spec" || records[1][3] != "line 1\nline \"2\"" || records[1][5] != "alice" {
+		t.Fatalf("条目行不正确: %v", records[1])
+	}
+	if records[2][0] != strconv.FormatInt(e3, 10) || records[2][1] != "" || records[2][2] != "Loose" {
+		t.Fatalf("不在列表中的条目应排在最后: %v", records[2])
+	}
+
+	// 预览不写入
+	input := "\xef\xbb\xbfSummary,Status,Kind,Notes\n" +
+		"Plan,Todo,task,first\n" +
+		",Todo,task,no title\n" +
+		"Build,doing,task,\n" +
+		"Ship,Doing,task,over limit\n" +
+		"Bug,Doing,bug,wrong type\n" +
+		"Retro,Done\n" +
+		"Triage,,task,\n"
+	opts := CSVImportOptions{Mapping: map[string]string{"title": "Summary", "list": "Status", "type": "Kind", "content": "Notes"}, DefaultList: "Inbox", DryRun: true}
+	preview, err := ImportProjectCSV(db, projectID, 1, []byte(input), opts)
+	if err != nil {
+		t.Fatalf("预览失败: %v", err)
+	}
+	if preview.Created != 4 || preview.Failed != 3 || strings.Join(preview.CreatedLists, ",") != "Done,Inbox" {
+		t.Fatalf("预览结果不正确: %+v", preview)
+	}
+	wantErrors := map[int]bool{3: true, 5: true, 6: true}
+	for _, row := range preview.Rows {
+		if (row.Error != "") != wantErrors[row.Row] || row.EntryID != 0 {
+			t.Fatalf("第 %d 行的结果不正确: %+v", row.Row, row)
+		}
+	}
+	if entries, _ := db.Query("content_entry", nil); entries.Count() != 3 {
+		t.Fatal("预览不应创建条目")
+	}
+
+	opts.DryRun = false
+	result, err := ImportProjectCSV(db, projectID, 1, []byte(input), opts)
+	if err != nil || result.Created != 4 || result.Failed != 3 {
+		t.Fatalf("导入失败: %v %+v", err, result)
+	}
+	cl, _ := GetContentList(db, todo)
+	if len(cl.Items) != 2 || cl.Items[0] != e1 {
+		t.Fatalf("条目应追加到已有列表: %v", cl.Items)
+	}
+	plan, _ := GetContentEntry(db, cl.Items[1])
+	if plan.Title != "Plan" || plan.Content != "first" || plan.Type != "task" || plan.CreatorID != 1 {
+		t.Fatalf("字段映射不正确: %+v", plan)
+	}
+	if cl, _ := GetContentList(db, doing); len(cl.Items) != 1 {
+		t.Fatalf("应遵守列表的 WIP 上限: %v", cl.Items)
+	}
+	lists, _ := GetContentListsByProject(db, projectID)
+	if len(lists) != 4 || lists[2].Title != "Done" || lists[3].Title != "Inbox" || len(lists[3].Items) != 1 {
+		t.Fatalf("应按名称创建缺少的列表: %+v", lists)
+	}
+	if ok, _ := HasPermission(db, 1, "content_list", lists[2].ID, "admin"); !ok {
+		t.Fatal("导入者应获得新列表的 admin 权限")
+	}
+
+	// 导出的文件可以直接导入
+	again, err := ImportProjectCSV(db, projectID, 1, buf.Bytes(), CSVImportOptions{DefaultList: "Inbox"})
+	if err != nil || again.Created != 2 || again.Rows[1].List != "Inbox" {
+		t.Fatalf("重新导入导出文件失败: %v %+v", err, again)
+	}
+
+	if _, err := ImportProjectCSV(db, projectID, 1, []byte("Name\nx\n"), CSVImportOptions{}); !errors.Is(err, ErrInvalidImport) {
+		t.Fatalf("缺少标题列时应拒绝, got %v", err)
+	}
+	if _, err := ImportProjectCSV(db, projectID, 1, []byte("title\nx\n"), CSVImportOptions{Mapping: map[string]string{"owner": "x"}}); !errors.Is(err, ErrInvalidImport) {
+		t.Fatalf("应拒绝未知的字段映射, got %v", err)
+	}
+	if _, err := ImportProjectCSV(db, projectID, 1, []byte("title\n\"unterminated\n"), CSVImportOptions{}); !errors.Is(err, ErrInvalidImport) {
+		t.Fatalf("应拒绝格式错误的 CSV, got %v", err)
+	}
+}
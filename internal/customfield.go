@@ -0,0 +1,471 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+const (
+	CustomFieldTypeText         = "text"
+	CustomFieldTypeNumber       = "number"
+	CustomFieldTypeDate         = "date"
+	CustomFieldTypeSingleSelect = "single_select"
+	CustomFieldTypeMultiSelect  = "multi_select"
+	CustomFieldTypeUser         = "user"
+)
+
+// ErrInvalidCustomField is returned when a field definition or value does not match its type.
+var ErrInvalidCustomField = errors.New("invalid custom field")
+
+func isSelectType(fieldType string) bool {
+	return fieldType == CustomFieldTypeSingleSelect || fieldType == CustomFieldTypeMultiSelect
+}
+
+// ValidateCustomField checks a field definition and normalizes its name and options.
+func ValidateCustomField(f *CustomField) error {
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidCustomField)
+	}
+	switch f.Type {
+	case CustomFieldTypeText, CustomFieldTypeNumber, CustomFieldTypeDate, CustomFieldTypeUser:
+		f.Options = make([]string, 0)
+	case CustomFieldTypeSingleSelect, CustomFieldTypeMultiSelect:
+		seen := make(map[string]bool)
+		options := make([]string, 0, len(f.Options))
+		for _, o := range f.Options {
+			o = strings.TrimSpace(o)
+			if o == "" || seen[o] {
+				continue
+			}
+			seen[o] = true
+			options = append(options, o)
+		}
+		if len(options) == 0 {
+			return fmt.Errorf("%w: select fields need at least one option", ErrInvalidCustomField)
+		}
+		f.Options = options
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidCustomField, f.Type)
+	}
+	return nil
+}
+
+// NormalizeCustomFieldValue converts a decoded JSON value into the Go type stored for the field,
+// rejecting values that do not match the field type. A nil result means the value is cleared.
+func NormalizeCustomFieldValue(db types.Conn, f *CustomField, raw interface{}) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	invalid := func(expected string) error {
+		return fmt.Errorf("%w: field %q expects %s", ErrInvalidCustomField, f.Name, expected)
+	}
+	switch f.Type {
+	case CustomFieldTypeText:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, invalid("a string")
+		}
+		return s, nil
+	case CustomFieldTypeNumber:
+		n, ok := raw.(float64)
+		if !ok || math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, invalid("a number")
+		}
+		return n, nil
+	case CustomFieldTypeDate:
+		switch v := raw.(type) {
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, invalid("a Unix timestamp")
+			}
+			return int64(v), nil
+		case string:
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, invalid("a Unix timestamp or RFC 3339 date")
+			}
+			return t.Unix(), nil
+		}
+		return nil, invalid("a Unix timestamp or RFC 3339 date")
+	case CustomFieldTypeSingleSelect:
+		s, ok := raw.(string)
+		if !ok || !containsString(f.Options, s) {
+			return nil, invalid("one of its options")
+		}
+		return s, nil
+	case CustomFieldTypeMultiSelect:
+		items, ok := raw.([]interface{})
+		if !ok {
+			return nil, invalid("a list of its options")
+		}
+		values := make([]string, 0, len(items))
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok || !containsString(f.Options, s) {
+				return nil, invalid("a list of its options")
+			}
+			if !containsString(values, s) {
+				values = append(values, s)
+			}
+		}
+		return values, nil
+	case CustomFieldTypeUser:
+		n, ok := raw.(float64)
+		if !ok || n != math.Trunc(n) || n <= 0 {
+			return nil, invalid("a user ID")
+		}
+		userID := int64(n)
+		canRead, err := HasPermission(db, userID, "project", f.ProjectID, "read")
+		if err != nil {
+			return nil, err
+		}
+		if !canRead {
+			return nil, fmt.Errorf("%w: user %d has no read access to project %d", ErrInvalidCustomField, userID, f.ProjectID)
+		}
+		return userID, nil
+	}
+	return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidCustomField, f.Type)
+}
+
+// CustomField CRUD
+
+func CreateCustomField(db types.Conn, f *CustomField) (int64, error) {
+	optionsJson, _ := json.Marshal(f.Options)
+	cond := dbhelper.Cond().Eq("project_id", f.ProjectID).Eq("name", f.Name).Eq("field_type", f.Type).Eq("options", string(optionsJson)).Eq("order_num", f.Order).Build()
+	return db.Insert("custom_field", cond)
+}
+
+func GetCustomField(db types.Conn, id int64) (*CustomField, error) {
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	rows, err := db.Query("custom_field", cond)
+	if err != nil {
+		return nil, err
+	}
+	if rows.Count() == 0 {
+		return nil, errors.New("custom field not found")
+	}
+	f := customFieldFromRow(rows.All()[0])
+	return &f, nil
+}
+
+// UpdateCustomField updates a field definition. Select values whose option was removed are deleted.
+func UpdateCustomField(db types.Conn, id int64, updates *CustomField) error {
+	optionsJson, _ := json.Marshal(updates.Options)
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	upd := dbhelper.Cond().Eq("name", updates.Name).Eq("options", string(optionsJson)).Eq("order_num", updates.Order).Build()
+	_, err := db.Update("custom_field", cond, upd)
+	if err != nil {
+		return err
+	}
+	if !isSelectType(updates.Type) {
+		return nil
+	}
+	valueCond := dbhelper.Cond().Eq("field_id", id).Build()
+	rows, err := db.Query("custom_field_value", valueCond)
+	if err != nil {
+		return err
+	}
+	for _, data := range rows.All() {
+		if containsString(updates.Options, asString(data["text_value"])) {
+			continue
+		}
+		delCond := dbhelper.Cond().Eq("id", data["id"].(int64)).Build()
+		if _, err := db.Delete("custom_field_value", delCond); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteCustomField deletes a field definition together with all of its values.
+func DeleteCustomField(db types.Conn, id int64) error {
+	valueCond := dbhelper.Cond().Eq("field_id", id).Build()
+	_, err := db.Delete("custom_field_value", valueCond)
+	if err != nil {
+		return err
+	}
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	_, err = db.Delete("custom_field", cond)
+	return err
+}
+
+// GetCustomFieldsByProject returns the field definitions of a project ordered by Order then ID.
+func GetCustomFieldsByProject(db types.Conn, projectID int64) ([]CustomField, error) {
+	cond := dbhelper.Cond().Eq("project_id", projectID).Build()
+	rows, err := db.Query("custom_field", cond)
+	if err != nil {
+		return []CustomField{}, err
+	}
+	fields := make([]CustomField, 0)
+	for _, data := range rows.All() {
+		fields = append(fields, customFieldFromRow(data))
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].Order != fields[j].Order {
+			return fields[i].Order < fields[j].Order
+		}
+		return fields[i].ID < fields[j].ID
+	})
+	return fields, nil
+}
+
+// DeleteCustomFieldsByProject removes every field definition of a project and their values.
+func DeleteCustomFieldsByProject(db types.Conn, projectID int64) error {
+	fields, err := GetCustomFieldsByProject(db, projectID)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if err := DeleteCustomField(db, f.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func customFieldFromRow(data map[string]interface{}) CustomField {
+	f := CustomField{
+		ID:        data["id"].(int64),
+		ProjectID: data["project_id"].(int64),
+		Name:      data["name"].(string),
+		Type:      data["field_type"].(string),
+		Order:     int(asInt64(data["order_num"])),
+	}
+	if optionsJson := asString(data["options"]); optionsJson != "" {
+		json.Unmarshal([]byte(optionsJson), &f.Options)
+	}
+	if f.Options == nil {
+		f.Options = make([]string, 0)
+	}
+	return f
+}
+
+// Custom field values
+
+// SetCustomFieldValue replaces the entry's value for the field on behalf of userID and marks the
+// entry as changed. value must already be normalized by NormalizeCustomFieldValue; nil clears it.
+func SetCustomFieldValue(db types.Conn, entryID int64, f *CustomField, value interface{}, userID int64) error {
+	return runInTx(db, "SetCustomFieldValue", func(db types.Conn) error {
+		if err := setCustomFieldValue(db, entryID, f, value); err != nil {
+			return err
+		}
+		return TouchContentEntry(db, entryID, userID)
+	})
+}
+
+// setCustomFieldValue is SetCustomFieldValue without touching the entry, for callers that write
+// the entry themselves.
+func setCustomFieldValue(db types.Conn, entryID int64, f *CustomField, value interface{}) error {
+	cond := dbhelper.Cond().Eq("entry_id", entryID).Eq("field_id", f.ID).Build()
+	_, err := db.Delete("custom_field_value", cond)
+	if err != nil || value == nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case string:
+		_, err = db.Insert("custom_field_value", dbhelper.Cond().Eq("entry_id", entryID).Eq("field_id", f.ID).Eq("text_value", v).Build())
+		return err
+	case float64:
+		_, err = db.Insert("custom_field_value", dbhelper.Cond().Eq("entry_id", entryID).Eq("field_id", f.ID).Eq("number_value", v).Build())
+		return err
+	case int64:
+		_, err = db.Insert("custom_field_value", dbhelper.Cond().Eq("entry_id", entryID).Eq("field_id", f.ID).Eq("int_value", v).Build())
+		return err
+	case []string:
+		// 多选字段每个选项一行
+		for _, option := range v {
+			_, err = db.Insert("custom_field_value", dbhelper.Cond().Eq("entry_id", entryID).Eq("field_id", f.ID).Eq("text_value", option).Build())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unsupported value type %T", ErrInvalidCustomField, value)
+}
+
+// DeleteCustomFieldValuesByEntry removes every custom field value of an entry.
+func DeleteCustomFieldValuesByEntry(db types.Conn, entryID int64) error {
+	cond := dbhelper.Cond().Eq("entry_id", entryID).Build()
+	_, err := db.Delete("custom_field_value", cond)
+	return err
+}
+
+// attachCustomFields fills in CustomFields for a batch of entries with one query per table.
+func attachCustomFields(db types.Conn, entries []ContentEntry) error {
+	fields := make(map[int64]CustomField)
+	valueData := make([]map[string]interface{}, 0)
+	if len(entries) == 1 {
+		// 单个条目只查询其所属项目与自身的数据
+		fieldRows, err := db.Query("custom_field", dbhelper.Cond().Eq("project_id", entries[0].ProjectID).Build())
+		if err != nil {
+			return err
+		}
+		for _, data := range fieldRows.All() {
+			f := customFieldFromRow(data)
+			fields[f.ID] = f
+		}
+		valueRows, err := db.Query("custom_field_value", dbhelper.Cond().Eq("entry_id", entries[0].ID).Build())
+		if err != nil {
+			return err
+		}
+		for _, data := range valueRows.All() {
+			valueData = append(valueData, data)
+		}
+	} else {
+		fieldRows, err := db.Query("custom_field", nil)
+		if err != nil {
+			return err
+		}
+		for _, data := range fieldRows.All() {
+			f := customFieldFromRow(data)
+			fields[f.ID] = f
+		}
+		valueRows, err := db.Query("custom_field_value", nil)
+		if err != nil {
+			return err
+		}
+		for _, data := range valueRows.All() {
+			valueData = append(valueData, data)
+		}
+	}
+
+	type key struct{ entryID, fieldID int64 }
+	values := make(map[key]interface{})
+	order := make(map[int64][]int64) // entryID -> field IDs in first-seen order
+	for _, data := range valueData {
+		k := key{data["entry_id"].(int64), data["field_id"].(int64)}
+		f, ok := fields[k.fieldID]
+		if !ok {
+			continue
+		}
+		if _, seen := values[k]; !seen {
+			order[k.entryID] = append(order[k.entryID], k.fieldID)
+		}
+		switch f.Type {
+		case CustomFieldTypeNumber:
+			n, _ := data["number_value"].(float64)
+			values[k] = n
+		case CustomFieldTypeDate, CustomFieldTypeUser:
+			values[k] = asInt64(data["int_value"])
+		case CustomFieldTypeMultiSelect:
+			list, _ := values[k].([]string)
+			values[k] = append(list, asString(data["text_value"]))
+		default:
+			values[k] = asString(data["text_value"])
+		}
+	}
+
+	for i := range entries {
+		fieldIDs := order[entries[i].ID]
+		sort.Slice(fieldIDs, func(a, b int) bool {
+			fa, fb := fields[fieldIDs[a]], fields[fieldIDs[b]]
+			if fa.Order != fb.Order {
+				return fa.Order < fb.Order
+			}
+			return fa.ID < fb.ID
+		})
+		entries[i].CustomFields = make([]CustomFieldValue, 0, len(fieldIDs))
+		for _, fieldID := range fieldIDs {
+			entries[i].CustomFields = append(entries[i].CustomFields, CustomFieldValue{
+				FieldID: fieldID,
+				Value:   values[key{entries[i].ID, fieldID}],
+			})
+		}
+	}
+	return nil
+}
+
+// CustomFieldValueOf returns the entry's value for the field, or nil if unset.
+func CustomFieldValueOf(ce *ContentEntry, fieldID int64) interface{} {
+	for _, v := range ce.CustomFields {
+		if v.FieldID == fieldID {
+			return v.Value
+		}
+	}
+	return nil
+}
+
+// matchCustomFieldValue compares a stored value with a query string. Multi-select values match
+// when any option equals want.
+func matchCustomFieldValue(value interface{}, want string) bool {
+	switch v := value.(type) {
+	case string:
+		return v == want
+	case float64:
+		n, err := strconv.ParseFloat(want, 64)
+		return err == nil && n == v
+	case int64:
+		n, err := strconv.ParseInt(want, 10, 64)
+		return err == nil && n == v
+	case []string:
+		return containsString(v, want)
+	}
+	return false
+}
+
+// compareCustomFieldValues orders two values of the same field; it returns -1, 0 or 1.
+func compareCustomFieldValues(a, b interface{}) int {
+	switch av := a.(type) {
+	case float64:
+		bv, _ := b.(float64)
+		return cmpOrdered(av, bv)
+	case int64:
+		bv, _ := b.(int64)
+		return cmpOrdered(av, bv)
+	case string:
+		bv, _ := b.(string)
+		return cmpOrdered(strings.ToLower(av), strings.ToLower(bv))
+	case []string:
+		bv, _ := b.([]string)
+		return cmpOrdered(strings.ToLower(strings.Join(av, ",")), strings.ToLower(strings.Join(bv, ",")))
+	}
+	return 0
+}
+
+func cmpOrdered[T int64 | float64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// SortContentEntriesByCustomField sorts entries by a custom field value. Entries without a value
+// always sort last regardless of direction.
+func SortContentEntriesByCustomField(entries []ContentEntry, fieldID int64, desc bool) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a := CustomFieldValueOf(&entries[i], fieldID)
+		b := CustomFieldValueOf(&entries[j], fieldID)
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		c := compareCustomFieldValues(a, b)
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
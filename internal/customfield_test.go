@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeCustomFieldValue(t *testing.T) {
+	db := newTestDB(t)
+	grant(t, db, 5, "project", 1, "read")
+
+	cases := []struct {
+		field CustomField
+		raw   interface{}
+		ok    bool
+	}{
+		{CustomField{Type: CustomFieldTypeText}, "prod", true},
+		{CustomField{Type: CustomFieldTypeText}, 1.0, false},
+		{CustomField{Type: CustomFieldTypeNumber}, 3.5, true},
+		{CustomField{Type: CustomFieldTypeNumber}, "3", false},
+		{CustomField{Type: CustomFieldTypeDate}, 1700000000.0, true},
+		{CustomField{Type: CustomFieldTypeDate}, "2024-01-02T03:04:05Z", true},
+		{CustomField{Type: CustomFieldTypeDate}, "tomorrow", false},
+		{CustomField{Type: CustomFieldTypeSingleSelect, Options: []string{"dev", "prod"}}, "prod", true},
+		{CustomField{Type: CustomFieldTypeSingleSelect, Options: []string{"dev", "prod"}}, "qa", false},
+		{CustomField{Type: CustomFieldTypeMultiSelect, Options: []string{"a", "b"}}, []interface{}{"a", "b"}, true},
+		{CustomField{Type: CustomFieldTypeMultiSelect, Options: []string{"a", "b"}}, []interface{}{"c"}, false},
+		{CustomField{Type: CustomFieldTypeUser, ProjectID: 1}, 5.0, true},
+		{CustomField{Type: CustomFieldTypeUser, ProjectID: 1}, 6.0, false},
+	}
+	for _, tc := range cases {
+		_, err := NormalizeCustomFieldValue(db, &tc.field, tc.raw)
+		if tc.ok && err != nil {
+			t.Errorf("%s 字段应接受 %v: %v", tc.field.Type, tc.raw, err)
+		}
+		if !tc.ok && !errors.Is(err, ErrInvalidCustomField) {
+			t.Errorf("%s 字段应拒绝 %v, got %v", tc.field.Type, tc.raw, err)
+		}
+	}
+}
+
+func TestCustomFieldValuesFilterSortAndDelete(t *testing.T) {
+	db := newTestDB(t)
+
+	points := &CustomField{ProjectID: 1, Name: "Story points", Type: CustomFieldTypeNumber}
+	points.ID, _ = CreateCustomField(db, points)
+	env := &CustomField{ProjectID: 1, Name: "Env", Type: CustomFieldTypeMultiSelect, Options: []string{"dev", "prod"}}
+	env.ID, _ = CreateCustomField(db, env)
+
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: 1})
+	e2, _ := CreateContentEntry(db, &ContentEntry{Title: "E2", ProjectID: 1})
+	e3, _ := CreateContentEntry(db, &ContentEntry{Title: "E3", ProjectID: 1})
+	SetCustomFieldValue(db, e1, points, 8.0, 1)
+	SetCustomFieldValue(db, e2, points, 3.0, 1)
+	SetCustomFieldValue(db, e2, env, []string{"dev", "prod"}, 1)
+
+	got, err := GetContentEntry(db, e2)
+	if err != nil || len(got.CustomFields) != 2 {
+		t.Fatalf("条目应返回自定义字段值: %v, got=%+v", err, got)
+	}
+	if v, ok := CustomFieldValueOf(got, env.ID).([]string); !ok || len(v) != 2 {
+		t.Fatalf("多选字段值错误: %+v", got.CustomFields)
+	}
+
+	entries, _ := GetContentEntries(db)
+	filtered := FilterContentEntries(entries, EntryFilter{CustomFields: map[int64]string{env.ID: "prod"}})
+	if len(filtered) != 1 || filtered[0].ID != e2 {
+		t.Fatalf("按自定义字段过滤失败: %+v", filtered)
+	}
+
+	SortContentEntriesByCustomField(entries, points.ID, false)
+	if entries[0].ID != e2 || entries[1].ID != e1 || entries[2].ID != e3 {
+		t.Fatalf("按自定义字段排序失败: %d %d %d", entries[0].ID, entries[1].ID, entries[2].ID)
+	}
+
+	if err := DeleteCustomField(db, points.ID); err != nil {
+		t.Fatalf("删除字段失败: %v", err)
+	}
+	got, _ = GetContentEntry(db, e1)
+	if len(got.CustomFields) != 0 {
+		t.Fatalf("删除字段后值应被清理: %+v", got.CustomFields)
+	}
+}
+
+func TestSetCustomFieldValueTouchesEntry(t *testing.T) {
+	db := newTestDB(t)
+
+	points := &CustomField{ProjectID: 1, Name: "Story points", Type: CustomFieldTypeNumber}
+	points.ID, _ = CreateCustomField(db, points)
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: 1})
+	changes, _ := changesAfter(db, 0, MaxSyncLimit, nil)
+	since := changes[len(changes)-1].seq
+
+	if err := SetCustomFieldValue(db, e1, points, 5.0, 7); err != nil {
+		t.Fatalf("设置字段值失败: %v", err)
+	}
+	got, _ := GetContentEntry(db, e1)
+	if got.UpdatedBy != 7 || got.UpdatedAt == 0 {
+		t.Fatalf("设置字段值应更新条目: %+v", got.Timestamps)
+	}
+	changes, _ = changesAfter(db, since, MaxSyncLimit, nil)
+	if len(changes) != 1 || changes[0].objectType != "content_entry" || changes[0].objectID != e1 {
+		t.Fatalf("设置字段值应记录条目变更: %+v", changes)
+	}
+}
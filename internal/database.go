@@ -1,8 +1,16 @@
 package internal
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
 	"github.com/Kaguya154/dbhelper"
 	"github.com/Kaguya154/dbhelper/drivers/sqlite"
+	"github.com/Kaguya154/dbhelper/types"
 )
 
 func init() {
@@ -11,3 +19,168 @@ func init() {
 		return
 	}
 }
+
+// Migrations upgrades a database created by an earlier build, in order. Each statement runs once
+// per database: PRAGMA user_version records how many have run (see PendingMigrations). A fresh
+// database gets every table at its current shape and then runs them all, so adding a column that
+// exists fails with "duplicate column", which the caller ignores. Append new migrations at the end,
+// which bumps SchemaVersion.
+var Migrations = []string{
+	// 为旧数据库补充新增的列，列已存在时报 duplicate column 并跳过
+	"ALTER TABLE content_entry ADD COLUMN assignees TEXT DEFAULT '[]'",
+	"ALTER TABLE content_entry ADD COLUMN start_at INTEGER DEFAULT 0",
+	"ALTER TABLE content_entry ADD COLUMN due_at INTEGER DEFAULT 0",
+	"ALTER TABLE content_list ADD COLUMN max_items INTEGER DEFAULT 0",
+	"ALTER TABLE content_list ADD COLUMN allowed_types TEXT DEFAULT '[]'",
+	"ALTER TABLE content_list ADD COLUMN move_permission TEXT DEFAULT ''",
+	"ALTER TABLE content_list ADD COLUMN archived_at INTEGER DEFAULT 0",
+	"ALTER TABLE content_entry ADD COLUMN archived_at INTEGER DEFAULT 0",
+	"ALTER TABLE content_entry ADD COLUMN archived_list_id INTEGER DEFAULT 0",
+	"ALTER TABLE content_entry ADD COLUMN archived_position INTEGER DEFAULT 0",
+	"ALTER TABLE project ADD COLUMN is_template INTEGER DEFAULT 0",
+	"ALTER TABLE page ADD COLUMN project_id INTEGER DEFAULT 0",
+	"ALTER TABLE page ADD COLUMN parent_id INTEGER DEFAULT 0",
+	"ALTER TABLE page ADD COLUMN slug TEXT DEFAULT ''",
+	"ALTER TABLE page ADD COLUMN body TEXT DEFAULT ''",
+	"ALTER TABLE sidebar ADD COLUMN project_id INTEGER DEFAULT 0",
+	"ALTER TABLE sidebar ADD COLUMN user_id INTEGER DEFAULT 0",
+	"ALTER TABLE sidebar_item ADD COLUMN sidebar_id INTEGER DEFAULT 0",
+	"ALTER TABLE sidebar_item ADD COLUMN target_type TEXT DEFAULT ''",
+	"ALTER TABLE sidebar_item ADD COLUMN target_id INTEGER DEFAULT 0",
+	"ALTER TABLE project ADD COLUMN created_at INTEGER DEFAULT 0",
+	"ALTER TABLE project ADD COLUMN updated_at INTEGER DEFAULT 0",
+	"ALTER TABLE project ADD COLUMN updated_by INTEGER DEFAULT 0",
+	"ALTER TABLE user ADD COLUMN created_at INTEGER DEFAULT 0",
+	"ALTER TABLE user ADD COLUMN updated_at INTEGER DEFAULT 0",
+	"ALTER TABLE user ADD COLUMN updated_by INTEGER DEFAULT 0",
+	"ALTER TABLE content_list ADD COLUMN created_at INTEGER DEFAULT 0",
+	"ALTER TABLE content_list ADD COLUMN updated_at INTEGER DEFAULT 0",
+	"ALTER TABLE content_list ADD COLUMN updated_by INTEGER DEFAULT 0",
+	"ALTER TABLE content_entry ADD COLUMN created_at INTEGER DEFAULT 0",
+	"ALTER TABLE content_entry ADD COLUMN updated_at INTEGER DEFAULT 0",
+	"ALTER TABLE content_entry ADD COLUMN updated_by INTEGER DEFAULT 0",
+	"ALTER TABLE detail_permission ADD COLUMN created_at INTEGER DEFAULT 0",
+	"ALTER TABLE detail_permission ADD COLUMN updated_at INTEGER DEFAULT 0",
+	"ALTER TABLE detail_permission ADD COLUMN updated_by INTEGER DEFAULT 0",
+	"ALTER TABLE share_token ADD COLUMN creator_id INTEGER DEFAULT 0",
+	// 旧的侧边栏项用 parent_id 记录所属侧边栏，迁移到 sidebar_id 后 parent_id 表示父级项
+	"UPDATE sidebar_item SET sidebar_id = parent_id, parent_id = 0 WHERE sidebar_id = 0 OR sidebar_id IS NULL",
+	// 为迁移前已存在的记录补上创建与更新时间，修改人默认为创建者
+	"UPDATE project SET created_at = CAST(strftime('%s','now') AS INTEGER), updated_at = CAST(strftime('%s','now') AS INTEGER), updated_by = creator_id WHERE created_at = 0 OR created_at IS NULL",
+	"UPDATE content_list SET created_at = CAST(strftime('%s','now') AS INTEGER), updated_at = CAST(strftime('%s','now') AS INTEGER), updated_by = creator_id WHERE created_at = 0 OR created_at IS NULL",
+	"UPDATE content_entry SET created_at = CAST(strftime('%s','now') AS INTEGER), updated_at = CAST(strftime('%s','now') AS INTEGER), updated_by = creator_id WHERE created_at = 0 OR created_at IS NULL",
+	"UPDATE user SET created_at = CAST(strftime('%s','now') AS INTEGER), updated_at = CAST(strftime('%s','now') AS INTEGER) WHERE created_at = 0 OR created_at IS NULL",
+	"UPDATE detail_permission SET created_at = CAST(strftime('%s','now') AS INTEGER), updated_at = CAST(strftime('%s','now') AS INTEGER) WHERE created_at = 0 OR created_at IS NULL",
+	// 同一 incoming webhook 的外部 key 唯一，并发投递由数据库拒绝重复的 key；建索引前只保留每个 key 最新的一条
+	"DELETE FROM incoming_webhook_key WHERE id NOT IN (SELECT MAX(id) FROM incoming_webhook_key GROUP BY webhook_id, external_key)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS idx_incoming_webhook_key ON incoming_webhook_key (webhook_id, external_key)",
+	// 变更日志记录对象所属项目，同步时只读取调用者可读项目的变更；为已有记录补上项目
+	"ALTER TABLE change_log ADD COLUMN project_id INTEGER DEFAULT 0",
+	"UPDATE change_log SET project_id = object_id WHERE object_type = 'project' AND (project_id = 0 OR project_id IS NULL)",
+	"UPDATE change_log SET project_id = COALESCE((SELECT project_id FROM content_list WHERE content_list.id = change_log.object_id), 0) WHERE object_type = 'content_list' AND (project_id = 0 OR project_id IS NULL)",
+	"UPDATE change_log SET project_id = COALESCE((SELECT project_id FROM content_entry WHERE content_entry.id = change_log.object_id), 0) WHERE object_type = 'content_entry' AND (project_id = 0 OR project_id IS NULL)",
+}
+
+// SchemaVersion is the database schema version of this build, stored in PRAGMA user_version when
+// the database is opened. It is the number of Migrations.
+var SchemaVersion = len(Migrations)
+
+// PendingMigrations returns the Migrations that have not run on the database yet, going by the
+// schema version in PRAGMA user_version. A database from a newer build is rejected.
+func PendingMigrations(db types.Conn) ([]string, error) {
+	rows, err := db.Query("pragma_user_version", nil)
+	if err != nil {
+		return nil, err
+	}
+	version := 0
+	if rows.Count() > 0 {
+		version = int(asInt64(rows.All()[0]["user_version"]))
+	}
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("database schema version %d is newer than this build supports (%d)", version, SchemaVersion)
+	}
+	return Migrations[version:], nil
+}
+
+// asInt64 reads an INTEGER column that may be NULL on rows created before the column was added.
+func asInt64(v interface{}) int64 {
+	if n, ok := v.(int64); ok {
+		return n
+	}
+	return 0
+}
+
+// asString reads a TEXT column that may be NULL on rows created before the column was added.
+func asString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
+
+// boolToInt stores a bool in an INTEGER column.
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// newSecretToken returns a random URL-safe token and the hash to store in its place.
+func newSecretToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashSecretToken(token), nil
+}
+
+// hashSecretToken returns the stored form of a token, so a leaked database does not leak live links.
+func hashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// stampCreated sets the timestamps of a new record. by, when not 0, becomes UpdatedBy.
+func (t *Timestamps) stampCreated(by int64) {
+	now := time.Now().Unix()
+	t.CreatedAt = now
+	t.UpdatedAt = now
+	if by != 0 {
+		t.UpdatedBy = by
+	}
+}
+
+// stampUpdated sets UpdatedAt to now.
+func (t *Timestamps) stampUpdated() {
+	t.UpdatedAt = time.Now().Unix()
+}
+
+// timestampsFromRow reads the timestamp columns, which are 0 on rows not yet backfilled.
+func timestampsFromRow(data map[string]interface{}) Timestamps {
+	return Timestamps{
+		CreatedAt: asInt64(data["created_at"]),
+		UpdatedAt: asInt64(data["updated_at"]),
+		UpdatedBy: asInt64(data["updated_by"]),
+	}
+}
+
+// LastUpdated returns UpdatedAt; it lets UpdatedSince filter any record embedding Timestamps.
+func (t Timestamps) LastUpdated() int64 {
+	return t.UpdatedAt
+}
+
+// UpdatedSince keeps the records changed at or after since; 0 keeps everything.
+func UpdatedSince[T interface{ LastUpdated() int64 }](records []T, since int64) []T {
+	if since == 0 {
+		return records
+	}
+	kept := make([]T, 0, len(records))
+	for _, r := range records {
+		if r.LastUpdated() >= since {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/Kaguya154/dbhelper"
+)
+
+func TestTimestampsMaintainedByCRUD(t *testing.T) {
+	db := newTestDB(t)
+
+	projectID, _ := CreateProject(db, &Project{Name: "P", CreatorID: 7})
+	listID, _ := CreateContentList(db, &ContentList{Title: "L", ProjectID: projectID, CreatorID: 7})
+	entryID, _ := CreateContentEntry(db, &ContentEntry{Title: "E", ProjectID: projectID, CreatorID: 7})
+
+	p, _ := GetProject(db, projectID)
+	if p.CreatedAt == 0 || p.UpdatedAt != p.CreatedAt || p.UpdatedBy != 7 {
+		t.Fatalf("创建时应记录时间与创建者: %+v", p.Timestamps)
+	}
+
+	// 把记录的时间调早，确认更新会刷新 updated_at 而保留 created_at
+	old := int64(1000)
+	for _, table := range []string{"project", "content_list", "content_entry"} {
+		sql := "UPDATE " + table + " SET created_at = " + strconv.FormatInt(old, 10) + ", updated_at = " + strconv.FormatInt(old, 10)
+		if _, err := db.Exec(dbhelper.Cond().Raw(sql).Build()); err != nil {
+			t.Fatalf("重置时间失败: %v", err)
+		}
+	}
+	ce, _ := GetContentEntry(db, entryID)
+	ce.Title = "E2"
+	ce.UpdatedBy = 9
+	if err := UpdateContentEntry(db, entryID, ce); err != nil {
+		t.Fatalf("更新条目失败: %v", err)
+	}
+	ce, _ = GetContentEntry(db, entryID)
+	if ce.CreatedAt != old || ce.UpdatedAt <= old || ce.UpdatedBy != 9 {
+		t.Fatalf("更新应刷新 updated_at 与 updated_by: %+v", ce.Timestamps)
+	}
+
+	lists, _ := GetContentListsByProject(db, projectID)
+	if len(lists) != 1 || lists[0].ID != listID || lists[0].UpdatedAt != old {
+		t.Fatalf("未修改的列表应保持原时间: %+v", lists)
+	}
+	if got := UpdatedSince(lists, old+1); len(got) != 0 {
+		t.Fatalf("updated_since 之后未修改的列表应被过滤: %+v", got)
+	}
+	if got := UpdatedSince(lists, 0); len(got) != 1 {
+		t.Fatal("updated_since 为 0 时不过滤")
+	}
+
+	entries, _ := GetContentEntries(db)
+	if got := FilterContentEntries(entries, EntryFilter{UpdatedSince: old + 1}); len(got) != 1 || got[0].ID != entryID {
+		t.Fatalf("应只返回更新过的条目: %+v", got)
+	}
+}
+
+func TestPendingMigrations(t *testing.T) {
+	db := newTestDB(t)
+
+	setVersion := func(v int) {
+		if _, err := db.Exec(dbhelper.Cond().Raw("PRAGMA user_version = " + strconv.Itoa(v)).Build()); err != nil {
+			t.Fatalf("设置 schema 版本失败: %v", err)
+		}
+	}
+	if pending, err := PendingMigrations(db); err != nil || len(pending) != len(Migrations) {
+		t.Fatalf("未记录版本的数据库应执行全部迁移: %v %d", err, len(pending))
+	}
+	setVersion(3)
+	if pending, err := PendingMigrations(db); err != nil || len(pending) != len(Migrations)-3 || pending[0] != Migrations[3] {
+		t.Fatalf("应只返回尚未执行的迁移: %v %d", err, len(pending))
+	}
+	setVersion(SchemaVersion)
+	if pending, err := PendingMigrations(db); err != nil || len(pending) != 0 {
+		t.Fatalf("已是最新版本时不应有迁移: %v %v", err, pending)
+	}
+	setVersion(SchemaVersion + 1)
+	if _, err := PendingMigrations(db); err == nil {
+		t.Fatal("应拒绝更新版本的数据库")
+	}
+}
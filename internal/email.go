@@ -0,0 +1,374 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// Digest frequencies
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// Outbox states
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailFailed  = "failed"
+)
+
+const (
+	// MaxEmailAttempts is how many times an email is tried before it is marked failed.
+	MaxEmailAttempts = 5
+	// emailRetryBase is the delay before the first retry, in seconds; it doubles with each attempt.
+	emailRetryBase = 60
+	// digestMaxCards caps the cards listed per project in a digest.
+	digestMaxCards = 20
+)
+
+var (
+	// ErrInvalidEmailPreferences is returned for unknown notification types, digest frequencies or locales.
+	ErrInvalidEmailPreferences = errors.New("invalid email preferences")
+	// ErrUnknownUnsubscribeToken is returned when an unsubscribe link does not match any user.
+	ErrUnknownUnsubscribeToken = errors.New("unknown unsubscribe token")
+)
+
+// GetEmailPreferences returns the user's email settings. Email is opt-in: by default no
+// notification type is emailed and digests are off.
+func GetEmailPreferences(db types.Conn, userID int64) (*EmailPreferences, error) {
+	row, err := emailPreferenceRow(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	prefs := &EmailPreferences{Immediate: []string{}, Digest: DigestOff, Locale: DefaultMailLocale}
+	if row == nil {
+		return prefs, nil
+	}
+	json.Unmarshal([]byte(asString(row["immediate"])), &prefs.Immediate)
+	if prefs.Immediate == nil {
+		prefs.Immediate = []string{}
+	}
+	if d := asString(row["digest"]); d != "" {
+		prefs.Digest = d
+	}
+	if l := asString(row["locale"]); l != "" {
+		prefs.Locale = l
+	}
+	return prefs, nil
+}
+
+// SetEmailPreferences validates and stores the user's email settings.
+func SetEmailPreferences(db types.Conn, userID int64, prefs *EmailPreferences) error {
+	prefs.Immediate = normalizeStrings(prefs.Immediate)
+	for _, t := range prefs.Immediate {
+		if !isNotificationType(t) {
+			return fmt.Errorf("%w: unknown notification type %q", ErrInvalidEmailPreferences, t)
+		}
+	}
+	if prefs.Digest == "" {
+		prefs.Digest = DigestOff
+	}
+	if prefs.Digest != DigestOff && prefs.Digest != DigestDaily && prefs.Digest != DigestWeekly {
+		return fmt.Errorf("%w: digest must be off, daily or weekly", ErrInvalidEmailPreferences)
+	}
+	if prefs.Locale == "" {
+		prefs.Locale = DefaultMailLocale
+	}
+	if _, ok := MailTemplates[prefs.Locale]; !ok {
+		return fmt.Errorf("%w: unsupported locale %q", ErrInvalidEmailPreferences, prefs.Locale)
+	}
+	if _, err := ensureEmailPreferenceRow(db, userID); err != nil {
+		return err
+	}
+	immediateJson, _ := json.Marshal(prefs.Immediate)
+	upd := dbhelper.Cond().Eq("immediate", string(immediateJson)).Eq("digest", prefs.Digest).Eq("locale", prefs.Locale).Build()
+	_, err := db.Update("email_preference", dbhelper.Cond().Eq("user_id", userID).Build(), upd)
+	return err
+}
+
+// Unsubscribe turns off every email for the user owning the token.
+func Unsubscribe(db types.Conn, token string) error {
+	if token == "" {
+		return ErrUnknownUnsubscribeToken
+	}
+	cond := dbhelper.Cond().Eq("unsubscribe_token", token).Build()
+	rows, err := db.Query("email_preference", cond)
+	if err != nil {
+		return err
+	}
+	if rows.Count() == 0 {
+		return ErrUnknownUnsubscribeToken
+	}
+	_, err = db.Update("email_preference", cond, dbhelper.Cond().Eq("immediate", "[]").Eq("digest", DigestOff).Build())
+	return err
+}
+
+func emailPreferenceRow(db types.Conn, userID int64) (map[string]interface{}, error) {
+	rows, err := db.Query("email_preference", dbhelper.Cond().Eq("user_id", userID).Build())
+	if err != nil {
+		return nil, err
+	}
+	if rows.Count() == 0 {
+		return nil, nil
+	}
+	return rows.All()[0], nil
+}
+
+// ensureEmailPreferenceRow returns the user's settings row, creating it with a fresh unsubscribe
+// token on first use.
+func ensureEmailPreferenceRow(db types.Conn, userID int64) (map[string]interface{}, error) {
+	row, err := emailPreferenceRow(db, userID)
+	if err != nil || row != nil {
+		return row, err
+	}
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	cond := dbhelper.Cond().Eq("user_id", userID).Eq("immediate", "[]").Eq("digest", DigestOff).Eq("locale", DefaultMailLocale).
+		Eq("unsubscribe_token", hex.EncodeToString(b)).Eq("last_digest_at", 0).Build()
+	if _, err := db.Insert("email_preference", cond); err != nil {
+		return nil, err
+	}
+	return emailPreferenceRow(db, userID)
+}
+
+func unsubscribeURL(baseURL string, row map[string]interface{}) string {
+	return baseURL + "/unsubscribe?token=" + url.QueryEscape(asString(row["unsubscribe_token"]))
+}
+
+// QueueNotificationEmail queues an email for a notification if its recipient chose to get that type
+// by email and has an address. Users are not emailed about their own actions.
+func QueueNotificationEmail(db types.Conn, n *Notification, baseURL string) error {
+	if n.UserID == 0 || n.UserID == n.ActorID {
+		return nil
+	}
+	prefs, err := GetEmailPreferences(db, n.UserID)
+	if err != nil {
+		return err
+	}
+	if !containsString(prefs.Immediate, n.Type) {
+		return nil
+	}
+	u, err := GetUser(db, n.UserID)
+	if err != nil || u.Email == "" {
+		return nil
+	}
+	row, err := ensureEmailPreferenceRow(db, n.UserID)
+	if err != nil {
+		return err
+	}
+	link := ""
+	if n.ProjectID != 0 {
+		link = baseURL + "/board.html?project=" + strconv.FormatInt(n.ProjectID, 10)
+		if n.EntryID != 0 {
+			link += "&entry=" + strconv.FormatInt(n.EntryID, 10)
+		}
+	}
+	m := &Mail{To: u.Email, UnsubscribeURL: unsubscribeURL(baseURL, row)}
+	m.Subject, m.Body, err = RenderMail(prefs.Locale, "notification", map[string]interface{}{
+		"Username":       u.Username,
+		"Message":        n.Message,
+		"Link":           link,
+		"UnsubscribeURL": m.UnsubscribeURL,
+	})
+	if err != nil {
+		return err
+	}
+	return QueueEmail(db, m)
+}
+
+// QueueEmail stores an email in the outbox; ProcessEmailOutbox sends it.
+func QueueEmail(db types.Conn, m *Mail) error {
+	if _, err := mail.ParseAddress(m.To); err != nil {
+		return fmt.Errorf("invalid recipient %q: %v", m.To, err)
+	}
+	now := time.Now().Unix()
+	cond := dbhelper.Cond().Eq("to_addr", m.To).Eq("subject", m.Subject).Eq("body", m.Body).Eq("unsubscribe_url", m.UnsubscribeURL).
+		Eq("status", EmailPending).Eq("attempts", 0).Eq("next_attempt_at", now).Eq("last_error", "").Eq("created_at", now).Eq("sent_at", 0).Build()
+	_, err := db.Insert("email_outbox", cond)
+	return err
+}
+
+// ProcessEmailOutbox sends the pending emails that are due at now. A failed send is retried with
+// exponential backoff until MaxEmailAttempts is reached, after which the email is marked failed.
+func ProcessEmailOutbox(ctx context.Context, db types.Conn, mailer Mailer, now int64) error {
+	rows, err := db.Query("email_outbox", dbhelper.Cond().Eq("status", EmailPending).Build())
+	if err != nil {
+		return err
+	}
+	pending := rows.All()
+	sort.Slice(pending, func(i, j int) bool { return asInt64(pending[i]["id"]) < asInt64(pending[j]["id"]) })
+	for _, data := range pending {
+		if asInt64(data["next_attempt_at"]) > now {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		id := asInt64(data["id"])
+		m := &Mail{To: asString(data["to_addr"]), Subject: asString(data["subject"]), Body: asString(data["body"]), UnsubscribeURL: asString(data["unsubscribe_url"])}
+		cond := dbhelper.Cond().Eq("id", id).Build()
+		sendErr := mailer.Send(ctx, m)
+		if sendErr == nil {
+			if _, err := db.Update("email_outbox", cond, dbhelper.Cond().Eq("status", EmailSent).Eq("sent_at", now).Build()); err != nil {
+				return err
+			}
+			continue
+		}
+		attempts := asInt64(data["attempts"]) + 1
+		status := EmailPending
+		if attempts >= MaxEmailAttempts {
+			status = EmailFailed
+		}
+		hlog.Errorf("ProcessEmailOutbox: Send failed, emailID=%d, attempt=%d, error=%v", id, attempts, sendErr)
+		upd := dbhelper.Cond().Eq("status", status).Eq("attempts", attempts).Eq("last_error", sendErr.Error()).
+			Eq("next_attempt_at", now+emailRetryBase<<(attempts-1)).Build()
+		if _, err := db.Update("email_outbox", cond, upd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type digestCard struct {
+	Title string
+}
+
+type digestProject struct {
+	Name    string
+	Link    string
+	Created []digestCard
+	Updated []digestCard
+	More    int
+}
+
+// RunDigests queues the daily and weekly digests that are due at now. A digest lists the cards
+// created or updated since the previous one in the projects the user can read; nothing is sent
+// when there was no activity.
+func RunDigests(db types.Conn, baseURL string, now int64) error {
+	rows, err := db.Query("email_preference", nil)
+	if err != nil {
+		return err
+	}
+	var entries []ContentEntry
+	for _, row := range rows.All() {
+		period := int64(0)
+		switch asString(row["digest"]) {
+		case DigestDaily:
+			period = 24 * 60 * 60
+		case DigestWeekly:
+			period = 7 * 24 * 60 * 60
+		default:
+			continue
+		}
+		last := asInt64(row["last_digest_at"])
+		if last != 0 && now-last < period {
+			continue
+		}
+		since := last
+		if since == 0 {
+			since = now - period
+		}
+		if entries == nil {
+			if entries, err = GetContentEntries(db); err != nil {
+				return err
+			}
+		}
+		userID := asInt64(row["user_id"])
+		if err := queueDigest(db, baseURL, row, entries, since); err != nil {
+			hlog.Errorf("RunDigests: queueDigest failed, userID=%d, error=%v", userID, err)
+			continue
+		}
+		upd := dbhelper.Cond().Eq("last_digest_at", now).Build()
+		if _, err := db.Update("email_preference", dbhelper.Cond().Eq("user_id", userID).Build(), upd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func queueDigest(db types.Conn, baseURL string, row map[string]interface{}, entries []ContentEntry, since int64) error {
+	userID := asInt64(row["user_id"])
+	u, err := GetUser(db, userID)
+	if err != nil || u.Email == "" {
+		return nil
+	}
+	projects, err := GetProjectsForUser(db, userID)
+	if err != nil {
+		return err
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].ID < projects[j].ID })
+	var activity []digestProject
+	for _, p := range projects {
+		dp := digestProject{Name: p.Name, Link: baseURL + "/board.html?project=" + strconv.FormatInt(p.ID, 10)}
+		listed := 0
+		for _, ce := range entries {
+			if ce.ProjectID != p.ID || ce.UpdatedAt < since {
+				continue
+			}
+			if listed == digestMaxCards {
+				dp.More++
+				continue
+			}
+			listed++
+			if ce.CreatedAt >= since {
+				dp.Created = append(dp.Created, digestCard{Title: ce.Title})
+			} else {
+				dp.Updated = append(dp.Updated, digestCard{Title: ce.Title})
+			}
+		}
+		if listed > 0 {
+			activity = append(activity, dp)
+		}
+	}
+	if len(activity) == 0 {
+		return nil
+	}
+	m := &Mail{To: u.Email, UnsubscribeURL: unsubscribeURL(baseURL, row)}
+	m.Subject, m.Body, err = RenderMail(asString(row["locale"]), "digest", map[string]interface{}{
+		"Username":       u.Username,
+		"Period":         asString(row["digest"]),
+		"Projects":       activity,
+		"UnsubscribeURL": m.UnsubscribeURL,
+	})
+	if err != nil {
+		return err
+	}
+	return QueueEmail(db, m)
+}
+
+// RunMailWorker queues due digests and sends the outbox every interval until ctx is done.
+func RunMailWorker(ctx context.Context, db types.Conn, mailer Mailer, baseURL string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		now := time.Now().Unix()
+		if err := RunDigests(db, baseURL, now); err != nil {
+			hlog.Errorf("RunMailWorker: RunDigests failed, error=%v", err)
+		}
+		if err := ProcessEmailOutbox(ctx, db, mailer, now); err != nil && ctx.Err() == nil {
+			hlog.Errorf("RunMailWorker: ProcessEmailOutbox failed, error=%v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+// ErrInvalidAssignee is returned when an assignee cannot read the entry's project.
+var ErrInvalidAssignee = errors.New("invalid assignee")
+
+// EntryFilter narrows a list of content entries. Zero values disable the corresponding filter,
+// except that archived entries are left out unless IncludeArchived is set.
+type EntryFilter struct {
+	AssigneeID int64   // only entries assigned to this user
+	DueBefore  int64   // only entries with a due date before this Unix timestamp
+	Overdue    bool    // only entries whose due date has passed
+	Now        int64   // reference time for Overdue
+	LabelIDs   []int64 // only entries carrying at least one of these labels
+
+	CustomFields map[int64]string // only entries whose custom field value equals the string, keyed by field ID
+
+	IncludeArchived bool  // also return archived entries
+	UpdatedSince    int64 // only entries changed at or after this Unix timestamp
+}
+
+// FilterContentEntries returns the entries matching every filter in f.
+func FilterContentEntries(entries []ContentEntry, f EntryFilter) []ContentEntry {
+	filtered := make([]ContentEntry, 0, len(entries))
+	for _, ce := range entries {
+		if !f.IncludeArchived && ce.ArchivedAt != 0 {
+			continue
+		}
+		if f.UpdatedSince != 0 && ce.UpdatedAt < f.UpdatedSince {
+			continue
+		}
+		if f.AssigneeID != 0 && !containsID(ce.Assignees, f.AssigneeID) {
+			continue
+		}
+		if f.DueBefore != 0 && (ce.DueAt == 0 || ce.DueAt >= f.DueBefore) {
+			continue
+		}
+		if f.Overdue && (ce.DueAt == 0 || ce.DueAt >= f.Now) {
+			continue
+		}
+		if len(f.LabelIDs) > 0 && !containsAnyID(ce.Labels, f.LabelIDs) {
+			continue
+		}
+		if !matchCustomFields(&ce, f.CustomFields) {
+			continue
+		}
+		filtered = append(filtered, ce)
+	}
+	return filtered
+}
+
+// ValidateAssignees checks that every assignee has at least read permission on the project.
+func ValidateAssignees(db types.Conn, projectID int64, assignees []int64) error {
+	for _, userID := range assignees {
+		ok, err := HasPermission(db, userID, "project", projectID, "read")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: user %d has no read access to project %d", ErrInvalidAssignee, userID, projectID)
+		}
+	}
+	return nil
+}
+
+// AddedAssignees returns the assignees that are not among the previous ones. An update only
+// validates these, so a user who lost access to the project does not block unrelated edits.
+func AddedAssignees(previous, assignees []int64) []int64 {
+	added := make([]int64, 0)
+	for _, userID := range assignees {
+		if !containsID(previous, userID) && !containsID(added, userID) {
+			added = append(added, userID)
+		}
+	}
+	return added
+}
+
+// GetAssignedEntriesForUser returns the entries assigned to the user across all projects the user can read.
+func GetAssignedEntriesForUser(db types.Conn, userID int64) ([]ContentEntry, error) {
+	projects, err := GetProjectsForUser(db, userID)
+	if err != nil {
+		return []ContentEntry{}, err
+	}
+	readable := make(map[int64]bool, len(projects))
+	for _, p := range projects {
+		readable[p.ID] = true
+	}
+
+	entries, err := GetContentEntries(db)
+	if err != nil {
+		return []ContentEntry{}, err
+	}
+	assigned := make([]ContentEntry, 0)
+	for _, ce := range FilterContentEntries(entries, EntryFilter{AssigneeID: userID}) {
+		if readable[ce.ProjectID] {
+			assigned = append(assigned, ce)
+		}
+	}
+	return assigned, nil
+}
+
+// GetReadableEntriesForUser returns the entries userID can read, either through read permission
+// on the entry or on its project.
+func GetReadableEntriesForUser(db types.Conn, userID int64) ([]ContentEntry, error) {
+	projects, err := readableIDs(db, userID, "project")
+	if err != nil {
+		return []ContentEntry{}, err
+	}
+	granted, err := readableIDs(db, userID, "content_entry")
+	if err != nil {
+		return []ContentEntry{}, err
+	}
+	entries, err := GetContentEntries(db)
+	if err != nil {
+		return []ContentEntry{}, err
+	}
+	readable := make([]ContentEntry, 0, len(entries))
+	for _, ce := range entries {
+		if projects[ce.ProjectID] || granted[ce.ID] {
+			readable = append(readable, ce)
+		}
+	}
+	return readable, nil
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAnyID(ids []int64, wanted []int64) bool {
+	for _, id := range wanted {
+		if containsID(ids, id) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchCustomFields(ce *ContentEntry, want map[int64]string) bool {
+	for fieldID, value := range want {
+		if !matchCustomFieldValue(CustomFieldValueOf(ce, fieldID), value) {
+			return false
+		}
+	}
+	return true
+}
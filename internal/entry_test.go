@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestFilterContentEntries(t *testing.T) {
+	entries := []ContentEntry{
+		{ID: 1, Assignees: []int64{7}, DueAt: 100},
+		{ID: 2, Assignees: []int64{8}, DueAt: 300},
+		{ID: 3, Assignees: []int64{7, 8}},
+	}
+
+	got := FilterContentEntries(entries, EntryFilter{AssigneeID: 7})
+	if len(got) != 2 || got[0].ID != 1 || got[1].ID != 3 {
+		t.Fatalf("assignee 过滤结果错误: %+v", got)
+	}
+
+	got = FilterContentEntries(entries, EntryFilter{DueBefore: 200})
+	if len(got) != 1 || got[0].ID != 1 {
+		t.Fatalf("due_before 过滤结果错误: %+v", got)
+	}
+
+	got = FilterContentEntries(entries, EntryFilter{Overdue: true, Now: 301})
+	if len(got) != 2 {
+		t.Fatalf("overdue 过滤结果错误: %+v", got)
+	}
+}
+
+func TestAssigneesAndAssignedEntries(t *testing.T) {
+	db := newTestDB(t)
+
+	p1, _ := CreateProject(db, &Project{Name: "P1"})
+	p2, _ := CreateProject(db, &Project{Name: "P2"})
+	grant(t, db, 7, "project", p1, "read")
+
+	if err := ValidateAssignees(db, p1, []int64{7}); err != nil {
+		t.Fatalf("有读权限的负责人应通过校验: %v", err)
+	}
+	if err := ValidateAssignees(db, p2, []int64{7}); !errors.Is(err, ErrInvalidAssignee) {
+		t.Fatalf("无读权限的负责人应被拒绝, got %v", err)
+	}
+
+	id, err := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: p1, Assignees: []int64{7, 7, 0}, DueAt: 42})
+	if err != nil {
+		t.Fatalf("创建条目失败: %v", err)
+	}
+	got, err := GetContentEntry(db, id)
+	if err != nil || len(got.Assignees) != 1 || got.Assignees[0] != 7 || got.DueAt != 42 {
+		t.Fatalf("读取条目负责人失败: %v, got=%+v", err, got)
+	}
+	// 用户无权读取 P2，分配在 P2 的条目不应出现
+	if _, err := CreateContentEntry(db, &ContentEntry{Title: "E2", ProjectID: p2, Assignees: []int64{7}}); err != nil {
+		t.Fatalf("创建条目失败: %v", err)
+	}
+
+	assigned, err := GetAssignedEntriesForUser(db, 7)
+	if err != nil || len(assigned) != 1 || assigned[0].ID != id {
+		t.Fatalf("获取分配给我的条目失败: %v, got=%+v", err, assigned)
+	}
+
+	// 更新时只校验新增的负责人
+	if added := AddedAssignees([]int64{7, 8}, []int64{8, 9, 9, 7}); len(added) != 1 || added[0] != 9 {
+		t.Fatalf("应只返回新增的负责人: %v", added)
+	}
+}
+
+func TestContentEntryUpdateKeepsServerFields(t *testing.T) {
+	ce := ContentEntry{ID: 3, Title: "Old", CreatorID: 1, ProjectID: 1, Assignees: []int64{7}, ArchivedAt: 0}
+	var upd ContentEntryUpdate
+	if err := json.Unmarshal([]byte(`{"title": "New", "due_at": 100, "project_id": 2, "creator_id": 9, "archived_at": 5, "updated_at": 1}`), &upd); err != nil {
+		t.Fatalf("解码失败: %v", err)
+	}
+	upd.Apply(&ce)
+	if ce.Title != "New" || ce.DueAt != 100 || len(ce.Assignees) != 1 {
+		t.Fatalf("应只修改请求中给出的可编辑字段: %+v", ce)
+	}
+	if ce.ProjectID != 1 || ce.CreatorID != 1 || ce.ArchivedAt != 0 || ce.UpdatedAt != 0 {
+		t.Fatalf("服务端维护的字段不应被修改: %+v", ce)
+	}
+}
+
+func TestGetReadableEntriesForUser(t *testing.T) {
+	db := newTestDB(t)
+	p1, _ := CreateProject(db, &Project{Name: "P1"})
+	p2, _ := CreateProject(db, &Project{Name: "P2"})
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: p1})
+	e2, _ := CreateContentEntry(db, &ContentEntry{Title: "E2", ProjectID: p2})
+	CreateContentEntry(db, &ContentEntry{Title: "E3", ProjectID: p2})
+	grant(t, db, 7, "project", p1, "read")
+	grant(t, db, 7, "content_entry", e2, "read")
+
+	entries, err := GetReadableEntriesForUser(db, 7)
+	if err != nil || len(entries) != 2 || entries[0].ID != e1 || entries[1].ID != e2 {
+		t.Fatalf("应只返回可读项目或可读条目: %v %+v", err, entries)
+	}
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/drivers/sqlite"
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+// newTestDB 在临时目录中创建数据库文件并按 main.go 中的当前表结构建表。
+// 事务使用另一条连接，内存数据库无法在连接间共享，因此使用文件
+func newTestDB(t *testing.T) *Database {
+	db, err := OpenDatabase(types.DBConfig{
+		Driver: sqlite.DriverName,
+		DSN:    filepath.Join(t.TempDir(), "test.db"),
+	})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	tables := []string{
+		"CREATE TABLE project (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, description TEXT, creator_id INTEGER, is_template INTEGER DEFAULT 0, created_at INTEGER DEFAULT 0, updated_at INTEGER DEFAULT 0, updated_by INTEGER DEFAULT 0)",
+		"CREATE TABLE user (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT, email TEXT, openid TEXT, password_hash TEXT, groups TEXT, avatar_url TEXT, created_at INTEGER DEFAULT 0, updated_at INTEGER DEFAULT 0, updated_by INTEGER DEFAULT 0)",
+		"CREATE TABLE content_list (id INTEGER PRIMARY KEY AUTOINCREMENT, type TEXT, title TEXT, items TEXT, creator_id INTEGER, project_id INTEGER, max_items INTEGER DEFAULT 0, allowed_types TEXT DEFAULT '[]', move_permission TEXT DEFAULT '', archived_at INTEGER DEFAULT 0, created_at INTEGER DEFAULT 0, updated_at INTEGER DEFAULT 0, updated_by INTEGER DEFAULT 0)",
+		"CREATE TABLE content_entry (id INTEGER PRIMARY KEY AUTOINCREMENT, type TEXT, title TEXT, content TEXT, creator_id INTEGER, project_id INTEGER, assignees TEXT DEFAULT '[]', start_at INTEGER DEFAULT 0, due_at INTEGER DEFAULT 0, archived_at INTEGER DEFAULT 0, archived_list_id INTEGER DEFAULT 0, archived_position INTEGER DEFAULT 0, created_at INTEGER DEFAULT 0, updated_at INTEGER DEFAULT 0, updated_by INTEGER DEFAULT 0)",
+		"CREATE TABLE detail_permission (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, content_type TEXT, content_ids TEXT, action TEXT, created_at INTEGER DEFAULT 0, updated_at INTEGER DEFAULT 0, updated_by INTEGER DEFAULT 0)",
+		"CREATE TABLE share_token (id INTEGER PRIMARY KEY AUTOINCREMENT, token TEXT UNIQUE, project_id INTEGER, permission_level TEXT, created_at INTEGER, expires_at INTEGER, creator_id INTEGER DEFAULT 0)",
+		"CREATE TABLE label (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER, name TEXT, color TEXT, description TEXT)",
+		"CREATE TABLE content_entry_label (id INTEGER PRIMARY KEY AUTOINCREMENT, entry_id INTEGER, label_id INTEGER)",
+		"CREATE TABLE custom_field (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER, name TEXT, field_type TEXT, options TEXT, order_num INTEGER)",
+		"CREATE TABLE custom_field_value (id INTEGER PRIMARY KEY AUTOINCREMENT, entry_id INTEGER, field_id INTEGER, text_value TEXT, number_value REAL, int_value INTEGER)",
+		"CREATE TABLE attachment (id INTEGER PRIMARY KEY AUTOINCREMENT, entry_id INTEGER, project_id INTEGER, filename TEXT, content_type TEXT, size INTEGER, hash TEXT, uploader_id INTEGER, created_at INTEGER)",
+		"CREATE TABLE entry_relation (id INTEGER PRIMARY KEY AUTOINCREMENT, source_id INTEGER, target_id INTEGER, relation_type TEXT, creator_id INTEGER, created_at INTEGER)",
+		"CREATE TABLE sidebar (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER DEFAULT 0, user_id INTEGER DEFAULT 0, name TEXT, description TEXT)",
+		"CREATE TABLE sidebar_item (id INTEGER PRIMARY KEY AUTOINCREMENT, sidebar_id INTEGER DEFAULT 0, parent_id INTEGER, name TEXT, icon TEXT, url TEXT, order_num INTEGER, target_type TEXT DEFAULT '', target_id INTEGER DEFAULT 0)",
+		"CREATE TABLE page (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER DEFAULT 0, parent_id INTEGER DEFAULT 0, title TEXT, slug TEXT DEFAULT '', body TEXT DEFAULT '', author_id INTEGER)",
+		"CREATE TABLE entry_comment (id INTEGER PRIMARY KEY AUTOINCREMENT, entry_id INTEGER, parent_id INTEGER DEFAULT 0, author_id INTEGER, body TEXT, mentions TEXT DEFAULT '[]', deleted INTEGER DEFAULT 0, created_at INTEGER, updated_at INTEGER)",
+		"CREATE TABLE change_log (id INTEGER PRIMARY KEY AUTOINCREMENT, object_type TEXT, object_id INTEGER, op TEXT, user_id INTEGER DEFAULT 0, content_type TEXT DEFAULT '', project_id INTEGER DEFAULT 0, created_at INTEGER)",
+		"CREATE TABLE notification (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, type TEXT, actor_id INTEGER DEFAULT 0, project_id INTEGER DEFAULT 0, entry_id INTEGER DEFAULT 0, message TEXT, read INTEGER DEFAULT 0, created_at INTEGER)",
+		"CREATE TABLE notification_preference (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, type TEXT, enabled INTEGER DEFAULT 1)",
+		"CREATE TABLE email_preference (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER UNIQUE, immediate TEXT DEFAULT '[]', digest TEXT DEFAULT 'off', locale TEXT DEFAULT 'en', unsubscribe_token TEXT, last_digest_at INTEGER DEFAULT 0)",
+		"CREATE TABLE email_outbox (id INTEGER PRIMARY KEY AUTOINCREMENT, to_addr TEXT, subject TEXT, body TEXT, unsubscribe_url TEXT DEFAULT '', status TEXT, attempts INTEGER DEFAULT 0, next_attempt_at INTEGER, last_error TEXT DEFAULT '', created_at INTEGER, sent_at INTEGER DEFAULT 0)",
+		"CREATE TABLE invitation (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER, email TEXT, permission_level TEXT, inviter_id INTEGER, status TEXT, token_hash TEXT UNIQUE, created_at INTEGER, sent_at INTEGER, expires_at INTEGER, accepted_by INTEGER DEFAULT 0, accepted_at INTEGER DEFAULT 0)",
+		"CREATE TABLE webhook (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER, url TEXT, secret TEXT, events TEXT DEFAULT '[]', active INTEGER DEFAULT 1, creator_id INTEGER, created_at INTEGER)",
+		"CREATE TABLE webhook_delivery (id INTEGER PRIMARY KEY AUTOINCREMENT, webhook_id INTEGER, event TEXT, payload TEXT, status TEXT, attempts INTEGER DEFAULT 0, response_code INTEGER DEFAULT 0, response_body TEXT DEFAULT '', error TEXT DEFAULT '', next_attempt_at INTEGER, created_at INTEGER, delivered_at INTEGER DEFAULT 0)",
+		"CREATE TABLE incoming_webhook (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER, name TEXT, list_id INTEGER, entry_type TEXT DEFAULT '', title_template TEXT, content_template TEXT DEFAULT '', key_template TEXT DEFAULT '', active INTEGER DEFAULT 1, creator_id INTEGER, created_at INTEGER, token_hash TEXT UNIQUE)",
+		"CREATE TABLE incoming_webhook_key (id INTEGER PRIMARY KEY AUTOINCREMENT, webhook_id INTEGER, external_key TEXT, entry_id INTEGER, created_at INTEGER)",
+		"CREATE UNIQUE INDEX idx_incoming_webhook_key ON incoming_webhook_key (webhook_id, external_key)",
+	}
+	for _, sql := range tables {
+		cond := dbhelper.Cond().Raw(sql).Build()
+		if _, err := db.Exec(cond); err != nil {
+			t.Fatalf("建表失败: %v", err)
+		}
+	}
+	return db
+}
+
+// grant 为用户添加某个内容的权限
+func grant(t *testing.T, db types.Conn, userID int64, contentType string, contentID int64, action string) {
+	dp := &DetailPermission{UserID: userID, ContentType: contentType, ContentIDs: []int64{contentID}, Action: action}
+	if _, err := CreateDetailPermission(db, dp); err != nil {
+		t.Fatalf("创建权限失败: %v", err)
+	}
+}
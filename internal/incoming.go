@@ -0,0 +1,295 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+// DefaultIncomingTitleTemplate is used when an incoming webhook has no title template.
+const DefaultIncomingTitleTemplate = "{{.title}}"
+
+var (
+	// ErrInvalidIncomingWebhook is returned for a configuration with a bad template or a list
+	// outside the project.
+	ErrInvalidIncomingWebhook = errors.New("invalid incoming webhook")
+	// ErrIncomingWebhookNotFound is returned for unknown or inactive webhooks.
+	ErrIncomingWebhookNotFound = errors.New("incoming webhook not found")
+	// ErrInvalidIncomingPayload is returned when the payload is not a JSON object or renders an empty title.
+	ErrInvalidIncomingPayload = errors.New("invalid incoming webhook payload")
+	// ErrIncomingWebhookForbidden is returned when the webhook's creator can no longer write to the
+	// project, since the webhook acts on the creator's behalf.
+	ErrIncomingWebhookForbidden = errors.New("incoming webhook creator can no longer write to the project")
+)
+
+// ValidateIncomingWebhook checks that the templates parse and that the target list belongs to the project.
+func ValidateIncomingWebhook(db types.Conn, w *IncomingWebhook) error {
+	if w.TitleTemplate == "" {
+		w.TitleTemplate = DefaultIncomingTitleTemplate
+	}
+	for name, src := range map[string]string{"title_template": w.TitleTemplate, "content_template": w.ContentTemplate, "key_template": w.KeyTemplate} {
+		if _, err := template.New(name).Parse(src); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidIncomingWebhook, name, err)
+		}
+	}
+	cl, err := GetContentList(db, w.ListID)
+	if err != nil || cl.ProjectID != w.ProjectID {
+		return fmt.Errorf("%w: list %d is not in project %d", ErrInvalidIncomingWebhook, w.ListID, w.ProjectID)
+	}
+	return nil
+}
+
+// CreateIncomingWebhook validates and stores an incoming webhook and sets w.Token to the secret
+// token of its URL.
+func CreateIncomingWebhook(db types.Conn, w *IncomingWebhook) (int64, error) {
+	if err := ValidateIncomingWebhook(db, w); err != nil {
+		return 0, err
+	}
+	token, hash, err := newSecretToken()
+	if err != nil {
+		return 0, err
+	}
+	w.CreatedAt = time.Now().Unix()
+	cond := dbhelper.Cond().Eq("project_id", w.ProjectID).Eq("name", w.Name).Eq("list_id", w.ListID).Eq("entry_type", w.EntryType).
+		Eq("title_template", w.TitleTemplate).Eq("content_template", w.ContentTemplate).Eq("key_template", w.KeyTemplate).
+		Eq("active", boolToInt(w.Active)).Eq("creator_id", w.CreatorID).Eq("created_at", w.CreatedAt).Eq("token_hash", hash).Build()
+	id, err := db.Insert("incoming_webhook", cond)
+	if err != nil {
+		return 0, err
+	}
+	w.ID = id
+	w.Token = token
+	return id, nil
+}
+
+// GetIncomingWebhook returns an incoming webhook by ID.
+func GetIncomingWebhook(db types.Conn, id int64) (*IncomingWebhook, error) {
+	rows, err := db.Query("incoming_webhook", dbhelper.Cond().Eq("id", id).Build())
+	if err != nil {
+		return nil, err
+	}
+	if rows.Count() == 0 {
+		return nil, ErrIncomingWebhookNotFound
+	}
+	w := incomingWebhookFromRow(rows.All()[0])
+	return &w, nil
+}
+
+// GetIncomingWebhooks returns the incoming webhooks of a project ordered by ID.
+func GetIncomingWebhooks(db types.Conn, projectID int64) ([]IncomingWebhook, error) {
+	rows, err := db.Query("incoming_webhook", dbhelper.Cond().Eq("project_id", projectID).Build())
+	if err != nil {
+		return nil, err
+	}
+	webhooks := []IncomingWebhook{}
+	for _, data := range rows.All() {
+		webhooks = append(webhooks, incomingWebhookFromRow(data))
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+// UpdateIncomingWebhook validates and saves the name, mapping and active flag of an incoming webhook.
+func UpdateIncomingWebhook(db types.Conn, id int64, w *IncomingWebhook) error {
+	if err := ValidateIncomingWebhook(db, w); err != nil {
+		return err
+	}
+	upd := dbhelper.Cond().Eq("name", w.Name).Eq("list_id", w.ListID).Eq("entry_type", w.EntryType).Eq("title_template", w.TitleTemplate).
+		Eq("content_template", w.ContentTemplate).Eq("key_template", w.KeyTemplate).Eq("active", boolToInt(w.Active)).Build()
+	_, err := db.Update("incoming_webhook", dbhelper.Cond().Eq("id", id).Build(), upd)
+	return err
+}
+
+// RotateIncomingWebhookToken gives the webhook a new URL token; the old URL stops working.
+func RotateIncomingWebhookToken(db types.Conn, id int64) (string, error) {
+	token, hash, err := newSecretToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.Update("incoming_webhook", dbhelper.Cond().Eq("id", id).Build(), dbhelper.Cond().Eq("token_hash", hash).Build())
+	return token, err
+}
+
+// DeleteIncomingWebhook deletes an incoming webhook and its external keys. Entries it created stay.
+func DeleteIncomingWebhook(db types.Conn, id int64) error {
+	if _, err := db.Delete("incoming_webhook_key", dbhelper.Cond().Eq("webhook_id", id).Build()); err != nil {
+		return err
+	}
+	_, err := db.Delete("incoming_webhook", dbhelper.Cond().Eq("id", id).Build())
+	return err
+}
+
+// ReceiveIncomingWebhook maps a payload posted to the webhook with the given token onto an entry.
+// It returns the entry and whether it was created; a payload whose key matches an earlier one
+// updates that entry's title and content instead, unless the entry has since been deleted, archived
+// or moved to another project. The webhook acts as its creator and stops working once the creator
+// loses write permission on the project.
+func ReceiveIncomingWebhook(db types.Conn, token string, payload []byte) (*ContentEntry, bool, error) {
+	rows, err := db.Query("incoming_webhook", dbhelper.Cond().Eq("token_hash", hashSecretToken(token)).Build())
+	if err != nil {
+		return nil, false, err
+	}
+	if rows.Count() == 0 {
+		return nil, false, ErrIncomingWebhookNotFound
+	}
+	w := incomingWebhookFromRow(rows.All()[0])
+	if !w.Active {
+		return nil, false, ErrIncomingWebhookNotFound
+	}
+	canWrite, err := HasPermission(db, w.CreatorID, "project", w.ProjectID, "write")
+	if err != nil {
+		return nil, false, err
+	}
+	if !canWrite {
+		return nil, false, ErrIncomingWebhookForbidden
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber() // 保留大整数 ID 的原样
+	var data map[string]interface{}
+	if err := dec.Decode(&data); err != nil {
+		return nil, false, fmt.Errorf("%w: body must be a JSON object", ErrInvalidIncomingPayload)
+	}
+	title, err := renderIncomingTemplate(w.TitleTemplate, data)
+	if err != nil {
+		return nil, false, err
+	}
+	if title == "" {
+		return nil, false, fmt.Errorf("%w: title template rendered an empty title", ErrInvalidIncomingPayload)
+	}
+	content, err := renderIncomingTemplate(w.ContentTemplate, data)
+	if err != nil {
+		return nil, false, err
+	}
+	key, err := renderIncomingTemplate(w.KeyTemplate, data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if key != "" {
+		if ce, err := updateKeyedEntry(db, &w, key, title, content); err != nil || ce != nil {
+			return ce, false, err
+		}
+	}
+
+	ce := &ContentEntry{Type: w.EntryType, Title: title, Content: content, CreatorID: w.CreatorID, ProjectID: w.ProjectID}
+	err = runInTx(db, "ReceiveIncomingWebhook", func(db types.Conn) error {
+		cl, err := GetContentList(db, w.ListID)
+		if err != nil {
+			return fmt.Errorf("%w: target list %d no longer exists", ErrInvalidIncomingWebhook, w.ListID)
+		}
+		if err := CheckListPolicy(db, cl, []ContentEntry{*ce}, len(cl.Items), len(cl.Items)+1, w.CreatorID); err != nil {
+			return err
+		}
+		id, err := CreateContentEntry(db, ce)
+		if err != nil {
+			return err
+		}
+		ce.ID = id
+		for _, action := range []string{"admin", "read"} {
+			if err := grantDetailPermission(db, w.CreatorID, "content_entry", id, action); err != nil {
+				return err
+			}
+		}
+		cl.Items = append(cl.Items, id)
+		cl.UpdatedBy = w.CreatorID
+		if err := UpdateContentList(db, cl.ID, cl); err != nil {
+			return err
+		}
+		if key == "" {
+			return nil
+		}
+		_, err = db.Insert("incoming_webhook_key", dbhelper.Cond().Eq("webhook_id", w.ID).Eq("external_key", key).
+			Eq("entry_id", id).Eq("created_at", time.Now().Unix()).Build())
+		if err != nil && isUniqueViolation(err) {
+			return errIncomingKeyTaken
+		}
+		return err
+	})
+	if errors.Is(err, errIncomingKeyTaken) {
+		// 并发的请求先用同一个 key 创建了条目，撤销本次创建，改为更新该条目
+		existing, err := updateKeyedEntry(db, &w, key, title, content)
+		if err == nil && existing == nil {
+			err = fmt.Errorf("entry for key %q was deleted concurrently", key)
+		}
+		return existing, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return ce, true, nil
+}
+
+// errIncomingKeyTaken is returned inside ReceiveIncomingWebhook when another request recorded the
+// same external key first.
+var errIncomingKeyTaken = errors.New("incoming webhook key already recorded")
+
+// updateKeyedEntry updates the entry recorded for key with the rendered title and content. It
+// returns nil when no entry is recorded; a key whose entry has been deleted, archived or moved out
+// of the webhook's project is dropped so that a new entry is created in the target list.
+func updateKeyedEntry(db types.Conn, w *IncomingWebhook, key, title, content string) (*ContentEntry, error) {
+	keyRows, err := db.Query("incoming_webhook_key", dbhelper.Cond().Eq("webhook_id", w.ID).Eq("external_key", key).Build())
+	if err != nil || keyRows.Count() == 0 {
+		return nil, err
+	}
+	keyRow := keyRows.All()[0]
+	ce, err := GetContentEntry(db, asInt64(keyRow["entry_id"]))
+	if err != nil || ce.ProjectID != w.ProjectID || ce.ArchivedAt != 0 {
+		// 条目已被删除、归档或移到其他项目，重新创建并指向新条目
+		_, err := db.Delete("incoming_webhook_key", dbhelper.Cond().Eq("id", asInt64(keyRow["id"])).Build())
+		return nil, err
+	}
+	ce.Title = title
+	ce.Content = content
+	ce.UpdatedBy = w.CreatorID
+	if err := UpdateContentEntry(db, ce.ID, ce); err != nil {
+		return nil, err
+	}
+	return ce, nil
+}
+
+// isUniqueViolation reports whether err is SQLite rejecting a row that breaks a UNIQUE constraint.
+func isUniqueViolation(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// renderIncomingTemplate executes a mapping template. Fields missing from the payload render as
+// empty strings.
+func renderIncomingTemplate(src string, data map[string]interface{}) (string, error) {
+	if src == "" {
+		return "", nil
+	}
+	tmpl, err := template.New("mapping").Option("missingkey=zero").Parse(src)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidIncomingWebhook, err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidIncomingPayload, err)
+	}
+	return strings.TrimSpace(strings.ReplaceAll(b.String(), "<no value>", "")), nil
+}
+
+func incomingWebhookFromRow(data map[string]interface{}) IncomingWebhook {
+	return IncomingWebhook{
+		ID:              asInt64(data["id"]),
+		ProjectID:       asInt64(data["project_id"]),
+		Name:            asString(data["name"]),
+		ListID:          asInt64(data["list_id"]),
+		EntryType:       asString(data["entry_type"]),
+		TitleTemplate:   asString(data["title_template"]),
+		ContentTemplate: asString(data["content_template"]),
+		KeyTemplate:     asString(data["key_template"]),
+		Active:          asInt64(data["active"]) != 0,
+		CreatorID:       asInt64(data["creator_id"]),
+		CreatedAt:       asInt64(data["created_at"]),
+	}
+}
@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+func TestIncomingWebhook(t *testing.T) {
+	db := newTestDB(t)
+	projectID, _ := CreateProject(db, &Project{Name: "Ops", CreatorID: 1})
+	otherID, _ := CreateProject(db, &Project{Name: "Other", CreatorID: 1})
+	listID, _ := CreateContentList(db, &ContentList{Title: "Alerts", ProjectID: projectID, MaxItems: 2})
+	otherList, _ := CreateContentList(db, &ContentList{Title: "Elsewhere", ProjectID: otherID})
+	creatorWrite := &DetailPermission{UserID: 1, ContentType: "project", ContentIDs: []int64{projectID}, Action: "write"}
+	creatorWrite.ID, _ = CreateDetailPermission(db, creatorWrite)
+
+	if _, err := CreateIncomingWebhook(db, &IncomingWebhook{ProjectID: projectID, ListID: otherList}); !errors.Is(err, ErrInvalidIncomingWebhook) {
+		t.Fatalf("应拒绝其他项目的列表, got %v", err)
+	}
+	if _, err := CreateIncomingWebhook(db, &IncomingWebhook{ProjectID: projectID, ListID: listID, TitleTemplate: "{{.title"}); !errors.Is(err, ErrInvalidIncomingWebhook) {
+		t.Fatalf("应拒绝无法解析的模板, got %v", err)
+	}
+	hook := &IncomingWebhook{
+		ProjectID:       projectID,
+		ListID:          listID,
+		EntryType:       "alert",
+		TitleTemplate:   "[{{.severity}}] {{.alert.name}}",
+		ContentTemplate: "{{.alert.summary}}",
+		KeyTemplate:     "{{.alert.id}}",
+		Active:          true,
+		CreatorID:       1,
+	}
+	if _, err := CreateIncomingWebhook(db, hook); err != nil || hook.Token == "" {
+		t.Fatalf("创建 incoming webhook 失败: %v", err)
+	}
+
+	ce, created, err := ReceiveIncomingWebhook(db, hook.Token, []byte(`{"severity":"high","alert":{"id":9007199254740993,"name":"Disk full","summary":"sda1 at 95%"}}`))
+	if err != nil || !created {
+		t.Fatalf("接收负载失败: %v %v", err, created)
+	}
+	if ce.Title != "[high] Disk full" || ce.Content != "sda1 at 95%" || ce.Type != "alert" || ce.ProjectID != projectID {
+		t.Fatalf("字段映射不正确: %+v", ce)
+	}
+	cl, _ := GetContentList(db, listID)
+	if len(cl.Items) != 1 || cl.Items[0] != ce.ID {
+		t.Fatalf("新条目应加入目标列表: %v", cl.Items)
+	}
+	if ok, _ := HasPermission(db, 1, "content_entry", ce.ID, "admin"); !ok {
+		t.Fatal("创建者应获得条目的 admin 权限")
+	}
+
+	// 相同的外部 key 更新同一条目
+	again, created, err := ReceiveIncomingWebhook(db, hook.Token, []byte(`{"severity":"low","alert":{"id":9007199254740993,"name":"Disk full","summary":"sda1 at 80%"}}`))
+	if err != nil || created || again.ID != ce.ID || again.Title != "[low] Disk full" || again.Content != "sda1 at 80%" {
+		t.Fatalf("重复的 key 应更新原条目: %v %v %+v", err, created, again)
+	}
+	if cl, _ := GetContentList(db, listID); len(cl.Items) != 1 {
+		t.Fatalf("更新不应新增条目: %v", cl.Items)
+	}
+
+	// 缺失的字段渲染为空，标题为空时拒绝
+	second, created, err := ReceiveIncomingWebhook(db, hook.Token, []byte(`{"alert":{"id":2,"name":"CPU"}}`))
+	if err != nil || !created || second.Title != "[] CPU" || second.Content != "" {
+		t.Fatalf("缺失字段应渲染为空: %v %+v", err, second)
+	}
+	if _, _, err := ReceiveIncomingWebhook(db, hook.Token, []byte(`[1,2]`)); !errors.Is(err, ErrInvalidIncomingPayload) {
+		t.Fatalf("应拒绝非对象的负载, got %v", err)
+	}
+	hook.TitleTemplate = "{{.title}}"
+	if err := UpdateIncomingWebhook(db, hook.ID, hook); err != nil {
+		t.Fatalf("更新 incoming webhook 失败: %v", err)
+	}
+	if _, _, err := ReceiveIncomingWebhook(db, hook.Token, []byte(`{"alert":{"id":3}}`)); !errors.Is(err, ErrInvalidIncomingPayload) {
+		t.Fatalf("标题为空时应拒绝, got %v", err)
+	}
+
+	// 列表已满时不创建条目
+	if _, _, err := ReceiveIncomingWebhook(db, hook.Token, []byte(`{"title":"Third","alert":{"id":3}}`)); !errors.Is(err, ErrListPolicy) {
+		t.Fatalf("应遵守列表的条目上限, got %v", err)
+	}
+	if entries, _ := db.Query("content_entry", nil); entries.Count() != 2 {
+		t.Fatalf("被拒绝的负载不应留下条目: %d", entries.Count())
+	}
+
+	// 条目被删除后，相同 key 重新创建
+	DeleteContentEntry(db, ce.ID)
+	cl, _ = GetContentList(db, listID)
+	cl.Items = []int64{second.ID}
+	UpdateContentList(db, listID, cl)
+	recreated, created, err := ReceiveIncomingWebhook(db, hook.Token, []byte(`{"title":"Disk full again","alert":{"id":9007199254740993}}`))
+	if err != nil || !created || recreated.ID == ce.ID {
+		t.Fatalf("原条目删除后应重新创建: %v %v %+v", err, created, recreated)
+	}
+
+	// 条目归档或移到其他项目后，相同 key 在目标列表中重新创建，不再修改原条目
+	if err := ArchiveContentEntry(db, recreated.ID, 1); err != nil {
+		t.Fatalf("归档条目失败: %v", err)
+	}
+	afterArchive, created, err := ReceiveIncomingWebhook(db, hook.Token, []byte(`{"title":"Disk full once more","alert":{"id":9007199254740993}}`))
+	if err != nil || !created || afterArchive.ID == recreated.ID {
+		t.Fatalf("原条目归档后应重新创建: %v %v %+v", err, created, afterArchive)
+	}
+	if archived, _ := GetContentEntry(db, recreated.ID); archived.Title != "Disk full again" {
+		t.Fatalf("不应修改已归档的条目: %+v", archived)
+	}
+	if err := MoveContentEntry(db, afterArchive.ID, otherList, -1, 1, PermissionPolicyKeep); err != nil {
+		t.Fatalf("移动条目失败: %v", err)
+	}
+	afterMove, created, err := ReceiveIncomingWebhook(db, hook.Token, []byte(`{"title":"Disk full elsewhere","alert":{"id":9007199254740993}}`))
+	if err != nil || !created || afterMove.ID == afterArchive.ID || afterMove.ProjectID != projectID {
+		t.Fatalf("原条目移出项目后应在目标列表重新创建: %v %v %+v", err, created, afterMove)
+	}
+	if moved, _ := GetContentEntry(db, afterArchive.ID); moved.Title != "Disk full once more" {
+		t.Fatalf("不应修改已移到其他项目的条目: %+v", moved)
+	}
+
+	// 创建者失去项目写权限后不再接收
+	if err := DeleteDetailPermission(db, creatorWrite.ID); err != nil {
+		t.Fatalf("撤销权限失败: %v", err)
+	}
+	if _, _, err := ReceiveIncomingWebhook(db, hook.Token, []byte(`{"title":"x"}`)); !errors.Is(err, ErrIncomingWebhookForbidden) {
+		t.Fatalf("创建者无写权限时应拒绝, got %v", err)
+	}
+	grant(t, db, 1, "project", projectID, "write")
+
+	// 更换令牌后旧令牌失效；停用后不再接收
+	oldToken := hook.Token
+	newToken, err := RotateIncomingWebhookToken(db, hook.ID)
+	if err != nil || newToken == oldToken {
+		t.Fatalf("更换令牌失败: %v", err)
+	}
+	if _, _, err := ReceiveIncomingWebhook(db, oldToken, []byte(`{"title":"x"}`)); !errors.Is(err, ErrIncomingWebhookNotFound) {
+		t.Fatalf("旧令牌应失效, got %v", err)
+	}
+	hook.Active = false
+	UpdateIncomingWebhook(db, hook.ID, hook)
+	if _, _, err := ReceiveIncomingWebhook(db, newToken, []byte(`{"title":"x"}`)); !errors.Is(err, ErrIncomingWebhookNotFound) {
+		t.Fatalf("停用的 webhook 不应接收, got %v", err)
+	}
+
+	if err := DeleteIncomingWebhook(db, hook.ID); err != nil {
+		t.Fatalf("删除 incoming webhook 失败: %v", err)
+	}
+	if keys, _ := db.Query("incoming_webhook_key", nil); keys.Count() != 0 {
+		t.Fatal("删除 incoming webhook 应同时删除外部 key")
+	}
+}
+
+// receiveDuringLookup 在查询外部 key 之后、返回结果之前执行 other，模拟同一 key 的并发投递
+type receiveDuringLookup struct {
+	*Database
+	other func()
+}
+
+func (c *receiveDuringLookup) Query(table string, cond *types.Condition) (types.Rows, error) {
+	rows, err := c.Database.Query(table, cond)
+	if table == "incoming_webhook_key" && c.other != nil {
+		c.other()
+		c.other = nil
+	}
+	return rows, err
+}
+
+func TestIncomingWebhookConcurrentKey(t *testing.T) {
+	db := newTestDB(t)
+	projectID, _ := CreateProject(db, &Project{Name: "Ops", CreatorID: 1})
+	listID, _ := CreateContentList(db, &ContentList{Title: "Alerts", ProjectID: projectID})
+	grant(t, db, 1, "project", projectID, "write")
+	hook := &IncomingWebhook{ProjectID: projectID, ListID: listID, KeyTemplate: "{{.id}}", Active: true, CreatorID: 1}
+	CreateIncomingWebhook(db, hook)
+
+	var first *ContentEntry
+	conn := &receiveDuringLookup{Database: db, other: func() {
+		var err error
+		if first, _, err = ReceiveIncomingWebhook(db, hook.Token, []byte(`{"id":"a","title":"First"}`)); err != nil {
+			t.Errorf("并发投递失败: %v", err)
+		}
+	}}
+	ce, created, err := ReceiveIncomingWebhook(conn, hook.Token, []byte(`{"id":"a","title":"Second"}`))
+	if err != nil || created || first == nil || ce.ID != first.ID || ce.Title != "Second" {
+		t.Fatalf("后到的投递应更新先创建的条目: %v %v %+v", err, created, ce)
+	}
+	cl, _ := GetContentList(db, listID)
+	entries, _ := GetContentEntries(db)
+	if len(cl.Items) != 1 || len(entries) != 1 {
+		t.Fatalf("同一 key 只应有一个条目: items=%v entries=%d", cl.Items, len(entries))
+	}
+}
@@ -0,0 +1,256 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+// Invitation states. Expired is never stored: a pending invitation past ExpiresAt reads as expired.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// InvitationTTL is how long an invitation can be accepted after it was last sent.
+const InvitationTTL = 7 * 24 * time.Hour
+
+var (
+	// ErrInvalidInvitation is returned for an invalid email address or permission level.
+	ErrInvalidInvitation = errors.New("invalid invitation")
+	// ErrInvitationExists is returned when the address already has a pending invitation to the project.
+	ErrInvitationExists = errors.New("email already invited to this project")
+	// ErrInvitationNotFound is returned for unknown invitations and accept tokens.
+	ErrInvitationNotFound = errors.New("invitation not found")
+	// ErrInvitationClosed is returned when an invitation was already accepted, revoked or has expired.
+	ErrInvitationClosed = errors.New("invitation is no longer valid")
+)
+
+// CreateInvitation stores a pending invitation and returns the one-time accept token to email.
+// The address is normalised to lower case.
+func CreateInvitation(db types.Conn, inv *Invitation) (string, error) {
+	addr, err := mail.ParseAddress(inv.Email)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid email address", ErrInvalidInvitation)
+	}
+	if GetPermissionLevel(inv.PermissionLevel) == PermissionNone {
+		return "", fmt.Errorf("%w: invalid permission level", ErrInvalidInvitation)
+	}
+	inv.Email = strings.ToLower(addr.Address)
+	existing, err := GetInvitations(db, inv.ProjectID)
+	if err != nil {
+		return "", err
+	}
+	for _, other := range existing {
+		if other.Email == inv.Email && other.Status == InvitationPending {
+			return "", ErrInvitationExists
+		}
+	}
+	token, hash, err := newSecretToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	inv.Status = InvitationPending
+	inv.CreatedAt = now.Unix()
+	inv.SentAt = now.Unix()
+	inv.ExpiresAt = now.Add(InvitationTTL).Unix()
+	inv.AcceptedBy, inv.AcceptedAt = 0, 0
+	cond := dbhelper.Cond().Eq("project_id", inv.ProjectID).Eq("email", inv.Email).Eq("permission_level", inv.PermissionLevel).
+		Eq("inviter_id", inv.InviterID).Eq("status", inv.Status).Eq("token_hash", hash).Eq("created_at", inv.CreatedAt).
+		Eq("sent_at", inv.SentAt).Eq("expires_at", inv.ExpiresAt).Eq("accepted_by", 0).Eq("accepted_at", 0).Build()
+	id, err := db.Insert("invitation", cond)
+	if err != nil {
+		return "", err
+	}
+	inv.ID = id
+	return token, nil
+}
+
+// GetInvitation returns an invitation by ID.
+func GetInvitation(db types.Conn, id int64) (*Invitation, error) {
+	rows, err := db.Query("invitation", dbhelper.Cond().Eq("id", id).Build())
+	if err != nil {
+		return nil, err
+	}
+	if rows.Count() == 0 {
+		return nil, ErrInvitationNotFound
+	}
+	inv := invitationFromRow(rows.All()[0], time.Now().Unix())
+	return &inv, nil
+}
+
+// GetInvitations returns the invitations of a project, oldest first.
+func GetInvitations(db types.Conn, projectID int64) ([]Invitation, error) {
+	rows, err := db.Query("invitation", dbhelper.Cond().Eq("project_id", projectID).Build())
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	invitations := []Invitation{}
+	for _, data := range rows.All() {
+		invitations = append(invitations, invitationFromRow(data, now))
+	}
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].ID < invitations[j].ID })
+	return invitations, nil
+}
+
+// RenewInvitation replaces the accept token of a pending or expired invitation and restarts its
+// expiry, so it can be emailed again. Links sent earlier stop working.
+func RenewInvitation(db types.Conn, id int64) (*Invitation, string, error) {
+	inv, err := GetInvitation(db, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if inv.Status != InvitationPending && inv.Status != InvitationExpired {
+		return nil, "", ErrInvitationClosed
+	}
+	token, hash, err := newSecretToken()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	inv.Status = InvitationPending
+	inv.SentAt = now.Unix()
+	inv.ExpiresAt = now.Add(InvitationTTL).Unix()
+	upd := dbhelper.Cond().Eq("token_hash", hash).Eq("sent_at", inv.SentAt).Eq("expires_at", inv.ExpiresAt).Build()
+	if _, err := db.Update("invitation", dbhelper.Cond().Eq("id", id).Build(), upd); err != nil {
+		return nil, "", err
+	}
+	return inv, token, nil
+}
+
+// RevokeInvitation withdraws an invitation that has not been accepted.
+func RevokeInvitation(db types.Conn, id int64) error {
+	inv, err := GetInvitation(db, id)
+	if err != nil {
+		return err
+	}
+	if inv.Status == InvitationAccepted || inv.Status == InvitationRevoked {
+		return ErrInvitationClosed
+	}
+	_, err = db.Update("invitation", dbhelper.Cond().Eq("id", id).Build(), dbhelper.Cond().Eq("status", InvitationRevoked).Build())
+	return err
+}
+
+// AcceptInvitation accepts the invitation behind an accept token for userID, whatever their email
+// address: the token was only sent to the invited address. The token cannot be used again.
+func AcceptInvitation(db types.Conn, token string, userID int64) (*Invitation, error) {
+	if token == "" {
+		return nil, ErrInvitationNotFound
+	}
+	rows, err := db.Query("invitation", dbhelper.Cond().Eq("token_hash", hashSecretToken(token)).Build())
+	if err != nil {
+		return nil, err
+	}
+	if rows.Count() == 0 {
+		return nil, ErrInvitationNotFound
+	}
+	inv := invitationFromRow(rows.All()[0], time.Now().Unix())
+	if inv.Status != InvitationPending {
+		return nil, ErrInvitationClosed
+	}
+	if err := acceptInvitation(db, &inv, userID); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// AcceptInvitationsForEmails accepts every pending invitation sent to one of the given verified
+// email addresses for userID. It is called when a user logs in.
+func AcceptInvitationsForEmails(db types.Conn, userID int64, emails []string) ([]Invitation, error) {
+	accepted := []Invitation{}
+	if len(emails) == 0 {
+		return accepted, nil
+	}
+	rows, err := db.Query("invitation", dbhelper.Cond().Eq("status", InvitationPending).Build())
+	if err != nil {
+		return nil, err
+	}
+	wanted := make([]string, 0, len(emails))
+	for _, e := range emails {
+		wanted = append(wanted, strings.ToLower(strings.TrimSpace(e)))
+	}
+	now := time.Now().Unix()
+	pending := rows.All()
+	sort.Slice(pending, func(i, j int) bool { return asInt64(pending[i]["id"]) < asInt64(pending[j]["id"]) })
+	for _, data := range pending {
+		inv := invitationFromRow(data, now)
+		if inv.Status != InvitationPending || !containsString(wanted, inv.Email) {
+			continue
+		}
+		if err := acceptInvitation(db, &inv, userID); err != nil {
+			return accepted, err
+		}
+		accepted = append(accepted, inv)
+	}
+	return accepted, nil
+}
+
+// acceptInvitation grants the invited level on the project and closes the invitation.
+func acceptInvitation(db types.Conn, inv *Invitation, userID int64) error {
+	return runInTx(db, "acceptInvitation", func(db types.Conn) error {
+		ok, err := HasPermission(db, userID, "project", inv.ProjectID, inv.PermissionLevel)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if err := grantDetailPermission(db, userID, "project", inv.ProjectID, inv.PermissionLevel); err != nil {
+				return err
+			}
+		}
+		inv.Status = InvitationAccepted
+		inv.AcceptedBy = userID
+		inv.AcceptedAt = time.Now().Unix()
+		upd := dbhelper.Cond().Eq("status", inv.Status).Eq("accepted_by", inv.AcceptedBy).Eq("accepted_at", inv.AcceptedAt).Build()
+		_, err = db.Update("invitation", dbhelper.Cond().Eq("id", inv.ID).Eq("status", InvitationPending).Build(), upd)
+		return err
+	})
+}
+
+// InvitationMail renders the invitation email in the given locale. The accept link is
+// baseURL + "/invite?token=...".
+func InvitationMail(inv *Invitation, token string, baseURL string, locale string, inviterName string, projectName string) (*Mail, error) {
+	m := &Mail{To: inv.Email}
+	var err error
+	m.Subject, m.Body, err = RenderMail(locale, "invitation", map[string]interface{}{
+		"Inviter":         inviterName,
+		"Project":         projectName,
+		"PermissionLevel": inv.PermissionLevel,
+		"Link":            baseURL + "/invite?token=" + url.QueryEscape(token),
+		"ExpiresAt":       time.Unix(inv.ExpiresAt, 0).UTC().Format("2006-01-02 15:04 UTC"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func invitationFromRow(data map[string]interface{}, now int64) Invitation {
+	inv := Invitation{
+		ID:              asInt64(data["id"]),
+		ProjectID:       asInt64(data["project_id"]),
+		Email:           asString(data["email"]),
+		PermissionLevel: asString(data["permission_level"]),
+		InviterID:       asInt64(data["inviter_id"]),
+		Status:          asString(data["status"]),
+		CreatedAt:       asInt64(data["created_at"]),
+		SentAt:          asInt64(data["sent_at"]),
+		ExpiresAt:       asInt64(data["expires_at"]),
+		AcceptedBy:      asInt64(data["accepted_by"]),
+		AcceptedAt:      asInt64(data["accepted_at"]),
+	}
+	if inv.Status == InvitationPending && inv.ExpiresAt < now {
+		inv.Status = InvitationExpired
+	}
+	return inv
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Kaguya154/dbhelper"
+)
+
+func TestInvitations(t *testing.T) {
+	db := newTestDB(t)
+	projectID, _ := CreateProject(db, &Project{Name: "Roadmap", CreatorID: 1})
+
+	if _, err := CreateInvitation(db, &Invitation{ProjectID: projectID, Email: "not-an-email", PermissionLevel: "read"}); !errors.Is(err, ErrInvalidInvitation) {
+		t.Fatalf("应拒绝无效的邮箱, got %v", err)
+	}
+	if _, err := CreateInvitation(db, &Invitation{ProjectID: projectID, Email: "a@example.com", PermissionLevel: "owner"}); !errors.Is(err, ErrInvalidInvitation) {
+		t.Fatalf("应拒绝无效的权限级别, got %v", err)
+	}
+	inv := &Invitation{ProjectID: projectID, Email: "Alice <Alice@Example.com>", PermissionLevel: "write", InviterID: 1}
+	token, err := CreateInvitation(db, inv)
+	if err != nil || token == "" || inv.Email != "alice@example.com" || inv.Status != InvitationPending {
+		t.Fatalf("创建邀请失败: %v %+v", err, inv)
+	}
+	if _, err := CreateInvitation(db, &Invitation{ProjectID: projectID, Email: "alice@example.com", PermissionLevel: "read"}); !errors.Is(err, ErrInvitationExists) {
+		t.Fatalf("同一邮箱不应重复邀请, got %v", err)
+	}
+
+	// 重发后旧链接失效
+	_, newToken, err := RenewInvitation(db, inv.ID)
+	if err != nil || newToken == token {
+		t.Fatalf("重发邀请失败: %v", err)
+	}
+	if _, err := AcceptInvitation(db, token, 2); !errors.Is(err, ErrInvitationNotFound) {
+		t.Fatalf("旧链接应失效, got %v", err)
+	}
+	accepted, err := AcceptInvitation(db, newToken, 2)
+	if err != nil || accepted.AcceptedBy != 2 || accepted.Status != InvitationAccepted {
+		t.Fatalf("接受邀请失败: %v %+v", err, accepted)
+	}
+	if ok, _ := HasPermission(db, 2, "project", projectID, "write"); !ok {
+		t.Fatal("接受邀请后应获得对应权限")
+	}
+	if _, err := AcceptInvitation(db, newToken, 3); !errors.Is(err, ErrInvitationClosed) {
+		t.Fatalf("链接只能使用一次, got %v", err)
+	}
+	if err := RevokeInvitation(db, inv.ID); !errors.Is(err, ErrInvitationClosed) {
+		t.Fatalf("已接受的邀请不能撤销, got %v", err)
+	}
+
+	// 登录时按已验证邮箱自动接受；撤销和过期的邀请不生效
+	bob := &Invitation{ProjectID: projectID, Email: "bob@example.com", PermissionLevel: "read", InviterID: 1}
+	CreateInvitation(db, bob)
+	revoked := &Invitation{ProjectID: projectID, Email: "carol@example.com", PermissionLevel: "admin", InviterID: 1}
+	CreateInvitation(db, revoked)
+	if err := RevokeInvitation(db, revoked.ID); err != nil {
+		t.Fatalf("撤销邀请失败: %v", err)
+	}
+	otherID, _ := CreateProject(db, &Project{Name: "Other", CreatorID: 1})
+	expired := &Invitation{ProjectID: otherID, Email: "bob@example.com", PermissionLevel: "read", InviterID: 1}
+	CreateInvitation(db, expired)
+	db.Update("invitation", dbhelper.Cond().Eq("id", expired.ID).Build(), dbhelper.Cond().Eq("expires_at", 1).Build())
+
+	got, err := AcceptInvitationsForEmails(db, 4, []string{"BOB@example.com", "carol@example.com"})
+	if err != nil || len(got) != 1 || got[0].ID != bob.ID {
+		t.Fatalf("应只接受有效的邀请: %v %+v", err, got)
+	}
+	if ok, _ := HasPermission(db, 4, "project", projectID, "read"); !ok {
+		t.Fatal("自动接受后应获得权限")
+	}
+	if ok, _ := HasPermission(db, 4, "project", otherID, "read"); ok {
+		t.Fatal("过期的邀请不应生效")
+	}
+
+	list, _ := GetInvitations(db, projectID)
+	statuses := []string{}
+	for _, i := range list {
+		statuses = append(statuses, i.Status)
+	}
+	if strings.Join(statuses, ",") != "accepted,accepted,revoked" {
+		t.Fatalf("邀请状态不正确: %v", statuses)
+	}
+	if e, _ := GetInvitation(db, expired.ID); e.Status != InvitationExpired {
+		t.Fatalf("过期的邀请应显示为 expired: %+v", e)
+	}
+	if _, _, err := RenewInvitation(db, expired.ID); err != nil {
+		t.Fatalf("过期的邀请可以重发: %v", err)
+	}
+
+	m, err := InvitationMail(bob, "tok", "http://lb", "zh", "alice", "Roadmap")
+	if err != nil || m.To != "bob@example.com" || !strings.Contains(m.Subject, "alice 邀请你加入 Roadmap") || !strings.Contains(m.Body, "http://lb/invite?token=tok") {
+		t.Fatalf("邀请邮件内容不正确: %v %+v", err, m)
+	}
+}
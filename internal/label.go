@@ -0,0 +1,264 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+// DefaultLabelColor is used when a label is created without a color.
+const DefaultLabelColor = "#808080"
+
+var (
+	// ErrInvalidLabel is returned when a label's name or color is malformed.
+	ErrInvalidLabel = errors.New("invalid label")
+	// ErrLabelExists is returned when a project already has a label with the same name.
+	ErrLabelExists = errors.New("label with this name already exists")
+
+	labelColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// ValidateLabel normalizes the label's name and color and checks they are well-formed.
+func ValidateLabel(l *Label) error {
+	l.Name = strings.TrimSpace(l.Name)
+	if l.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidLabel)
+	}
+	if l.Color == "" {
+		l.Color = DefaultLabelColor
+	}
+	if !labelColorPattern.MatchString(l.Color) {
+		return fmt.Errorf("%w: color must look like #RRGGBB", ErrInvalidLabel)
+	}
+	return nil
+}
+
+// CheckLabelNameAvailable reports ErrLabelExists if another label in the project uses the name.
+// excludeID lets a label keep its own name when it is renamed.
+func CheckLabelNameAvailable(db types.Conn, projectID int64, name string, excludeID int64) error {
+	labels, err := GetLabelsByProject(db, projectID)
+	if err != nil {
+		return err
+	}
+	for _, l := range labels {
+		if l.ID != excludeID && strings.EqualFold(l.Name, name) {
+			return ErrLabelExists
+		}
+	}
+	return nil
+}
+
+// Label CRUD
+
+func CreateLabel(db types.Conn, l *Label) (int64, error) {
+	cond := dbhelper.Cond().Eq("project_id", l.ProjectID).Eq("name", l.Name).Eq("color", l.Color).Eq("description", l.Description).Build()
+	return db.Insert("label", cond)
+}
+
+func GetLabel(db types.Conn, id int64) (*Label, error) {
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	rows, err := db.Query("label", cond)
+	if err != nil {
+		return nil, err
+	}
+	if rows.Count() == 0 {
+		return nil, errors.New("label not found")
+	}
+	l := labelFromRow(rows.All()[0])
+	return &l, nil
+}
+
+func UpdateLabel(db types.Conn, id int64, updates *Label) error {
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	upd := dbhelper.Cond().Eq("name", updates.Name).Eq("color", updates.Color).Eq("description", updates.Description).Build()
+	_, err := db.Update("label", cond, upd)
+	return err
+}
+
+// DeleteLabel deletes the label and detaches it from every entry, marking those entries as
+// changed by userID.
+func DeleteLabel(db types.Conn, id int64, userID int64) error {
+	return runInTx(db, "DeleteLabel", func(db types.Conn) error {
+		entryIDs, err := labeledEntryIDs(db, id)
+		if err != nil {
+			return err
+		}
+		if err := deleteLabel(db, id); err != nil {
+			return err
+		}
+		return touchContentEntries(db, entryIDs, userID)
+	})
+}
+
+func deleteLabel(db types.Conn, id int64) error {
+	assignCond := dbhelper.Cond().Eq("label_id", id).Build()
+	_, err := db.Delete("content_entry_label", assignCond)
+	if err != nil {
+		return err
+	}
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	_, err = db.Delete("label", cond)
+	return err
+}
+
+// GetLabelsByProject returns the label catalog of a project.
+func GetLabelsByProject(db types.Conn, projectID int64) ([]Label, error) {
+	cond := dbhelper.Cond().Eq("project_id", projectID).Build()
+	rows, err := db.Query("label", cond)
+	if err != nil {
+		return []Label{}, err
+	}
+	labels := make([]Label, 0)
+	for _, data := range rows.All() {
+		labels = append(labels, labelFromRow(data))
+	}
+	return labels, nil
+}
+
+// DeleteLabelsByProject removes a project's label catalog along with all assignments.
+func DeleteLabelsByProject(db types.Conn, projectID int64) error {
+	labels, err := GetLabelsByProject(db, projectID)
+	if err != nil {
+		return err
+	}
+	for _, l := range labels {
+		if err := deleteLabel(db, l.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func labelFromRow(data map[string]interface{}) Label {
+	return Label{
+		ID:          data["id"].(int64),
+		ProjectID:   data["project_id"].(int64),
+		Name:        data["name"].(string),
+		Color:       asString(data["color"]),
+		Description: asString(data["description"]),
+	}
+}
+
+// Entry label assignment
+
+// AddEntryLabel attaches a label to an entry on behalf of userID. Attaching twice is a no-op.
+func AddEntryLabel(db types.Conn, entryID, labelID int64, userID int64) error {
+	added, err := addEntryLabel(db, entryID, labelID)
+	if err != nil || !added {
+		return err
+	}
+	return TouchContentEntry(db, entryID, userID)
+}
+
+// addEntryLabel attaches a label to an entry and reports whether it was not attached yet. It
+// leaves the entry's timestamps alone, for callers that write the entry themselves.
+func addEntryLabel(db types.Conn, entryID, labelID int64) (bool, error) {
+	cond := dbhelper.Cond().Eq("entry_id", entryID).Eq("label_id", labelID).Build()
+	rows, err := db.Query("content_entry_label", cond)
+	if err != nil {
+		return false, err
+	}
+	if rows.Count() > 0 {
+		return false, nil
+	}
+	_, err = db.Insert("content_entry_label", cond)
+	return err == nil, err
+}
+
+// RemoveEntryLabel detaches a label from an entry on behalf of userID.
+func RemoveEntryLabel(db types.Conn, entryID, labelID int64, userID int64) error {
+	cond := dbhelper.Cond().Eq("entry_id", entryID).Eq("label_id", labelID).Build()
+	rows, err := db.Query("content_entry_label", cond)
+	if err != nil || rows.Count() == 0 {
+		return err
+	}
+	if _, err := db.Delete("content_entry_label", cond); err != nil {
+		return err
+	}
+	return TouchContentEntry(db, entryID, userID)
+}
+
+// labeledEntryIDs returns the IDs of the entries carrying the label.
+func labeledEntryIDs(db types.Conn, labelID int64) ([]int64, error) {
+	rows, err := db.Query("content_entry_label", dbhelper.Cond().Eq("label_id", labelID).Build())
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, rows.Count())
+	for _, data := range rows.All() {
+		ids = append(ids, asInt64(data["entry_id"]))
+	}
+	return ids, nil
+}
+
+// touchContentEntries marks each of the entries as changed by userID.
+func touchContentEntries(db types.Conn, ids []int64, userID int64) error {
+	for _, id := range ids {
+		if err := TouchContentEntry(db, id, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetEntryLabelIDs returns the IDs of the labels attached to an entry.
+func GetEntryLabelIDs(db types.Conn, entryID int64) ([]int64, error) {
+	cond := dbhelper.Cond().Eq("entry_id", entryID).Build()
+	rows, err := db.Query("content_entry_label", cond)
+	if err != nil {
+		return []int64{}, err
+	}
+	ids := make([]int64, 0, rows.Count())
+	for _, data := range rows.All() {
+		ids = append(ids, data["label_id"].(int64))
+	}
+	return ids, nil
+}
+
+// attachLabels fills in Labels for a batch of entries with a single query.
+func attachLabels(db types.Conn, entries []ContentEntry) error {
+	rows, err := db.Query("content_entry_label", nil)
+	if err != nil {
+		return err
+	}
+	byEntry := make(map[int64][]int64)
+	for _, data := range rows.All() {
+		entryID := data["entry_id"].(int64)
+		byEntry[entryID] = append(byEntry[entryID], data["label_id"].(int64))
+	}
+	for i := range entries {
+		entries[i].Labels = byEntry[entries[i].ID]
+		if entries[i].Labels == nil {
+			entries[i].Labels = make([]int64, 0)
+		}
+	}
+	return nil
+}
+
+// MergeLabels moves every assignment of source onto target and deletes source in one
+// transaction, marking the entries involved as changed by userID. Entries that already carry both
+// labels end up with target only once.
+func MergeLabels(db types.Conn, sourceID, targetID int64, userID int64) error {
+	if sourceID == targetID {
+		return fmt.Errorf("%w: cannot merge a label into itself", ErrInvalidLabel)
+	}
+	return runInTx(db, "MergeLabels", func(db types.Conn) error {
+		entryIDs, err := labeledEntryIDs(db, sourceID)
+		if err != nil {
+			return err
+		}
+		for _, entryID := range entryIDs {
+			if _, err := addEntryLabel(db, entryID, targetID); err != nil {
+				return err
+			}
+		}
+		if err := deleteLabel(db, sourceID); err != nil {
+			return err
+		}
+		return touchContentEntries(db, entryIDs, userID)
+	})
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Kaguya154/dbhelper"
+)
+
+func TestValidateLabel(t *testing.T) {
+	l := &Label{Name: "  bug "}
+	if err := ValidateLabel(l); err != nil || l.Name != "bug" || l.Color != DefaultLabelColor {
+		t.Fatalf("标签规范化失败: %v, got=%+v", err, l)
+	}
+	if err := ValidateLabel(&Label{Name: "bug", Color: "red"}); !errors.Is(err, ErrInvalidLabel) {
+		t.Fatalf("非法颜色应被拒绝, got %v", err)
+	}
+	if err := ValidateLabel(&Label{Name: " "}); !errors.Is(err, ErrInvalidLabel) {
+		t.Fatalf("空名称应被拒绝, got %v", err)
+	}
+}
+
+func TestMergeLabelsKeepsAssignments(t *testing.T) {
+	db := newTestDB(t)
+
+	bug, _ := CreateLabel(db, &Label{ProjectID: 1, Name: "bug", Color: "#ff0000"})
+	defect, _ := CreateLabel(db, &Label{ProjectID: 1, Name: "defect", Color: "#ff0000"})
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: 1})
+	e2, _ := CreateContentEntry(db, &ContentEntry{Title: "E2", ProjectID: 1})
+
+	AddEntryLabel(db, e1, defect, 1)
+	AddEntryLabel(db, e2, defect, 1)
+	AddEntryLabel(db, e2, bug, 1)
+
+	if err := CheckLabelNameAvailable(db, 1, "BUG", 0); !errors.Is(err, ErrLabelExists) {
+		t.Fatalf("重名标签应被拒绝, got %v", err)
+	}
+
+	if err := MergeLabels(db, defect, bug, 1); err != nil {
+		t.Fatalf("合并标签失败: %v", err)
+	}
+	if _, err := GetLabel(db, defect); err == nil {
+		t.Fatalf("合并后源标签应被删除")
+	}
+
+	entries, err := GetContentEntries(db)
+	if err != nil {
+		t.Fatalf("获取条目失败: %v", err)
+	}
+	for _, ce := range entries {
+		if len(ce.Labels) != 1 || ce.Labels[0] != bug {
+			t.Fatalf("合并后条目标签错误: %+v", ce)
+		}
+	}
+
+	got := FilterContentEntries(entries, EntryFilter{LabelIDs: []int64{bug}})
+	if len(got) != 2 {
+		t.Fatalf("按标签过滤失败: %+v", got)
+	}
+}
+
+func TestMergeLabelsRollsBackOnFailure(t *testing.T) {
+	db := newTestDB(t)
+
+	bug, _ := CreateLabel(db, &Label{ProjectID: 1, Name: "bug", Color: "#ff0000"})
+	defect, _ := CreateLabel(db, &Label{ProjectID: 1, Name: "defect", Color: "#ff0000"})
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: 1})
+	e2, _ := CreateContentEntry(db, &ContentEntry{Title: "E2", ProjectID: 1})
+	AddEntryLabel(db, e1, defect, 1)
+	AddEntryLabel(db, e2, defect, 1)
+	AddEntryLabel(db, e2, bug, 1)
+
+	// 指派已转移后，删除源标签时失败
+	db.Exec(dbhelper.Cond().Raw("CREATE TRIGGER keep_label BEFORE DELETE ON label BEGIN SELECT RAISE(ABORT, 'locked'); END").Build())
+	if err := MergeLabels(db, defect, bug, 1); err == nil {
+		t.Fatal("删除源标签失败时合并应返回错误")
+	}
+	if l, err := GetLabel(db, defect); err != nil || l.Name != "defect" {
+		t.Fatalf("源标签应保留: %v", err)
+	}
+	want := map[int64][]int64{e1: {defect}, e2: {defect, bug}}
+	for entryID, labels := range want {
+		got, _ := GetEntryLabelIDs(db, entryID)
+		if len(got) != len(labels) || !containsID(got, labels[0]) || !containsID(got, labels[len(labels)-1]) {
+			t.Fatalf("条目 %d 的标签应恢复为 %v: %v", entryID, labels, got)
+		}
+	}
+}
+
+func TestEntryLabelChangesTouchEntry(t *testing.T) {
+	db := newTestDB(t)
+
+	bug, _ := CreateLabel(db, &Label{ProjectID: 1, Name: "bug", Color: "#ff0000"})
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: 1})
+	changes, _ := changesAfter(db, 0, MaxSyncLimit, nil)
+	since := changes[len(changes)-1].seq
+
+	touched := func(userID int64) bool {
+		ce, err := GetContentEntry(db, e1)
+		if err != nil || ce.UpdatedBy != userID || ce.UpdatedAt == 0 {
+			return false
+		}
+		changes, _ := changesAfter(db, since, MaxSyncLimit, nil)
+		for _, r := range changes {
+			since = r.seq
+		}
+		return len(changes) == 1 && changes[0].objectType == "content_entry" && changes[0].objectID == e1
+	}
+
+	if err := AddEntryLabel(db, e1, bug, 7); err != nil || !touched(7) {
+		t.Fatalf("添加标签应更新条目并记录变更: %v", err)
+	}
+	if err := AddEntryLabel(db, e1, bug, 8); err != nil || touched(8) {
+		t.Fatalf("重复添加标签不应更新条目: %v", err)
+	}
+	if err := RemoveEntryLabel(db, e1, bug, 8); err != nil || !touched(8) {
+		t.Fatalf("移除标签应更新条目并记录变更: %v", err)
+	}
+	AddEntryLabel(db, e1, bug, 7)
+	touched(7)
+	if err := DeleteLabel(db, bug, 9); err != nil || !touched(9) {
+		t.Fatalf("删除标签应更新其条目并记录变更: %v", err)
+	}
+}
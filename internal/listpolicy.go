@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+var (
+	// ErrInvalidListPolicy is returned when a list's policy settings are malformed.
+	ErrInvalidListPolicy = errors.New("invalid list policy")
+	// ErrListPolicy is returned when adding entries to a list would violate its policy.
+	ErrListPolicy = errors.New("list policy violation")
+)
+
+// ValidateListPolicy normalizes and checks the policy settings of a list.
+func ValidateListPolicy(cl *ContentList) error {
+	if cl.MaxItems < 0 {
+		return fmt.Errorf("%w: max_items cannot be negative", ErrInvalidListPolicy)
+	}
+	cl.AllowedTypes = normalizeStrings(cl.AllowedTypes)
+	cl.MovePermission = strings.TrimSpace(cl.MovePermission)
+	if cl.MovePermission != "" && getPermissionLevel(cl.MovePermission) == PermissionNone {
+		return fmt.Errorf("%w: unknown permission level %q", ErrInvalidListPolicy, cl.MovePermission)
+	}
+	return nil
+}
+
+// ListPolicyChanged reports whether two versions of a list differ in their policy settings.
+func ListPolicyChanged(a, b *ContentList) bool {
+	if a.MaxItems != b.MaxItems || a.MovePermission != b.MovePermission || len(a.AllowedTypes) != len(b.AllowedTypes) {
+		return true
+	}
+	for i := range a.AllowedTypes {
+		if a.AllowedTypes[i] != b.AllowedTypes[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// IsListAdmin reports whether the user is an admin of the list or of its project. Only list admins
+// may change a list's policy or override it.
+func IsListAdmin(db types.Conn, userID int64, cl *ContentList) (bool, error) {
+	admin, err := HasPermission(db, userID, "content_list", cl.ID, "admin")
+	if err != nil || admin {
+		return admin, err
+	}
+	return HasPermission(db, userID, "project", cl.ProjectID, "admin")
+}
+
+// CheckListPolicy checks that the user may add the given entries to the list, which grows from
+// oldCount to newCount items. A list above its limit may still be reordered or shrunk, just not grown.
+func CheckListPolicy(db types.Conn, cl *ContentList, added []ContentEntry, oldCount, newCount int, userID int64) error {
+	if len(added) == 0 && newCount <= oldCount {
+		return nil
+	}
+	if cl.MaxItems > 0 && newCount > cl.MaxItems && newCount > oldCount {
+		return fmt.Errorf("%w: list %q is limited to %d items", ErrListPolicy, cl.Title, cl.MaxItems)
+	}
+	if len(cl.AllowedTypes) > 0 {
+		for _, ce := range added {
+			if !containsString(cl.AllowedTypes, ce.Type) {
+				return fmt.Errorf("%w: list %q does not accept entries of type %q", ErrListPolicy, cl.Title, ce.Type)
+			}
+		}
+	}
+	if cl.MovePermission != "" {
+		ok, err := HasPermission(db, userID, "project", cl.ProjectID, cl.MovePermission)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: moving entries into list %q requires %s permission", ErrListPolicy, cl.Title, cl.MovePermission)
+		}
+	}
+	return nil
+}
+
+// CheckListUpdate applies CheckListPolicy to the entries that appear in cl.Items but not in oldItems.
+func CheckListUpdate(db types.Conn, cl *ContentList, oldItems []int64, userID int64) error {
+	added := make([]ContentEntry, 0)
+	for _, id := range cl.Items {
+		if containsID(oldItems, id) {
+			continue
+		}
+		ce, err := GetContentEntry(db, id)
+		if err != nil {
+			// 悬空的条目 ID 没有类型可供检查，但仍计入条目数
+			continue
+		}
+		added = append(added, *ce)
+	}
+	return CheckListPolicy(db, cl, added, len(oldItems), len(cl.Items), userID)
+}
+
+// normalizeStrings trims the values and drops empty and duplicate ones
+func normalizeStrings(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || containsString(out, v) {
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
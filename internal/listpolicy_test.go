@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateListPolicy(t *testing.T) {
+	cl := &ContentList{AllowedTypes: []string{" task ", "", "bug", "task"}, MovePermission: "write"}
+	if err := ValidateListPolicy(cl); err != nil {
+		t.Fatalf("合法策略被拒绝: %v", err)
+	}
+	if len(cl.AllowedTypes) != 2 || cl.AllowedTypes[0] != "task" || cl.AllowedTypes[1] != "bug" {
+		t.Fatalf("allowed_types 未规范化: %v", cl.AllowedTypes)
+	}
+	if err := ValidateListPolicy(&ContentList{MaxItems: -1}); !errors.Is(err, ErrInvalidListPolicy) {
+		t.Fatalf("负数上限应被拒绝, got %v", err)
+	}
+	if err := ValidateListPolicy(&ContentList{MovePermission: "owner"}); !errors.Is(err, ErrInvalidListPolicy) {
+		t.Fatalf("未知权限级别应被拒绝, got %v", err)
+	}
+}
+
+func TestCheckListUpdate(t *testing.T) {
+	db := newTestDB(t)
+
+	task, _ := CreateContentEntry(db, &ContentEntry{Type: "task", Title: "T", ProjectID: 1})
+	bug, _ := CreateContentEntry(db, &ContentEntry{Type: "bug", Title: "B", ProjectID: 1})
+	note, _ := CreateContentEntry(db, &ContentEntry{Type: "note", Title: "N", ProjectID: 1})
+
+	cl := &ContentList{Title: "Doing", ProjectID: 1, MaxItems: 2, AllowedTypes: []string{"task", "bug"}}
+	old := []int64{task}
+
+	cl.Items = []int64{task, bug}
+	if err := CheckListUpdate(db, cl, old, 1); err != nil {
+		t.Fatalf("未超出上限应允许: %v", err)
+	}
+	cl.Items = []int64{task, bug, note}
+	if err := CheckListUpdate(db, cl, []int64{task, bug}, 1); !errors.Is(err, ErrListPolicy) {
+		t.Fatalf("超出上限应被拒绝, got %v", err)
+	}
+	cl.MaxItems = 0
+	if err := CheckListUpdate(db, cl, old, 1); !errors.Is(err, ErrListPolicy) {
+		t.Fatalf("不允许的条目类型应被拒绝, got %v", err)
+	}
+
+	// 已超出上限的列表仍可调整顺序或移出条目
+	cl.MaxItems = 1
+	cl.AllowedTypes = nil
+	cl.Items = []int64{bug, task}
+	if err := CheckListUpdate(db, cl, []int64{task, bug, note}, 1); err != nil {
+		t.Fatalf("缩减列表应允许: %v", err)
+	}
+
+	cl.MaxItems = 0
+	cl.MovePermission = "admin"
+	cl.Items = []int64{task, note}
+	if err := CheckListUpdate(db, cl, old, 2); !errors.Is(err, ErrListPolicy) {
+		t.Fatalf("权限不足的移入应被拒绝, got %v", err)
+	}
+	grant(t, db, 2, "project", 1, "admin")
+	if err := CheckListUpdate(db, cl, old, 2); err != nil {
+		t.Fatalf("管理员移入应允许: %v", err)
+	}
+}
+
+func TestContentListPolicyRoundTrip(t *testing.T) {
+	db := newTestDB(t)
+
+	id, err := CreateContentList(db, &ContentList{Title: "Doing", ProjectID: 1, MaxItems: 3, AllowedTypes: []string{"task"}, MovePermission: "write"})
+	if err != nil {
+		t.Fatalf("创建列表失败: %v", err)
+	}
+	cl, err := GetContentList(db, id)
+	if err != nil {
+		t.Fatalf("读取列表失败: %v", err)
+	}
+	if cl.MaxItems != 3 || len(cl.AllowedTypes) != 1 || cl.AllowedTypes[0] != "task" || cl.MovePermission != "write" {
+		t.Fatalf("列表策略未正确保存: %+v", cl)
+	}
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// DefaultMailLocale is used for users without a locale and for locales without templates.
+const DefaultMailLocale = "en"
+
+// MailTemplates holds the email templates by locale, each with a subject and a body template for
+// every kind of email. Adding a locale means adding an entry with the same keys.
+var MailTemplates = map[string]map[string]string{
+	"en": {
+		"notification.subject": "[liteboard] {{.Message}}",
+		"notification.body": `Hi {{.Username}},
+
+{{.Message}}
+{{if .Link}}
+Open: {{.Link}}
+{{end}}
+--
+You receive this email because of your liteboard notification settings.
+Unsubscribe from all liteboard emails: {{.UnsubscribeURL}}
+`,
+		"digest.subject": "[liteboard] Your {{if eq .Period \"weekly\"}}weekly{{else}}daily{{end}} activity digest",
+		"digest.body": `Hi {{.Username}},
+
+Here is what happened in your projects {{if eq .Period "weekly"}}this week{{else}}today{{end}}.
+{{range .Projects}}
+== {{.Name}} ==
+{{.Link}}
+{{if .Created}}New cards:
+{{range .Created}}  - {{.Title}}
+{{end}}{{end}}{{if .Updated}}Updated cards:
+{{range .Updated}}  - {{.Title}}
+{{end}}{{end}}{{if .More}}  ... and {{.More}} more
+{{end}}{{end}}
+--
+You receive this digest because of your liteboard notification settings.
+Unsubscribe from all liteboard emails: {{.UnsubscribeURL}}
+`,
+		"invitation.subject": "[liteboard] {{.Inviter}} invited you to {{.Project}}",
+		"invitation.body": `Hi,
+
+{{.Inviter}} invited you to the liteboard project "{{.Project}}" with {{.PermissionLevel}} access.
+
+Accept the invitation: {{.Link}}
+
+The link works once and expires on {{.ExpiresAt}}. You can also sign in to liteboard with a GitHub
+account that has this address verified and the invitation is applied automatically.
+
+If you don't know the sender, you can ignore this email.
+`,
+	},
+	"zh": {
+		"notification.subject": "[liteboard] {{.Message}}",
+		"notification.body": `{{.Username}}，你好：
+
+{{.Message}}
+{{if .Link}}
+查看：{{.Link}}
+{{end}}
+--
+你收到这封邮件是因为你在 liteboard 中开启了邮件通知。
+退订所有 liteboard 邮件：{{.UnsubscribeURL}}
+`,
+		"digest.subject": "[liteboard] {{if eq .Period \"weekly\"}}每周{{else}}每日{{end}}动态摘要",
+		"digest.body": `{{.Username}}，你好：
+
+以下是你的项目{{if eq .Period "weekly"}}本周{{else}}今天{{end}}的动态。
+{{range .Projects}}
+== {{.Name}} ==
+{{.Link}}
+{{if .Created}}新建的卡片：
+{{range .Created}}  - {{.Title}}
+{{end}}{{end}}{{if .Updated}}更新的卡片：
+{{range .Updated}}  - {{.Title}}
+{{end}}{{end}}{{if .More}}  …… 另有 {{.More}} 项
+{{end}}{{end}}
+--
+你收到这封摘要是因为你在 liteboard 中开启了邮件摘要。
+退订所有 liteboard 邮件：{{.UnsubscribeURL}}
+`,
+		"invitation.subject": "[liteboard] {{.Inviter}} 邀请你加入 {{.Project}}",
+		"invitation.body": `你好：
+
+{{.Inviter}} 邀请你加入 liteboard 项目“{{.Project}}”（{{.PermissionLevel}} 权限）。
+
+接受邀请：{{.Link}}
+
+链接只能使用一次，有效期至 {{.ExpiresAt}}。也可以直接用此邮箱已验证的 GitHub 账号登录 liteboard，邀请会自动生效。
+
+如果你不认识对方，忽略这封邮件即可。
+`,
+	},
+}
+
+// RenderMail renders the subject and body of an email kind ("notification", "digest" or
+// "invitation") in the given locale, falling back to DefaultMailLocale.
+func RenderMail(locale string, kind string, data interface{}) (string, string, error) {
+	templates, ok := MailTemplates[locale]
+	if !ok {
+		templates = MailTemplates[DefaultMailLocale]
+	}
+	subject, err := renderMailTemplate(templates, kind+".subject", data)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := renderMailTemplate(templates, kind+".body", data)
+	if err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(subject), body, nil
+}
+
+func renderMailTemplate(templates map[string]string, name string, data interface{}) (string, error) {
+	src, ok := templates[name]
+	if !ok {
+		return "", fmt.Errorf("mail template %s not found", name)
+	}
+	tmpl, err := template.New(name).Parse(src)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP connection security
+const (
+	SMTPTLSNone     = "none"     // 明文连接，仅适合本地或受信网络
+	SMTPTLSStartTLS = "starttls" // 明文连接后升级为 TLS（通常是 587 端口）
+	SMTPTLSImplicit = "tls"      // 直接建立 TLS 连接（通常是 465 端口）
+)
+
+// Mail is a plain text email to a single recipient.
+type Mail struct {
+	To             string
+	Subject        string
+	Body           string
+	UnsubscribeURL string // sent as List-Unsubscribe when set
+}
+
+// Mailer sends emails. SMTPMailer is the production implementation.
+type Mailer interface {
+	Send(ctx context.Context, m *Mail) error
+}
+
+// SMTPConfig configures an SMTPMailer.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string // 为空表示不认证
+	Password string
+	From     string // e.g. "liteboard <noreply@example.com>"
+	TLS      string // one of the SMTPTLS* constants; empty means starttls
+
+	InsecureSkipVerify bool // 跳过证书校验，仅用于测试
+	Timeout            time.Duration
+}
+
+// SMTPMailer sends mail through an SMTP server, one connection per message.
+type SMTPMailer struct {
+	cfg  SMTPConfig
+	from *mail.Address
+}
+
+// NewSMTPMailer checks the configuration and returns a mailer. The port defaults to 465 for
+// implicit TLS and 587 otherwise; the timeout defaults to 30 seconds.
+func NewSMTPMailer(cfg SMTPConfig) (*SMTPMailer, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("smtp host is required")
+	}
+	if cfg.TLS == "" {
+		cfg.TLS = SMTPTLSStartTLS
+	}
+	switch cfg.TLS {
+	case SMTPTLSNone, SMTPTLSStartTLS:
+		if cfg.Port == 0 {
+			cfg.Port = 587
+		}
+	case SMTPTLSImplicit:
+		if cfg.Port == 0 {
+			cfg.Port = 465
+		}
+	default:
+		return nil, fmt.Errorf("unknown smtp tls mode %q", cfg.TLS)
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp from address: %v", err)
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	return &SMTPMailer{cfg: cfg, from: from}, nil
+}
+
+func (s *SMTPMailer) tlsConfig() *tls.Config {
+	return &tls.Config{ServerName: s.cfg.Host, InsecureSkipVerify: s.cfg.InsecureSkipVerify}
+}
+
+// Send delivers m. Any error leaves the message unsent; callers retry through the outbox.
+func (s *SMTPMailer) Send(ctx context.Context, m *Mail) error {
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %v", err)
+	}
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	dialer := &net.Dialer{Timeout: s.cfg.Timeout}
+	var conn net.Conn
+	if s.cfg.TLS == SMTPTLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: s.tlsConfig()}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(s.cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if s.cfg.TLS == SMTPTLSStartTLS {
+		if err := c.StartTLS(s.tlsConfig()); err != nil {
+			return err
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMessage(s.from, to, m, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// buildMessage renders m as a quoted-printable UTF-8 text message.
+func buildMessage(from, to *mail.Address, m *Mail, now time.Time) []byte {
+	// 标题来自条目等用户内容，去掉换行以免注入额外的邮件头
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(m.Subject)
+	var b bytes.Buffer
+	b.WriteString("From: " + from.String() + "\r\n")
+	b.WriteString("To: " + to.String() + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("Date: " + now.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	if m.UnsubscribeURL != "" && !strings.ContainsAny(m.UnsubscribeURL, "\r\n") {
+		b.WriteString("List-Unsubscribe: <" + m.UnsubscribeURL + ">\r\n")
+	}
+	b.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&b)
+	qp.Write([]byte(m.Body))
+	qp.Close()
+	return b.Bytes()
+}
@@ -0,0 +1,232 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kaguya154/dbhelper"
+)
+
+// fakeSMTPServer 是一个只支持明文会话的最小 SMTP 服务器，收到的邮件数据写入 received
+func fakeSMTPServer(t *testing.T) (string, int, chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO", "HELO", "MAIL", "RCPT", "RSET", "NOOP":
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				received <- string(data)
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("502 unsupported")
+			}
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, received
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	host, port, received := fakeSMTPServer(t)
+	if _, err := NewSMTPMailer(SMTPConfig{Host: host, From: "noreply@example.com", TLS: "ssl"}); err == nil {
+		t.Fatal("应拒绝未知的 TLS 模式")
+	}
+	m, err := NewSMTPMailer(SMTPConfig{Host: host, Port: port, From: "liteboard <noreply@example.com>", TLS: SMTPTLSNone, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("创建 mailer 失败: %v", err)
+	}
+	mail := &Mail{To: "alice@example.com", Subject: "卡片已更新\r\nBcc: evil@example.com", Body: "你好\n", UnsubscribeURL: "http://lb/unsubscribe?token=abc"}
+	if err := m.Send(context.Background(), mail); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	var data string
+	select {
+	case data = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("服务器未收到邮件")
+	}
+	header, body, _ := strings.Cut(data, "\n\n")
+	if strings.Contains(header, "\nBcc:") {
+		t.Fatalf("标题中的换行不应产生新的邮件头:\n%s", header)
+	}
+	for _, want := range []string{"From: \"liteboard\" <noreply@example.com>", "To: <alice@example.com>", "Subject: =?utf-8?q?", "List-Unsubscribe: <http://lb/unsubscribe?token=abc>"} {
+		if !strings.Contains(header, want) {
+			t.Fatalf("邮件头缺少 %q:\n%s", want, header)
+		}
+	}
+	decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(body)))
+	if err != nil || strings.TrimSpace(string(decoded)) != "你好" {
+		t.Fatalf("正文解码不正确: %v %q", err, decoded)
+	}
+}
+
+type failingMailer struct {
+	calls int
+}
+
+func (f *failingMailer) Send(ctx context.Context, m *Mail) error {
+	f.calls++
+	return errors.New("connection refused")
+}
+
+func TestEmailOutboxRetry(t *testing.T) {
+	db := newTestDB(t)
+	if err := QueueEmail(db, &Mail{To: "not an address"}); err == nil {
+		t.Fatal("应拒绝无效的收件地址")
+	}
+	if err := QueueEmail(db, &Mail{To: "alice@example.com", Subject: "hi", Body: "hello"}); err != nil {
+		t.Fatalf("排队失败: %v", err)
+	}
+
+	f := &failingMailer{}
+	now := time.Now().Unix()
+	for i := 1; i <= MaxEmailAttempts; i++ {
+		if err := ProcessEmailOutbox(context.Background(), db, f, now); err != nil {
+			t.Fatalf("处理发件箱失败: %v", err)
+		}
+		rows, _ := db.Query("email_outbox", nil)
+		row := rows.All()[0]
+		if asInt64(row["attempts"]) != int64(i) {
+			t.Fatalf("第 %d 次尝试后次数不正确: %+v", i, row)
+		}
+		if i < MaxEmailAttempts {
+			if asString(row["status"]) != EmailPending || asInt64(row["next_attempt_at"]) != now+emailRetryBase<<(i-1) {
+				t.Fatalf("失败后应按指数退避重试: %+v", row)
+			}
+			// 未到重试时间不应再次发送
+			ProcessEmailOutbox(context.Background(), db, f, now)
+			if f.calls != i {
+				t.Fatalf("未到重试时间不应发送, calls=%d", f.calls)
+			}
+			now = asInt64(row["next_attempt_at"])
+		} else if asString(row["status"]) != EmailFailed || asString(row["last_error"]) != "connection refused" {
+			t.Fatalf("达到最大次数后应标记为失败: %+v", row)
+		}
+	}
+	ProcessEmailOutbox(context.Background(), db, f, now+1<<20)
+	if f.calls != MaxEmailAttempts {
+		t.Fatalf("失败的邮件不应再发送, calls=%d", f.calls)
+	}
+}
+
+func TestNotificationEmailsAndDigest(t *testing.T) {
+	db := newTestDB(t)
+	aliceID, _ := CreateUser(db, &User{Username: "alice", Email: "alice@example.com"})
+	bobID, _ := CreateUser(db, &User{Username: "bob"})
+	outbox := func() []map[string]interface{} {
+		rows, _ := db.Query("email_outbox", nil)
+		return rows.All()
+	}
+
+	n := &Notification{UserID: aliceID, ActorID: bobID, Type: NotificationMention, ProjectID: 7, EntryID: 9, Message: "bob mentioned you"}
+	if err := QueueNotificationEmail(db, n, "http://lb"); err != nil || len(outbox()) != 0 {
+		t.Fatalf("默认不应发送邮件: %v %d", err, len(outbox()))
+	}
+	if err := SetEmailPreferences(db, aliceID, &EmailPreferences{Immediate: []string{"bogus"}}); !errors.Is(err, ErrInvalidEmailPreferences) {
+		t.Fatalf("应拒绝未知的通知类型, got %v", err)
+	}
+	if err := SetEmailPreferences(db, aliceID, &EmailPreferences{Digest: "hourly"}); !errors.Is(err, ErrInvalidEmailPreferences) {
+		t.Fatalf("应拒绝未知的摘要频率, got %v", err)
+	}
+	if err := SetEmailPreferences(db, aliceID, &EmailPreferences{Immediate: []string{NotificationMention}, Digest: DigestDaily, Locale: "zh"}); err != nil {
+		t.Fatalf("保存邮件偏好失败: %v", err)
+	}
+	QueueNotificationEmail(db, &Notification{UserID: aliceID, ActorID: bobID, Type: NotificationProjectAccess}, "http://lb")
+	if err := QueueNotificationEmail(db, n, "http://lb"); err != nil {
+		t.Fatalf("排队通知邮件失败: %v", err)
+	}
+	emails := outbox()
+	if len(emails) != 1 {
+		t.Fatalf("只应发送选择的通知类型: %+v", emails)
+	}
+	body := asString(emails[0]["body"])
+	if asString(emails[0]["to_addr"]) != "alice@example.com" || !strings.Contains(body, "alice，你好") ||
+		!strings.Contains(body, "http://lb/board.html?project=7&entry=9") {
+		t.Fatalf("通知邮件内容不正确: %+v", emails[0])
+	}
+	unsubscribe := asString(emails[0]["unsubscribe_url"])
+	if !strings.HasPrefix(unsubscribe, "http://lb/unsubscribe?token=") || !strings.Contains(body, unsubscribe) {
+		t.Fatalf("邮件应包含退订链接: %q", unsubscribe)
+	}
+
+	// 摘要：只列出可读项目中自上次摘要以来的动态
+	projectID, _ := CreateProject(db, &Project{Name: "Roadmap", CreatorID: bobID})
+	hiddenID, _ := CreateProject(db, &Project{Name: "Secret", CreatorID: bobID})
+	grant(t, db, aliceID, "project", projectID, "read")
+	CreateContentEntry(db, &ContentEntry{Title: "Launch", ProjectID: projectID})
+	oldID, _ := CreateContentEntry(db, &ContentEntry{Title: "Polish", ProjectID: projectID})
+	CreateContentEntry(db, &ContentEntry{Title: "Hidden card", ProjectID: hiddenID})
+	now := time.Now().Unix()
+	db.Exec(dbhelper.Cond().Raw("UPDATE content_entry SET created_at = " + strconv.FormatInt(now-3*24*60*60, 10) + " WHERE id = " + strconv.FormatInt(oldID, 10)).Build())
+
+	if err := RunDigests(db, "http://lb", now); err != nil {
+		t.Fatalf("生成摘要失败: %v", err)
+	}
+	emails = outbox()
+	if len(emails) != 2 {
+		t.Fatalf("应排队一封摘要: %+v", emails)
+	}
+	digest := asString(emails[1]["body"])
+	if asString(emails[1]["subject"]) != "[liteboard] 每日动态摘要" || !strings.Contains(digest, "== Roadmap ==") ||
+		!strings.Contains(digest, "新建的卡片：\n  - Launch") || !strings.Contains(digest, "更新的卡片：\n  - Polish") {
+		t.Fatalf("摘要内容不正确: %s\n%s", asString(emails[1]["subject"]), digest)
+	}
+	if strings.Contains(digest, "Hidden card") {
+		t.Fatalf("摘要不应包含无权查看的项目: %s", digest)
+	}
+	RunDigests(db, "http://lb", now+60)
+	if len(outbox()) != 2 {
+		t.Fatal("未到下一周期不应再次发送摘要")
+	}
+
+	// 退订后不再发送任何邮件
+	token := strings.TrimPrefix(unsubscribe, "http://lb/unsubscribe?token=")
+	if err := Unsubscribe(db, "nope"); !errors.Is(err, ErrUnknownUnsubscribeToken) {
+		t.Fatalf("未知令牌应返回错误, got %v", err)
+	}
+	if err := Unsubscribe(db, token); err != nil {
+		t.Fatalf("退订失败: %v", err)
+	}
+	prefs, _ := GetEmailPreferences(db, aliceID)
+	if len(prefs.Immediate) != 0 || prefs.Digest != DigestOff || prefs.Locale != "zh" {
+		t.Fatalf("退订后应关闭所有邮件: %+v", prefs)
+	}
+	QueueNotificationEmail(db, n, "http://lb")
+	RunDigests(db, "http://lb", now+2*24*60*60)
+	if len(outbox()) != 2 {
+		t.Fatal("退订后不应再排队邮件")
+	}
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var (
+	// markdown renders CommonMark with the GitHub extensions (tables, task lists, strikethrough,
+	// autolinks). Raw HTML in the source is dropped by goldmark's default renderer.
+	markdown = goldmark.New(goldmark.WithExtensions(
+		// 用 align 属性表示列对齐，避免放行 style 属性
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		extension.Strikethrough,
+		extension.Linkify,
+		extension.TaskList,
+	))
+
+	// markdownPolicy is the allowlist applied to rendered HTML. Only the elements goldmark emits
+	// for markdown are kept; scripts, styles, event handlers and non-http(s)/mailto URLs are removed.
+	markdownPolicy = newMarkdownPolicy()
+)
+
+func newMarkdownPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "hr", "h1", "h2", "h3", "h4", "h5", "h6",
+		"blockquote", "pre", "code", "em", "strong", "del", "ul", "ol", "li",
+		"table", "thead", "tbody", "tr", "th", "td")
+
+	p.AllowAttrs("href", "title").OnElements("a")
+	p.AllowAttrs("src", "alt", "title").OnElements("img")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.AllowRelativeURLs(true)
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|right|center)$`)).OnElements("th", "td")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+
+	// GFM 任务列表渲染为禁用的复选框
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").Matching(regexp.MustCompile(`^(|checked|disabled)$`)).OnElements("input")
+	return p
+}
+
+// RenderMarkdown converts markdown source to sanitized HTML that is safe to insert into a page.
+func RenderMarkdown(src string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(src), &buf); err != nil {
+		return "", err
+	}
+	return string(markdownPolicy.SanitizeBytes(buf.Bytes())), nil
+}
+
+// SanitizeHTML applies the markdown allowlist to an arbitrary HTML fragment.
+func SanitizeHTML(html string) string {
+	return markdownPolicy.Sanitize(html)
+}
+
+// RenderEntryContent fills ContentHTML of each entry from its markdown Content.
+func RenderEntryContent(entries []ContentEntry) error {
+	for i := range entries {
+		html, err := RenderMarkdown(entries[i].Content)
+		if err != nil {
+			return err
+		}
+		entries[i].ContentHTML = html
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdownGFM(t *testing.T) {
+	src := "# Title\n\n" +
+		"- [x] done\n- [ ] todo\n\n" +
+		"| a | b |\n|:--|--:|\n| 1 | 2 |\n\n" +
+		"```go\nfmt.Println(\"<hi>\")\n```\n\n" +
+		"~~old~~ see https://example.com"
+	html, err := RenderMarkdown(src)
+	if err != nil {
+		t.Fatalf("渲染失败: %v", err)
+	}
+	for _, want := range []string{
+		"<h1>Title</h1>",
+		`<input checked="" disabled="" type="checkbox"`,
+		`<input disabled="" type="checkbox"`,
+		"<table>",
+		`<th align="left">a</th>`,
+		`<code class="language-go">`,
+		"&lt;hi&gt;",
+		"<del>old</del>",
+		`<a href="https://example.com" rel="nofollow noopener" target="_blank">`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("缺少 %q, got:\n%s", want, html)
+		}
+	}
+}
+
+func TestRenderMarkdownXSS(t *testing.T) {
+	payloads := []string{
+		"<script>alert(1)</script>",
+		"<img src=x onerror=alert(1)>",
+		"[click](javascript:alert(1))",
+		"[click](JaVaScRiPt:alert(1))",
+		"[click](&#106;avascript:alert(1))",
+		"![x](javascript:alert(1))",
+		"<a href=\"javascript:alert(1)\">x</a>",
+		"<iframe src=\"https://evil.example\"></iframe>",
+		"<svg onload=alert(1)>",
+		"<div style=\"background:url(javascript:alert(1))\">x</div>",
+		"[x](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)",
+		"<details open ontoggle=alert(1)>",
+		"<<script>script>alert(1)<</script>/script>",
+		"`code` <style>body{display:none}</style>",
+		"<form action=\"https://evil.example\"><input type=\"submit\"></form>",
+		"[x](vbscript:msgbox(1))",
+	}
+	for _, p := range payloads {
+		html, err := RenderMarkdown(p)
+		if err != nil {
+			t.Fatalf("渲染失败: %v", err)
+		}
+		lower := strings.ToLower(html)
+		for _, bad := range []string{"<script", "javascript:", "vbscript:", "data:text", "onerror", "onload", "ontoggle", "<iframe", "<svg", "<style", "style=", "<form", "type=\"submit\""} {
+			if strings.Contains(lower, bad) {
+				t.Errorf("payload %q 未被清理 (%s): %s", p, bad, html)
+			}
+		}
+	}
+}
+
+func TestSanitizeHTMLStripsRawHTML(t *testing.T) {
+	got := SanitizeHTML(`<p onclick="x()">hi <b>there</b><script>x()</script></p>`)
+	if got != "<p>hi there</p>" {
+		t.Fatalf("清理结果错误: %s", got)
+	}
+}
@@ -38,11 +38,54 @@ func NewSuccessResponseWithData(message string, data interface{}) SuccessRespons
 	return SuccessResponse{Message: message, Data: data}
 }
 
+// Timestamps records when a record was created and last changed, and by whom. CreatedAt and
+// UpdatedAt are maintained by the CRUD functions; callers set UpdatedBy to the acting user.
+type Timestamps struct {
+	CreatedAt int64 `json:"created_at"` // Unix 时间戳
+	UpdatedAt int64 `json:"updated_at"` // Unix 时间戳
+	UpdatedBy int64 `json:"updated_by"` // 最后修改者的 user ID，0 表示未知
+}
+
 type Project struct {
 	ID          int64  `json:"id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	CreatorID   int64  `json:"creator_id"`
+	IsTemplate  bool   `json:"is_template"` // 模板项目出现在新建项目的模板选择中
+	Timestamps
+}
+
+// CloneOptions controls what CloneProject copies into the new project.
+type CloneOptions struct {
+	Name           string `json:"name"`            // 新项目名称，为空时使用 "<原名称> (copy)"
+	Description    string `json:"description"`     // 新项目描述，为空时沿用原项目描述
+	IncludeEntries bool   `json:"include_entries"` // 是否复制条目；否则只复制列表结构
+	IsTemplate     bool   `json:"is_template"`     // 新项目是否标记为模板
+}
+
+// BatchOperation is one step of a batch. ID, ListID, TargetListID and TargetProjectID take either
+// a number or "$name" to refer to an object created by an earlier operation with Ref "name"; so do
+// project_id and items inside Data.
+type BatchOperation struct {
+	Op               string          `json:"op"`   // create、update、delete 或 move
+	Type             string          `json:"type"` // project、list 或 entry
+	ID               json.RawMessage `json:"id,omitempty"`
+	Ref              string          `json:"ref,omitempty"`     // 为创建的对象命名，供后续操作引用
+	Data             json.RawMessage `json:"data,omitempty"`    // create 和 update 的字段
+	ListID           json.RawMessage `json:"list_id,omitempty"` // 创建条目时放入的列表
+	TargetListID     json.RawMessage `json:"target_list_id,omitempty"`
+	TargetProjectID  json.RawMessage `json:"target_project_id,omitempty"`
+	Position         *int            `json:"position,omitempty"` // 插入位置，省略时追加到末尾
+	PermissionPolicy string          `json:"permission_policy,omitempty"`
+}
+
+// BatchResult reports the outcome of one batch operation.
+type BatchResult struct {
+	Index int    `json:"index"`
+	Op    string `json:"op"`
+	Type  string `json:"type"`
+	ID    int64  `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
 }
 
 type User struct {
@@ -51,6 +94,7 @@ type User struct {
 	Email     string   `json:"email"`
 	Groups    []string `json:"groups"`
 	AvatarURL string   `json:"avatar_url,omitempty"`
+	Timestamps
 }
 
 type UserInternal struct {
@@ -61,28 +105,59 @@ type UserInternal struct {
 	PasswordHash string
 	Groups       []string
 	AvatarURL    string
+	Timestamps
 }
 
+// Sidebar is the navigation of a project or of a user; exactly one of ProjectID and UserID is set.
 type Sidebar struct {
 	ID          int64         `json:"id"`
+	ProjectID   int64         `json:"project_id,omitempty"`
+	UserID      int64         `json:"user_id,omitempty"`
 	Name        string        `json:"name"`
 	Description string        `json:"description"`
 	Items       []SidebarItem `json:"items"`
 }
 
+// SidebarItem is a link in a sidebar. It points at a wiki page, a project board, a list or an
+// external URL; for content targets URL is filled in when the sidebar is read.
 type SidebarItem struct {
-	ID       int64  `json:"id"`
-	ParentID int64  `json:"parent_id"`
-	Name     string `json:"name"`
-	Icon     string `json:"icon"`
-	URL      string `json:"url"`
-	Order    int    `json:"order"`
+	ID         int64  `json:"id"`
+	SidebarID  int64  `json:"sidebar_id"`
+	ParentID   int64  `json:"parent_id"` // 父级侧边栏项，0 表示顶层
+	Name       string `json:"name"`
+	Icon       string `json:"icon"`
+	URL        string `json:"url"`
+	Order      int    `json:"order"`
+	TargetType string `json:"target_type"` // page、board、list 或 url，默认 url
+	TargetID   int64  `json:"target_id"`   // 页面、项目或列表的 ID
+}
+
+// SidebarItemOrder is the new position of an item in a sidebar reorder.
+type SidebarItemOrder struct {
+	ID       int64 `json:"id"`
+	ParentID int64 `json:"parent_id"`
+	Order    int   `json:"order"`
 }
 
+// Page is a wiki page of a project. Body is markdown and may link to other pages of the project
+// with [[Title]] or [[slug|text]] and to entries with #<entry id>.
 type Page struct {
-	ID       int64  `json:"id"`
-	Title    string `json:"title"`
-	AuthorID int64  `json:"author_id"`
+	ID          int64  `json:"id"`
+	ProjectID   int64  `json:"project_id"`
+	ParentID    int64  `json:"parent_id"` // 0 表示顶层页面
+	Title       string `json:"title"`
+	Slug        string `json:"slug"` // 项目内唯一，为空时由标题生成
+	Body        string `json:"body"`
+	AuthorID    int64  `json:"author_id"`
+	ContentHTML string `json:"content_html,omitempty"` // 仅在请求 render=html 时返回，不入库
+}
+
+// PageNode is a page in the page tree of a project, without its body.
+type PageNode struct {
+	ID       int64      `json:"id"`
+	Title    string     `json:"title"`
+	Slug     string     `json:"slug"`
+	Children []PageNode `json:"children"`
 }
 
 // ContentItem is a union type that can hold either a ContentEntry or a ContentList.
@@ -145,15 +220,183 @@ type ContentList struct {
 	Items     []int64 `json:"items"` // 存储 content entry 的 ID
 	CreatorID int64   `json:"creator_id"`
 	ProjectID int64   `json:"project_id"`
+
+	// List policy, enforced when entries are added to the list
+	MaxItems       int      `json:"max_items"`       // WIP 上限，0 表示不限
+	AllowedTypes   []string `json:"allowed_types"`   // 允许的条目类型，空表示不限
+	MovePermission string   `json:"move_permission"` // 移入条目所需的项目权限级别，空表示只需列表写权限
+
+	ArchivedAt int64 `json:"archived_at"` // Unix 时间戳，0 表示未归档；通过 /content_lists/:id/archive 维护
+	Timestamps
+}
+
+// ContentListUpdate holds the fields of a list that an update may change; fields left out keep
+// their value. The project, creator, archive state and timestamps are maintained by the server.
+type ContentListUpdate struct {
+	Type           *string   `json:"type"`
+	Title          *string   `json:"title"`
+	Items          *[]int64  `json:"items"`
+	MaxItems       *int      `json:"max_items"`
+	AllowedTypes   *[]string `json:"allowed_types"`
+	MovePermission *string   `json:"move_permission"`
+}
+
+// Apply copies the fields given in u onto cl.
+func (u *ContentListUpdate) Apply(cl *ContentList) {
+	if u.Type != nil {
+		cl.Type = *u.Type
+	}
+	if u.Title != nil {
+		cl.Title = *u.Title
+	}
+	if u.Items != nil {
+		cl.Items = *u.Items
+	}
+	if u.MaxItems != nil {
+		cl.MaxItems = *u.MaxItems
+	}
+	if u.AllowedTypes != nil {
+		cl.AllowedTypes = *u.AllowedTypes
+	}
+	if u.MovePermission != nil {
+		cl.MovePermission = *u.MovePermission
+	}
 }
 
 type ContentEntry struct {
+	ID        int64   `json:"id"`
+	Type      string  `json:"type"`
+	Title     string  `json:"title"`
+	Content   string  `json:"content"`
+	CreatorID int64   `json:"creator_id"`
+	ProjectID int64   `json:"project_id"`
+	Assignees []int64 `json:"assignees"` // 存储负责人的 user ID
+	StartAt   int64   `json:"start_at"`  // Unix 时间戳，0 表示未设置
+	DueAt     int64   `json:"due_at"`    // Unix 时间戳，0 表示未设置
+	Labels    []int64 `json:"labels"`    // 标签 ID，通过 /content_entries/:id/labels 维护
+
+	CustomFields []CustomFieldValue `json:"custom_fields"`          // 通过 /content_entries/:id/custom_fields 维护
+	ContentHTML  string             `json:"content_html,omitempty"` // 仅在请求 render=html 时返回，不入库
+
+	// Archive state, maintained through /content_entries/:id/archive
+	ArchivedAt       int64 `json:"archived_at"`      // Unix 时间戳，0 表示未归档
+	ArchivedListID   int64 `json:"archived_list_id"` // 归档前所在的列表，取消归档时放回
+	ArchivedPosition int   `json:"archived_position"`
+	Timestamps
+}
+
+// ContentEntryUpdate holds the fields of an entry that an update may change; fields left out keep
+// their value. The project, creator, archive state and timestamps are maintained by the server,
+// labels and custom fields through their own endpoints.
+type ContentEntryUpdate struct {
+	Type      *string  `json:"type"`
+	Title     *string  `json:"title"`
+	Content   *string  `json:"content"`
+	Assignees *[]int64 `json:"assignees"`
+	StartAt   *int64   `json:"start_at"`
+	DueAt     *int64   `json:"due_at"`
+}
+
+// Apply copies the fields given in u onto ce.
+func (u *ContentEntryUpdate) Apply(ce *ContentEntry) {
+	if u.Type != nil {
+		ce.Type = *u.Type
+	}
+	if u.Title != nil {
+		ce.Title = *u.Title
+	}
+	if u.Content != nil {
+		ce.Content = *u.Content
+	}
+	if u.Assignees != nil {
+		ce.Assignees = *u.Assignees
+	}
+	if u.StartAt != nil {
+		ce.StartAt = *u.StartAt
+	}
+	if u.DueAt != nil {
+		ce.DueAt = *u.DueAt
+	}
+}
+
+// ArchivedItems lists the archived lists and entries of a project.
+type ArchivedItems struct {
+	Lists   []ContentList  `json:"lists"`
+	Entries []ContentEntry `json:"entries"`
+}
+
+// Label is a project-scoped tag that can be attached to content entries.
+type Label struct {
+	ID          int64  `json:"id"`
+	ProjectID   int64  `json:"project_id"`
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+}
+
+// CustomField is a project-level field definition for entry metadata such as story points.
+// Type is one of the CustomFieldType* constants; Options lists the choices of select fields.
+type CustomField struct {
+	ID        int64    `json:"id"`
+	ProjectID int64    `json:"project_id"`
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Options   []string `json:"options"`
+	Order     int      `json:"order"`
+}
+
+// CustomFieldValue is the value of one custom field on an entry.
+// Value is a string (text, single_select), float64 (number), int64 (date as Unix timestamp, user ID)
+// or []string (multi_select).
+type CustomFieldValue struct {
+	FieldID int64       `json:"field_id"`
+	Value   interface{} `json:"value"`
+}
+
+// EntryComment is a markdown comment on a content entry. ParentID is 0 for top-level comments
+// and the ID of the comment being replied to otherwise.
+type EntryComment struct {
+	ID        int64   `json:"id"`
+	EntryID   int64   `json:"entry_id"`
+	ParentID  int64   `json:"parent_id"`
+	AuthorID  int64   `json:"author_id"`
+	Body      string  `json:"body"`
+	Mentions  []int64 `json:"mentions"` // 被 @ 提及的用户 ID
+	Deleted   bool    `json:"deleted"`  // 已删除但仍有回复的评论保留占位
+	CreatedAt int64   `json:"created_at"`
+	UpdatedAt int64   `json:"updated_at"`
+}
+
+// Attachment is a file attached to a content entry. The file content lives in the blob store
+// under its SHA-256 hash, so identical uploads share one blob.
+type Attachment struct {
+	ID          int64  `json:"id"`
+	EntryID     int64  `json:"entry_id"`
+	ProjectID   int64  `json:"project_id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Hash        string `json:"hash"`
+	UploaderID  int64  `json:"uploader_id"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+// EntryRelation is a typed link between two content entries, possibly in different projects.
+// For blocks, SourceID blocks TargetID; for duplicates, SourceID duplicates TargetID.
+type EntryRelation struct {
 	ID        int64  `json:"id"`
+	SourceID  int64  `json:"source_id"`
+	TargetID  int64  `json:"target_id"`
 	Type      string `json:"type"`
-	Title     string `json:"title"`
-	Content   string `json:"content"`
 	CreatorID int64  `json:"creator_id"`
-	ProjectID int64  `json:"project_id"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// RelationGraph is the neighbourhood of an entry reached by following relations.
+type RelationGraph struct {
+	RootID    int64           `json:"root_id"`
+	Entries   []ContentEntry  `json:"entries"`
+	Relations []EntryRelation `json:"relations"`
 }
 
 type DetailPermission struct {
@@ -162,6 +405,7 @@ type DetailPermission struct {
 	ContentType string  `json:"content_type"`
 	ContentIDs  []int64 `json:"content_ids"`
 	Action      string  `json:"action"`
+	Timestamps
 }
 
 type Permission struct {
@@ -187,6 +431,7 @@ type ShareToken struct {
 	PermissionLevel string `json:"permission_level"`
 	CreatedAt       int64  `json:"created_at"`
 	ExpiresAt       int64  `json:"expires_at"`
+	CreatorID       int64  `json:"creator_id"` // 生成链接的用户，有人通过链接加入时通知此人
 }
 
 type ProjectPermission struct {
@@ -195,3 +440,205 @@ type ProjectPermission struct {
 	Email           string `json:"email"`
 	PermissionLevel string `json:"permission_level"`
 }
+
+// SyncChange is one object in a delta sync page. Op is upsert, with the current state of the object
+// in Data, or delete, a tombstone carrying only the type and ID.
+type SyncChange struct {
+	Seq  int64       `json:"seq"`
+	Type string      `json:"type"` // project, content_list, content_entry 或 detail_permission
+	ID   int64       `json:"id"`
+	Op   string      `json:"op"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// SyncPage is a page of changes after a cursor. Cursor is passed as since to fetch the next page;
+// when FullResync is set the client must reload everything and continue from Cursor.
+type SyncPage struct {
+	Changes    []SyncChange `json:"changes"`
+	Cursor     int64        `json:"cursor"`
+	HasMore    bool         `json:"has_more"`
+	FullResync bool         `json:"full_resync"`
+}
+
+// Notification is an entry in a user's inbox. ProjectID and EntryID point at what it is about and
+// are 0 when not applicable.
+type Notification struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Type      string `json:"type"` // NotificationProjectAccess 等常量之一
+	ActorID   int64  `json:"actor_id"`
+	ProjectID int64  `json:"project_id"`
+	EntryID   int64  `json:"entry_id"`
+	Message   string `json:"message"`
+	Read      bool   `json:"read"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// NotificationList is a page of a user's inbox together with the number of unread notifications.
+type NotificationList struct {
+	Notifications []Notification `json:"notifications"`
+	Unread        int            `json:"unread"`
+}
+
+// EmailPreferences are a user's email settings: the notification types emailed as they happen, how
+// often a digest of project activity is sent and the language of the emails.
+type EmailPreferences struct {
+	Immediate []string `json:"immediate"` // 即时邮件通知的类型，取值同 Notification.Type
+	Digest    string   `json:"digest"`    // off, daily 或 weekly
+	Locale    string   `json:"locale"`    // 邮件语言，如 en、zh
+}
+
+// Invitation invites someone by email to a project before they have an account. The accept link
+// token is only handed out when the invitation is created or resent; just its hash is stored.
+type Invitation struct {
+	ID              int64  `json:"id"`
+	ProjectID       int64  `json:"project_id"`
+	Email           string `json:"email"`
+	PermissionLevel string `json:"permission_level"`
+	InviterID       int64  `json:"inviter_id"`
+	Status          string `json:"status"` // pending, accepted, revoked 或 expired
+	CreatedAt       int64  `json:"created_at"`
+	SentAt          int64  `json:"sent_at"` // 最近一次发送邀请邮件的时间
+	ExpiresAt       int64  `json:"expires_at"`
+	AcceptedBy      int64  `json:"accepted_by"`
+	AcceptedAt      int64  `json:"accepted_at"`
+}
+
+// Webhook posts the events of a project to a URL. Events lists the event names to deliver, or
+// prefixes such as "entry.*"; an empty list means every event. The secret signs each delivery
+// and is never returned by the API.
+type Webhook struct {
+	ID        int64    `json:"id"`
+	ProjectID int64    `json:"project_id"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"-"`
+	Events    []string `json:"events"`
+	Active    bool     `json:"active"`
+	CreatorID int64    `json:"creator_id"`
+	CreatedAt int64    `json:"created_at"`
+}
+
+// WebhookDelivery is one attempt series to deliver an event to a webhook, kept as the delivery log.
+type WebhookDelivery struct {
+	ID            int64  `json:"id"`
+	WebhookID     int64  `json:"webhook_id"`
+	Event         string `json:"event"`
+	Payload       string `json:"payload"`
+	Status        string `json:"status"` // pending, succeeded 或 failed
+	Attempts      int    `json:"attempts"`
+	ResponseCode  int    `json:"response_code"` // 最近一次请求的 HTTP 状态码，连接失败时为 0
+	ResponseBody  string `json:"response_body"` // 最近一次响应的开头部分
+	Error         string `json:"error"`
+	NextAttemptAt int64  `json:"next_attempt_at"`
+	CreatedAt     int64  `json:"created_at"`
+	DeliveredAt   int64  `json:"delivered_at"`
+}
+
+// IncomingWebhook turns JSON posted to /hooks/{token} into entries of a list. The templates are Go
+// text/templates executed on the decoded payload, e.g. "{{.alert.name}}". When KeyTemplate renders
+// a non-empty key, payloads with the same key update the entry created for the first one.
+type IncomingWebhook struct {
+	ID              int64  `json:"id"`
+	ProjectID       int64  `json:"project_id"`
+	Name            string `json:"name"`
+	ListID          int64  `json:"list_id"`
+	EntryType       string `json:"entry_type"`
+	TitleTemplate   string `json:"title_template"`
+	ContentTemplate string `json:"content_template"`
+	KeyTemplate     string `json:"key_template"`
+	Active          bool   `json:"active"`
+	CreatorID       int64  `json:"creator_id"` // 新建条目的创建者
+	CreatedAt       int64  `json:"created_at"`
+	Token           string `json:"token,omitempty"` // 仅在创建和更换令牌时返回，库中只保存哈希
+}
+
+// ImportReport describes the project created by an import and what could not be imported.
+type ImportReport struct {
+	Project Project      `json:"project"`
+	Lists   int          `json:"lists"`
+	Entries int          `json:"entries"`
+	Labels  int          `json:"labels"`
+	Skipped []ImportSkip `json:"skipped"`
+
+	UnmatchedUsers []ArchiveUser `json:"unmatched_users,omitempty"` // 项目存档中在本实例找不到的用户
+}
+
+// ImportSkip is an item of the source that was left out or only partly imported.
+type ImportSkip struct {
+	Type   string `json:"type"` // 来源中的对象类型，如 card、attachment、comment
+	ID     string `json:"id"`   // 来源中的 ID
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// CSVImportOptions controls how ImportProjectCSV reads a CSV file.
+type CSVImportOptions struct {
+	Mapping     map[string]string `json:"mapping"`      // 字段名 (list, title, content, type) 到 CSV 列名，省略的字段使用同名列
+	DefaultList string            `json:"default_list"` // 行中没有列表名时放入的列表
+	DryRun      bool              `json:"dry_run"`      // 只校验并预览结果，不写入
+}
+
+// CSVImportResult reports the outcome of a CSV import, row by row. Rows with an error are not
+// imported; the other rows are.
+type CSVImportResult struct {
+	DryRun       bool           `json:"dry_run"`
+	Created      int            `json:"created"`
+	Failed       int            `json:"failed"`
+	CreatedLists []string       `json:"created_lists"` // 按名称新建的列表
+	Rows         []CSVRowResult `json:"rows"`
+}
+
+// CSVRowResult is the outcome of one CSV row. Row is the line number in the file, the header
+// being row 1.
+type CSVRowResult struct {
+	Row     int    `json:"row"`
+	List    string `json:"list"`
+	Title   string `json:"title"`
+	EntryID int64  `json:"entry_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ProjectArchive is the versioned, instance-independent form of a project, used for backups and to
+// move a project between Liteboard instances. All IDs are those of the exporting instance. Users
+// are listed in Users and matched on import by OpenID, then by email.
+type ProjectArchive struct {
+	Format       string              `json:"format"` // 固定为 liteboard.project
+	Version      int                 `json:"version"`
+	ExportedAt   int64               `json:"exported_at"`
+	Project      Project             `json:"project"`
+	Users        []ArchiveUser       `json:"users"`
+	Labels       []Label             `json:"labels"`
+	CustomFields []CustomField       `json:"custom_fields"`
+	Lists        []ContentList       `json:"lists"`
+	Entries      []ContentEntry      `json:"entries"`
+	Comments     []EntryComment      `json:"comments"`
+	Attachments  []Attachment        `json:"attachments"` // 文件内容在 zip 的 blobs/<hash> 中
+	Relations    []EntryRelation     `json:"relations"`   // 仅包含两端都在本项目中的关系
+	Pages        []Page              `json:"pages"`
+	Permissions  []ArchivePermission `json:"permissions"`
+	ShareTokens  []ShareToken        `json:"share_tokens"`
+}
+
+// ArchiveUser identifies a user referred to by a project archive.
+type ArchiveUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	OpenID   string `json:"openid"`
+}
+
+// ArchivePermission is a user's permission on the project or on one of its lists or entries.
+type ArchivePermission struct {
+	UserID      int64  `json:"user_id"`
+	ContentType string `json:"content_type"` // project, content_list 或 content_entry
+	ContentID   int64  `json:"content_id"`
+	Action      string `json:"action"`
+}
+
+// BackupInfo describes a database backup file that passed the integrity check.
+type BackupInfo struct {
+	File          string `json:"file"`
+	Size          int64  `json:"size"`
+	SchemaVersion int    `json:"schema_version"` // 备份时数据库的 PRAGMA user_version
+	CreatedAt     int64  `json:"created_at"`     // 文件的修改时间
+}
@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+// Notification types
+const (
+	NotificationProjectAccess = "project_access" // 被授予项目权限
+	NotificationProjectJoined = "project_joined" // 有人通过自己的分享链接加入项目
+	NotificationEntryChanged  = "entry_changed"  // 自己创建的条目被他人修改
+	NotificationMention       = "mention"        // 在评论中被 @
+)
+
+// NotificationTypes lists every notification type, in the order preferences are shown.
+var NotificationTypes = []string{NotificationProjectAccess, NotificationProjectJoined, NotificationEntryChanged, NotificationMention}
+
+var (
+	// ErrInvalidNotificationType is returned for preferences naming an unknown notification type.
+	ErrInvalidNotificationType = errors.New("invalid notification type")
+	// ErrNotificationNotFound is returned when a notification does not exist or belongs to another user.
+	ErrNotificationNotFound = errors.New("notification not found")
+)
+
+// Notify stores a notification for n.UserID unless the user turned its type off. Users are not
+// notified of their own actions.
+func Notify(db types.Conn, n *Notification) error {
+	if n.UserID == 0 || n.UserID == n.ActorID {
+		return nil
+	}
+	prefs, err := GetNotificationPreferences(db, n.UserID)
+	if err != nil {
+		return err
+	}
+	if !prefs[n.Type] {
+		return nil
+	}
+	n.CreatedAt = time.Now().Unix()
+	n.Read = false
+	cond := dbhelper.Cond().Eq("user_id", n.UserID).Eq("type", n.Type).Eq("actor_id", n.ActorID).Eq("project_id", n.ProjectID).
+		Eq("entry_id", n.EntryID).Eq("message", n.Message).Eq("read", 0).Eq("created_at", n.CreatedAt).Build()
+	id, err := db.Insert("notification", cond)
+	if err != nil {
+		return err
+	}
+	n.ID = id
+	return nil
+}
+
+// GetNotifications returns the user's notifications, newest first, and how many are unread. With
+// unreadOnly only unread ones are returned; limit, when positive, caps the number returned.
+func GetNotifications(db types.Conn, userID int64, unreadOnly bool, limit int) ([]Notification, int, error) {
+	rows, err := db.Query("notification", dbhelper.Cond().Eq("user_id", userID).Build())
+	if err != nil {
+		return nil, 0, err
+	}
+	notifications := []Notification{}
+	unread := 0
+	for _, data := range rows.All() {
+		n := notificationFromRow(data)
+		if !n.Read {
+			unread++
+		} else if unreadOnly {
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		if notifications[i].CreatedAt != notifications[j].CreatedAt {
+			return notifications[i].CreatedAt > notifications[j].CreatedAt
+		}
+		return notifications[i].ID > notifications[j].ID
+	})
+	if limit > 0 && len(notifications) > limit {
+		notifications = notifications[:limit]
+	}
+	return notifications, unread, nil
+}
+
+// MarkNotificationRead marks one of the user's notifications as read.
+func MarkNotificationRead(db types.Conn, userID int64, id int64) error {
+	cond := dbhelper.Cond().Eq("id", id).Eq("user_id", userID).Build()
+	rows, err := db.Query("notification", cond)
+	if err != nil {
+		return err
+	}
+	if rows.Count() == 0 {
+		return ErrNotificationNotFound
+	}
+	_, err = db.Update("notification", cond, dbhelper.Cond().Eq("read", 1).Build())
+	return err
+}
+
+// MarkAllNotificationsRead marks every notification of the user as read.
+func MarkAllNotificationsRead(db types.Conn, userID int64) error {
+	cond := dbhelper.Cond().Eq("user_id", userID).Eq("read", 0).Build()
+	_, err := db.Update("notification", cond, dbhelper.Cond().Eq("read", 1).Build())
+	return err
+}
+
+// GetNotificationPreferences returns whether each notification type is enabled for the user.
+// Types the user never changed are enabled.
+func GetNotificationPreferences(db types.Conn, userID int64) (map[string]bool, error) {
+	prefs := make(map[string]bool, len(NotificationTypes))
+	for _, t := range NotificationTypes {
+		prefs[t] = true
+	}
+	rows, err := db.Query("notification_preference", dbhelper.Cond().Eq("user_id", userID).Build())
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range rows.All() {
+		if t := asString(data["type"]); isNotificationType(t) {
+			prefs[t] = asInt64(data["enabled"]) != 0
+		}
+	}
+	return prefs, nil
+}
+
+// SetNotificationPreferences turns notification types on or off for the user. Types left out of
+// prefs keep their setting.
+func SetNotificationPreferences(db types.Conn, userID int64, prefs map[string]bool) error {
+	for t := range prefs {
+		if !isNotificationType(t) {
+			return fmt.Errorf("%w: %q", ErrInvalidNotificationType, t)
+		}
+	}
+	for t, enabled := range prefs {
+		cond := dbhelper.Cond().Eq("user_id", userID).Eq("type", t).Build()
+		rows, err := db.Query("notification_preference", cond)
+		if err != nil {
+			return err
+		}
+		if rows.Count() > 0 {
+			_, err = db.Update("notification_preference", cond, dbhelper.Cond().Eq("enabled", boolToInt(enabled)).Build())
+		} else {
+			_, err = db.Insert("notification_preference", dbhelper.Cond().Eq("user_id", userID).Eq("type", t).Eq("enabled", boolToInt(enabled)).Build())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isNotificationType(t string) bool {
+	for _, known := range NotificationTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+func notificationFromRow(data map[string]interface{}) Notification {
+	return Notification{
+		ID:        asInt64(data["id"]),
+		UserID:    asInt64(data["user_id"]),
+		Type:      asString(data["type"]),
+		ActorID:   asInt64(data["actor_id"]),
+		ProjectID: asInt64(data["project_id"]),
+		EntryID:   asInt64(data["entry_id"]),
+		Message:   asString(data["message"]),
+		Read:      asInt64(data["read"]) != 0,
+		CreatedAt: asInt64(data["created_at"]),
+	}
+}
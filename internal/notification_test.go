@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNotificationsInbox(t *testing.T) {
+	db := newTestDB(t)
+
+	if err := Notify(db, &Notification{UserID: 1, ActorID: 1, Type: NotificationEntryChanged}); err != nil {
+		t.Fatalf("Notify 失败: %v", err)
+	}
+	first := Notification{UserID: 1, ActorID: 2, Type: NotificationProjectAccess, ProjectID: 5, Message: "bob gave you read access to P"}
+	if err := Notify(db, &first); err != nil || first.ID == 0 {
+		t.Fatalf("Notify 失败: %v", err)
+	}
+	second := Notification{UserID: 1, ActorID: 2, Type: NotificationMention, EntryID: 3}
+	Notify(db, &second)
+	Notify(db, &Notification{UserID: 2, ActorID: 1, Type: NotificationMention})
+
+	list, unread, err := GetNotifications(db, 1, false, 0)
+	if err != nil || len(list) != 2 || unread != 2 {
+		t.Fatalf("自己的操作不应产生通知: %v %d %+v", err, unread, list)
+	}
+	if list[0].ID != second.ID {
+		t.Fatalf("应按时间倒序: %+v", list)
+	}
+
+	if err := MarkNotificationRead(db, 2, first.ID); !errors.Is(err, ErrNotificationNotFound) {
+		t.Fatalf("不能标记他人的通知, got %v", err)
+	}
+	if err := MarkNotificationRead(db, 1, first.ID); err != nil {
+		t.Fatalf("标记已读失败: %v", err)
+	}
+	list, unread, _ = GetNotifications(db, 1, true, 0)
+	if unread != 1 || len(list) != 1 || list[0].ID != second.ID {
+		t.Fatalf("unread=true 应只返回未读通知: %d %+v", unread, list)
+	}
+	if err := MarkAllNotificationsRead(db, 1); err != nil {
+		t.Fatalf("全部标记已读失败: %v", err)
+	}
+	if _, unread, _ = GetNotifications(db, 1, false, 1); unread != 0 {
+		t.Fatalf("全部已读后未读数应为 0: %d", unread)
+	}
+	if _, unread, _ = GetNotifications(db, 2, false, 0); unread != 1 {
+		t.Fatal("不应影响其他用户的通知")
+	}
+
+	// 关闭某类通知后不再收到
+	if err := SetNotificationPreferences(db, 1, map[string]bool{"bogus": true}); !errors.Is(err, ErrInvalidNotificationType) {
+		t.Fatalf("应拒绝未知的通知类型, got %v", err)
+	}
+	if err := SetNotificationPreferences(db, 1, map[string]bool{NotificationMention: false}); err != nil {
+		t.Fatalf("保存偏好失败: %v", err)
+	}
+	prefs, _ := GetNotificationPreferences(db, 1)
+	if prefs[NotificationMention] || !prefs[NotificationProjectAccess] {
+		t.Fatalf("偏好不正确: %+v", prefs)
+	}
+	Notify(db, &Notification{UserID: 1, ActorID: 2, Type: NotificationMention})
+	if list, _, _ = GetNotifications(db, 1, false, 0); len(list) != 2 {
+		t.Fatalf("已关闭的通知类型不应保存: %+v", list)
+	}
+}
@@ -0,0 +1,318 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+var (
+	// ErrInvalidPage is returned when a page's title, slug or parent is malformed.
+	ErrInvalidPage = errors.New("invalid page")
+	// ErrPageExists is returned when a project already has a page with the same slug.
+	ErrPageExists = errors.New("page with this slug already exists")
+
+	// pageLinkPattern matches [[target]] and [[target|text]].
+	pageLinkPattern = regexp.MustCompile(`\[\[([^\[\]|]+)(?:\|([^\[\]]+))?\]\]`)
+	// entryLinkPattern matches #<entry id> not preceded by a word character, & (HTML entities) or #.
+	entryLinkPattern = regexp.MustCompile(`(^|[^\w&#])#(\d+)\b`)
+)
+
+// Slugify turns a title into a slug: lowercase letters and digits, other runs become a hyphen.
+func Slugify(title string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(strings.TrimSpace(title)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			hyphen = false
+		} else if !hyphen && b.Len() > 0 {
+			b.WriteByte('-')
+			hyphen = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// PreparePage normalizes a page before it is saved and checks its slug and parent against the
+// other pages of the project. An empty slug is derived from the title and made unique; an explicit
+// slug that is taken is ErrPageExists. The parent must be another page of the project that is not
+// below this one.
+func PreparePage(db types.Conn, p *Page) error {
+	p.Title = strings.TrimSpace(p.Title)
+	if p.Title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalidPage)
+	}
+	pages, err := GetPagesByProject(db, p.ProjectID)
+	if err != nil {
+		return err
+	}
+	taken := make(map[string]bool, len(pages))
+	byID := make(map[int64]Page, len(pages))
+	for _, other := range pages {
+		byID[other.ID] = other
+		if other.ID != p.ID {
+			taken[other.Slug] = true
+		}
+	}
+
+	if p.Slug != "" {
+		p.Slug = Slugify(p.Slug)
+		if p.Slug == "" {
+			return fmt.Errorf("%w: slug must contain letters or digits", ErrInvalidPage)
+		}
+		if taken[p.Slug] {
+			return ErrPageExists
+		}
+	} else {
+		base := Slugify(p.Title)
+		if base == "" {
+			base = "page"
+		}
+		p.Slug = base
+		for n := 2; taken[p.Slug]; n++ {
+			p.Slug = base + "-" + strconv.Itoa(n)
+		}
+	}
+
+	// 父页面必须属于同一项目，且不能是自身或自身的子孙
+	for parentID := p.ParentID; parentID != 0; {
+		parent, ok := byID[parentID]
+		if !ok {
+			return fmt.Errorf("%w: parent page %d is not in this project", ErrInvalidPage, p.ParentID)
+		}
+		if parent.ID == p.ID {
+			return fmt.Errorf("%w: a page cannot be placed under itself", ErrInvalidPage)
+		}
+		parentID = parent.ParentID
+	}
+	return nil
+}
+
+// FindPageBySlug returns the page of a project with the given slug.
+func FindPageBySlug(db types.Conn, projectID int64, slug string) (*Page, error) {
+	pages, err := GetPagesByProject(db, projectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pages {
+		if p.Slug == slug {
+			return &p, nil
+		}
+	}
+	return nil, errors.New("page not found")
+}
+
+// DeleteProjectPage deletes a page and moves its children up to its parent.
+func DeleteProjectPage(db types.Conn, p *Page) error {
+	pages, err := GetPagesByProject(db, p.ProjectID)
+	if err != nil {
+		return err
+	}
+	for _, child := range pages {
+		if child.ParentID != p.ID {
+			continue
+		}
+		child.ParentID = p.ParentID
+		if err := UpdatePage(db, child.ID, &child); err != nil {
+			return err
+		}
+	}
+	return DeletePage(db, p.ID)
+}
+
+// BuildPageTree arranges the pages of a project by parent. Pages whose parent is missing are
+// placed at the top level.
+func BuildPageTree(pages []Page) []PageNode {
+	present := make(map[int64]bool, len(pages))
+	for _, p := range pages {
+		present[p.ID] = true
+	}
+	children := make(map[int64][]Page)
+	for _, p := range pages {
+		parentID := p.ParentID
+		if !present[parentID] {
+			parentID = 0
+		}
+		children[parentID] = append(children[parentID], p)
+	}
+	var build func(parentID int64) []PageNode
+	build = func(parentID int64) []PageNode {
+		nodes := []PageNode{}
+		for _, p := range children[parentID] {
+			nodes = append(nodes, PageNode{ID: p.ID, Title: p.Title, Slug: p.Slug, Children: build(p.ID)})
+		}
+		return nodes
+	}
+	return build(0)
+}
+
+// pageLinkTarget reports whether a [[target]] link refers to the page, by slug or by title.
+func pageLinkTarget(target string, p *Page) bool {
+	target = strings.TrimSpace(target)
+	return Slugify(target) == p.Slug || strings.EqualFold(target, p.Title)
+}
+
+// forEachTextSegment calls fn with each piece of markdown outside fenced code blocks and inline
+// code spans and replaces the piece with fn's result.
+func forEachTextSegment(src string, fn func(string) string) string {
+	lines := strings.Split(src, "\n")
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		parts := strings.Split(line, "`")
+		for j := 0; j < len(parts); j += 2 {
+			parts[j] = fn(parts[j])
+		}
+		lines[i] = strings.Join(parts, "`")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// PageLinks returns the [[page]] targets and #entry IDs referenced by a markdown body.
+func PageLinks(body string) (pages []string, entries []int64) {
+	forEachTextSegment(body, func(text string) string {
+		for _, m := range pageLinkPattern.FindAllStringSubmatch(text, -1) {
+			pages = append(pages, strings.TrimSpace(m[1]))
+		}
+		for _, m := range entryLinkPattern.FindAllStringSubmatch(text, -1) {
+			if id, err := strconv.ParseInt(m[2], 10, 64); err == nil {
+				entries = append(entries, id)
+			}
+		}
+		return text
+	})
+	return pages, entries
+}
+
+// GetPageBacklinks returns the other pages of the project that link to the page.
+func GetPageBacklinks(db types.Conn, p *Page) ([]Page, error) {
+	pages, err := GetPagesByProject(db, p.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	backlinks := []Page{}
+	for _, other := range pages {
+		if other.ID == p.ID {
+			continue
+		}
+		targets, _ := PageLinks(other.Body)
+		for _, target := range targets {
+			if pageLinkTarget(target, p) {
+				backlinks = append(backlinks, other)
+				break
+			}
+		}
+	}
+	return backlinks, nil
+}
+
+// GetEntryBacklinks returns the pages of the entry's project that mention it as #<id>.
+func GetEntryBacklinks(db types.Conn, ce *ContentEntry) ([]Page, error) {
+	pages, err := GetPagesByProject(db, ce.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	backlinks := []Page{}
+	for _, p := range pages {
+		if _, entries := PageLinks(p.Body); containsID(entries, ce.ID) {
+			backlinks = append(backlinks, p)
+		}
+	}
+	return backlinks, nil
+}
+
+// RenderPageContent fills ContentHTML of a page from its markdown body. [[page]] links point to
+// the page with that slug or title, or to the slug they would get if the page does not exist yet;
+// #<id> becomes a link only for entries of the same project.
+func RenderPageContent(db types.Conn, p *Page) error {
+	pages, err := GetPagesByProject(db, p.ProjectID)
+	if err != nil {
+		return err
+	}
+	entries, err := GetContentEntries(db)
+	if err != nil {
+		return err
+	}
+	projectEntries := make(map[int64]bool)
+	for _, ce := range entries {
+		if ce.ProjectID == p.ProjectID {
+			projectEntries[ce.ID] = true
+		}
+	}
+	base := "/board.html?project=" + strconv.FormatInt(p.ProjectID, 10)
+
+	src := forEachTextSegment(p.Body, func(text string) string {
+		text = pageLinkPattern.ReplaceAllStringFunc(text, func(link string) string {
+			m := pageLinkPattern.FindStringSubmatch(link)
+			target, label := strings.TrimSpace(m[1]), strings.TrimSpace(m[2])
+			if label == "" {
+				label = target
+			}
+			slug := Slugify(target)
+			for i := range pages {
+				if pageLinkTarget(target, &pages[i]) {
+					slug = pages[i].Slug
+					break
+				}
+			}
+			return "[" + escapeLinkText(label) + "](" + base + "&page=" + url.QueryEscape(slug) + ")"
+		})
+		return entryLinkPattern.ReplaceAllStringFunc(text, func(ref string) string {
+			m := entryLinkPattern.FindStringSubmatch(ref)
+			id, err := strconv.ParseInt(m[2], 10, 64)
+			if err != nil || !projectEntries[id] {
+				return ref
+			}
+			return m[1] + "[#" + m[2] + "](" + base + "&entry=" + m[2] + ")"
+		})
+	})
+	html, err := RenderMarkdown(src)
+	if err != nil {
+		return err
+	}
+	p.ContentHTML = html
+	return nil
+}
+
+func escapeLinkText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(s)
+}
+
+// Page queries
+
+func GetPagesByProject(db types.Conn, projectID int64) ([]Page, error) {
+	cond := dbhelper.Cond().Eq("project_id", projectID).Build()
+	rows, err := db.Query("page", cond)
+	if err != nil {
+		return nil, err
+	}
+	pages := []Page{}
+	for _, data := range rows.All() {
+		pages = append(pages, pageFromRow(data))
+	}
+	return pages, nil
+}
+
+func DeletePagesByProject(db types.Conn, projectID int64) error {
+	cond := dbhelper.Cond().Eq("project_id", projectID).Build()
+	_, err := db.Delete("page", cond)
+	return err
+}
@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPreparePageSlugsAndParents(t *testing.T) {
+	db := newTestDB(t)
+
+	home := Page{ProjectID: 1, Title: "  Getting Started! "}
+	if err := PreparePage(db, &home); err != nil || home.Title != "Getting Started!" || home.Slug != "getting-started" {
+		t.Fatalf("应由标题生成 slug: %v %+v", err, home)
+	}
+	home.ID, _ = CreatePage(db, &home)
+
+	dup := Page{ProjectID: 1, Title: "Getting started"}
+	if err := PreparePage(db, &dup); err != nil || dup.Slug != "getting-started-2" {
+		t.Fatalf("自动生成的 slug 重复时应加后缀: %v %+v", err, dup)
+	}
+	if err := PreparePage(db, &Page{ProjectID: 1, Title: "X", Slug: "Getting Started"}); !errors.Is(err, ErrPageExists) {
+		t.Fatalf("显式指定已占用的 slug 应报错, got %v", err)
+	}
+	if err := PreparePage(db, &Page{ProjectID: 2, Title: "Getting Started"}); err != nil {
+		t.Fatalf("slug 只需在项目内唯一: %v", err)
+	}
+	if err := PreparePage(db, &Page{ProjectID: 1}); !errors.Is(err, ErrInvalidPage) {
+		t.Fatalf("标题为空应报错, got %v", err)
+	}
+
+	child := Page{ProjectID: 1, Title: "Install", ParentID: home.ID}
+	PreparePage(db, &child)
+	child.ID, _ = CreatePage(db, &child)
+	home.ParentID = child.ID
+	if err := PreparePage(db, &home); !errors.Is(err, ErrInvalidPage) {
+		t.Fatalf("不能把页面移到自己的子页面下, got %v", err)
+	}
+	if err := PreparePage(db, &Page{ProjectID: 2, Title: "Y", ParentID: home.ID}); !errors.Is(err, ErrInvalidPage) {
+		t.Fatalf("父页面必须属于同一项目, got %v", err)
+	}
+
+	home.ParentID = 0
+	if err := DeleteProjectPage(db, &home); err != nil {
+		t.Fatalf("删除页面失败: %v", err)
+	}
+	moved, _ := GetPage(db, child.ID)
+	if moved.ParentID != 0 {
+		t.Fatalf("子页面应上移到被删除页面的父级: %+v", moved)
+	}
+}
+
+func TestPageLinksAndBacklinks(t *testing.T) {
+	db := newTestDB(t)
+
+	entryID, _ := CreateContentEntry(db, &ContentEntry{Title: "Bug", ProjectID: 1})
+	CreateContentEntry(db, &ContentEntry{Title: "Elsewhere", ProjectID: 2})
+
+	target := Page{ProjectID: 1, Title: "Release Notes", Slug: "release-notes"}
+	target.ID, _ = CreatePage(db, &target)
+	body := "See [[Release Notes|the notes]] and [[missing page]], fixes #1 and #2.\n\n`[[code]] #1`\n\n```\n[[fenced]]\n```\n"
+	source := Page{ProjectID: 1, Title: "Home", Slug: "home", Body: body}
+	source.ID, _ = CreatePage(db, &source)
+
+	pages, entries := PageLinks(body)
+	if len(pages) != 2 || pages[0] != "Release Notes" || len(entries) != 2 {
+		t.Fatalf("代码中的链接不应计入: pages=%v entries=%v", pages, entries)
+	}
+
+	backlinks, _ := GetPageBacklinks(db, &target)
+	if len(backlinks) != 1 || backlinks[0].ID != source.ID {
+		t.Fatalf("Release Notes 的反向链接应为 Home: %+v", backlinks)
+	}
+	ce, _ := GetContentEntry(db, entryID)
+	if refs, _ := GetEntryBacklinks(db, ce); len(refs) != 1 {
+		t.Fatalf("条目的反向链接应为 Home: %+v", refs)
+	}
+
+	if err := RenderPageContent(db, &source); err != nil {
+		t.Fatalf("渲染页面失败: %v", err)
+	}
+	html := source.ContentHTML
+	if !strings.Contains(html, "page=release-notes") || !strings.Contains(html, ">the notes</a>") {
+		t.Fatalf("页面链接应按标题解析: %s", html)
+	}
+	if !strings.Contains(html, "page=missing-page") || !strings.Contains(html, "entry=1") {
+		t.Fatalf("未知页面链接到将来的 slug，条目链接到本项目条目: %s", html)
+	}
+	if strings.Contains(html, "entry=2") || strings.Contains(html, "page=code") || strings.Contains(html, "page=fenced") {
+		t.Fatalf("其他项目的条目和代码中的链接不应渲染为链接: %s", html)
+	}
+}
@@ -10,16 +10,19 @@ import (
 )
 
 const (
-	PermissionNone  = 0
-	PermissionRead  = 1
-	PermissionWrite = 2
-	PermissionAdmin = 3
+	PermissionNone    = 0
+	PermissionRead    = 1
+	PermissionComment = 2
+	PermissionWrite   = 3
+	PermissionAdmin   = 4
 )
 
 func getPermissionLevel(action string) int {
 	switch action {
 	case "read":
 		return PermissionRead
+	case "comment":
+		return PermissionComment
 	case "write":
 		return PermissionWrite
 	case "admin":
@@ -121,6 +124,29 @@ func GetProjectsForUser(db types.Conn, userID int64) ([]Project, error) {
 	return projects, nil
 }
 
+// readableIDs returns the IDs of the content of contentType that userID holds at least read
+// permission on.
+func readableIDs(db types.Conn, userID int64, contentType string) (map[int64]bool, error) {
+	rows, err := db.Query("detail_permission", dbhelper.Cond().Eq("user_id", userID).Eq("content_type", contentType).Build())
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[int64]bool)
+	for _, data := range rows.All() {
+		if getPermissionLevel(asString(data["action"])) < PermissionRead {
+			continue
+		}
+		var contentIDs []int64
+		if err := json.Unmarshal([]byte(asString(data["content_ids"])), &contentIDs); err != nil {
+			continue
+		}
+		for _, id := range contentIDs {
+			ids[id] = true
+		}
+	}
+	return ids, nil
+}
+
 func GetContentListsForProject(db types.Conn, projectID int64) ([]ContentList, error) {
 	cond := dbhelper.Cond().Eq("project_id", projectID).Build()
 	rows, err := db.Query("content_list", cond)
@@ -140,3 +166,55 @@ func GetContentListsForProject(db types.Conn, projectID int64) ([]ContentList, e
 
 	return lists, nil
 }
+
+// GetProjectPermissions returns every user with access to the project and their highest permission level,
+// ordered by user ID.
+func GetProjectPermissions(db types.Conn, projectID int64) ([]ProjectPermission, error) {
+	cond := dbhelper.Cond().Eq("content_type", "project").Build()
+	rows, err := db.Query("detail_permission", cond)
+	if err != nil {
+		return []ProjectPermission{}, err
+	}
+
+	permMap := make(map[int64]string) // userID -> permission level
+	for _, data := range rows.All() {
+		contentIDsJson := data["content_ids"].(string)
+		var contentIDs []int64
+		json.Unmarshal([]byte(contentIDsJson), &contentIDs)
+
+		for _, id := range contentIDs {
+			if id == projectID {
+				userID := data["user_id"].(int64)
+				action := data["action"].(string)
+
+				// Keep the highest permission level
+				if existing, ok := permMap[userID]; !ok || getPermissionLevel(action) > getPermissionLevel(existing) {
+					permMap[userID] = action
+				}
+			}
+		}
+	}
+
+	userIDs := make([]int64, 0, len(permMap))
+	for userID := range permMap {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Slice(userIDs, func(i, j int) bool {
+		return userIDs[i] < userIDs[j]
+	})
+
+	permissions := make([]ProjectPermission, 0, len(userIDs))
+	for _, userID := range userIDs {
+		u, err := GetUser(db, userID)
+		if err != nil {
+			continue // skip if not found
+		}
+		permissions = append(permissions, ProjectPermission{
+			UserID:          userID,
+			Username:        u.Username,
+			Email:           u.Email,
+			PermissionLevel: permMap[userID],
+		})
+	}
+	return permissions, nil
+}
@@ -0,0 +1,766 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+const (
+	// ProjectArchiveFormat identifies a project archive.
+	ProjectArchiveFormat = "liteboard.project"
+	// ProjectArchiveVersion is the archive version written by this build. Imports accept this
+	// version and older ones.
+	ProjectArchiveVersion = 1
+
+	// projectArchiveManifest is the name of the archive JSON inside a zip archive.
+	projectArchiveManifest = "project.json"
+	// projectArchiveBlobDir holds the attachment contents inside a zip archive, named by hash.
+	projectArchiveBlobDir = "blobs/"
+)
+
+// maxProjectArchiveManifest bounds the size of the archive JSON inside a zip archive, so that a
+// small zip cannot expand into more memory than an import may use.
+var maxProjectArchiveManifest int64 = 64 << 20
+
+// BuildProjectArchive collects everything belonging to a project: lists (including archived
+// ones), entries with their labels and custom field values, comments, attachment records,
+// relations between its entries, wiki pages, permissions on the project and its content, and
+// share links. Notifications, webhooks, the sidebar and the sync change log are not included.
+func BuildProjectArchive(db types.Conn, projectID int64) (*ProjectArchive, error) {
+	p, err := GetProject(db, projectID)
+	if err != nil {
+		return nil, err
+	}
+	a := &ProjectArchive{
+		Format:      ProjectArchiveFormat,
+		Version:     ProjectArchiveVersion,
+		ExportedAt:  time.Now().Unix(),
+		Project:     *p,
+		Users:       []ArchiveUser{},
+		Comments:    []EntryComment{},
+		Attachments: []Attachment{},
+		Relations:   []EntryRelation{},
+		Permissions: []ArchivePermission{},
+	}
+	users := make(map[int64]bool)
+	useUser := func(id int64) {
+		if id != 0 {
+			users[id] = true
+		}
+	}
+	useUser(p.CreatorID)
+	useUser(p.UpdatedBy)
+
+	if a.Labels, err = GetLabelsByProject(db, projectID); err != nil {
+		return nil, err
+	}
+	if a.CustomFields, err = GetCustomFieldsByProject(db, projectID); err != nil {
+		return nil, err
+	}
+	fieldTypes := make(map[int64]string, len(a.CustomFields))
+	for _, f := range a.CustomFields {
+		fieldTypes[f.ID] = f.Type
+	}
+	if a.Lists, err = GetContentListsByProject(db, projectID); err != nil {
+		return nil, err
+	}
+	sort.Slice(a.Lists, func(i, j int) bool { return a.Lists[i].ID < a.Lists[j].ID })
+	for _, cl := range a.Lists {
+		useUser(cl.CreatorID)
+		useUser(cl.UpdatedBy)
+	}
+
+	entries, err := GetContentEntries(db)
+	if err != nil {
+		return nil, err
+	}
+	a.Entries = []ContentEntry{}
+	inProject := make(map[int64]bool)
+	for _, ce := range entries {
+		if ce.ProjectID != projectID {
+			continue
+		}
+		inProject[ce.ID] = true
+		a.Entries = append(a.Entries, ce)
+		useUser(ce.CreatorID)
+		useUser(ce.UpdatedBy)
+		for _, id := range ce.Assignees {
+			useUser(id)
+		}
+		for _, v := range ce.CustomFields {
+			if id, ok := v.Value.(int64); ok && fieldTypes[v.FieldID] == CustomFieldTypeUser {
+				useUser(id)
+			}
+		}
+		comments, err := GetEntryComments(db, ce.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, ec := range comments {
+			useUser(ec.AuthorID)
+			a.Comments = append(a.Comments, ec)
+		}
+		attachments, err := GetAttachmentsByEntry(db, ce.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, at := range attachments {
+			useUser(at.UploaderID)
+			a.Attachments = append(a.Attachments, at)
+		}
+	}
+	sort.Slice(a.Entries, func(i, j int) bool { return a.Entries[i].ID < a.Entries[j].ID })
+	sort.Slice(a.Comments, func(i, j int) bool { return a.Comments[i].ID < a.Comments[j].ID })
+	sort.Slice(a.Attachments, func(i, j int) bool { return a.Attachments[i].ID < a.Attachments[j].ID })
+
+	rows, err := db.Query("entry_relation", nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range rows.All() {
+		r := entryRelationFromRow(data)
+		if inProject[r.SourceID] && inProject[r.TargetID] {
+			useUser(r.CreatorID)
+			a.Relations = append(a.Relations, r)
+		}
+	}
+	sort.Slice(a.Relations, func(i, j int) bool { return a.Relations[i].ID < a.Relations[j].ID })
+
+	if a.Pages, err = GetPagesByProject(db, projectID); err != nil {
+		return nil, err
+	}
+	sort.Slice(a.Pages, func(i, j int) bool { return a.Pages[i].ID < a.Pages[j].ID })
+	for _, pg := range a.Pages {
+		useUser(pg.AuthorID)
+	}
+
+	// 权限按单个对象展开，只保留属于本项目的对象
+	owned := map[string]map[int64]bool{"project": {projectID: true}, "content_list": {}, "content_entry": inProject}
+	for _, cl := range a.Lists {
+		owned["content_list"][cl.ID] = true
+	}
+	dps, err := GetDetailPermissions(db)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(dps, func(i, j int) bool { return dps[i].ID < dps[j].ID })
+	for _, dp := range dps {
+		for _, id := range dp.ContentIDs {
+			if owned[dp.ContentType][id] {
+				useUser(dp.UserID)
+				a.Permissions = append(a.Permissions, ArchivePermission{UserID: dp.UserID, ContentType: dp.ContentType, ContentID: id, Action: dp.Action})
+			}
+		}
+	}
+
+	if a.ShareTokens, err = GetShareTokensByProjectID(db, projectID); err != nil {
+		return nil, err
+	}
+	for _, st := range a.ShareTokens {
+		useUser(st.CreatorID)
+	}
+
+	userRows, err := db.Query("user", nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range userRows.All() {
+		if id := asInt64(data["id"]); users[id] {
+			a.Users = append(a.Users, ArchiveUser{ID: id, Username: asString(data["username"]), Email: asString(data["email"]), OpenID: asString(data["openid"])})
+		}
+	}
+	sort.Slice(a.Users, func(i, j int) bool { return a.Users[i].ID < a.Users[j].ID })
+	return a, nil
+}
+
+// WriteProjectArchive writes the archive as a zip file holding project.json and, when store is not
+// nil, the attachment contents under blobs/<hash>. Attachments whose blob is missing from the store
+// are left out of the zip.
+func WriteProjectArchive(ctx context.Context, store BlobStore, a *ProjectArchive, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	manifest, err := zw.Create(projectArchiveManifest)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(manifest)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(a); err != nil {
+		return err
+	}
+	if store != nil {
+		written := make(map[string]bool)
+		for _, at := range a.Attachments {
+			if written[at.Hash] {
+				continue
+			}
+			written[at.Hash] = true
+			body, err := store.Get(ctx, at.Hash, 0, -1)
+			if errors.Is(err, ErrBlobNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			f, err := zw.CreateHeader(&zip.FileHeader{Name: projectArchiveBlobDir + at.Hash, Method: zip.Store})
+			if err == nil {
+				_, err = io.Copy(f, body)
+			}
+			body.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// ReadProjectArchive parses a project archive, either a zip written by WriteProjectArchive or the
+// bare JSON. It returns the attachment contents found in the zip by hash. A zip whose archive JSON
+// expands beyond maxProjectArchiveManifest is rejected.
+func ReadProjectArchive(data []byte) (*ProjectArchive, map[string]*zip.File, error) {
+	blobs := make(map[string]*zip.File)
+	manifest := data
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		manifest = nil
+		for _, f := range zr.File {
+			switch {
+			case f.Name == projectArchiveManifest:
+				manifest, err = readArchiveFile(f, maxProjectArchiveManifest)
+				if err != nil {
+					return nil, nil, err
+				}
+			case strings.HasPrefix(f.Name, projectArchiveBlobDir):
+				blobs[strings.TrimPrefix(f.Name, projectArchiveBlobDir)] = f
+			}
+		}
+		if manifest == nil {
+			return nil, nil, fmt.Errorf("%w: %s missing from zip", ErrInvalidImport, projectArchiveManifest)
+		}
+	}
+	var a ProjectArchive
+	if err := json.Unmarshal(manifest, &a); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	if a.Format != ProjectArchiveFormat {
+		return nil, nil, fmt.Errorf("%w: not a Liteboard project archive", ErrInvalidImport)
+	}
+	if a.Version < 1 || a.Version > ProjectArchiveVersion {
+		return nil, nil, fmt.Errorf("%w: archive version %d is not supported, this instance reads up to version %d", ErrInvalidImport, a.Version, ProjectArchiveVersion)
+	}
+	return &a, blobs, nil
+}
+
+// readArchiveFile reads a file of a zip archive, rejecting it once it is larger than limit bytes
+// whatever its header claims. A limit of 0 or less means no limit.
+func readArchiveFile(f *zip.File, limit int64) ([]byte, error) {
+	if limit > 0 && f.UncompressedSize64 > uint64(limit) {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrInvalidImport, f.Name, limit)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	defer rc.Close()
+	var r io.Reader = rc
+	if limit > 0 {
+		r = io.LimitReader(rc, limit+1)
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	if limit > 0 && int64(len(content)) > limit {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrInvalidImport, f.Name, limit)
+	}
+	return content, nil
+}
+
+// ImportProjectArchive creates a new project owned by ownerID from a project archive. Every ID is
+// remapped, including list items, archived positions, comment threads, page parents, relations and
+// #<id> entry links in markdown. Users are matched by OpenID, then by email; unmatched users are
+// reported, their permissions dropped, their assignments cleared and the objects they created
+// attributed to ownerID. Share links whose token is already in use here are skipped. Attachment
+// contents are stored in store; without one, attachments are skipped. Like uploads, attachments
+// are typed by their content and skipped when limits rejects their size or type. Either the whole
+// project is imported or nothing is (see runInTx).
+func ImportProjectArchive(ctx context.Context, db types.Conn, store BlobStore, limits AttachmentLimits, data []byte, ownerID int64) (*ImportReport, error) {
+	a, blobs, err := ReadProjectArchive(data)
+	if err != nil {
+		return nil, err
+	}
+	var report *ImportReport
+	err = runInTx(db, "ImportProjectArchive", func(db types.Conn) error {
+		im := &archiveImporter{ctx: ctx, db: db, store: store, limits: limits, blobs: blobs, ownerID: ownerID,
+			report: &ImportReport{Skipped: []ImportSkip{}, UnmatchedUsers: []ArchiveUser{}}}
+		report = im.report
+		return im.run(a)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+type archiveImporter struct {
+	ctx     context.Context
+	db      types.Conn
+	store   BlobStore
+	limits  AttachmentLimits
+	blobs   map[string]*zip.File
+	ownerID int64
+	report  *ImportReport
+
+	users   map[int64]int64 // 存档中的用户 ID -> 本实例的用户 ID，未匹配的不在其中
+	labels  map[int64]int64
+	fields  map[int64]CustomField
+	lists   map[int64]int64
+	entries map[int64]int64
+}
+
+func (im *archiveImporter) skip(typ string, id int64, name, reason string) {
+	im.report.Skipped = append(im.report.Skipped, ImportSkip{Type: typ, ID: strconv.FormatInt(id, 10), Name: name, Reason: reason})
+}
+
+// user maps an archived user ID; unmatched users map to the importing user and 0 stays 0.
+func (im *archiveImporter) user(id int64) int64 {
+	if mapped, ok := im.users[id]; ok || id == 0 {
+		return mapped
+	}
+	return im.ownerID
+}
+
+func (im *archiveImporter) run(a *ProjectArchive) error {
+	if err := im.matchUsers(a.Users); err != nil {
+		return err
+	}
+	db := im.db
+
+	p := a.Project
+	p.ID = 0
+	p.CreatorID = im.user(p.CreatorID)
+	id, err := CreateProject(db, &p)
+	if err != nil {
+		return err
+	}
+	p.ID = id
+	im.report.Project = p
+
+	im.labels = make(map[int64]int64, len(a.Labels))
+	for _, l := range a.Labels {
+		oldID := l.ID
+		l.ProjectID = p.ID
+		if im.labels[oldID], err = CreateLabel(db, &l); err != nil {
+			return err
+		}
+		im.report.Labels++
+	}
+	im.fields = make(map[int64]CustomField, len(a.CustomFields))
+	for _, f := range a.CustomFields {
+		oldID := f.ID
+		f.ProjectID = p.ID
+		if f.ID, err = CreateCustomField(db, &f); err != nil {
+			return err
+		}
+		im.fields[oldID] = f
+	}
+
+	im.entries = make(map[int64]int64, len(a.Entries))
+	for _, ce := range a.Entries {
+		if err := im.importEntry(ce, p.ID); err != nil {
+			return err
+		}
+	}
+	// 所有条目创建后才能改写内容中指向其他条目的链接
+	for _, ce := range a.Entries {
+		content := remapEntryLinks(ce.Content, im.entries)
+		if content == ce.Content {
+			continue
+		}
+		if _, err := db.Update("content_entry", dbhelper.Cond().Eq("id", im.entries[ce.ID]).Build(), dbhelper.Cond().Eq("content", content).Build()); err != nil {
+			return err
+		}
+	}
+	im.lists = make(map[int64]int64, len(a.Lists))
+	for _, cl := range a.Lists {
+		oldID := cl.ID
+		cl.ID = 0
+		cl.ProjectID = p.ID
+		cl.CreatorID = im.user(cl.CreatorID)
+		items := make([]int64, 0, len(cl.Items))
+		for _, itemID := range cl.Items {
+			if newID, ok := im.entries[itemID]; ok {
+				items = append(items, newID)
+			}
+		}
+		cl.Items = items
+		newID, err := CreateContentList(db, &cl)
+		if err != nil {
+			return err
+		}
+		im.lists[oldID] = newID
+		if cl.ArchivedAt != 0 {
+			if err := setListArchive(db, newID, cl.ArchivedAt); err != nil {
+				return err
+			}
+		}
+		if err := restoreTimestamps(db, "content_list", newID, cl.Timestamps, im.user(cl.UpdatedBy)); err != nil {
+			return err
+		}
+		im.report.Lists++
+	}
+	for _, ce := range a.Entries {
+		if ce.ArchivedAt == 0 {
+			continue
+		}
+		newID := im.entries[ce.ID]
+		if err := setEntryArchive(db, newID, ce.ArchivedAt, im.lists[ce.ArchivedListID], ce.ArchivedPosition); err != nil {
+			return err
+		}
+		if err := restoreTimestamps(db, "content_entry", newID, ce.Timestamps, im.user(ce.UpdatedBy)); err != nil {
+			return err
+		}
+	}
+
+	if err := im.importComments(a.Comments); err != nil {
+		return err
+	}
+	if err := im.importAttachments(a.Attachments, p.ID); err != nil {
+		return err
+	}
+	for _, r := range a.Relations {
+		oldID := r.ID
+		src, okSrc := im.entries[r.SourceID]
+		dst, okDst := im.entries[r.TargetID]
+		if !okSrc || !okDst {
+			im.skip("relation", oldID, r.Type, "entry not in the archive")
+			continue
+		}
+		r.SourceID, r.TargetID, r.CreatorID = src, dst, im.user(r.CreatorID)
+		if _, err := CreateEntryRelation(db, &r); err != nil {
+			return err
+		}
+	}
+	if err := im.importPages(a.Pages, p.ID); err != nil {
+		return err
+	}
+	if err := im.importPermissions(a.Permissions, a.Project.ID, p.ID); err != nil {
+		return err
+	}
+	for _, st := range a.ShareTokens {
+		if _, err := GetShareToken(db, st.Token); err == nil {
+			im.skip("share_token", st.ID, st.PermissionLevel, "share link token is already in use on this instance")
+			continue
+		}
+		st.ProjectID = p.ID
+		st.CreatorID = im.user(st.CreatorID)
+		if _, err := CreateShareToken(db, &st); err != nil {
+			return err
+		}
+	}
+	return restoreTimestamps(db, "project", p.ID, a.Project.Timestamps, im.user(a.Project.UpdatedBy))
+}
+
+// matchUsers maps the archived users to local users by OpenID, then case-insensitively by email.
+func (im *archiveImporter) matchUsers(users []ArchiveUser) error {
+	rows, err := im.db.Query("user", nil)
+	if err != nil {
+		return err
+	}
+	byOpenID := make(map[string]int64)
+	byEmail := make(map[string]int64)
+	for _, data := range rows.All() {
+		id := asInt64(data["id"])
+		if openID := asString(data["openid"]); openID != "" {
+			byOpenID[openID] = id
+		}
+		if email := strings.ToLower(asString(data["email"])); email != "" {
+			if _, ok := byEmail[email]; !ok {
+				byEmail[email] = id
+			}
+		}
+	}
+	im.users = make(map[int64]int64, len(users))
+	for _, u := range users {
+		if id, ok := byOpenID[u.OpenID]; ok && u.OpenID != "" {
+			im.users[u.ID] = id
+		} else if id, ok := byEmail[strings.ToLower(u.Email)]; ok && u.Email != "" {
+			im.users[u.ID] = id
+		} else {
+			im.report.UnmatchedUsers = append(im.report.UnmatchedUsers, u)
+		}
+	}
+	return nil
+}
+
+func (im *archiveImporter) importEntry(ce ContentEntry, projectID int64) error {
+	db := im.db
+	oldID := ce.ID
+	saved := ce.Timestamps
+	ce.ID = 0
+	ce.ProjectID = projectID
+	ce.CreatorID = im.user(ce.CreatorID)
+	assignees := make([]int64, 0, len(ce.Assignees))
+	for _, id := range ce.Assignees {
+		if mapped, ok := im.users[id]; ok {
+			assignees = append(assignees, mapped)
+		}
+	}
+	ce.Assignees = assignees
+	id, err := CreateContentEntry(db, &ce)
+	if err != nil {
+		return err
+	}
+	im.entries[oldID] = id
+	for _, labelID := range ce.Labels {
+		if newLabelID, ok := im.labels[labelID]; ok {
+			if _, err := addEntryLabel(db, id, newLabelID); err != nil {
+				return err
+			}
+		}
+	}
+	for _, v := range ce.CustomFields {
+		f, ok := im.fields[v.FieldID]
+		if !ok {
+			continue
+		}
+		value, ok := im.fieldValue(&f, v.Value)
+		if !ok {
+			continue
+		}
+		if err := setCustomFieldValue(db, id, &f, value); err != nil {
+			return err
+		}
+	}
+	if err := restoreTimestamps(db, "content_entry", id, saved, im.user(saved.UpdatedBy)); err != nil {
+		return err
+	}
+	im.report.Entries++
+	return nil
+}
+
+// fieldValue converts a custom field value decoded from the archive JSON back to its stored type.
+// User values of unmatched users are dropped.
+func (im *archiveImporter) fieldValue(f *CustomField, raw interface{}) (interface{}, bool) {
+	switch f.Type {
+	case CustomFieldTypeNumber:
+		n, ok := raw.(float64)
+		return n, ok
+	case CustomFieldTypeDate:
+		n, ok := raw.(float64)
+		return int64(n), ok
+	case CustomFieldTypeUser:
+		n, ok := raw.(float64)
+		if !ok {
+			return nil, false
+		}
+		id, ok := im.users[int64(n)]
+		return id, ok
+	case CustomFieldTypeMultiSelect:
+		items, ok := raw.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		values := make([]string, 0, len(items))
+		for _, item := range items {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values, true
+	}
+	s, ok := raw.(string)
+	return s, ok
+}
+
+func (im *archiveImporter) importComments(comments []EntryComment) error {
+	mapped := make(map[int64]int64, len(comments))
+	for _, ec := range comments {
+		oldID := ec.ID
+		entryID, ok := im.entries[ec.EntryID]
+		if !ok {
+			im.skip("comment", oldID, "", "entry not in the archive")
+			continue
+		}
+		ec.EntryID = entryID
+		ec.ParentID = mapped[ec.ParentID]
+		ec.AuthorID = im.user(ec.AuthorID)
+		ec.Body = remapEntryLinks(ec.Body, im.entries)
+		mentions := make([]int64, 0, len(ec.Mentions))
+		for _, id := range ec.Mentions {
+			if userID, ok := im.users[id]; ok {
+				mentions = append(mentions, userID)
+			}
+		}
+		ec.Mentions = mentions
+		newID, err := CreateEntryComment(im.db, &ec)
+		if err != nil {
+			return err
+		}
+		mapped[oldID] = newID
+		if ec.Deleted {
+			if _, err := im.db.Update("entry_comment", dbhelper.Cond().Eq("id", newID).Build(), dbhelper.Cond().Eq("deleted", 1).Build()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (im *archiveImporter) importAttachments(attachments []Attachment, projectID int64) error {
+	for _, at := range attachments {
+		oldID := at.ID
+		entryID, ok := im.entries[at.EntryID]
+		if !ok {
+			im.skip("attachment", oldID, at.Filename, "entry not in the archive")
+			continue
+		}
+		f, ok := im.blobs[at.Hash]
+		if !ok || im.store == nil {
+			im.skip("attachment", oldID, at.Filename, "file content not in the archive or no attachment storage configured")
+			continue
+		}
+		if im.limits.MaxSize > 0 && f.UncompressedSize64 > uint64(im.limits.MaxSize) {
+			im.skip("attachment", oldID, at.Filename, fmt.Sprintf("%v: %d bytes exceeds the limit of %d bytes", ErrAttachmentTooLarge, f.UncompressedSize64, im.limits.MaxSize))
+			continue
+		}
+		content, err := readArchiveFile(f, im.limits.MaxSize)
+		if err != nil {
+			return err
+		}
+		// 与上传一致，按内容识别类型并检查大小和类型，不信任存档中记录的类型
+		head := content
+		if len(head) > 512 {
+			head = head[:512]
+		}
+		at.ContentType = DetectAttachmentType(head, at.ContentType)
+		if err := im.limits.CheckAttachment(int64(len(content)), at.ContentType); err != nil {
+			im.skip("attachment", oldID, at.Filename, err.Error())
+			continue
+		}
+		at.ID = 0
+		at.EntryID = entryID
+		at.ProjectID = projectID
+		at.Size = int64(len(content))
+		at.UploaderID = im.user(at.UploaderID)
+		if _, err := CreateAttachmentWithBlob(im.ctx, im.db, im.store, &at, bytes.NewReader(content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importPages creates the pages first and sets their parents afterwards, since a page may have
+// been moved under a page created after it.
+func (im *archiveImporter) importPages(pages []Page, projectID int64) error {
+	mapped := make(map[int64]int64, len(pages))
+	for _, pg := range pages {
+		oldID := pg.ID
+		pg.ProjectID = projectID
+		pg.ParentID = 0
+		pg.AuthorID = im.user(pg.AuthorID)
+		pg.Body = remapEntryLinks(pg.Body, im.entries)
+		newID, err := CreatePage(im.db, &pg)
+		if err != nil {
+			return err
+		}
+		mapped[oldID] = newID
+	}
+	for _, pg := range pages {
+		parentID, ok := mapped[pg.ParentID]
+		if pg.ParentID == 0 || !ok {
+			continue
+		}
+		page, err := GetPage(im.db, mapped[pg.ID])
+		if err != nil {
+			return err
+		}
+		page.ParentID = parentID
+		if err := UpdatePage(im.db, page.ID, page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importPermissions grants the archived permissions of matched users and makes sure the importing
+// user administers the new project and every imported list and entry.
+func (im *archiveImporter) importPermissions(perms []ArchivePermission, oldProjectID, projectID int64) error {
+	ids := map[string]map[int64]int64{"project": {oldProjectID: projectID}, "content_list": im.lists, "content_entry": im.entries}
+	granted := make(map[ArchivePermission]bool)
+	grant := func(perm ArchivePermission) error {
+		if granted[perm] {
+			return nil
+		}
+		granted[perm] = true
+		return grantDetailPermission(im.db, perm.UserID, perm.ContentType, perm.ContentID, perm.Action)
+	}
+	for _, perm := range perms {
+		userID, ok := im.users[perm.UserID]
+		if !ok {
+			continue
+		}
+		contentID, ok := ids[perm.ContentType][perm.ContentID]
+		if !ok {
+			continue
+		}
+		if err := grant(ArchivePermission{UserID: userID, ContentType: perm.ContentType, ContentID: contentID, Action: perm.Action}); err != nil {
+			return err
+		}
+	}
+	for _, action := range []string{"admin", "read"} {
+		if err := grant(ArchivePermission{UserID: im.ownerID, ContentType: "project", ContentID: projectID, Action: action}); err != nil {
+			return err
+		}
+		// 权限不从项目继承到列表和条目
+		for _, contentType := range []string{"content_list", "content_entry"} {
+			for _, contentID := range ids[contentType] {
+				if err := grant(ArchivePermission{UserID: im.ownerID, ContentType: contentType, ContentID: contentID, Action: action}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// remapEntryLinks rewrites #<entry id> links in markdown to the IDs of the imported entries.
+func remapEntryLinks(text string, entries map[int64]int64) string {
+	return entryLinkPattern.ReplaceAllStringFunc(text, func(match string) string {
+		m := entryLinkPattern.FindStringSubmatch(match)
+		oldID, err := strconv.ParseInt(m[2], 10, 64)
+		if err != nil {
+			return match
+		}
+		newID, ok := entries[oldID]
+		if !ok {
+			return match
+		}
+		return m[1] + "#" + strconv.FormatInt(newID, 10)
+	})
+}
+
+// restoreTimestamps sets the created and updated times of an imported row to the archived ones.
+func restoreTimestamps(db types.Conn, table string, id int64, ts Timestamps, updatedBy int64) error {
+	if ts.CreatedAt == 0 {
+		return nil
+	}
+	upd := dbhelper.Cond().Eq("created_at", ts.CreatedAt).Eq("updated_at", ts.UpdatedAt).Eq("updated_by", updatedBy).Build()
+	_, err := db.Update(table, dbhelper.Cond().Eq("id", id).Build(), upd)
+	return err
+}
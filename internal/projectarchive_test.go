@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestProjectArchiveRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := newTestDB(t)
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建存储失败: %v", err)
+	}
+	CreateUserInternal(src, &UserInternal{Username: "alice", Email: "alice@example.com"})
+	CreateUserInternal(src, &UserInternal{Username: "bob", Email: "bob@old.example.com", OpenID: "oid-bob"})
+	CreateUserInternal(src, &UserInternal{Username: "carol", Email: "carol@example.com"})
+
+	projectID, _ := CreateProject(src, &Project{Name: "Launch", CreatorID: 1})
+	labelID, _ := CreateLabel(src, &Label{Name: "Bug", Color: "#ff0000", ProjectID: projectID})
+	field := &CustomField{Name: "Owner", Type: CustomFieldTypeUser, ProjectID: projectID}
+	field.ID, _ = CreateCustomField(src, field)
+	e1, _ := CreateContentEntry(src, &ContentEntry{Title: "Spec", Content: "depends on #2 and #99", CreatorID: 2, ProjectID: projectID, Assignees: []int64{2, 3}})
+	e2, _ := CreateContentEntry(src, &ContentEntry{Title: "Old", CreatorID: 1, ProjectID: projectID})
+	e3, _ := CreateContentEntry(src, &ContentEntry{Title: "Build", CreatorID: 3, ProjectID: projectID})
+	AddEntryLabel(src, e1, labelID, 1)
+	SetCustomFieldValue(src, e1, field, int64(2), 1)
+	CreateContentList(src, &ContentList{Title: "Todo", ProjectID: projectID, Items: []int64{e1, e2, e3}})
+	ArchiveContentEntry(src, e2, 100)
+	parent, _ := CreateEntryComment(src, &EntryComment{EntryID: e1, AuthorID: 2, Body: "see #3", Mentions: []int64{3}})
+	CreateEntryComment(src, &EntryComment{EntryID: e1, ParentID: parent, AuthorID: 1, Body: "ok"})
+	CreateEntryRelation(src, &EntryRelation{SourceID: e1, TargetID: e3, Type: RelationBlocks, CreatorID: 1})
+	root, _ := CreatePage(src, &Page{ProjectID: projectID, Title: "Home", Body: "start at #1", AuthorID: 1})
+	CreatePage(src, &Page{ProjectID: projectID, ParentID: root, Title: "Notes", AuthorID: 3})
+	CreateDetailPermission(src, &DetailPermission{UserID: 1, ContentType: "project", ContentIDs: []int64{projectID}, Action: "admin"})
+	CreateDetailPermission(src, &DetailPermission{UserID: 2, ContentType: "project", ContentIDs: []int64{projectID, 42}, Action: "write"})
+	CreateDetailPermission(src, &DetailPermission{UserID: 3, ContentType: "content_entry", ContentIDs: []int64{e3}, Action: "write"})
+	CreateShareToken(src, &ShareToken{Token: "share-1", ProjectID: projectID, PermissionLevel: "read", CreatorID: 1})
+	content := []byte("hello attachment")
+	hash, err := StoreAttachmentBlob(ctx, store, bytes.NewReader(content), int64(len(content)), "text/plain")
+	if err != nil {
+		t.Fatalf("写入附件失败: %v", err)
+	}
+	CreateAttachment(src, &Attachment{EntryID: e1, ProjectID: projectID, Filename: "a.txt", ContentType: "text/plain", Size: int64(len(content)), Hash: hash, UploaderID: 1})
+
+	archive, err := BuildProjectArchive(src, projectID)
+	if err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+	if len(archive.Entries) != 3 || len(archive.Lists) != 1 || len(archive.Users) != 3 || len(archive.Comments) != 2 || len(archive.Pages) != 2 {
+		t.Fatalf("存档内容不完整: %+v", archive)
+	}
+	for _, perm := range archive.Permissions {
+		if perm.ContentID == 42 {
+			t.Fatal("不属于本项目的权限不应导出")
+		}
+	}
+	var buf bytes.Buffer
+	if err := WriteProjectArchive(ctx, store, archive, &buf); err != nil {
+		t.Fatalf("写入存档失败: %v", err)
+	}
+
+	// 导入到另一个实例：bob 按 OpenID 匹配，alice 按邮箱匹配（忽略大小写），carol 未匹配
+	dst := newTestDB(t)
+	dstStore, _ := NewLocalBlobStore(t.TempDir())
+	CreateUserInternal(dst, &UserInternal{Username: "dave"})
+	CreateUserInternal(dst, &UserInternal{Username: "alice2", Email: "Alice@Example.com"})
+	CreateUserInternal(dst, &UserInternal{Username: "bob2", Email: "bob@new.example.com", OpenID: "oid-bob"})
+	report, err := ImportProjectArchive(ctx, dst, dstStore, DefaultAttachmentLimits, buf.Bytes(), 1)
+	if err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+	if report.Lists != 1 || report.Entries != 3 || report.Labels != 1 || len(report.UnmatchedUsers) != 1 || report.UnmatchedUsers[0].Username != "carol" || len(report.Skipped) != 0 {
+		t.Fatalf("导入报告不正确: %+v", report)
+	}
+	p := report.Project
+	if p.Name != "Launch" || p.CreatorID != 2 {
+		t.Fatalf("项目不正确: %+v", p)
+	}
+	lists, _ := GetContentListsByProject(dst, p.ID)
+	if len(lists) != 1 || len(lists[0].Items) != 2 {
+		t.Fatalf("列表条目应重新映射: %+v", lists)
+	}
+	spec, _ := GetContentEntry(dst, lists[0].Items[0])
+	build, _ := GetContentEntry(dst, lists[0].Items[1])
+	if spec.Title != "Spec" || spec.CreatorID != 3 || build.CreatorID != 1 {
+		t.Fatalf("条目或创建者映射不正确: %+v %+v", spec, build)
+	}
+	if len(spec.Assignees) != 1 || spec.Assignees[0] != 3 || len(spec.Labels) != 1 {
+		t.Fatalf("未匹配用户的指派应清除，标签应保留: %+v", spec)
+	}
+	if len(spec.CustomFields) != 1 || spec.CustomFields[0].Value != int64(3) {
+		t.Fatalf("用户字段应映射到本实例的用户: %+v", spec.CustomFields)
+	}
+	archived, _ := GetArchivedItems(dst, p.ID)
+	if len(archived.Entries) != 1 || archived.Entries[0].ArchivedListID != lists[0].ID || archived.Entries[0].ArchivedPosition != 1 {
+		t.Fatalf("归档状态应保留: %+v", archived.Entries)
+	}
+	oldID := archived.Entries[0].ID
+	if want := "depends on #" + strconv.FormatInt(oldID, 10) + " and #99"; spec.Content != want {
+		t.Fatalf("条目链接应重新映射: %q, want %q", spec.Content, want)
+	}
+
+	comments, _ := GetEntryComments(dst, spec.ID)
+	if len(comments) != 2 || comments[0].Body != "see #"+strconv.FormatInt(build.ID, 10) || len(comments[0].Mentions) != 0 || comments[1].ParentID != comments[0].ID {
+		t.Fatalf("评论不正确: %+v", comments)
+	}
+	pages, _ := GetPagesByProject(dst, p.ID)
+	if len(pages) != 2 || pages[0].Body != "start at #"+strconv.FormatInt(spec.ID, 10) || pages[1].ParentID != pages[0].ID || pages[1].AuthorID != 1 {
+		t.Fatalf("页面不正确: %+v", pages)
+	}
+	attachments, _ := GetAttachmentsByEntry(dst, spec.ID)
+	if len(attachments) != 1 || attachments[0].Hash != hash {
+		t.Fatalf("附件不正确: %+v", attachments)
+	}
+	if ok, _ := dstStore.Exists(ctx, hash); !ok {
+		t.Fatal("附件内容应写入本实例的存储")
+	}
+	if ok, _ := HasPermission(dst, 3, "project", p.ID, "write"); !ok {
+		t.Fatal("已匹配用户的权限应保留")
+	}
+	if ok, _ := HasPermission(dst, 1, "project", p.ID, "admin"); !ok {
+		t.Fatal("导入者应获得项目的 admin 权限")
+	}
+	for _, action := range []string{"read", "write"} {
+		if ok, _ := HasPermission(dst, 1, "content_entry", build.ID, action); !ok {
+			t.Fatalf("导入者应能%s导入的条目", action)
+		}
+		if ok, _ := HasPermission(dst, 1, "content_list", lists[0].ID, action); !ok {
+			t.Fatalf("导入者应能%s导入的列表", action)
+		}
+	}
+	if st, err := GetShareToken(dst, "share-1"); err != nil || st.ProjectID != p.ID {
+		t.Fatalf("分享链接应导入: %v %+v", err, st)
+	}
+
+	// 导入回原实例：分享链接令牌冲突时跳过，其余照常
+	again, err := ImportProjectArchive(ctx, src, store, DefaultAttachmentLimits, buf.Bytes(), 1)
+	if err != nil || len(again.UnmatchedUsers) != 0 || len(again.Skipped) != 1 || again.Skipped[0].Type != "share_token" {
+		t.Fatalf("重复导入失败: %v %+v", err, again)
+	}
+
+	// 只有 JSON 时跳过附件
+	manifest, _ := json.Marshal(archive)
+	plain, err := ImportProjectArchive(ctx, dst, dstStore, DefaultAttachmentLimits, manifest, 1)
+	if err != nil || len(plain.Skipped) != 2 {
+		t.Fatalf("JSON 存档导入失败: %v %+v", err, plain)
+	}
+
+	bad := *archive
+	bad.Version = ProjectArchiveVersion + 1
+	manifest, _ = json.Marshal(&bad)
+	if _, err := ImportProjectArchive(ctx, dst, dstStore, DefaultAttachmentLimits, manifest, 1); !errors.Is(err, ErrInvalidImport) {
+		t.Fatalf("应拒绝更新的存档版本, got %v", err)
+	}
+	if _, err := ImportProjectArchive(ctx, dst, dstStore, DefaultAttachmentLimits, []byte(`{"format": "other", "version": 1}`), 1); !errors.Is(err, ErrInvalidImport) {
+		t.Fatalf("应拒绝其他格式, got %v", err)
+	}
+	if _, err := ImportProjectArchive(ctx, dst, dstStore, DefaultAttachmentLimits, []byte("PK\x03\x04broken"), 1); !errors.Is(err, ErrInvalidImport) {
+		t.Fatalf("应拒绝损坏的 zip, got %v", err)
+	}
+	if projects, _ := dst.Query("project", nil); projects.Count() != 2 {
+		t.Fatalf("失败的导入不应留下项目: %d", projects.Count())
+	}
+}
+
+func TestImportProjectArchiveLimits(t *testing.T) {
+	ctx := context.Background()
+	src := newTestDB(t)
+	store, _ := NewLocalBlobStore(t.TempDir())
+	projectID, _ := CreateProject(src, &Project{Name: "Launch", CreatorID: 1})
+	entryID, _ := CreateContentEntry(src, &ContentEntry{Title: "Spec", CreatorID: 1, ProjectID: projectID})
+	CreateContentList(src, &ContentList{Title: "Todo", ProjectID: projectID, Items: []int64{entryID}})
+	// 存档中记录的类型不可信：HTML 伪装成纯文本，超限的文件声明为允许的类型
+	files := map[string][]byte{
+		"ok.txt":    []byte("plain notes"),
+		"page.txt":  []byte("<html><script>alert(1)</script></html>"),
+		"large.txt": bytes.Repeat([]byte("x"), 100),
+	}
+	for name, content := range files {
+		hash, err := StoreAttachmentBlob(ctx, store, bytes.NewReader(content), int64(len(content)), "text/plain")
+		if err != nil {
+			t.Fatalf("写入附件失败: %v", err)
+		}
+		CreateAttachment(src, &Attachment{EntryID: entryID, ProjectID: projectID, Filename: name, ContentType: "text/plain", Size: int64(len(content)), Hash: hash, UploaderID: 1})
+	}
+	archive, _ := BuildProjectArchive(src, projectID)
+	var buf bytes.Buffer
+	if err := WriteProjectArchive(ctx, store, archive, &buf); err != nil {
+		t.Fatalf("写入存档失败: %v", err)
+	}
+
+	dst := newTestDB(t)
+	dstStore, _ := NewLocalBlobStore(t.TempDir())
+	limits := AttachmentLimits{MaxSize: 64, AllowedTypes: []string{"text/*"}}
+	report, err := ImportProjectArchive(ctx, dst, dstStore, limits, buf.Bytes(), 1)
+	if err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+	skipped := map[string]bool{}
+	for _, s := range report.Skipped {
+		skipped[s.Name] = s.Type == "attachment"
+	}
+	if len(report.Skipped) != 2 || !skipped["page.txt"] || !skipped["large.txt"] {
+		t.Fatalf("超限或类型不允许的附件应跳过: %+v", report.Skipped)
+	}
+	entries, _ := GetContentEntries(dst)
+	attachments, _ := GetAttachmentsByEntry(dst, entries[0].ID)
+	if len(attachments) != 1 || attachments[0].Filename != "ok.txt" || attachments[0].ContentType != "text/plain" {
+		t.Fatalf("应只导入通过检查的附件: %+v", attachments)
+	}
+
+	// 解压后超过上限的存档 JSON 直接拒绝
+	defer func(max int64) { maxProjectArchiveManifest = max }(maxProjectArchiveManifest)
+	maxProjectArchiveManifest = 64
+	if _, err := ImportProjectArchive(ctx, dst, dstStore, limits, buf.Bytes(), 1); !errors.Is(err, ErrInvalidImport) {
+		t.Fatalf("过大的存档 JSON 应被拒绝, got %v", err)
+	}
+}
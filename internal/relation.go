@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+// Relation types between content entries
+const (
+	RelationBlocks     = "blocks"
+	RelationRelatesTo  = "relates_to"
+	RelationDuplicates = "duplicates"
+)
+
+var (
+	// ErrInvalidRelation is returned when a relation's type or ends are malformed.
+	ErrInvalidRelation = errors.New("invalid relation")
+	// ErrRelationExists is returned when the same relation is added twice.
+	ErrRelationExists = errors.New("relation already exists")
+	// ErrRelationCycle is returned when a blocks relation would close a cycle.
+	ErrRelationCycle = errors.New("relation would create a blocks cycle")
+)
+
+// ValidateRelation checks the type and that the relation links two different entries.
+func ValidateRelation(r *EntryRelation) error {
+	switch r.Type {
+	case RelationBlocks, RelationRelatesTo, RelationDuplicates:
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidRelation, r.Type)
+	}
+	if r.SourceID == 0 || r.TargetID == 0 {
+		return fmt.Errorf("%w: source and target are required", ErrInvalidRelation)
+	}
+	if r.SourceID == r.TargetID {
+		return fmt.Errorf("%w: an entry cannot relate to itself", ErrInvalidRelation)
+	}
+	return nil
+}
+
+// CheckRelationAllowed reports ErrRelationExists if the relation is already recorded (relates_to
+// counts in both directions) and ErrRelationCycle if a blocks relation would close a cycle.
+func CheckRelationAllowed(db types.Conn, r *EntryRelation) error {
+	relations, err := getRelationsByType(db, r.Type)
+	if err != nil {
+		return err
+	}
+	next := make(map[int64][]int64)
+	for _, existing := range relations {
+		if existing.SourceID == r.SourceID && existing.TargetID == r.TargetID {
+			return ErrRelationExists
+		}
+		if r.Type == RelationRelatesTo && existing.SourceID == r.TargetID && existing.TargetID == r.SourceID {
+			return ErrRelationExists
+		}
+		next[existing.SourceID] = append(next[existing.SourceID], existing.TargetID)
+	}
+	if r.Type != RelationBlocks {
+		return nil
+	}
+
+	// 从 target 沿 blocks 边出发，若能回到 source 则新关系会成环
+	visited := map[int64]bool{r.TargetID: true}
+	stack := []int64{r.TargetID}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, n := range next[id] {
+			if n == r.SourceID {
+				return fmt.Errorf("%w: entry %d already depends on entry %d", ErrRelationCycle, r.SourceID, r.TargetID)
+			}
+			if !visited[n] {
+				visited[n] = true
+				stack = append(stack, n)
+			}
+		}
+	}
+	return nil
+}
+
+// GetRelationGraph walks relations in both directions from rootID up to depth hops. Entries for
+// which canRead returns false are neither returned nor traversed, so every returned relation has
+// two readable ends.
+func GetRelationGraph(db types.Conn, rootID int64, depth int, canRead func(entryID int64) (bool, error)) (*RelationGraph, error) {
+	rows, err := db.Query("entry_relation", nil)
+	if err != nil {
+		return nil, err
+	}
+	byEntry := make(map[int64][]EntryRelation)
+	for _, data := range rows.All() {
+		r := entryRelationFromRow(data)
+		byEntry[r.SourceID] = append(byEntry[r.SourceID], r)
+		byEntry[r.TargetID] = append(byEntry[r.TargetID], r)
+	}
+
+	readable := map[int64]bool{rootID: true}
+	checked := map[int64]bool{rootID: true}
+	seenRelation := make(map[int64]bool)
+	graph := &RelationGraph{RootID: rootID, Entries: []ContentEntry{}, Relations: []EntryRelation{}}
+
+	frontier := []int64{rootID}
+	for level := 0; level < depth && len(frontier) > 0; level++ {
+		var nextFrontier []int64
+		for _, id := range frontier {
+			for _, r := range byEntry[id] {
+				if seenRelation[r.ID] {
+					continue
+				}
+				other := r.TargetID
+				if other == id {
+					other = r.SourceID
+				}
+				if !checked[other] {
+					checked[other] = true
+					ok, err := canRead(other)
+					if err != nil {
+						return nil, err
+					}
+					readable[other] = ok
+					if ok {
+						nextFrontier = append(nextFrontier, other)
+					}
+				}
+				if !readable[other] {
+					continue
+				}
+				seenRelation[r.ID] = true
+				graph.Relations = append(graph.Relations, r)
+			}
+		}
+		frontier = nextFrontier
+	}
+
+	ids := make([]int64, 0, len(readable))
+	for id, ok := range readable {
+		if ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		ce, err := GetContentEntry(db, id)
+		if err != nil {
+			continue
+		}
+		graph.Entries = append(graph.Entries, *ce)
+	}
+	sort.Slice(graph.Relations, func(i, j int) bool { return graph.Relations[i].ID < graph.Relations[j].ID })
+	return graph, nil
+}
+
+// EntryRelation CRUD
+
+func CreateEntryRelation(db types.Conn, r *EntryRelation) (int64, error) {
+	cond := dbhelper.Cond().Eq("source_id", r.SourceID).Eq("target_id", r.TargetID).Eq("relation_type", r.Type).
+		Eq("creator_id", r.CreatorID).Eq("created_at", r.CreatedAt).Build()
+	return db.Insert("entry_relation", cond)
+}
+
+func GetEntryRelation(db types.Conn, id int64) (*EntryRelation, error) {
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	rows, err := db.Query("entry_relation", cond)
+	if err != nil {
+		return nil, err
+	}
+	if rows.Count() == 0 {
+		return nil, errors.New("relation not found")
+	}
+	r := entryRelationFromRow(rows.All()[0])
+	return &r, nil
+}
+
+func DeleteEntryRelation(db types.Conn, id int64) error {
+	cond := dbhelper.Cond().Eq("id", id).Build()
+	_, err := db.Delete("entry_relation", cond)
+	return err
+}
+
+// DeleteEntryRelationsByEntry removes every relation with the entry at either end.
+func DeleteEntryRelationsByEntry(db types.Conn, entryID int64) error {
+	cond := dbhelper.Cond().Eq("source_id", entryID).Build()
+	if _, err := db.Delete("entry_relation", cond); err != nil {
+		return err
+	}
+	cond = dbhelper.Cond().Eq("target_id", entryID).Build()
+	_, err := db.Delete("entry_relation", cond)
+	return err
+}
+
+func getRelationsByType(db types.Conn, relationType string) ([]EntryRelation, error) {
+	cond := dbhelper.Cond().Eq("relation_type", relationType).Build()
+	rows, err := db.Query("entry_relation", cond)
+	if err != nil {
+		return []EntryRelation{}, err
+	}
+	relations := make([]EntryRelation, 0)
+	for _, data := range rows.All() {
+		relations = append(relations, entryRelationFromRow(data))
+	}
+	return relations, nil
+}
+
+func entryRelationFromRow(data map[string]interface{}) EntryRelation {
+	return EntryRelation{
+		ID:        data["id"].(int64),
+		SourceID:  asInt64(data["source_id"]),
+		TargetID:  asInt64(data["target_id"]),
+		Type:      asString(data["relation_type"]),
+		CreatorID: asInt64(data["creator_id"]),
+		CreatedAt: asInt64(data["created_at"]),
+	}
+}
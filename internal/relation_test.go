@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBlocksCycleRejected(t *testing.T) {
+	db := newTestDB(t)
+
+	add := func(source, target int64, typ string) error {
+		r := &EntryRelation{SourceID: source, TargetID: target, Type: typ}
+		if err := ValidateRelation(r); err != nil {
+			return err
+		}
+		if err := CheckRelationAllowed(db, r); err != nil {
+			return err
+		}
+		_, err := CreateEntryRelation(db, r)
+		return err
+	}
+
+	if err := add(1, 2, RelationBlocks); err != nil {
+		t.Fatalf("添加关系失败: %v", err)
+	}
+	if err := add(2, 3, RelationBlocks); err != nil {
+		t.Fatalf("添加关系失败: %v", err)
+	}
+	if err := add(3, 1, RelationBlocks); !errors.Is(err, ErrRelationCycle) {
+		t.Fatalf("成环的 blocks 关系应被拒绝, got %v", err)
+	}
+	if err := add(3, 1, RelationRelatesTo); err != nil {
+		t.Fatalf("relates_to 不参与环检测: %v", err)
+	}
+	if err := add(1, 3, RelationRelatesTo); !errors.Is(err, ErrRelationExists) {
+		t.Fatalf("反向的 relates_to 应视为重复, got %v", err)
+	}
+	if err := add(1, 2, RelationBlocks); !errors.Is(err, ErrRelationExists) {
+		t.Fatalf("重复关系应被拒绝, got %v", err)
+	}
+	if err := add(1, 1, RelationDuplicates); !errors.Is(err, ErrInvalidRelation) {
+		t.Fatalf("自关联应被拒绝, got %v", err)
+	}
+}
+
+func TestRelationGraphHidesUnreadableEntries(t *testing.T) {
+	db := newTestDB(t)
+
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: 1})
+	e2, _ := CreateContentEntry(db, &ContentEntry{Title: "E2", ProjectID: 1})
+	e3, _ := CreateContentEntry(db, &ContentEntry{Title: "E3", ProjectID: 2})
+	e4, _ := CreateContentEntry(db, &ContentEntry{Title: "E4", ProjectID: 1})
+	CreateEntryRelation(db, &EntryRelation{SourceID: e1, TargetID: e2, Type: RelationBlocks})
+	CreateEntryRelation(db, &EntryRelation{SourceID: e3, TargetID: e1, Type: RelationRelatesTo})
+	CreateEntryRelation(db, &EntryRelation{SourceID: e2, TargetID: e4, Type: RelationBlocks})
+
+	canRead := func(id int64) (bool, error) { return id != e3, nil }
+
+	graph, err := GetRelationGraph(db, e1, 1, canRead)
+	if err != nil {
+		t.Fatalf("查询关系图失败: %v", err)
+	}
+	if len(graph.Entries) != 2 || len(graph.Relations) != 1 || graph.Relations[0].TargetID != e2 {
+		t.Fatalf("深度 1 的关系图错误: %+v", graph)
+	}
+
+	graph, _ = GetRelationGraph(db, e1, 2, canRead)
+	if len(graph.Entries) != 3 || len(graph.Relations) != 2 {
+		t.Fatalf("深度 2 的关系图错误: %+v", graph)
+	}
+	for _, r := range graph.Relations {
+		if r.SourceID == e3 || r.TargetID == e3 {
+			t.Fatalf("不可读条目的关系不应返回: %+v", r)
+		}
+	}
+
+	if err := DeleteContentEntry(db, e2); err != nil {
+		t.Fatalf("删除条目失败: %v", err)
+	}
+	graph, _ = GetRelationGraph(db, e1, 2, func(int64) (bool, error) { return true, nil })
+	if len(graph.Relations) != 1 || graph.Relations[0].SourceID != e3 {
+		t.Fatalf("删除条目后应清理其关系: %+v", graph)
+	}
+}
@@ -0,0 +1,277 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+// Sidebar item targets
+const (
+	SidebarTargetURL   = "url"
+	SidebarTargetPage  = "page"
+	SidebarTargetBoard = "board"
+	SidebarTargetList  = "list"
+)
+
+// ErrInvalidSidebarItem is returned when a sidebar item or a reorder request is malformed.
+var ErrInvalidSidebarItem = errors.New("invalid sidebar item")
+
+// GetProjectSidebar returns the sidebar of a project, creating an empty one on first use.
+func GetProjectSidebar(db types.Conn, projectID int64) (*Sidebar, error) {
+	return getOwnedSidebar(db, "project_id", projectID, &Sidebar{ProjectID: projectID, Name: "Project"})
+}
+
+// GetUserSidebar returns the personal sidebar of a user, creating an empty one on first use.
+func GetUserSidebar(db types.Conn, userID int64) (*Sidebar, error) {
+	return getOwnedSidebar(db, "user_id", userID, &Sidebar{UserID: userID, Name: "Personal"})
+}
+
+func getOwnedSidebar(db types.Conn, column string, ownerID int64, blank *Sidebar) (*Sidebar, error) {
+	cond := dbhelper.Cond().Eq(column, ownerID).Build()
+	rows, err := db.Query("sidebar", cond)
+	if err != nil {
+		return nil, err
+	}
+	if rows.Count() > 0 {
+		return GetSidebar(db, asInt64(rows.All()[0]["id"]))
+	}
+	id, err := CreateSidebar(db, blank)
+	if err != nil {
+		return nil, err
+	}
+	return GetSidebar(db, id)
+}
+
+// DeleteProjectSidebar removes the sidebar of a project, if it has one.
+func DeleteProjectSidebar(db types.Conn, projectID int64) error {
+	cond := dbhelper.Cond().Eq("project_id", projectID).Build()
+	rows, err := db.Query("sidebar", cond)
+	if err != nil {
+		return err
+	}
+	for _, data := range rows.All() {
+		if err := DeleteSidebar(db, asInt64(data["id"])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateSidebarItem normalizes an item and checks its target and parent. The target must exist
+// and be readable by userID, so an item cannot reveal content its author cannot see. The parent
+// must be another item of the same sidebar that is not below this one.
+func ValidateSidebarItem(db types.Conn, si *SidebarItem, userID int64) error {
+	si.Name = strings.TrimSpace(si.Name)
+	if si.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSidebarItem)
+	}
+	if si.TargetType == "" {
+		si.TargetType = SidebarTargetURL
+	}
+	switch si.TargetType {
+	case SidebarTargetURL:
+		si.TargetID = 0
+		si.URL = strings.TrimSpace(si.URL)
+		if !isSafeSidebarURL(si.URL) {
+			return fmt.Errorf("%w: url must be an http(s) URL or a path starting with /", ErrInvalidSidebarItem)
+		}
+	case SidebarTargetPage, SidebarTargetBoard, SidebarTargetList:
+		si.URL = ""
+		visible, _, err := sidebarTarget(db, userID, si)
+		if err != nil {
+			return err
+		}
+		if !visible {
+			return fmt.Errorf("%w: %s %d not found", ErrInvalidSidebarItem, si.TargetType, si.TargetID)
+		}
+	default:
+		return fmt.Errorf("%w: unknown target_type %q", ErrInvalidSidebarItem, si.TargetType)
+	}
+
+	items, err := GetSidebarItems(db, si.SidebarID)
+	if err != nil {
+		return err
+	}
+	return checkSidebarParents(items, map[int64]int64{si.ID: si.ParentID})
+}
+
+// checkSidebarParents checks that, with the given parent changes applied, every parent is an item
+// of the sidebar and no item ends up below itself.
+func checkSidebarParents(items []SidebarItem, parents map[int64]int64) error {
+	parentOf := make(map[int64]int64, len(items))
+	for _, item := range items {
+		parentOf[item.ID] = item.ParentID
+	}
+	for id, parentID := range parents {
+		if parentID != 0 {
+			if _, ok := parentOf[parentID]; !ok {
+				return fmt.Errorf("%w: parent item %d is not in this sidebar", ErrInvalidSidebarItem, parentID)
+			}
+		}
+		parentOf[id] = parentID
+	}
+	for id := range parents {
+		seen := map[int64]bool{}
+		for cur := parentOf[id]; cur != 0; cur = parentOf[cur] {
+			if cur == id || seen[cur] {
+				return fmt.Errorf("%w: an item cannot be placed under itself", ErrInvalidSidebarItem)
+			}
+			seen[cur] = true
+		}
+	}
+	return nil
+}
+
+func isSafeSidebarURL(raw string) bool {
+	if strings.HasPrefix(raw, "/") && !strings.HasPrefix(raw, "//") {
+		return true
+	}
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// sidebarTarget reports whether the user can read the item's target and the link to it.
+func sidebarTarget(db types.Conn, userID int64, si *SidebarItem) (bool, string, error) {
+	switch si.TargetType {
+	case SidebarTargetPage:
+		p, err := GetPage(db, si.TargetID)
+		if err != nil {
+			return false, "", nil
+		}
+		ok, err := HasPermission(db, userID, "project", p.ProjectID, "read")
+		return ok, "/board.html?project=" + strconv.FormatInt(p.ProjectID, 10) + "&page=" + url.QueryEscape(p.Slug), err
+	case SidebarTargetBoard:
+		if _, err := GetProject(db, si.TargetID); err != nil {
+			return false, "", nil
+		}
+		ok, err := HasPermission(db, userID, "project", si.TargetID, "read")
+		return ok, "/board.html?project=" + strconv.FormatInt(si.TargetID, 10), err
+	case SidebarTargetList:
+		cl, err := GetContentList(db, si.TargetID)
+		if err != nil {
+			return false, "", nil
+		}
+		ok, err := HasPermission(db, userID, "content_list", cl.ID, "read")
+		return ok, "/board.html?project=" + strconv.FormatInt(cl.ProjectID, 10) + "&list=" + strconv.FormatInt(cl.ID, 10), err
+	}
+	return true, si.URL, nil
+}
+
+// VisibleSidebarItems returns the items the user may see, ordered by parent and position, with the
+// URL of content targets filled in. Items whose target is gone or unreadable are left out, and so
+// is everything nested below them.
+func VisibleSidebarItems(db types.Conn, userID int64, items []SidebarItem) ([]SidebarItem, error) {
+	hidden := map[int64]bool{}
+	for i := range items {
+		visible, link, err := sidebarTarget(db, userID, &items[i])
+		if err != nil {
+			return nil, err
+		}
+		if !visible {
+			hidden[items[i].ID] = true
+			continue
+		}
+		items[i].URL = link
+	}
+	parentOf := make(map[int64]int64, len(items))
+	for _, item := range items {
+		parentOf[item.ID] = item.ParentID
+	}
+	visible := []SidebarItem{}
+	for _, item := range items {
+		if !sidebarItemHidden(item.ID, parentOf, hidden) {
+			visible = append(visible, item)
+		}
+	}
+	sort.SliceStable(visible, func(i, j int) bool {
+		if visible[i].ParentID != visible[j].ParentID {
+			return visible[i].ParentID < visible[j].ParentID
+		}
+		return visible[i].Order < visible[j].Order
+	})
+	return visible, nil
+}
+
+func sidebarItemHidden(id int64, parentOf map[int64]int64, hidden map[int64]bool) bool {
+	for depth := 0; id != 0 && depth <= len(parentOf); depth++ {
+		if hidden[id] {
+			return true
+		}
+		id = parentOf[id]
+	}
+	return false
+}
+
+// DeleteSidebarItemTree deletes an item of a sidebar together with the items nested below it.
+func DeleteSidebarItemTree(db types.Conn, sidebarID int64, itemID int64) error {
+	items, err := GetSidebarItems(db, sidebarID)
+	if err != nil {
+		return err
+	}
+	doomed := map[int64]bool{itemID: true}
+	for changed := true; changed; {
+		changed = false
+		for _, item := range items {
+			if !doomed[item.ID] && doomed[item.ParentID] {
+				doomed[item.ID] = true
+				changed = true
+			}
+		}
+	}
+	return runInTx(db, "DeleteSidebarItemTree", func(db types.Conn) error {
+		for _, item := range items {
+			if !doomed[item.ID] {
+				continue
+			}
+			if err := DeleteSidebarItem(db, item.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ReorderSidebarItems moves and reorders items of a sidebar in one step: either every change is
+// applied or none is. Items not listed keep their place.
+func ReorderSidebarItems(db types.Conn, sidebarID int64, moves []SidebarItemOrder) error {
+	items, err := GetSidebarItems(db, sidebarID)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int64]SidebarItem, len(items))
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+	parents := make(map[int64]int64, len(moves))
+	for _, m := range moves {
+		if _, ok := byID[m.ID]; !ok {
+			return fmt.Errorf("%w: item %d is not in this sidebar", ErrInvalidSidebarItem, m.ID)
+		}
+		if _, dup := parents[m.ID]; dup {
+			return fmt.Errorf("%w: item %d is listed twice", ErrInvalidSidebarItem, m.ID)
+		}
+		parents[m.ID] = m.ParentID
+	}
+	if err := checkSidebarParents(items, parents); err != nil {
+		return err
+	}
+
+	return runInTx(db, "ReorderSidebarItems", func(db types.Conn) error {
+		for _, m := range moves {
+			item := byID[m.ID]
+			item.ParentID = m.ParentID
+			item.Order = m.Order
+			if err := UpdateSidebarItem(db, item.ID, &item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSidebarVisibilityAndNesting(t *testing.T) {
+	db := newTestDB(t)
+
+	projectID, _ := CreateProject(db, &Project{Name: "Visible"})
+	secretID, _ := CreateProject(db, &Project{Name: "Secret"})
+	grant(t, db, 1, "project", projectID, "read")
+	pageID, _ := CreatePage(db, &Page{ProjectID: projectID, Title: "Home", Slug: "home"})
+	secretList, _ := CreateContentList(db, &ContentList{Title: "Hidden", ProjectID: secretID})
+
+	s, err := GetUserSidebar(db, 1)
+	if err != nil || s.UserID != 1 {
+		t.Fatalf("应自动创建个人侧边栏: %v %+v", err, s)
+	}
+	if again, _ := GetUserSidebar(db, 1); again.ID != s.ID {
+		t.Fatal("再次获取应返回同一个侧边栏")
+	}
+
+	docs := SidebarItem{SidebarID: s.ID, Name: "Docs", TargetType: SidebarTargetPage, TargetID: pageID, Order: 2}
+	if err := ValidateSidebarItem(db, &docs, 1); err != nil {
+		t.Fatalf("校验页面项失败: %v", err)
+	}
+	docs.ID, _ = CreateSidebarItem(db, &docs)
+	link := SidebarItem{SidebarID: s.ID, Name: "Site", URL: "https://example.com", Order: 1}
+	if err := ValidateSidebarItem(db, &link, 1); err != nil || link.TargetType != SidebarTargetURL {
+		t.Fatalf("target_type 默认为 url: %v %+v", err, link)
+	}
+	link.ID, _ = CreateSidebarItem(db, &link)
+
+	bad := SidebarItem{SidebarID: s.ID, Name: "XSS", URL: "javascript:alert(1)"}
+	if err := ValidateSidebarItem(db, &bad, 1); !errors.Is(err, ErrInvalidSidebarItem) {
+		t.Fatalf("应拒绝不安全的 URL, got %v", err)
+	}
+	hidden := SidebarItem{SidebarID: s.ID, Name: "Hidden", TargetType: SidebarTargetList, TargetID: secretList}
+	if err := ValidateSidebarItem(db, &hidden, 1); !errors.Is(err, ErrInvalidSidebarItem) {
+		t.Fatalf("不能添加自己无权读取的目标, got %v", err)
+	}
+
+	// 其他有权限的用户添加的项，对用户 1 不可见，其子项也随之隐藏
+	hidden.ID, _ = CreateSidebarItem(db, &hidden)
+	child := SidebarItem{SidebarID: s.ID, ParentID: hidden.ID, Name: "Child", URL: "/dashboard"}
+	child.ID, _ = CreateSidebarItem(db, &child)
+
+	s, _ = GetSidebar(db, s.ID)
+	items, err := VisibleSidebarItems(db, 1, s.Items)
+	if err != nil {
+		t.Fatalf("过滤侧边栏失败: %v", err)
+	}
+	if len(items) != 2 || items[0].ID != link.ID || items[1].ID != docs.ID {
+		t.Fatalf("应只返回可见项并按 order 排序: %+v", items)
+	}
+	if items[1].URL != "/board.html?project=1&page=home" {
+		t.Fatalf("页面项应生成链接: %q", items[1].URL)
+	}
+
+	if err := ReorderSidebarItems(db, s.ID, []SidebarItemOrder{{ID: link.ID, ParentID: docs.ID}, {ID: docs.ID, ParentID: link.ID}}); !errors.Is(err, ErrInvalidSidebarItem) {
+		t.Fatalf("重排不能产生循环, got %v", err)
+	}
+	if err := ReorderSidebarItems(db, s.ID, []SidebarItemOrder{{ID: docs.ID, Order: 0}, {ID: link.ID, ParentID: docs.ID, Order: 0}}); err != nil {
+		t.Fatalf("重排失败: %v", err)
+	}
+	moved, _ := GetSidebarItem(db, link.ID)
+	if moved.ParentID != docs.ID {
+		t.Fatalf("重排应修改父级: %+v", moved)
+	}
+
+	if err := DeleteSidebarItemTree(db, s.ID, docs.ID); err != nil {
+		t.Fatalf("删除侧边栏项失败: %v", err)
+	}
+	left, _ := GetSidebarItems(db, s.ID)
+	if len(left) != 2 {
+		t.Fatalf("删除应连同子项一起删除: %+v", left)
+	}
+}
@@ -0,0 +1,390 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+// Change log operations
+const (
+	ChangeUpsert = "upsert"
+	ChangeDelete = "delete"
+)
+
+const (
+	// DefaultSyncLimit and MaxSyncLimit bound the number of changes in a sync page.
+	DefaultSyncLimit = 500
+	MaxSyncLimit     = 1000
+	// ChangeLogRetention is how long changes are kept, in seconds. Older cursors get a full resync.
+	ChangeLogRetention = 30 * 24 * 60 * 60
+
+	// changeLogPruneEvery is how many changes are recorded between two prunes of the log.
+	changeLogPruneEvery = 1000
+)
+
+// RecordChange appends a change of a project, list or entry to the change log, along with the
+// project the object is in, so that sync only reads the changes of projects the caller can see. The
+// ID of the log row is the change sequence that sync cursors refer to.
+func RecordChange(db types.Conn, objectType string, objectID int64, op string) error {
+	projectID, err := changeProjectID(db, objectType, objectID)
+	if err != nil {
+		return err
+	}
+	return recordChange(db, changeRecord{objectType: objectType, objectID: objectID, op: op, projectID: projectID})
+}
+
+// RecordPermissionChange is RecordChange for a detail permission. The owner and content type are
+// logged too, so a tombstone reaches only its owner and a change of project access is detectable
+// after the permission is gone.
+func RecordPermissionChange(db types.Conn, id int64, userID int64, contentType string, op string) error {
+	return recordChange(db, changeRecord{objectType: "detail_permission", objectID: id, op: op, userID: userID, contentType: contentType})
+}
+
+// recordAccessRevoked logs that userID lost a permission on the lists or entries, so that a client
+// of that user which has them gets a tombstone if it can no longer read them. The change reaches
+// no one else.
+func recordAccessRevoked(db types.Conn, userID int64, contentType string, ids []int64) error {
+	if contentType != "content_list" && contentType != "content_entry" {
+		return nil
+	}
+	for _, id := range normalizeIDs(ids) {
+		projectID, err := changeProjectID(db, contentType, id)
+		if err != nil {
+			return err
+		}
+		if err := recordChange(db, changeRecord{objectType: contentType, objectID: id, op: ChangeUpsert, userID: userID, projectID: projectID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changeProjectID returns the project a project, list or entry belongs to, falling back to the
+// project logged with its last change once it has been deleted.
+func changeProjectID(db types.Conn, objectType string, objectID int64) (int64, error) {
+	switch objectType {
+	case "project":
+		return objectID, nil
+	case "content_list", "content_entry":
+	default:
+		return 0, nil
+	}
+	rows, err := db.Query(objectType, dbhelper.Cond().Eq("id", objectID).Build())
+	if err != nil {
+		return 0, err
+	}
+	if rows.Count() > 0 {
+		return asInt64(rows.All()[0]["project_id"]), nil
+	}
+	cond := dbhelper.Cond().Raw("object_type = ? AND object_id = ? AND project_id > 0 ORDER BY id DESC LIMIT 1", objectType, objectID).Build()
+	rows, err = db.Query("change_log", cond)
+	if err != nil || rows.Count() == 0 {
+		return 0, err
+	}
+	return asInt64(rows.All()[0]["project_id"]), nil
+}
+
+func recordChange(db types.Conn, r changeRecord) error {
+	now := time.Now().Unix()
+	cond := dbhelper.Cond().Eq("object_type", r.objectType).Eq("object_id", r.objectID).Eq("op", r.op).
+		Eq("user_id", r.userID).Eq("content_type", r.contentType).Eq("project_id", r.projectID).Eq("created_at", now).Build()
+	seq, err := db.Insert("change_log", cond)
+	if err != nil {
+		return err
+	}
+	if seq%changeLogPruneEvery == 0 {
+		return PruneChangeLog(db, now-ChangeLogRetention)
+	}
+	return nil
+}
+
+// PruneChangeLog removes the changes recorded before the given Unix time. The newest change is
+// always kept so the current sequence stays known.
+func PruneChangeLog(db types.Conn, before int64) error {
+	sql := fmt.Sprintf("DELETE FROM change_log WHERE created_at < %d AND id < (SELECT MAX(id) FROM change_log)", before)
+	_, err := db.Exec(dbhelper.Cond().Raw(sql).Build())
+	return err
+}
+
+type changeRecord struct {
+	seq         int64
+	objectType  string
+	objectID    int64
+	op          string
+	userID      int64
+	contentType string
+	projectID   int64
+}
+
+// changeScope is what a user can read, loaded once per sync page.
+type changeScope struct {
+	userID   int64
+	projects map[int64]bool
+	lists    map[int64]bool
+	entries  map[int64]bool
+}
+
+func loadChangeScope(db types.Conn, userID int64) (*changeScope, error) {
+	s := &changeScope{userID: userID}
+	var err error
+	if s.projects, err = readableIDs(db, userID, "project"); err != nil {
+		return nil, err
+	}
+	if s.lists, err = readableIDs(db, userID, "content_list"); err != nil {
+		return nil, err
+	}
+	if s.entries, err = readableIDs(db, userID, "content_entry"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// filter returns the SQL condition selecting the changes that may concern the user: those of
+// readable projects and of lists and entries granted directly, and those logged for the user
+// alone. The IDs come from the database and are inlined.
+func (s *changeScope) filter() string {
+	clauses := []string{"user_id = " + strconv.FormatInt(s.userID, 10)}
+	if len(s.projects) > 0 {
+		clauses = append(clauses, "project_id IN ("+sqlIDList(s.projects)+")")
+	}
+	if len(s.lists) > 0 {
+		clauses = append(clauses, "(object_type = 'content_list' AND object_id IN ("+sqlIDList(s.lists)+"))")
+	}
+	if len(s.entries) > 0 {
+		clauses = append(clauses, "(object_type = 'content_entry' AND object_id IN ("+sqlIDList(s.entries)+"))")
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")"
+}
+
+// granted reports whether the user holds a read permission on the object, which outlives the
+// object when it is deleted.
+func (s *changeScope) granted(objectType string, id int64) bool {
+	switch objectType {
+	case "project":
+		return s.projects[id]
+	case "content_list":
+		return s.lists[id]
+	case "content_entry":
+		return s.entries[id]
+	}
+	return false
+}
+
+func sqlIDList(ids map[int64]bool) string {
+	sorted := make([]int64, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	parts := make([]string, len(sorted))
+	for i, id := range sorted {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// GetChanges returns the page of changes after since that userID may see, oldest first. Only the
+// changes of projects the user can read and of lists and entries granted to the user are read, so
+// a page is not filled with changes the user never sees. Each object appears once in a page, at its
+// latest sequence there, with its current state. An object the user could read before is a
+// tombstone once it is deleted or the user's permission on it is revoked, including by a move to
+// another project; objects the user never could read are left out. Of the detail permissions only
+// the user's own are included. A full resync is requested when since is 0, was pruned from the log
+// or is ahead of it, and when the user's project access changed, since that changes which projects
+// are visible without changing them. Only the part of the log after since is read.
+func GetChanges(db types.Conn, userID int64, since int64, limit int) (*SyncPage, error) {
+	if limit <= 0 || limit > MaxSyncLimit {
+		limit = DefaultSyncLimit
+	}
+	bounds, err := db.Query("change_log", dbhelper.Cond().Raw("id = (SELECT MIN(id) FROM change_log) OR id = (SELECT MAX(id) FROM change_log)").Build())
+	if err != nil {
+		return nil, err
+	}
+	var minSeq, maxSeq int64
+	for _, data := range bounds.All() {
+		seq := asInt64(data["id"])
+		if minSeq == 0 || seq < minSeq {
+			minSeq = seq
+		}
+		if seq > maxSeq {
+			maxSeq = seq
+		}
+	}
+
+	page := &SyncPage{Changes: []SyncChange{}, Cursor: maxSeq}
+	if since <= 0 || since > maxSeq || since < minSeq-1 {
+		page.FullResync = true
+		return page, nil
+	}
+
+	scope, err := loadChangeScope(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	// 按序号分批读取，同一对象只保留最新的一次变更；看不到的对象不占页内名额，凑满一页为止
+	latest := make(map[string]SyncChange)
+	revoked := make(map[string]bool)
+	scanned := since
+	for len(latest) < limit && scanned < maxSeq {
+		records, err := changesAfter(db, scanned, limit, scope)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			break
+		}
+		for _, r := range records {
+			if r.objectType == "detail_permission" && r.userID == userID && r.contentType == "project" {
+				page.FullResync = true
+				return page, nil
+			}
+			key := r.objectType + ":" + strconv.FormatInt(r.objectID, 10)
+			if _, seen := latest[key]; !seen && len(latest) == limit {
+				break
+			}
+			// 本页中权限被撤销过的对象，之后的变更也按撤销处理，保证客户端收到删除标记
+			if r.userID == userID {
+				revoked[key] = true
+			}
+			if revoked[key] {
+				r.userID = userID
+			}
+			change, err := syncChange(db, scope, r)
+			if err != nil {
+				return nil, err
+			}
+			if change != nil {
+				latest[key] = *change
+			} else {
+				delete(latest, key)
+			}
+			scanned = r.seq
+		}
+		if len(records) < limit {
+			break
+		}
+	}
+	if len(latest) == limit && scanned < maxSeq {
+		page.HasMore = true
+		page.Cursor = scanned
+	}
+
+	for _, change := range latest {
+		page.Changes = append(page.Changes, change)
+	}
+	sort.Slice(page.Changes, func(i, j int) bool { return page.Changes[i].Seq < page.Changes[j].Seq })
+	return page, nil
+}
+
+// changesAfter returns up to limit changes with a sequence above since, oldest first, limited to
+// the scope if one is given.
+func changesAfter(db types.Conn, since int64, limit int, scope *changeScope) ([]changeRecord, error) {
+	where := "id > ?"
+	if scope != nil {
+		where += " AND " + scope.filter()
+	}
+	cond := dbhelper.Cond().Raw(where+" ORDER BY id LIMIT ?", since, limit).Build()
+	rows, err := db.Query("change_log", cond)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]changeRecord, 0, rows.Count())
+	for _, data := range rows.All() {
+		r := changeRecord{
+			seq:         asInt64(data["id"]),
+			objectType:  asString(data["object_type"]),
+			objectID:    asInt64(data["object_id"]),
+			op:          asString(data["op"]),
+			userID:      asInt64(data["user_id"]),
+			contentType: asString(data["content_type"]),
+			projectID:   asInt64(data["project_id"]),
+		}
+		if r.seq > since {
+			records = append(records, r)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].seq < records[j].seq })
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// syncChange resolves a logged change to what the user gets to see: the current object, a
+// tombstone or nothing. A tombstone is only sent for an object the user could read before: one the
+// user still holds a permission on after it is deleted, or one whose permission was revoked.
+func syncChange(db types.Conn, scope *changeScope, r changeRecord) (*SyncChange, error) {
+	userID := scope.userID
+	if r.objectType == "detail_permission" && r.userID != userID {
+		return nil, nil
+	}
+	tombstone := &SyncChange{Seq: r.seq, Type: r.objectType, ID: r.objectID, Op: ChangeDelete}
+	wasVisible := r.userID == userID || scope.granted(r.objectType, r.objectID)
+	rows, err := db.Query(r.objectType, dbhelper.Cond().Eq("id", r.objectID).Build())
+	if err != nil {
+		return nil, err
+	}
+	if rows.Count() == 0 {
+		if !wasVisible {
+			return nil, nil
+		}
+		return tombstone, nil
+	}
+
+	var data interface{}
+	visible := false
+	switch r.objectType {
+	case "project":
+		p, err := GetProject(db, r.objectID)
+		if err != nil {
+			return nil, err
+		}
+		visible, err = HasPermission(db, userID, "project", p.ID, "read")
+		if err != nil {
+			return nil, err
+		}
+		data = p
+	case "content_list":
+		cl, err := GetContentList(db, r.objectID)
+		if err != nil {
+			return nil, err
+		}
+		visible, err = HasPermission(db, userID, "content_list", cl.ID, "read")
+		if err != nil {
+			return nil, err
+		}
+		data = cl
+	case "content_entry":
+		ce, err := GetContentEntry(db, r.objectID)
+		if err != nil {
+			return nil, err
+		}
+		visible, err = HasPermission(db, userID, "content_entry", ce.ID, "read")
+		if err != nil {
+			return nil, err
+		}
+		data = ce
+	case "detail_permission":
+		dp, err := GetDetailPermission(db, r.objectID)
+		if err != nil {
+			return nil, err
+		}
+		visible = dp.UserID == userID
+		data = dp
+	default:
+		return nil, nil
+	}
+	if !visible {
+		if r.userID != userID {
+			return nil, nil
+		}
+		return tombstone, nil
+	}
+	return &SyncChange{Seq: r.seq, Type: r.objectType, ID: r.objectID, Op: ChangeUpsert, Data: data}, nil
+}
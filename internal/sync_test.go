@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDeltaSync(t *testing.T) {
+	db := newTestDB(t)
+
+	projectID, _ := CreateProject(db, &Project{Name: "Mine", CreatorID: 1})
+	otherID, _ := CreateProject(db, &Project{Name: "Other", CreatorID: 2})
+	grant(t, db, 1, "project", projectID, "read")
+
+	first, err := GetChanges(db, 1, 0, 0)
+	if err != nil || !first.FullResync || first.Cursor == 0 {
+		t.Fatalf("since=0 应要求全量同步并返回当前游标: %v %+v", err, first)
+	}
+	cursor := first.Cursor
+
+	// 列表和条目按条目级权限同步，与 REST 接口一致
+	listID, _ := CreateContentList(db, &ContentList{Title: "Todo", ProjectID: projectID})
+	grant(t, db, 1, "content_list", listID, "read")
+	entryID, _ := CreateContentEntry(db, &ContentEntry{Title: "A", ProjectID: projectID})
+	grant(t, db, 1, "content_entry", entryID, "read")
+	ce, _ := GetContentEntry(db, entryID)
+	ce.Title = "A2"
+	UpdateContentEntry(db, entryID, ce)
+	hiddenID, _ := CreateContentList(db, &ContentList{Title: "Hidden", ProjectID: otherID})
+	privateID, _ := CreateContentEntry(db, &ContentEntry{Title: "Private", ProjectID: projectID})
+	goneID, _ := CreateContentEntry(db, &ContentEntry{Title: "Gone", ProjectID: projectID})
+	grant(t, db, 1, "content_entry", goneID, "read")
+	DeleteContentEntry(db, goneID)
+	hiddenGoneID, _ := CreateContentEntry(db, &ContentEntry{Title: "Hidden gone", ProjectID: projectID})
+	DeleteContentEntry(db, hiddenGoneID)
+
+	page, err := GetChanges(db, 1, cursor, 0)
+	if err != nil || page.FullResync || page.HasMore {
+		t.Fatalf("同步失败: %v %+v", err, page)
+	}
+	changes := map[string]SyncChange{}
+	for _, c := range page.Changes {
+		changes[c.Type+":"+strconv.FormatInt(c.ID, 10)] = c
+	}
+	if len(page.Changes) != 6 || len(changes) != 6 {
+		t.Fatalf("每个对象应只返回一次: %+v", page.Changes)
+	}
+	if c := changes["content_list:"+strconv.FormatInt(listID, 10)]; c.Op != ChangeUpsert {
+		t.Fatalf("应返回可读的列表: %+v", c)
+	}
+	if c := changes["content_entry:"+strconv.FormatInt(entryID, 10)]; c.Op != ChangeUpsert || c.Data.(*ContentEntry).Title != "A2" {
+		t.Fatalf("同一条目的多次修改应合并为最新状态: %+v", c)
+	}
+	if c, ok := changes["content_list:"+strconv.FormatInt(hiddenID, 10)]; ok {
+		t.Fatalf("不可读项目中的对象不应同步，也不应返回删除标记: %+v", c)
+	}
+	if c, ok := changes["content_entry:"+strconv.FormatInt(privateID, 10)]; ok {
+		t.Fatalf("只有项目读权限时不应同步条目，也不应返回删除标记: %+v", c)
+	}
+	if c := changes["content_entry:"+strconv.FormatInt(goneID, 10)]; c.Op != ChangeDelete || c.Data != nil {
+		t.Fatalf("曾经可读的条目删除后应返回删除标记: %+v", c)
+	}
+	if c, ok := changes["content_entry:"+strconv.FormatInt(hiddenGoneID, 10)]; ok {
+		t.Fatalf("从未可读的条目删除后不应返回删除标记: %+v", c)
+	}
+
+	// 分页：游标停在本页读到的最后一条，逐页读完得到同样的对象
+	small, _ := GetChanges(db, 1, cursor, 2)
+	if !small.HasMore || len(small.Changes) != 2 || small.Cursor != small.Changes[1].Seq {
+		t.Fatalf("分页游标不正确: %+v", small)
+	}
+	paged := map[string]bool{}
+	for p := small; ; {
+		if len(p.Changes) > 2 {
+			t.Fatalf("每页不应超过 limit: %+v", p)
+		}
+		for _, c := range p.Changes {
+			paged[c.Type+":"+strconv.FormatInt(c.ID, 10)] = true
+		}
+		if !p.HasMore {
+			if p.Cursor != page.Cursor {
+				t.Fatalf("最后一页的游标应为最新序号: %+v", p)
+			}
+			break
+		}
+		p, _ = GetChanges(db, 1, p.Cursor, 2)
+	}
+	for key := range changes {
+		if !paged[key] {
+			t.Fatalf("分页读取遗漏了 %s", key)
+		}
+	}
+
+	// 项目权限变化会改变可见内容，需要全量同步
+	grant(t, db, 1, "project", otherID, "read")
+	if p, _ := GetChanges(db, 1, page.Cursor, 0); !p.FullResync {
+		t.Fatalf("项目权限变化后应要求全量同步: %+v", p)
+	}
+	if p, _ := GetChanges(db, 2, page.Cursor, 0); p.FullResync || len(p.Changes) != 0 {
+		t.Fatalf("其他用户的权限变更不应同步给用户 2: %+v", p)
+	}
+
+	// 过旧或未知的游标需要全量同步
+	if err := PruneChangeLog(db, time.Now().Unix()+1); err != nil {
+		t.Fatalf("清理变更日志失败: %v", err)
+	}
+	if p, _ := GetChanges(db, 1, cursor, 0); !p.FullResync {
+		t.Fatal("游标早于保留的日志时应要求全量同步")
+	}
+	if p, _ := GetChanges(db, 1, page.Cursor+1000, 0); !p.FullResync {
+		t.Fatal("超前的游标应要求全量同步")
+	}
+}
+
+func TestDeltaSyncRevokedAccess(t *testing.T) {
+	db := newTestDB(t)
+
+	projectID, _ := CreateProject(db, &Project{Name: "Mine", CreatorID: 1})
+	otherID, _ := CreateProject(db, &Project{Name: "Other", CreatorID: 2})
+	grant(t, db, 1, "project", projectID, "read")
+	listID, _ := CreateContentList(db, &ContentList{Title: "Todo", ProjectID: projectID})
+	keptID, _ := CreateContentEntry(db, &ContentEntry{Title: "Kept", ProjectID: projectID})
+	revokedID, _ := CreateContentEntry(db, &ContentEntry{Title: "Revoked", ProjectID: projectID})
+	movedID, _ := CreateContentEntry(db, &ContentEntry{Title: "Moved", ProjectID: projectID})
+	UpdateContentList(db, listID, &ContentList{Title: "Todo", ProjectID: projectID, Items: []int64{keptID, revokedID, movedID}})
+	otherList, _ := CreateContentList(db, &ContentList{Title: "Elsewhere", ProjectID: otherID})
+	dp := &DetailPermission{UserID: 1, ContentType: "content_entry", ContentIDs: []int64{keptID, revokedID}, Action: "read"}
+	dp.ID, _ = CreateDetailPermission(db, dp)
+	grant(t, db, 1, "content_entry", movedID, "read")
+	cursor, _ := GetChanges(db, 1, 0, 0)
+
+	// 其他项目中的大量变更不应占用用户 1 的分页
+	for i := 0; i < 5; i++ {
+		CreateContentEntry(db, &ContentEntry{Title: "Noise", ProjectID: otherID})
+	}
+	dp.ContentIDs = []int64{keptID}
+	if err := UpdateDetailPermission(db, dp.ID, dp); err != nil {
+		t.Fatalf("修改权限失败: %v", err)
+	}
+	// 以 destination 策略移到用户 1 不可读的项目，原有授权被移除
+	if err := MoveContentEntry(db, movedID, otherList, -1, 2, PermissionPolicyDestination); err != nil {
+		t.Fatalf("移动条目失败: %v", err)
+	}
+	// 撤销后条目仍有变更，仍应以删除标记同步
+	ce, _ := GetContentEntry(db, revokedID)
+	ce.Title = "Revoked 2"
+	UpdateContentEntry(db, revokedID, ce)
+
+	page, err := GetChanges(db, 1, cursor.Cursor, 3)
+	if err != nil || page.FullResync {
+		t.Fatalf("同步失败: %v %+v", err, page)
+	}
+	tombstones := map[int64]bool{}
+	for _, c := range page.Changes {
+		if c.Type == "content_entry" {
+			if c.Op != ChangeDelete {
+				t.Fatalf("失去权限的条目应返回删除标记: %+v", c)
+			}
+			tombstones[c.ID] = true
+		}
+	}
+	for p := page; p.HasMore; {
+		p, _ = GetChanges(db, 1, p.Cursor, 3)
+		for _, c := range p.Changes {
+			if c.Type == "content_entry" && c.Op == ChangeDelete {
+				tombstones[c.ID] = true
+			}
+		}
+	}
+	if len(tombstones) != 2 || !tombstones[revokedID] || !tombstones[movedID] {
+		t.Fatalf("应只为撤销和移出的条目返回删除标记: %v", tombstones)
+	}
+	other, _ := GetChanges(db, 2, cursor.Cursor, 0)
+	for _, c := range other.Changes {
+		if c.Op == ChangeDelete {
+			t.Fatalf("其他用户不应收到用户 1 的撤销记录: %+v", c)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+// Permission policies for content copied or moved to another project
+const (
+	// PermissionPolicyKeep leaves the detail permissions on the content as they are.
+	PermissionPolicyKeep = "keep"
+	// PermissionPolicyDestination replaces them with the destination project's members at their project level.
+	PermissionPolicyDestination = "destination"
+	// PermissionPolicyOwner replaces them with admin access for the user performing the operation.
+	PermissionPolicyOwner = "owner"
+)
+
+var (
+	// ErrInvalidTransfer is returned when a copy or move request is malformed or not possible.
+	ErrInvalidTransfer = errors.New("invalid transfer")
+	// ErrTransferForbidden is returned when the user may not move some of the content.
+	ErrTransferForbidden = errors.New("permission denied")
+)
+
+// ValidatePermissionPolicy checks a permission policy, defaulting an empty one to keep.
+func ValidatePermissionPolicy(policy string) (string, error) {
+	switch policy {
+	case "":
+		return PermissionPolicyKeep, nil
+	case PermissionPolicyKeep, PermissionPolicyDestination, PermissionPolicyOwner:
+		return policy, nil
+	}
+	return "", fmt.Errorf("%w: unknown permission policy %q", ErrInvalidTransfer, policy)
+}
+
+// CopyContentEntry copies an entry into the target list at position (negative or past the end
+// appends) and returns the new entry's ID. Labels and custom field values are carried over to the
+// destination project's labels and fields of the same name; attachments are shared with the
+// original. The copy gets a fresh history: comments and relations are not copied. userID becomes
+// the creator and an admin of the copy; under the keep policy the original's grants are copied too.
+func CopyContentEntry(db types.Conn, srcID int64, targetListID int64, position int, userID int64, policy string) (int64, error) {
+	var newID int64
+	err := runInTx(db, "CopyContentEntry", func(db types.Conn) error {
+		ce, err := GetContentEntry(db, srcID)
+		if err != nil {
+			return err
+		}
+		target, err := getTransferTarget(db, targetListID)
+		if err != nil {
+			return err
+		}
+
+		clone := *ce
+		clone.CreatorID = userID
+		clone.ProjectID = target.ProjectID
+		clone.Assignees, err = filterProjectReaders(db, target.ProjectID, ce.Assignees)
+		if err != nil {
+			return err
+		}
+		newID, err = CreateContentEntry(db, &clone)
+		if err != nil {
+			return err
+		}
+
+		labels, values, err := mapEntryMetadata(db, ce, target.ProjectID)
+		if err != nil {
+			return err
+		}
+		if err := replaceEntryMetadata(db, newID, labels, values); err != nil {
+			return err
+		}
+		attachments, err := GetAttachmentsByEntry(db, srcID)
+		if err != nil {
+			return err
+		}
+		for _, a := range attachments {
+			a.EntryID = newID
+			a.ProjectID = target.ProjectID
+			if _, err := CreateAttachment(db, &a); err != nil {
+				return err
+			}
+		}
+
+		if policy == PermissionPolicyKeep {
+			grants, err := getDetailPermissionsFor(db, "content_entry", srcID)
+			if err != nil {
+				return err
+			}
+			for _, dp := range grants {
+				if err := grantDetailPermission(db, dp.UserID, "content_entry", newID, dp.Action); err != nil {
+					return err
+				}
+			}
+		} else if err := grantByPolicy(db, "content_entry", newID, target.ProjectID, userID, policy); err != nil {
+			return err
+		}
+		for _, action := range []string{"admin", "read"} {
+			if err := grantDetailPermission(db, userID, "content_entry", newID, action); err != nil {
+				return err
+			}
+		}
+
+		target.Items = insertID(target.Items, newID, position)
+		target.UpdatedBy = userID
+		return UpdateContentList(db, target.ID, target)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// MoveContentEntry moves an entry into the target list at position, keeping its ID, comments,
+// relations and attachments. The entry is taken out of every list of its current project. When the
+// target list is in another project, ProjectID is rewritten, labels and custom field values are
+// mapped by name as in CopyContentEntry, assignees without access to the destination are dropped
+// and the entry's detail permissions follow policy.
+func MoveContentEntry(db types.Conn, id int64, targetListID int64, position int, userID int64, policy string) error {
+	return runInTx(db, "MoveContentEntry", func(db types.Conn) error {
+		return moveContentEntry(db, id, targetListID, position, userID, policy)
+	})
+}
+
+func moveContentEntry(db types.Conn, id int64, targetListID int64, position int, userID int64, policy string) error {
+	ce, err := GetContentEntry(db, id)
+	if err != nil {
+		return err
+	}
+	if ce.ArchivedAt != 0 {
+		return fmt.Errorf("%w: archived entries cannot be moved", ErrInvalidTransfer)
+	}
+	if _, err := getTransferTarget(db, targetListID); err != nil {
+		return err
+	}
+
+	lists, err := GetContentListsByProject(db, ce.ProjectID)
+	if err != nil {
+		return err
+	}
+	for _, cl := range lists {
+		if !containsID(cl.Items, id) {
+			continue
+		}
+		cl.Items = removeID(cl.Items, id)
+		cl.UpdatedBy = userID
+		if err := UpdateContentList(db, cl.ID, &cl); err != nil {
+			return err
+		}
+	}
+
+	// 重新读取目标列表，它可能就是刚移出条目的列表
+	target, err := GetContentList(db, targetListID)
+	if err != nil {
+		return err
+	}
+	if target.ProjectID != ce.ProjectID {
+		if err := moveEntryToProject(db, ce, target.ProjectID, userID, policy); err != nil {
+			return err
+		}
+	}
+	target.Items = insertID(target.Items, id, position)
+	target.UpdatedBy = userID
+	return UpdateContentList(db, target.ID, target)
+}
+
+// MoveContentList moves a list and its entries, including entries archived out of it, to another
+// project. userID needs write permission on every one of those entries; otherwise nothing is moved
+// and the error lists the entries that fail. The list's own detail permissions and those of its
+// entries follow policy.
+func MoveContentList(db types.Conn, id int64, targetProjectID int64, userID int64, policy string) error {
+	return runInTx(db, "MoveContentList", func(db types.Conn) error {
+		return moveContentList(db, id, targetProjectID, userID, policy)
+	})
+}
+
+func moveContentList(db types.Conn, id int64, targetProjectID int64, userID int64, policy string) error {
+	cl, err := GetContentList(db, id)
+	if err != nil {
+		return err
+	}
+	if cl.ProjectID == targetProjectID {
+		return fmt.Errorf("%w: the list is already in project %d", ErrInvalidTransfer, targetProjectID)
+	}
+	if _, err := GetProject(db, targetProjectID); err != nil {
+		return fmt.Errorf("%w: target project not found", ErrInvalidTransfer)
+	}
+
+	// 列表中的条目，加上从该列表归档出去的条目
+	entryIDs := append([]int64{}, cl.Items...)
+	archived, err := db.Query("content_entry", dbhelper.Cond().Eq("archived_list_id", cl.ID).Build())
+	if err != nil {
+		return err
+	}
+	for _, data := range archived.All() {
+		entryID := asInt64(data["id"])
+		if asInt64(data["project_id"]) == cl.ProjectID && asInt64(data["archived_at"]) != 0 && !containsID(entryIDs, entryID) {
+			entryIDs = append(entryIDs, entryID)
+		}
+	}
+	entries := make([]*ContentEntry, 0, len(entryIDs))
+	var denied []int64
+	for _, entryID := range entryIDs {
+		ce, err := GetContentEntry(db, entryID)
+		if err != nil || ce.ProjectID != cl.ProjectID {
+			continue
+		}
+		canWrite, err := HasPermission(db, userID, "content_entry", entryID, "write")
+		if err != nil {
+			return err
+		}
+		if !canWrite {
+			denied = append(denied, entryID)
+		}
+		entries = append(entries, ce)
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("%w: write permission on entries %v is required", ErrTransferForbidden, denied)
+	}
+	for _, ce := range entries {
+		if err := moveEntryToProject(db, ce, targetProjectID, userID, policy); err != nil {
+			return err
+		}
+	}
+
+	cl.ProjectID = targetProjectID
+	cl.UpdatedBy = userID
+	if err := UpdateContentList(db, cl.ID, cl); err != nil {
+		return err
+	}
+	return applyPermissionPolicy(db, "content_list", cl.ID, targetProjectID, userID, policy)
+}
+
+// moveEntryToProject rewrites an entry for another project. The caller updates the lists.
+func moveEntryToProject(db types.Conn, ce *ContentEntry, projectID int64, userID int64, policy string) error {
+	labels, values, err := mapEntryMetadata(db, ce, projectID)
+	if err != nil {
+		return err
+	}
+	moved := *ce
+	moved.ProjectID = projectID
+	moved.UpdatedBy = userID
+	moved.Assignees, err = filterProjectReaders(db, projectID, ce.Assignees)
+	if err != nil {
+		return err
+	}
+	if err := UpdateContentEntry(db, moved.ID, &moved); err != nil {
+		return err
+	}
+	if err := replaceEntryMetadata(db, moved.ID, labels, values); err != nil {
+		return err
+	}
+	if err := setAttachmentsProject(db, moved.ID, projectID); err != nil {
+		return err
+	}
+	return applyPermissionPolicy(db, "content_entry", moved.ID, projectID, userID, policy)
+}
+
+// getTransferTarget loads the destination list of a copy or move.
+func getTransferTarget(db types.Conn, listID int64) (*ContentList, error) {
+	target, err := GetContentList(db, listID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: target list not found", ErrInvalidTransfer)
+	}
+	if target.ArchivedAt != 0 {
+		return nil, fmt.Errorf("%w: target list is archived", ErrInvalidTransfer)
+	}
+	return target, nil
+}
+
+// mapEntryMetadata maps the entry's labels and custom field values onto the labels and fields of
+// the same name in projectID. Values that have no counterpart, or whose select option does not
+// exist there, are dropped.
+func mapEntryMetadata(db types.Conn, ce *ContentEntry, projectID int64) ([]int64, []CustomFieldValue, error) {
+	if ce.ProjectID == projectID {
+		return ce.Labels, ce.CustomFields, nil
+	}
+
+	srcLabels, err := GetLabelsByProject(db, ce.ProjectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	dstLabels, err := GetLabelsByProject(db, projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	labelNames := make(map[int64]string, len(srcLabels))
+	for _, l := range srcLabels {
+		labelNames[l.ID] = strings.ToLower(l.Name)
+	}
+	labels := make([]int64, 0, len(ce.Labels))
+	for _, labelID := range ce.Labels {
+		for _, l := range dstLabels {
+			if strings.ToLower(l.Name) == labelNames[labelID] {
+				labels = append(labels, l.ID)
+				break
+			}
+		}
+	}
+
+	srcFields, err := GetCustomFieldsByProject(db, ce.ProjectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	dstFields, err := GetCustomFieldsByProject(db, projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make([]CustomFieldValue, 0, len(ce.CustomFields))
+	for _, v := range ce.CustomFields {
+		for _, src := range srcFields {
+			if src.ID != v.FieldID {
+				continue
+			}
+			for _, dst := range dstFields {
+				if dst.Name != src.Name || dst.Type != src.Type {
+					continue
+				}
+				if value := mapSelectValue(&dst, v.Value); value != nil {
+					values = append(values, CustomFieldValue{FieldID: dst.ID, Value: value})
+				}
+				break
+			}
+		}
+	}
+	return labels, values, nil
+}
+
+// mapSelectValue drops select options the field does not have; other values pass through.
+func mapSelectValue(f *CustomField, value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if f.Type == CustomFieldTypeSingleSelect && !containsString(f.Options, v) {
+			return nil
+		}
+	case []string:
+		kept := make([]string, 0, len(v))
+		for _, option := range v {
+			if containsString(f.Options, option) {
+				kept = append(kept, option)
+			}
+		}
+		if len(kept) == 0 {
+			return nil
+		}
+		return kept
+	}
+	return value
+}
+
+// replaceEntryMetadata sets the entry's labels and custom field values, removing any others.
+func replaceEntryMetadata(db types.Conn, entryID int64, labels []int64, values []CustomFieldValue) error {
+	if _, err := db.Delete("content_entry_label", dbhelper.Cond().Eq("entry_id", entryID).Build()); err != nil {
+		return err
+	}
+	for _, labelID := range labels {
+		if _, err := addEntryLabel(db, entryID, labelID); err != nil {
+			return err
+		}
+	}
+	if err := DeleteCustomFieldValuesByEntry(db, entryID); err != nil {
+		return err
+	}
+	for _, v := range values {
+		if err := setCustomFieldValue(db, entryID, &CustomField{ID: v.FieldID}, v.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setAttachmentsProject(db types.Conn, entryID int64, projectID int64) error {
+	cond := dbhelper.Cond().Eq("entry_id", entryID).Build()
+	upd := dbhelper.Cond().Eq("project_id", projectID).Build()
+	_, err := db.Update("attachment", cond, upd)
+	return err
+}
+
+// filterProjectReaders keeps the users that can read the project.
+func filterProjectReaders(db types.Conn, projectID int64, userIDs []int64) ([]int64, error) {
+	kept := make([]int64, 0, len(userIDs))
+	for _, userID := range userIDs {
+		ok, err := HasPermission(db, userID, "project", projectID, "read")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			kept = append(kept, userID)
+		}
+	}
+	return kept, nil
+}
+
+// applyPermissionPolicy replaces the detail permissions on moved content according to policy.
+// Under the keep policy nothing changes.
+func applyPermissionPolicy(db types.Conn, contentType string, contentID int64, projectID int64, userID int64, policy string) error {
+	if policy == PermissionPolicyKeep {
+		return nil
+	}
+	grants, err := getDetailPermissionsFor(db, contentType, contentID)
+	if err != nil {
+		return err
+	}
+	for _, dp := range grants {
+		dp.ContentIDs = removeID(dp.ContentIDs, contentID)
+		if len(dp.ContentIDs) == 0 {
+			err = DeleteDetailPermission(db, dp.ID)
+		} else {
+			err = UpdateDetailPermission(db, dp.ID, &dp)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return grantByPolicy(db, contentType, contentID, projectID, userID, policy)
+}
+
+// grantByPolicy grants access to content under the destination or owner policy.
+func grantByPolicy(db types.Conn, contentType string, contentID int64, projectID int64, userID int64, policy string) error {
+	if policy == PermissionPolicyOwner {
+		for _, action := range []string{"admin", "read"} {
+			if err := grantDetailPermission(db, userID, contentType, contentID, action); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	members, err := GetProjectPermissions(db, projectID)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		if err := grantDetailPermission(db, m.UserID, contentType, contentID, m.PermissionLevel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func grantDetailPermission(db types.Conn, userID int64, contentType string, contentID int64, action string) error {
+	_, err := CreateDetailPermission(db, &DetailPermission{UserID: userID, ContentType: contentType, ContentIDs: []int64{contentID}, Action: action})
+	return err
+}
+
+// getDetailPermissionsFor returns the detail permissions of the content type that include contentID.
+func getDetailPermissionsFor(db types.Conn, contentType string, contentID int64) ([]DetailPermission, error) {
+	dps, err := GetDetailPermissions(db)
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]DetailPermission, 0)
+	for _, dp := range dps {
+		if dp.ContentType == contentType && containsID(dp.ContentIDs, contentID) {
+			matched = append(matched, dp)
+		}
+	}
+	return matched, nil
+}
+
+// insertID inserts id at position; a negative position or one past the end appends.
+func insertID(ids []int64, id int64, position int) []int64 {
+	if position < 0 || position > len(ids) {
+		position = len(ids)
+	}
+	out := make([]int64, 0, len(ids)+1)
+	out = append(out, ids[:position]...)
+	out = append(out, id)
+	return append(out, ids[position:]...)
+}
+
+func removeID(ids []int64, id int64) []int64 {
+	out := make([]int64, 0, len(ids))
+	for _, v := range ids {
+		if v != id {
+			out = append(out, v)
+		}
+	}
+	return out
+}
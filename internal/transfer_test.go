@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMoveContentEntryAcrossProjects(t *testing.T) {
+	db := newTestDB(t)
+
+	srcLabel, _ := CreateLabel(db, &Label{ProjectID: 1, Name: "Bug"})
+	CreateLabel(db, &Label{ProjectID: 1, Name: "only-here"})
+	dstLabel, _ := CreateLabel(db, &Label{ProjectID: 2, Name: "bug"})
+	srcField := CustomField{ProjectID: 1, Name: "Priority", Type: CustomFieldTypeSingleSelect, Options: []string{"high", "low"}}
+	srcField.ID, _ = CreateCustomField(db, &srcField)
+	dstField := CustomField{ProjectID: 2, Name: "Priority", Type: CustomFieldTypeSingleSelect, Options: []string{"high"}}
+	dstField.ID, _ = CreateCustomField(db, &dstField)
+
+	// GetProjectPermissions 只返回存在的用户
+	for i := 1; i <= 6; i++ {
+		CreateUser(db, &User{Username: fmt.Sprintf("user%d", i)})
+	}
+	grant(t, db, 5, "project", 1, "read")
+	grant(t, db, 6, "project", 2, "write")
+	grant(t, db, 6, "project", 1, "read")
+
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: 1, Assignees: []int64{5, 6}})
+	e2, _ := CreateContentEntry(db, &ContentEntry{Title: "E2", ProjectID: 1})
+	AddEntryLabel(db, e1, srcLabel, 1)
+	SetCustomFieldValue(db, e1, &srcField, "high", 1)
+	grant(t, db, 5, "content_entry", e1, "write")
+	srcList, _ := CreateContentList(db, &ContentList{Title: "Src", ProjectID: 1, Items: []int64{e1, e2}})
+	e3, _ := CreateContentEntry(db, &ContentEntry{Title: "E3", ProjectID: 2})
+	dstList, _ := CreateContentList(db, &ContentList{Title: "Dst", ProjectID: 2, Items: []int64{e3}})
+
+	if err := MoveContentEntry(db, e1, dstList, 0, 6, PermissionPolicyDestination); err != nil {
+		t.Fatalf("移动条目失败: %v", err)
+	}
+
+	src, _ := GetContentList(db, srcList)
+	dst, _ := GetContentList(db, dstList)
+	if len(src.Items) != 1 || src.Items[0] != e2 || len(dst.Items) != 2 || dst.Items[0] != e1 {
+		t.Fatalf("两个列表的 Items 应同时更新: src=%v dst=%v", src.Items, dst.Items)
+	}
+	moved, _ := GetContentEntry(db, e1)
+	if moved.ProjectID != 2 || len(moved.Assignees) != 1 || moved.Assignees[0] != 6 {
+		t.Fatalf("应改写项目并移除无权访问的负责人: %+v", moved)
+	}
+	if len(moved.Labels) != 1 || moved.Labels[0] != dstLabel {
+		t.Fatalf("标签应按名称映射: %v", moved.Labels)
+	}
+	if CustomFieldValueOf(moved, dstField.ID) != "high" {
+		t.Fatalf("自定义字段值应映射到目标项目的同名字段: %+v", moved.CustomFields)
+	}
+	if ok, _ := HasPermission(db, 5, "content_entry", e1, "read"); ok {
+		t.Fatal("destination 策略应移除原有的条目权限")
+	}
+	if ok, _ := HasPermission(db, 6, "content_entry", e1, "write"); !ok {
+		t.Fatal("destination 策略应按目标项目成员的级别授权")
+	}
+}
+
+func TestCopyContentEntryKeepsOriginal(t *testing.T) {
+	db := newTestDB(t)
+
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", Content: "body", ProjectID: 1})
+	grant(t, db, 5, "content_entry", e1, "read")
+	srcList, _ := CreateContentList(db, &ContentList{Title: "Src", ProjectID: 1, Items: []int64{e1}})
+	e2, _ := CreateContentEntry(db, &ContentEntry{Title: "E2", ProjectID: 2})
+	dstList, _ := CreateContentList(db, &ContentList{Title: "Dst", ProjectID: 2, Items: []int64{e2}})
+	CreateAttachment(db, &Attachment{EntryID: e1, ProjectID: 1, Filename: "a.txt", Hash: "abc"})
+
+	newID, err := CopyContentEntry(db, e1, dstList, -1, 6, PermissionPolicyKeep)
+	if err != nil {
+		t.Fatalf("复制条目失败: %v", err)
+	}
+	src, _ := GetContentList(db, srcList)
+	dst, _ := GetContentList(db, dstList)
+	if len(src.Items) != 1 || len(dst.Items) != 2 || dst.Items[1] != newID {
+		t.Fatalf("副本应追加到目标列表且原列表不变: src=%v dst=%v", src.Items, dst.Items)
+	}
+	copied, _ := GetContentEntry(db, newID)
+	if copied.Content != "body" || copied.ProjectID != 2 || copied.CreatorID != 6 {
+		t.Fatalf("副本属性错误: %+v", copied)
+	}
+	if ok, _ := HasPermission(db, 5, "content_entry", newID, "read"); !ok {
+		t.Fatal("keep 策略应复制原条目的权限")
+	}
+	if ok, _ := HasPermission(db, 6, "content_entry", newID, "admin"); !ok {
+		t.Fatal("复制者应成为副本的管理员")
+	}
+	attachments, _ := GetAttachmentsByEntry(db, newID)
+	if len(attachments) != 1 || attachments[0].Hash != "abc" || attachments[0].ProjectID != 2 {
+		t.Fatalf("附件应与原条目共享内容: %+v", attachments)
+	}
+
+	if _, err := CopyContentEntry(db, e1, 999, -1, 6, PermissionPolicyKeep); !errors.Is(err, ErrInvalidTransfer) {
+		t.Fatalf("目标列表不存在时应报错, got %v", err)
+	}
+	if _, err := ValidatePermissionPolicy("everyone"); !errors.Is(err, ErrInvalidTransfer) {
+		t.Fatalf("未知策略应被拒绝, got %v", err)
+	}
+}
+
+func TestMoveContentList(t *testing.T) {
+	db := newTestDB(t)
+
+	srcID, _ := CreateProject(db, &Project{Name: "Src"})
+	e1, _ := CreateContentEntry(db, &ContentEntry{Title: "E1", ProjectID: srcID})
+	listID, _ := CreateContentList(db, &ContentList{Title: "L", ProjectID: srcID, Items: []int64{e1}})
+
+	if err := MoveContentList(db, listID, 42, 1, PermissionPolicyKeep); !errors.Is(err, ErrInvalidTransfer) {
+		t.Fatalf("目标项目不存在时应报错, got %v", err)
+	}
+	projectID, _ := CreateProject(db, &Project{Name: "Dst"})
+	// 需要列表中每个条目的写权限，否则不移动任何内容
+	if err := MoveContentList(db, listID, projectID, 1, PermissionPolicyOwner); !errors.Is(err, ErrTransferForbidden) || !strings.Contains(err.Error(), fmt.Sprint(e1)) {
+		t.Fatalf("缺少条目写权限时应拒绝并列出条目, got %v", err)
+	}
+	if cl, _ := GetContentList(db, listID); cl.ProjectID != srcID {
+		t.Fatal("被拒绝的移动不应改动列表")
+	}
+	grant(t, db, 1, "content_entry", e1, "write")
+	if err := MoveContentList(db, listID, projectID, 1, PermissionPolicyOwner); err != nil {
+		t.Fatalf("移动列表失败: %v", err)
+	}
+	cl, _ := GetContentList(db, listID)
+	ce, _ := GetContentEntry(db, e1)
+	if cl.ProjectID != projectID || ce.ProjectID != projectID {
+		t.Fatalf("列表及其条目应移动到目标项目: list=%d entry=%d", cl.ProjectID, ce.ProjectID)
+	}
+	if ok, _ := HasPermission(db, 1, "content_list", listID, "admin"); !ok {
+		t.Fatal("owner 策略应授予操作者管理员权限")
+	}
+}
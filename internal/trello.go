@@ -0,0 +1,340 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+// ErrInvalidImport is returned when an import file cannot be read.
+var ErrInvalidImport = errors.New("invalid import file")
+
+// trelloLabelColors maps Trello's named label colors to hex colors. The _light and _dark shades
+// use the base color.
+var trelloLabelColors = map[string]string{
+	"green":  "#61bd4f",
+	"yellow": "#f2d600",
+	"orange": "#ff9f1a",
+	"red":    "#eb5a46",
+	"purple": "#c377e0",
+	"blue":   "#0079bf",
+	"sky":    "#00c2e0",
+	"lime":   "#51e898",
+	"pink":   "#ff78cb",
+	"black":  "#344563",
+}
+
+// trelloBoard is the part of a Trello board JSON export that is imported.
+type trelloBoard struct {
+	Name         string            `json:"name"`
+	Desc         string            `json:"desc"`
+	Labels       []trelloLabel     `json:"labels"`
+	Lists        []trelloList      `json:"lists"`
+	Cards        []trelloCard      `json:"cards"`
+	Checklists   []trelloChecklist `json:"checklists"`
+	Actions      []trelloAction    `json:"actions"`
+	CustomFields []trelloNamed     `json:"customFields"`
+}
+
+type trelloNamed struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type trelloLabel struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type trelloList struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	Closed bool    `json:"closed"`
+	Pos    float64 `json:"pos"`
+}
+
+type trelloCard struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Desc        string       `json:"desc"`
+	Closed      bool         `json:"closed"`
+	IDList      string       `json:"idList"`
+	Pos         float64      `json:"pos"`
+	Start       string       `json:"start"`
+	Due         string       `json:"due"`
+	IDLabels    []string     `json:"idLabels"`
+	IDMembers   []string     `json:"idMembers"`
+	Attachments []trelloFile `json:"attachments"`
+}
+
+type trelloFile struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type trelloChecklist struct {
+	ID         string            `json:"id"`
+	IDCard     string            `json:"idCard"`
+	Name       string            `json:"name"`
+	Pos        float64           `json:"pos"`
+	CheckItems []trelloCheckItem `json:"checkItems"`
+}
+
+type trelloCheckItem struct {
+	Name  string  `json:"name"`
+	State string  `json:"state"` // complete 或 incomplete
+	Pos   float64 `json:"pos"`
+}
+
+type trelloAction struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Card trelloNamed `json:"card"`
+	} `json:"data"`
+}
+
+// ImportTrelloBoard creates a project owned by ownerID from a Trello board JSON export: a list per
+// Trello list and an entry per card, in Trello's order, with descriptions, due and start dates,
+// labels and archived state. Checklists become markdown task lists in the entry content and
+// attachments become links, since Liteboard has neither. Comments, members and custom fields are
+// reported as skipped. Either everything is imported or nothing is (see runInTx).
+func ImportTrelloBoard(db types.Conn, data []byte, ownerID int64) (*ImportReport, error) {
+	var board trelloBoard
+	if err := json.Unmarshal(data, &board); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	if board.Name == "" && len(board.Lists) == 0 && len(board.Cards) == 0 {
+		return nil, fmt.Errorf("%w: not a Trello board export", ErrInvalidImport)
+	}
+	var report *ImportReport
+	err := runInTx(db, "ImportTrelloBoard", func(db types.Conn) error {
+		var err error
+		report, err = importTrelloBoard(db, &board, ownerID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func importTrelloBoard(db types.Conn, board *trelloBoard, ownerID int64) (*ImportReport, error) {
+	report := &ImportReport{Skipped: []ImportSkip{}}
+	skip := func(typ, id, name, reason string) {
+		report.Skipped = append(report.Skipped, ImportSkip{Type: typ, ID: id, Name: name, Reason: reason})
+	}
+
+	p := &Project{Name: strings.TrimSpace(board.Name), Description: board.Desc, CreatorID: ownerID}
+	if p.Name == "" {
+		p.Name = "Trello import"
+	}
+	id, err := CreateProject(db, p)
+	if err != nil {
+		return nil, err
+	}
+	p.ID = id
+	for _, action := range []string{"admin", "read"} {
+		if _, err := CreateDetailPermission(db, &DetailPermission{UserID: ownerID, ContentType: "project", ContentIDs: []int64{p.ID}, Action: action}); err != nil {
+			return nil, err
+		}
+	}
+
+	// Trello 允许同名标签，同名（不区分大小写）的合并为一个
+	labelMap := make(map[string]int64, len(board.Labels))
+	byName := make(map[string]int64, len(board.Labels))
+	for _, tl := range board.Labels {
+		l := Label{ProjectID: p.ID, Name: tl.Name, Color: trelloLabelColor(tl.Color)}
+		if strings.TrimSpace(l.Name) == "" {
+			l.Name = tl.Color
+		}
+		if err := ValidateLabel(&l); err != nil {
+			skip("label", tl.ID, tl.Name, "label has neither a name nor a color")
+			continue
+		}
+		if existing, ok := byName[strings.ToLower(l.Name)]; ok {
+			labelMap[tl.ID] = existing
+			continue
+		}
+		labelID, err := CreateLabel(db, &l)
+		if err != nil {
+			return nil, err
+		}
+		labelMap[tl.ID] = labelID
+		byName[strings.ToLower(l.Name)] = labelID
+		report.Labels++
+	}
+
+	checklists := make(map[string][]trelloChecklist)
+	for _, cl := range board.Checklists {
+		checklists[cl.IDCard] = append(checklists[cl.IDCard], cl)
+	}
+	comments := make(map[string]int)
+	for _, a := range board.Actions {
+		if a.Type == "commentCard" {
+			comments[a.Data.Card.ID]++
+		}
+	}
+	for _, f := range board.CustomFields {
+		skip("custom_field", f.ID, f.Name, "Trello custom fields are not imported")
+	}
+
+	cards := make(map[string][]trelloCard)
+	known := make(map[string]bool, len(board.Lists))
+	for _, tl := range board.Lists {
+		known[tl.ID] = true
+	}
+	for _, card := range board.Cards {
+		if !known[card.IDList] {
+			skip("card", card.ID, card.Name, "card belongs to a list that is not in the export")
+			continue
+		}
+		cards[card.IDList] = append(cards[card.IDList], card)
+	}
+
+	lists := append([]trelloList{}, board.Lists...)
+	sort.SliceStable(lists, func(a, b int) bool { return lists[a].Pos < lists[b].Pos })
+	now := time.Now().Unix()
+	var closedLists []int64
+	for _, tl := range lists {
+		listCards := cards[tl.ID]
+		sort.SliceStable(listCards, func(a, b int) bool { return listCards[a].Pos < listCards[b].Pos })
+		cl := &ContentList{Title: tl.Name, Items: []int64{}, CreatorID: ownerID, ProjectID: p.ID}
+		var closedCards []int64
+		for _, card := range listCards {
+			entryID, err := importTrelloCard(db, &card, p.ID, ownerID, labelMap, checklists[card.ID], skip)
+			if err != nil {
+				return nil, err
+			}
+			if n := comments[card.ID]; n > 0 {
+				skip("comment", card.ID, card.Name, fmt.Sprintf("%d comment(s) not imported", n))
+			}
+			cl.Items = append(cl.Items, entryID)
+			if card.Closed {
+				closedCards = append(closedCards, entryID)
+			}
+			report.Entries++
+		}
+		listID, err := CreateContentList(db, cl)
+		if err != nil {
+			return nil, err
+		}
+		for _, action := range []string{"admin", "read"} {
+			if err := grantDetailPermission(db, ownerID, "content_list", listID, action); err != nil {
+				return nil, err
+			}
+		}
+		report.Lists++
+		cl.ID = listID
+		// 从后往前归档，使记录的位置与 Trello 中一致
+		for i := len(closedCards) - 1; i >= 0; i-- {
+			entryID := closedCards[i]
+			if err := ArchiveContentEntry(db, entryID, now); err != nil {
+				return nil, err
+			}
+		}
+		if tl.Closed {
+			closedLists = append(closedLists, listID)
+		}
+	}
+	for _, listID := range closedLists {
+		if err := ArchiveContentList(db, listID, now); err != nil {
+			return nil, err
+		}
+	}
+	report.Project = *p
+	return report, nil
+}
+
+// importTrelloCard creates the entry for a card and returns its ID.
+func importTrelloCard(db types.Conn, card *trelloCard, projectID, ownerID int64, labelMap map[string]int64, checklists []trelloChecklist, skip func(typ, id, name, reason string)) (int64, error) {
+	ce := ContentEntry{
+		Title:     card.Name,
+		Content:   trelloCardContent(card, checklists),
+		CreatorID: ownerID,
+		ProjectID: projectID,
+		StartAt:   parseTrelloTime(card.Start),
+		DueAt:     parseTrelloTime(card.Due),
+	}
+	id, err := CreateContentEntry(db, &ce)
+	if err != nil {
+		return 0, err
+	}
+	for _, action := range []string{"admin", "read"} {
+		if err := grantDetailPermission(db, ownerID, "content_entry", id, action); err != nil {
+			return 0, err
+		}
+	}
+	added := make(map[int64]bool)
+	for _, trelloID := range card.IDLabels {
+		labelID, ok := labelMap[trelloID]
+		if !ok || added[labelID] {
+			continue
+		}
+		if _, err := addEntryLabel(db, id, labelID); err != nil {
+			return 0, err
+		}
+		added[labelID] = true
+	}
+	if len(card.IDMembers) > 0 {
+		skip("member", card.ID, card.Name, "Trello members are not mapped to users, assignees left empty")
+	}
+	for _, f := range card.Attachments {
+		skip("attachment", f.ID, f.Name, "file not copied, linked from the entry content")
+	}
+	return id, nil
+}
+
+// trelloCardContent is the card description followed by its checklists as markdown task lists
+// and its attachments as links.
+func trelloCardContent(card *trelloCard, checklists []trelloChecklist) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(card.Desc))
+	sort.SliceStable(checklists, func(a, c int) bool { return checklists[a].Pos < checklists[c].Pos })
+	for _, cl := range checklists {
+		fmt.Fprintf(&b, "\n\n### %s\n", cl.Name)
+		items := append([]trelloCheckItem{}, cl.CheckItems...)
+		sort.SliceStable(items, func(a, c int) bool { return items[a].Pos < items[c].Pos })
+		for _, item := range items {
+			mark := " "
+			if item.State == "complete" {
+				mark = "x"
+			}
+			fmt.Fprintf(&b, "\n- [%s] %s", mark, item.Name)
+		}
+	}
+	if len(card.Attachments) > 0 {
+		b.WriteString("\n\n### Attachments\n")
+		for _, f := range card.Attachments {
+			fmt.Fprintf(&b, "\n- [%s](%s)", f.Name, f.URL)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func trelloLabelColor(color string) string {
+	base, _, _ := strings.Cut(color, "_")
+	if hex, ok := trelloLabelColors[base]; ok {
+		return hex
+	}
+	return DefaultLabelColor
+}
+
+// parseTrelloTime parses Trello's ISO 8601 timestamps; empty or malformed values give 0.
+func parseTrelloTime(s string) int64 {
+	if s == "" {
+		return 0
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
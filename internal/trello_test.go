@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const trelloExport = `{
+  "name": "Roadmap",
+  "desc": "Q3 plans",
+  "labels": [
+    {"id": "l1", "name": "Bug", "color": "red"},
+    {"id": "l2", "name": "", "color": "green_dark"},
+    {"id": "l3", "name": "bug", "color": "orange"},
+    {"id": "l4", "name": "", "color": null}
+  ],
+  "lists": [
+    {"id": "L2", "name": "Done", "closed": false, "pos": 32768},
+    {"id": "L1", "name": "Todo", "closed": false, "pos": 16384},
+    {"id": "L3", "name": "Old", "closed": true, "pos": 65536}
+  ],
+  "cards": [
+    {"id": "c2", "name": "Second", "desc": "", "idList": "L1", "pos": 2, "idLabels": ["l2"], "closed": true},
+    {"id": "c1", "name": "First", "desc": "Fix it", "idList": "L1", "pos": 1, "due": "2024-05-01T12:00:00.000Z",
+     "idLabels": ["l1", "l3"], "idMembers": ["m1"], "attachments": [{"id": "a1", "name": "log.txt", "url": "https://trello.com/a1"}]},
+    {"id": "c3", "name": "Shipped", "idList": "L2", "pos": 1},
+    {"id": "c4", "name": "Ancient", "idList": "L3", "pos": 1},
+    {"id": "c5", "name": "Orphan", "idList": "L9", "pos": 1}
+  ],
+  "checklists": [
+    {"id": "k1", "idCard": "c1", "name": "Steps", "pos": 1, "checkItems": [
+      {"name": "Verify", "state": "incomplete", "pos": 2},
+      {"name": "Reproduce", "state": "complete", "pos": 1}
+    ]}
+  ],
+  "actions": [
+    {"id": "x1", "type": "commentCard", "data": {"card": {"id": "c1", "name": "First"}, "text": "+1"}},
+    {"id": "x2", "type": "updateCard", "data": {"card": {"id": "c1"}}}
+  ],
+  "customFields": [{"id": "f1", "name": "Points"}]
+}`
+
+func TestImportTrelloBoard(t *testing.T) {
+	db := newTestDB(t)
+	report, err := ImportTrelloBoard(db, []byte(trelloExport), 7)
+	if err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+	if report.Project.Name != "Roadmap" || report.Project.Description != "Q3 plans" || report.Lists != 3 || report.Entries != 4 || report.Labels != 2 {
+		t.Fatalf("导入报告不正确: %+v", report)
+	}
+	if ok, _ := HasPermission(db, 7, "project", report.Project.ID, "admin"); !ok {
+		t.Fatal("导入者应获得项目的 admin 权限")
+	}
+	skipped := map[string]int{}
+	for _, s := range report.Skipped {
+		skipped[s.Type]++
+	}
+	for _, typ := range []string{"card", "label", "member", "attachment", "comment", "custom_field"} {
+		if skipped[typ] != 1 {
+			t.Fatalf("应报告跳过的 %s: %+v", typ, report.Skipped)
+		}
+	}
+
+	// 列表按 pos 排序，已关闭的列表被归档
+	lists, _ := GetContentListsByProject(db, report.Project.ID)
+	titles := []string{}
+	for _, cl := range lists {
+		titles = append(titles, cl.Title)
+	}
+	if strings.Join(titles, ",") != "Todo,Done,Old" {
+		t.Fatalf("列表顺序不正确: %v", titles)
+	}
+	if lists[2].ArchivedAt == 0 || lists[0].ArchivedAt != 0 {
+		t.Fatal("已关闭的列表应被归档")
+	}
+
+	// 已关闭的卡片被归档，取消归档时回到原位置
+	todo := lists[0]
+	if len(todo.Items) != 1 {
+		t.Fatalf("已关闭的卡片应移出列表: %v", todo.Items)
+	}
+	first, _ := GetContentEntry(db, todo.Items[0])
+	if first.Title != "First" || first.DueAt != 1714564800 {
+		t.Fatalf("卡片字段不正确: %+v", first)
+	}
+	if !strings.HasPrefix(first.Content, "Fix it\n\n### Steps\n\n- [x] Reproduce\n- [ ] Verify") || !strings.Contains(first.Content, "[log.txt](https://trello.com/a1)") {
+		t.Fatalf("清单和附件应写入内容: %q", first.Content)
+	}
+	if len(first.Labels) != 1 {
+		t.Fatalf("同名标签应合并: %v", first.Labels)
+	}
+	for _, action := range []string{"read", "write"} {
+		if ok, _ := HasPermission(db, 7, "content_entry", first.ID, action); !ok {
+			t.Fatalf("导入者应能%s导入的卡片", action)
+		}
+		if ok, _ := HasPermission(db, 7, "content_list", todo.ID, action); !ok {
+			t.Fatalf("导入者应能%s导入的列表", action)
+		}
+	}
+	archived, _ := GetArchivedItems(db, report.Project.ID)
+	if len(archived.Entries) != 2 {
+		t.Fatalf("应有两张归档卡片: %+v", archived.Entries)
+	}
+	for _, ce := range archived.Entries {
+		if ce.Title == "Second" {
+			if ce.ArchivedPosition != 1 || len(ce.Labels) != 1 {
+				t.Fatalf("归档位置或标签不正确: %+v", ce)
+			}
+			l, _ := GetLabel(db, ce.Labels[0])
+			if l.Name != "green_dark" || l.Color != "#61bd4f" {
+				t.Fatalf("无名标签应以颜色命名: %+v", l)
+			}
+		}
+	}
+
+	if _, err := ImportTrelloBoard(db, []byte(`{"foo": 1}`), 7); !errors.Is(err, ErrInvalidImport) {
+		t.Fatalf("应拒绝非 Trello 导出文件, got %v", err)
+	}
+	if _, err := ImportTrelloBoard(db, []byte(`not json`), 7); !errors.Is(err, ErrInvalidImport) {
+		t.Fatalf("应拒绝无效的 JSON, got %v", err)
+	}
+}
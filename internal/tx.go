@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// Database is the application's SQLite database. Single statements run on the embedded
+// connection; multi-step operations run through runInTx on a second connection that Database keeps
+// for transactions, so other requests keep reading the last committed state while one is open.
+type Database struct {
+	types.Conn
+	txMu sync.Mutex
+	tx   types.Conn
+}
+
+// OpenDatabase opens the database described by cfg once for single statements and once for
+// transactions. cfg must name a database file: every connection to ":memory:" is a database of
+// its own.
+func OpenDatabase(cfg types.DBConfig) (*Database, error) {
+	conn, err := dbhelper.Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := dbhelper.Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Database{Conn: conn, tx: tx}, nil
+}
+
+func (d *Database) database() *Database {
+	return d
+}
+
+// txConn is the connection handed to an operation running in a transaction. Operations started
+// with it join that transaction.
+type txConn struct {
+	types.Conn
+}
+
+// errNoTransactions is returned by runInTx for a connection that was not opened by OpenDatabase.
+var errNoTransactions = errors.New("database connection does not support transactions")
+
+// runInTx runs op in a SQLite transaction, committing its writes if it succeeds and rolling all
+// of them back if it fails or panics. BEGIN IMMEDIATE takes the write lock up front, so
+// transactions run one at a time; reads on other connections are not held up and never see a
+// half-applied operation. op must use the connection it is given.
+func runInTx(db types.Conn, name string, op func(db types.Conn) error) error {
+	if tx, ok := db.(*txConn); ok {
+		return op(tx)
+	}
+	src, ok := db.(interface{ database() *Database })
+	if !ok {
+		return errNoTransactions
+	}
+	d := src.database()
+	d.txMu.Lock()
+	defer d.txMu.Unlock()
+
+	if _, err := d.tx.Exec(dbhelper.Cond().Raw("BEGIN IMMEDIATE").Build()); err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		if _, err := d.tx.Exec(dbhelper.Cond().Raw("ROLLBACK").Build()); err != nil {
+			hlog.Errorf("%s: rollback failed, error=%v", name, err)
+		}
+	}()
+	if err := op(&txConn{Conn: d.tx}); err != nil {
+		return err
+	}
+	if _, err := d.tx.Exec(dbhelper.Cond().Raw("COMMIT").Build()); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Kaguya154/dbhelper/types"
+)
+
+func TestTransactionIsolation(t *testing.T) {
+	db := newTestDB(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- runInTx(db, "test", func(db types.Conn) error {
+			if _, err := CreateProject(db, &Project{Name: "half", CreatorID: 1}); err != nil {
+				return err
+			}
+			close(started)
+			<-release
+			return errors.New("boom")
+		})
+	}()
+	<-started
+
+	// 事务进行中时其他读取不等待，也看不到未提交的写入
+	rows, err := db.Query("project", nil)
+	if err != nil || rows.Count() != 0 {
+		t.Fatalf("不应看到未提交的写入: %v", err)
+	}
+	close(release)
+	if err := <-done; err == nil {
+		t.Fatal("操作应返回错误")
+	}
+	if rows, _ := db.Query("project", nil); rows.Count() != 0 {
+		t.Fatalf("失败的事务应回滚: %d", rows.Count())
+	}
+
+	err = runInTx(db, "test", func(db types.Conn) error {
+		_, err := CreateProject(db, &Project{Name: "whole", CreatorID: 1})
+		return err
+	})
+	if rows, _ := db.Query("project", nil); err != nil || rows.Count() != 1 {
+		t.Fatalf("成功的事务应提交: %v", err)
+	}
+}
+
+func TestTransactionRollsBackOnPanic(t *testing.T) {
+	db := newTestDB(t)
+	func() {
+		defer func() { recover() }()
+		runInTx(db, "test", func(db types.Conn) error {
+			CreateProject(db, &Project{Name: "half", CreatorID: 1})
+			panic("boom")
+		})
+	}()
+	if rows, _ := db.Query("project", nil); rows.Count() != 0 {
+		t.Fatal("panic 的事务应回滚")
+	}
+
+	// 嵌套的操作加入外层事务，随外层一起回滚
+	err := runInTx(db, "outer", func(tx types.Conn) error {
+		if err := runInTx(tx, "inner", func(db types.Conn) error {
+			_, err := CreateProject(db, &Project{Name: "inner", CreatorID: 1})
+			return err
+		}); err != nil {
+			return err
+		}
+		return errors.New("boom")
+	})
+	if rows, _ := db.Query("project", nil); err == nil || rows.Count() != 0 {
+		t.Fatalf("嵌套操作应随外层事务回滚: %v", err)
+	}
+}
@@ -0,0 +1,474 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Kaguya154/dbhelper"
+	"github.com/Kaguya154/dbhelper/types"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// Webhook events
+const (
+	WebhookProjectUpdated    = "project.updated"
+	WebhookProjectDeleted    = "project.deleted"
+	WebhookListCreated       = "list.created"
+	WebhookListUpdated       = "list.updated"
+	WebhookListDeleted       = "list.deleted"
+	WebhookEntryCreated      = "entry.created"
+	WebhookEntryUpdated      = "entry.updated"
+	WebhookEntryMoved        = "entry.moved"
+	WebhookEntryDeleted      = "entry.deleted"
+	WebhookPermissionGranted = "permission.granted"
+	WebhookPermissionRevoked = "permission.revoked"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to.
+var WebhookEvents = []string{
+	WebhookProjectUpdated, WebhookProjectDeleted,
+	WebhookListCreated, WebhookListUpdated, WebhookListDeleted,
+	WebhookEntryCreated, WebhookEntryUpdated, WebhookEntryMoved, WebhookEntryDeleted,
+	WebhookPermissionGranted, WebhookPermissionRevoked,
+}
+
+// Delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+const (
+	// MaxWebhookAttempts is how many times a delivery is tried before it is marked failed.
+	MaxWebhookAttempts = 6
+	// webhookRetryBase is the delay before the first retry, in seconds; it doubles with each attempt.
+	webhookRetryBase = 30
+	// webhookResponseLimit caps the response body kept in the delivery log.
+	webhookResponseLimit = 1024
+	// WebhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body keyed with the secret.
+	WebhookSignatureHeader = "X-Liteboard-Signature"
+	WebhookEventHeader     = "X-Liteboard-Event"
+	WebhookDeliveryHeader  = "X-Liteboard-Delivery"
+)
+
+var (
+	// ErrInvalidWebhook is returned for a webhook with an unusable URL or unknown events.
+	ErrInvalidWebhook = errors.New("invalid webhook")
+	// ErrWebhookNotFound is returned for unknown webhooks and deliveries.
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrBlockedAddress is returned when a webhook would reach a loopback, link-local or private
+	// address, which would let project admins probe the server's network.
+	ErrBlockedAddress = errors.New("webhook address not allowed")
+)
+
+// WebhookPayload is the JSON body of a delivery.
+type WebhookPayload struct {
+	Event     string      `json:"event"`
+	ProjectID int64       `json:"project_id"`
+	ActorID   int64       `json:"actor_id"`
+	CreatedAt int64       `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// ValidateWebhook checks the URL and the event filter. "*" and prefixes such as "entry.*" are
+// accepted in the filter. URLs naming an internal address directly are rejected; hostnames that
+// resolve to one are refused when delivering (see NewWebhookClient).
+func ValidateWebhook(w *Webhook) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	if err := checkWebhookHost(u.Hostname()); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	w.Events = normalizeStrings(w.Events)
+	for _, e := range w.Events {
+		if !isWebhookEventPattern(e) {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, e)
+		}
+	}
+	return nil
+}
+
+// checkWebhookHost rejects localhost and IP literals of blocked addresses.
+func checkWebhookHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && isBlockedIP(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	return nil
+}
+
+// isBlockedIP reports whether ip is an address webhooks must not reach: loopback, link-local
+// (which includes cloud metadata endpoints), private, unspecified or multicast.
+func isBlockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsPrivate() ||
+		ip.IsUnspecified() || ip.IsMulticast()
+}
+
+// NewWebhookClient returns the HTTP client deliveries are sent with. Every connection, including
+// those made for redirects, is checked after DNS resolution and refused with ErrBlockedAddress if
+// it would reach a blocked address, so a hostname pointing at the server's network is no way in.
+// Proxies from the environment are not used, as the address they connect to cannot be checked.
+func NewWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isBlockedIP(ip) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return checkWebhookHost(req.URL.Hostname())
+		},
+	}
+}
+
+func isWebhookEventPattern(pattern string) bool {
+	if pattern == "*" || containsString(WebhookEvents, pattern) {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, ".*"); ok {
+		for _, e := range WebhookEvents {
+			if strings.HasPrefix(e, prefix+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// webhookWants reports whether the webhook's filter matches event.
+func webhookWants(w *Webhook, event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, pattern := range w.Events {
+		if pattern == "*" || pattern == event {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(event, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateWebhook validates and stores a webhook.
+func CreateWebhook(db types.Conn, w *Webhook) (int64, error) {
+	if err := ValidateWebhook(w); err != nil {
+		return 0, err
+	}
+	w.CreatedAt = time.Now().Unix()
+	eventsJson, _ := json.Marshal(w.Events)
+	cond := dbhelper.Cond().Eq("project_id", w.ProjectID).Eq("url", w.URL).Eq("secret", w.Secret).Eq("events", string(eventsJson)).
+		Eq("active", boolToInt(w.Active)).Eq("creator_id", w.CreatorID).Eq("created_at", w.CreatedAt).Build()
+	id, err := db.Insert("webhook", cond)
+	if err != nil {
+		return 0, err
+	}
+	w.ID = id
+	return id, nil
+}
+
+// GetWebhook returns a webhook by ID.
+func GetWebhook(db types.Conn, id int64) (*Webhook, error) {
+	rows, err := db.Query("webhook", dbhelper.Cond().Eq("id", id).Build())
+	if err != nil {
+		return nil, err
+	}
+	if rows.Count() == 0 {
+		return nil, ErrWebhookNotFound
+	}
+	w := webhookFromRow(rows.All()[0])
+	return &w, nil
+}
+
+// GetWebhooks returns the webhooks of a project ordered by ID.
+func GetWebhooks(db types.Conn, projectID int64) ([]Webhook, error) {
+	rows, err := db.Query("webhook", dbhelper.Cond().Eq("project_id", projectID).Build())
+	if err != nil {
+		return nil, err
+	}
+	webhooks := []Webhook{}
+	for _, data := range rows.All() {
+		webhooks = append(webhooks, webhookFromRow(data))
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+// UpdateWebhook validates and saves the URL, secret, events and active flag of a webhook.
+func UpdateWebhook(db types.Conn, id int64, w *Webhook) error {
+	if err := ValidateWebhook(w); err != nil {
+		return err
+	}
+	eventsJson, _ := json.Marshal(w.Events)
+	upd := dbhelper.Cond().Eq("url", w.URL).Eq("secret", w.Secret).Eq("events", string(eventsJson)).Eq("active", boolToInt(w.Active)).Build()
+	_, err := db.Update("webhook", dbhelper.Cond().Eq("id", id).Build(), upd)
+	return err
+}
+
+// DeleteWebhook deletes a webhook together with its delivery log.
+func DeleteWebhook(db types.Conn, id int64) error {
+	if _, err := db.Delete("webhook_delivery", dbhelper.Cond().Eq("webhook_id", id).Build()); err != nil {
+		return err
+	}
+	_, err := db.Delete("webhook", dbhelper.Cond().Eq("id", id).Build())
+	return err
+}
+
+// QueueWebhookEvent queues a delivery of the event for every active webhook of the project whose
+// filter matches, and returns how many were queued.
+func QueueWebhookEvent(db types.Conn, projectID int64, event string, actorID int64, data interface{}) (int, error) {
+	webhooks, err := GetWebhooks(db, projectID)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().Unix()
+	var payload []byte
+	queued := 0
+	for i := range webhooks {
+		w := &webhooks[i]
+		if !w.Active || !webhookWants(w, event) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(WebhookPayload{Event: event, ProjectID: projectID, ActorID: actorID, CreatedAt: now, Data: data}); err != nil {
+				return queued, err
+			}
+		}
+		if _, err := insertWebhookDelivery(db, w.ID, event, string(payload), now); err != nil {
+			return queued, err
+		}
+		queued++
+	}
+	return queued, nil
+}
+
+func insertWebhookDelivery(db types.Conn, webhookID int64, event string, payload string, now int64) (int64, error) {
+	cond := dbhelper.Cond().Eq("webhook_id", webhookID).Eq("event", event).Eq("payload", payload).Eq("status", DeliveryPending).
+		Eq("attempts", 0).Eq("response_code", 0).Eq("response_body", "").Eq("error", "").Eq("next_attempt_at", now).
+		Eq("created_at", now).Eq("delivered_at", 0).Build()
+	return db.Insert("webhook_delivery", cond)
+}
+
+// GetWebhookDelivery returns a delivery by ID.
+func GetWebhookDelivery(db types.Conn, id int64) (*WebhookDelivery, error) {
+	rows, err := db.Query("webhook_delivery", dbhelper.Cond().Eq("id", id).Build())
+	if err != nil {
+		return nil, err
+	}
+	if rows.Count() == 0 {
+		return nil, ErrWebhookNotFound
+	}
+	d := webhookDeliveryFromRow(rows.All()[0])
+	return &d, nil
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook, newest first; limit, when positive,
+// caps the number returned.
+func GetWebhookDeliveries(db types.Conn, webhookID int64, limit int) ([]WebhookDelivery, error) {
+	rows, err := db.Query("webhook_delivery", dbhelper.Cond().Eq("webhook_id", webhookID).Build())
+	if err != nil {
+		return nil, err
+	}
+	deliveries := []WebhookDelivery{}
+	for _, data := range rows.All() {
+		deliveries = append(deliveries, webhookDeliveryFromRow(data))
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+// RedeliverWebhookDelivery queues the payload of an earlier delivery again as a new delivery.
+func RedeliverWebhookDelivery(db types.Conn, deliveryID int64) (*WebhookDelivery, error) {
+	d, err := GetWebhookDelivery(db, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	id, err := insertWebhookDelivery(db, d.WebhookID, d.Event, d.Payload, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	return GetWebhookDelivery(db, id)
+}
+
+// SignWebhookPayload returns the signature header value for a body.
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ProcessWebhookDeliveries sends the pending deliveries that are due at now. A delivery succeeds on
+// a 2xx response; otherwise it is retried with exponential backoff until MaxWebhookAttempts is
+// reached, after which it is marked failed.
+func ProcessWebhookDeliveries(ctx context.Context, db types.Conn, client *http.Client, now int64) error {
+	rows, err := db.Query("webhook_delivery", dbhelper.Cond().Eq("status", DeliveryPending).Build())
+	if err != nil {
+		return err
+	}
+	pending := rows.All()
+	sort.Slice(pending, func(i, j int) bool { return asInt64(pending[i]["id"]) < asInt64(pending[j]["id"]) })
+	webhooks := map[int64]*Webhook{}
+	for _, data := range pending {
+		d := webhookDeliveryFromRow(data)
+		if d.NextAttemptAt > now {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		w, ok := webhooks[d.WebhookID]
+		if !ok {
+			if w, err = GetWebhook(db, d.WebhookID); err != nil && !errors.Is(err, ErrWebhookNotFound) {
+				return err
+			}
+			webhooks[d.WebhookID] = w
+		}
+		cond := dbhelper.Cond().Eq("id", d.ID).Build()
+		if w == nil || !w.Active {
+			// webhook 已删除或停用，不再重试
+			upd := dbhelper.Cond().Eq("status", DeliveryFailed).Eq("error", "webhook deleted or inactive").Build()
+			if _, err := db.Update("webhook_delivery", cond, upd); err != nil {
+				return err
+			}
+			continue
+		}
+		code, body, sendErr := sendWebhookDelivery(ctx, client, w, &d)
+		attempts := d.Attempts + 1
+		if sendErr == nil {
+			upd := dbhelper.Cond().Eq("status", DeliverySucceeded).Eq("attempts", attempts).Eq("response_code", code).
+				Eq("response_body", body).Eq("error", "").Eq("delivered_at", now).Build()
+			if _, err := db.Update("webhook_delivery", cond, upd); err != nil {
+				return err
+			}
+			continue
+		}
+		status := DeliveryPending
+		if attempts >= MaxWebhookAttempts {
+			status = DeliveryFailed
+		}
+		hlog.Errorf("ProcessWebhookDeliveries: delivery failed, deliveryID=%d, webhookID=%d, attempt=%d, error=%v", d.ID, w.ID, attempts, sendErr)
+		upd := dbhelper.Cond().Eq("status", status).Eq("attempts", attempts).Eq("response_code", code).Eq("response_body", body).
+			Eq("error", sendErr.Error()).Eq("next_attempt_at", now+webhookRetryBase<<(attempts-1)).Build()
+		if _, err := db.Update("webhook_delivery", cond, upd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendWebhookDelivery posts the payload and returns the response code and the start of the body.
+func sendWebhookDelivery(ctx context.Context, client *http.Client, w *Webhook, d *WebhookDelivery) (int, string, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "liteboard-webhook")
+	req.Header.Set(WebhookEventHeader, d.Event)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(w.Secret, body))
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, string(respBody), fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(respBody), nil
+}
+
+// RunWebhookWorker sends due deliveries every interval, and right away when wake receives, until
+// ctx is done.
+func RunWebhookWorker(ctx context.Context, db types.Conn, client *http.Client, interval time.Duration, wake <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := ProcessWebhookDeliveries(ctx, db, client, time.Now().Unix()); err != nil && ctx.Err() == nil {
+			hlog.Errorf("RunWebhookWorker: ProcessWebhookDeliveries failed, error=%v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+func webhookFromRow(data map[string]interface{}) Webhook {
+	w := Webhook{
+		ID:        asInt64(data["id"]),
+		ProjectID: asInt64(data["project_id"]),
+		URL:       asString(data["url"]),
+		Secret:    asString(data["secret"]),
+		Active:    asInt64(data["active"]) != 0,
+		CreatorID: asInt64(data["creator_id"]),
+		CreatedAt: asInt64(data["created_at"]),
+	}
+	json.Unmarshal([]byte(asString(data["events"])), &w.Events)
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+	return w
+}
+
+func webhookDeliveryFromRow(data map[string]interface{}) WebhookDelivery {
+	return WebhookDelivery{
+		ID:            asInt64(data["id"]),
+		WebhookID:     asInt64(data["webhook_id"]),
+		Event:         asString(data["event"]),
+		Payload:       asString(data["payload"]),
+		Status:        asString(data["status"]),
+		Attempts:      int(asInt64(data["attempts"])),
+		ResponseCode:  int(asInt64(data["response_code"])),
+		ResponseBody:  asString(data["response_body"]),
+		Error:         asString(data["error"]),
+		NextAttemptAt: asInt64(data["next_attempt_at"]),
+		CreatedAt:     asInt64(data["created_at"]),
+		DeliveredAt:   asInt64(data["delivered_at"]),
+	}
+}
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clientTo 返回把所有连接都发往 srv 的客户端，webhook 可以使用公网域名的地址
+func clientTo(srv *httptest.Server) *http.Client {
+	return &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+	}}}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	db := newTestDB(t)
+	projectID, _ := CreateProject(db, &Project{Name: "CI", CreatorID: 1})
+
+	var mu sync.Mutex
+	var received []*http.Request
+	var bodies [][]byte
+	status := http.StatusInternalServerError
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r)
+		bodies = append(bodies, body)
+		w.WriteHeader(status)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	client := clientTo(srv)
+	hookURL := "http://hooks.example.com/ci"
+
+	if _, err := CreateWebhook(db, &Webhook{ProjectID: projectID, URL: "ftp://example.com"}); !errors.Is(err, ErrInvalidWebhook) {
+		t.Fatalf("应拒绝非 http 地址, got %v", err)
+	}
+	if _, err := CreateWebhook(db, &Webhook{ProjectID: projectID, URL: hookURL, Events: []string{"card.*"}}); !errors.Is(err, ErrInvalidWebhook) {
+		t.Fatalf("应拒绝未知的事件, got %v", err)
+	}
+	hook := &Webhook{ProjectID: projectID, URL: hookURL, Secret: "s3cret", Events: []string{"entry.*"}, Active: true}
+	if _, err := CreateWebhook(db, hook); err != nil {
+		t.Fatalf("创建 webhook 失败: %v", err)
+	}
+	CreateWebhook(db, &Webhook{ProjectID: projectID, URL: hookURL, Active: false})
+
+	if n, _ := QueueWebhookEvent(db, projectID, WebhookListCreated, 1, nil); n != 0 {
+		t.Fatalf("不匹配过滤条件或已停用的 webhook 不应投递, queued=%d", n)
+	}
+	n, err := QueueWebhookEvent(db, projectID, WebhookEntryCreated, 1, map[string]string{"title": "Build"})
+	if err != nil || n != 1 {
+		t.Fatalf("排队事件失败: %v %d", err, n)
+	}
+
+	// 接收方返回 500 时按指数退避重试
+	now := time.Now().Unix()
+	if err := ProcessWebhookDeliveries(context.Background(), db, client, now); err != nil {
+		t.Fatalf("投递失败: %v", err)
+	}
+	deliveries, _ := GetWebhookDeliveries(db, hook.ID, 0)
+	d := deliveries[0]
+	if d.Status != DeliveryPending || d.Attempts != 1 || d.ResponseCode != 500 || d.NextAttemptAt != now+webhookRetryBase {
+		t.Fatalf("失败的投递应记录状态码并等待重试: %+v", d)
+	}
+	ProcessWebhookDeliveries(context.Background(), db, client, now)
+	if len(received) != 1 {
+		t.Fatal("未到重试时间不应再次投递")
+	}
+
+	mu.Lock()
+	status = http.StatusNoContent
+	mu.Unlock()
+	ProcessWebhookDeliveries(context.Background(), db, client, d.NextAttemptAt)
+	d2, _ := GetWebhookDelivery(db, d.ID)
+	if d2.Status != DeliverySucceeded || d2.Attempts != 2 || d2.ResponseCode != 204 || d2.DeliveredAt == 0 {
+		t.Fatalf("重试成功后应标记为成功: %+v", d2)
+	}
+
+	// 请求头与签名
+	r, body := received[1], bodies[1]
+	if r.Header.Get(WebhookEventHeader) != WebhookEntryCreated || r.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("请求头不正确: %v", r.Header)
+	}
+	if r.Header.Get(WebhookSignatureHeader) != SignWebhookPayload("s3cret", body) {
+		t.Fatalf("签名不正确: %s", r.Header.Get(WebhookSignatureHeader))
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Event != WebhookEntryCreated || payload.ProjectID != projectID {
+		t.Fatalf("负载不正确: %v %s", err, body)
+	}
+
+	// 重新投递生成新的投递记录
+	redelivery, err := RedeliverWebhookDelivery(db, d.ID)
+	if err != nil || redelivery.ID == d.ID || redelivery.Payload != d.Payload || redelivery.Status != DeliveryPending {
+		t.Fatalf("重新投递失败: %v %+v", err, redelivery)
+	}
+	ProcessWebhookDeliveries(context.Background(), db, client, time.Now().Unix())
+	if len(received) != 3 || string(bodies[2]) != string(body) {
+		t.Fatalf("重新投递应发送相同的负载: %d", len(received))
+	}
+
+	// 达到最大次数后标记为失败
+	mu.Lock()
+	status = http.StatusBadGateway
+	mu.Unlock()
+	QueueWebhookEvent(db, projectID, WebhookEntryDeleted, 1, nil)
+	at := time.Now().Unix()
+	for i := 0; i < MaxWebhookAttempts; i++ {
+		ProcessWebhookDeliveries(context.Background(), db, client, at)
+		at += webhookRetryBase << i
+	}
+	deliveries, _ = GetWebhookDeliveries(db, hook.ID, 1)
+	if len(deliveries) != 1 || deliveries[0].Status != DeliveryFailed || deliveries[0].Attempts != MaxWebhookAttempts {
+		t.Fatalf("达到最大次数后应标记为失败: %+v", deliveries)
+	}
+
+	if err := DeleteWebhook(db, hook.ID); err != nil {
+		t.Fatalf("删除 webhook 失败: %v", err)
+	}
+	if list, _ := GetWebhookDeliveries(db, hook.ID, 0); len(list) != 0 {
+		t.Fatal("删除 webhook 应同时删除投递记录")
+	}
+}
+
+func TestWebhookBlocksInternalAddresses(t *testing.T) {
+	db := newTestDB(t)
+	for _, u := range []string{"http://127.0.0.1:8080/hook", "http://localhost/hook", "http://[::1]/", "http://169.254.169.254/latest/meta-data", "https://10.0.0.5/", "http://192.168.1.1/"} {
+		if _, err := CreateWebhook(db, &Webhook{ProjectID: 1, URL: u}); !errors.Is(err, ErrInvalidWebhook) {
+			t.Fatalf("应拒绝内网地址 %s, got %v", u, err)
+		}
+	}
+
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+	client := NewWebhookClient(time.Second)
+	// 域名解析到回环地址时在连接前拒绝
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	for _, u := range []string{srv.URL, "http://localhost:" + port} {
+		resp, err := client.Post(u, "application/json", nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if !errors.Is(err, ErrBlockedAddress) {
+			t.Fatalf("应拒绝连接 %s, got %v", u, err)
+		}
+	}
+	if called {
+		t.Fatal("请求不应到达内网服务")
+	}
+}
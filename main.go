@@ -10,6 +10,9 @@ import (
 	"liteboard/api"
 	"liteboard/auth"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "liteboard/docs"
 
@@ -25,9 +28,12 @@ import (
 	swaggerFiles "github.com/swaggo/files"
 	"golang.org/x/net/http2"
 
-	_ "liteboard/internal"
+	"liteboard/internal"
 )
 
+// dbPath 是 SQLite 数据库文件
+const dbPath = "liteboard.db"
+
 func main() {
 	// Register the type for gob encoding to allow storing auth.User in sessions
 	gob.Register(&auth.User{})
@@ -41,17 +47,42 @@ func main() {
 	crtPath := flag.String("crt", "server.crt", "TLS certificate path/TLS 证书路径")
 	keyPath := flag.String("key", "server.key", "TLS key path/TLS 密钥路径")
 	caPath := flag.String("ca", "ca.crt", "TLS CA certificate path/TLS CA 证书路径")
+	storageType := flag.String("storage", "local", "Attachment storage: local or s3/附件存储方式")
+	storageDir := flag.String("storage-dir", "attachments", "Attachment directory for local storage/本地附件目录")
+	maxUploadMB := flag.Int64("max-upload", 10, "Max attachment size in MiB/附件大小上限 (MiB)")
+	backupDir := flag.String("backup-dir", "backups", "Directory for database snapshots/数据库快照目录")
+	backupInterval := flag.Duration("backup-interval", 24*time.Hour, "Interval between scheduled snapshots, 0 to disable/定时快照间隔，0 为关闭")
+	backupKeep := flag.Int("backup-keep", 7, "Number of snapshots to keep, 0 to keep all/保留的快照数量，0 为全部保留")
 
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: liteboard [flags]                  start the server/启动服务")
+		fmt.Fprintln(flag.CommandLine.Output(), "       liteboard [flags] backup [file]    back up the database/备份数据库")
+		fmt.Fprintln(flag.CommandLine.Output(), "       liteboard restore <file>           restore the database, server stopped/恢复数据库（需先停止服务）")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 	if *help {
 		flag.Usage()
 		return
 	}
+	switch flag.Arg(0) {
+	case "":
+	case "backup":
+		runBackup(flag.Arg(1), *backupDir, *backupKeep)
+		return
+	case "restore":
+		runRestore(flag.Arg(1))
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
 	if *sessionSecret == "" {
 		hlog.Error("The session secret is strongly recommended to be set for security reasons.")
 	}
 
 	initDB()
+	initBlobStore(*storageType, *storageDir, *maxUploadMB)
 
 	hlog.Debug("Starting liteboard application")
 
@@ -63,15 +94,20 @@ func main() {
 		hlog.Info("TLS is enabled. Make sure to configure TLS certificates in production.")
 		hlog.Info("Remember to set crtPath, keyPath, and caPath correctly.")
 
-		h = server.Default(withTLS(*crtPath, *keyPath, *caPath), server.WithHostPorts(listenAddr))
+		h = server.Default(withTLS(*crtPath, *keyPath, *caPath), server.WithHostPorts(listenAddr), withMaxBody(*maxUploadMB))
 		hlog.Info("Listening on https://" + listenAddr)
 		serverAddr = "https://" + listenAddr
 	} else {
-		h = server.Default(server.WithHostPorts(listenAddr))
+		h = server.Default(server.WithHostPorts(listenAddr), withMaxBody(*maxUploadMB))
 		hlog.Info("Listening on http://" + listenAddr)
 		serverAddr = "http://" + listenAddr
 	}
 
+	initMailer(serverAddr)
+	api.StartWebhookWorker(time.Minute)
+	api.SetBackupConfig(dbPath, *backupDir, *backupKeep)
+	api.StartBackupWorker(*backupInterval)
+
 	store := cookie.NewStore([]byte(*sessionSecret))
 	h.Use(sessions.New("user", store))
 
@@ -117,6 +153,12 @@ func main() {
 	})
 	// 注册认证路由 (公开)
 	api.RegisterAuthRoutes(r)
+	// 邮件退订链接 (公开，凭令牌)
+	api.RegisterUnsubscribeRoutes(r)
+	// 邀请邮件中的接受链接 (未登录时先跳转登录)
+	api.RegisterInviteLinkRoutes(r)
+	// 外部系统推送的 incoming webhook (公开，凭令牌)
+	api.RegisterIncomingHookRoutes(r)
 
 	// 受保护路由组，需登录且具备组权限
 	apiRoute := r.Group("/api")
@@ -128,6 +170,25 @@ func main() {
 	api.RegisterProjectRoutes(apiRoute)
 	api.RegisterUserRoutes(apiRoute)
 	api.RegisterShareRoutes(apiRoute)
+	api.RegisterLabelRoutes(apiRoute)
+	api.RegisterCustomFieldRoutes(apiRoute)
+	api.RegisterCommentRoutes(apiRoute)
+	api.RegisterAttachmentRoutes(apiRoute)
+	api.RegisterRenderRoutes(apiRoute)
+	api.RegisterRelationRoutes(apiRoute)
+	api.RegisterArchiveRoutes(apiRoute)
+	api.RegisterTransferRoutes(apiRoute)
+	api.RegisterBatchRoutes(apiRoute)
+	api.RegisterPageRoutes(apiRoute)
+	api.RegisterSidebarRoutes(apiRoute)
+	api.RegisterSyncRoutes(apiRoute)
+	api.RegisterNotificationRoutes(apiRoute)
+	api.RegisterEmailRoutes(apiRoute)
+	api.RegisterInvitationRoutes(apiRoute)
+	api.RegisterWebhookRoutes(apiRoute)
+	api.RegisterIncomingWebhookRoutes(apiRoute)
+	api.RegisterImportRoutes(apiRoute)
+	api.RegisterBackupRoutes(apiRoute)
 
 	// User profile endpoint (requires login only, no permission check)
 	apiRoute.GET("/user/profile", api.GetUserProfile)
@@ -150,7 +211,8 @@ func main() {
 func initDB() {
 	// 初始化数据库
 	hlog.Debug("Opening database connection")
-	conn, err := dbhelper.Open(types.DBConfig{Driver: "sqlite3", DSN: "liteboard.db"})
+	// 多步操作在另一条连接上以事务执行，进行中时其他请求仍读取已提交的数据
+	conn, err := internal.OpenDatabase(types.DBConfig{Driver: "sqlite3", DSN: dbPath})
 	if err != nil {
 		hlog.Fatal("Failed to open database:", err)
 	}
@@ -158,17 +220,34 @@ func initDB() {
 	// 创建表
 	hlog.Debug("Creating database tables")
 	tables := []string{
-		"CREATE TABLE IF NOT EXISTS project (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, description TEXT, creator_id INTEGER)",
-		"CREATE TABLE IF NOT EXISTS user (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT, email TEXT, openid TEXT, password_hash TEXT, groups TEXT, avatar_url TEXT)",
-		"CREATE TABLE IF NOT EXISTS page (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT, author_id INTEGER)",
-		"CREATE TABLE IF NOT EXISTS sidebar (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, description TEXT)",
-		"CREATE TABLE IF NOT EXISTS sidebar_item (id INTEGER PRIMARY KEY AUTOINCREMENT, parent_id INTEGER, name TEXT, icon TEXT, url TEXT, order_num INTEGER)",
-		"CREATE TABLE IF NOT EXISTS content_list (id INTEGER PRIMARY KEY AUTOINCREMENT, type TEXT, title TEXT, items TEXT, creator_id INTEGER, project_id INTEGER)",
-		"CREATE TABLE IF NOT EXISTS content_entry (id INTEGER PRIMARY KEY AUTOINCREMENT, type TEXT, title TEXT, content TEXT, creator_id INTEGER, project_id INTEGER)",
-		"CREATE TABLE IF NOT EXISTS detail_permission (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, content_type TEXT, content_ids TEXT, action TEXT)",
+		"CREATE TABLE IF NOT EXISTS project (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, description TEXT, creator_id INTEGER, is_template INTEGER DEFAULT 0, created_at INTEGER DEFAULT 0, updated_at INTEGER DEFAULT 0, updated_by INTEGER DEFAULT 0)",
+		"CREATE TABLE IF NOT EXISTS user (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT, email TEXT, openid TEXT, password_hash TEXT, groups TEXT, avatar_url TEXT, created_at INTEGER DEFAULT 0, updated_at INTEGER DEFAULT 0, updated_by INTEGER DEFAULT 0)",
+		"CREATE TABLE IF NOT EXISTS page (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER DEFAULT 0, parent_id INTEGER DEFAULT 0, title TEXT, slug TEXT DEFAULT '', body TEXT DEFAULT '', author_id INTEGER)",
+		"CREATE TABLE IF NOT EXISTS sidebar (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER DEFAULT 0, user_id INTEGER DEFAULT 0, name TEXT, description TEXT)",
+		"CREATE TABLE IF NOT EXISTS sidebar_item (id INTEGER PRIMARY KEY AUTOINCREMENT, sidebar_id INTEGER DEFAULT 0, parent_id INTEGER, name TEXT, icon TEXT, url TEXT, order_num INTEGER, target_type TEXT DEFAULT '', target_id INTEGER DEFAULT 0)",
+		"CREATE TABLE IF NOT EXISTS content_list (id INTEGER PRIMARY KEY AUTOINCREMENT, type TEXT, title TEXT, items TEXT, creator_id INTEGER, project_id INTEGER, max_items INTEGER DEFAULT 0, allowed_types TEXT DEFAULT '[]', move_permission TEXT DEFAULT '', archived_at INTEGER DEFAULT 0, created_at INTEGER DEFAULT 0, updated_at INTEGER DEFAULT 0, updated_by INTEGER DEFAULT 0)",
+		"CREATE TABLE IF NOT EXISTS content_entry (id INTEGER PRIMARY KEY AUTOINCREMENT, type TEXT, title TEXT, content TEXT, creator_id INTEGER, project_id INTEGER, assignees TEXT DEFAULT '[]', start_at INTEGER DEFAULT 0, due_at INTEGER DEFAULT 0, archived_at INTEGER DEFAULT 0, archived_list_id INTEGER DEFAULT 0, archived_position INTEGER DEFAULT 0, created_at INTEGER DEFAULT 0, updated_at INTEGER DEFAULT 0, updated_by INTEGER DEFAULT 0)",
+		"CREATE TABLE IF NOT EXISTS detail_permission (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, content_type TEXT, content_ids TEXT, action TEXT, created_at INTEGER DEFAULT 0, updated_at INTEGER DEFAULT 0, updated_by INTEGER DEFAULT 0)",
 		"CREATE TABLE IF NOT EXISTS permission (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, description TEXT, content_type TEXT, action TEXT, detail INTEGER)",
 		"CREATE TABLE IF NOT EXISTS role (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, description TEXT, permissions TEXT)",
-		"CREATE TABLE IF NOT EXISTS share_token (id INTEGER PRIMARY KEY AUTOINCREMENT, token TEXT UNIQUE, project_id INTEGER, permission_level TEXT, created_at INTEGER, expires_at INTEGER)",
+		"CREATE TABLE IF NOT EXISTS share_token (id INTEGER PRIMARY KEY AUTOINCREMENT, token TEXT UNIQUE, project_id INTEGER, permission_level TEXT, created_at INTEGER, expires_at INTEGER, creator_id INTEGER DEFAULT 0)",
+		"CREATE TABLE IF NOT EXISTS label (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER, name TEXT, color TEXT, description TEXT)",
+		"CREATE TABLE IF NOT EXISTS content_entry_label (id INTEGER PRIMARY KEY AUTOINCREMENT, entry_id INTEGER, label_id INTEGER)",
+		"CREATE TABLE IF NOT EXISTS custom_field (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER, name TEXT, field_type TEXT, options TEXT, order_num INTEGER)",
+		"CREATE TABLE IF NOT EXISTS custom_field_value (id INTEGER PRIMARY KEY AUTOINCREMENT, entry_id INTEGER, field_id INTEGER, text_value TEXT, number_value REAL, int_value INTEGER)",
+		"CREATE TABLE IF NOT EXISTS attachment (id INTEGER PRIMARY KEY AUTOINCREMENT, entry_id INTEGER, project_id INTEGER, filename TEXT, content_type TEXT, size INTEGER, hash TEXT, uploader_id INTEGER, created_at INTEGER)",
+		"CREATE TABLE IF NOT EXISTS entry_relation (id INTEGER PRIMARY KEY AUTOINCREMENT, source_id INTEGER, target_id INTEGER, relation_type TEXT, creator_id INTEGER, created_at INTEGER)",
+		"CREATE TABLE IF NOT EXISTS entry_comment (id INTEGER PRIMARY KEY AUTOINCREMENT, entry_id INTEGER, parent_id INTEGER DEFAULT 0, author_id INTEGER, body TEXT, mentions TEXT DEFAULT '[]', deleted INTEGER DEFAULT 0, created_at INTEGER, updated_at INTEGER)",
+		"CREATE TABLE IF NOT EXISTS change_log (id INTEGER PRIMARY KEY AUTOINCREMENT, object_type TEXT, object_id INTEGER, op TEXT, user_id INTEGER DEFAULT 0, content_type TEXT DEFAULT '', project_id INTEGER DEFAULT 0, created_at INTEGER)",
+		"CREATE TABLE IF NOT EXISTS notification (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, type TEXT, actor_id INTEGER DEFAULT 0, project_id INTEGER DEFAULT 0, entry_id INTEGER DEFAULT 0, message TEXT, read INTEGER DEFAULT 0, created_at INTEGER)",
+		"CREATE TABLE IF NOT EXISTS notification_preference (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, type TEXT, enabled INTEGER DEFAULT 1)",
+		"CREATE TABLE IF NOT EXISTS email_preference (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER UNIQUE, immediate TEXT DEFAULT '[]', digest TEXT DEFAULT 'off', locale TEXT DEFAULT 'en', unsubscribe_token TEXT, last_digest_at INTEGER DEFAULT 0)",
+		"CREATE TABLE IF NOT EXISTS email_outbox (id INTEGER PRIMARY KEY AUTOINCREMENT, to_addr TEXT, subject TEXT, body TEXT, unsubscribe_url TEXT DEFAULT '', status TEXT, attempts INTEGER DEFAULT 0, next_attempt_at INTEGER, last_error TEXT DEFAULT '', created_at INTEGER, sent_at INTEGER DEFAULT 0)",
+		"CREATE TABLE IF NOT EXISTS invitation (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER, email TEXT, permission_level TEXT, inviter_id INTEGER, status TEXT, token_hash TEXT UNIQUE, created_at INTEGER, sent_at INTEGER, expires_at INTEGER, accepted_by INTEGER DEFAULT 0, accepted_at INTEGER DEFAULT 0)",
+		"CREATE TABLE IF NOT EXISTS webhook (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER, url TEXT, secret TEXT, events TEXT DEFAULT '[]', active INTEGER DEFAULT 1, creator_id INTEGER, created_at INTEGER)",
+		"CREATE TABLE IF NOT EXISTS webhook_delivery (id INTEGER PRIMARY KEY AUTOINCREMENT, webhook_id INTEGER, event TEXT, payload TEXT, status TEXT, attempts INTEGER DEFAULT 0, response_code INTEGER DEFAULT 0, response_body TEXT DEFAULT '', error TEXT DEFAULT '', next_attempt_at INTEGER, created_at INTEGER, delivered_at INTEGER DEFAULT 0)",
+		"CREATE TABLE IF NOT EXISTS incoming_webhook (id INTEGER PRIMARY KEY AUTOINCREMENT, project_id INTEGER, name TEXT, list_id INTEGER, entry_type TEXT DEFAULT '', title_template TEXT, content_template TEXT DEFAULT '', key_template TEXT DEFAULT '', active INTEGER DEFAULT 1, creator_id INTEGER, created_at INTEGER, token_hash TEXT UNIQUE)",
+		"CREATE TABLE IF NOT EXISTS incoming_webhook_key (id INTEGER PRIMARY KEY AUTOINCREMENT, webhook_id INTEGER, external_key TEXT, entry_id INTEGER, created_at INTEGER)",
 	}
 
 	for _, sql := range tables {
@@ -180,11 +259,131 @@ func initDB() {
 	}
 	hlog.Debug("Database tables created successfully")
 
+	// 只执行数据库尚未执行过的迁移，数据迁移因此只运行一次；列已存在时忽略
+	pending, err := internal.PendingMigrations(conn)
+	if err != nil {
+		hlog.Fatal("Failed to read schema version:", err)
+	}
+	for _, sql := range pending {
+		cond := dbhelper.Cond().Raw(sql).Build()
+		_, err := conn.Exec(cond)
+		if err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			hlog.Fatal("Failed to migrate table:", err)
+		}
+	}
+	// 记录 schema 版本，恢复备份时据此拒绝来自更新版本的数据库
+	if _, err := conn.Exec(dbhelper.Cond().Raw("PRAGMA user_version = " + strconv.Itoa(internal.SchemaVersion)).Build()); err != nil {
+		hlog.Fatal("Failed to set schema version:", err)
+	}
+	hlog.Debug("Database migrations applied successfully")
+
 	api.SetDB(conn)
 	auth.SetDB(conn)
+	auth.SetLoginHook(api.AcceptInvitationsOnLogin)
 	hlog.Debug("Database connections set for api and auth packages")
 }
 
+// runBackup 在服务运行时也可安全地备份数据库：指定 file 时写入该文件，否则在 dir 中写入带时间戳的快照并轮换
+func runBackup(file, dir string, keep int) {
+	var info *internal.BackupInfo
+	var err error
+	if file != "" {
+		info, err = internal.BackupDatabase(context.Background(), dbPath, file)
+	} else {
+		info, err = internal.SnapshotDatabase(context.Background(), dbPath, dir, keep)
+	}
+	if err != nil {
+		hlog.Fatal("Backup failed:", err)
+	}
+	fmt.Printf("Backed up %s to %s (%d bytes, schema version %d)\n", dbPath, info.File, info.Size, info.SchemaVersion)
+}
+
+// runRestore 校验备份后用其替换数据库，原数据库改名保留。恢复前需先停止服务
+func runRestore(file string) {
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "Usage: liteboard restore <file>")
+		os.Exit(2)
+	}
+	info, previous, err := internal.RestoreDatabase(context.Background(), file, dbPath)
+	if err != nil {
+		hlog.Fatal("Restore failed:", err)
+	}
+	fmt.Printf("Restored %s from %s (schema version %d)\n", dbPath, info.File, info.SchemaVersion)
+	if previous != "" {
+		fmt.Printf("The previous database was moved to %s\n", previous)
+	}
+}
+
+// initMailer 根据 SMTP_HOST、SMTP_PORT、SMTP_USERNAME、SMTP_PASSWORD、SMTP_FROM 和 SMTP_TLS
+// (none、starttls 或 tls) 配置邮件发送；未设置 SMTP_HOST 时不发送邮件。邮件中的链接以 PUBLIC_URL
+// 为前缀，默认为监听地址
+func initMailer(serverAddr string) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		hlog.Debug("SMTP_HOST not set, email notifications disabled")
+		return
+	}
+	port := 0
+	if s := os.Getenv("SMTP_PORT"); s != "" {
+		p, err := strconv.Atoi(s)
+		if err != nil {
+			hlog.Fatal("Invalid SMTP_PORT:", err)
+		}
+		port = p
+	}
+	mailer, err := internal.NewSMTPMailer(internal.SMTPConfig{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		TLS:      os.Getenv("SMTP_TLS"),
+	})
+	if err != nil {
+		hlog.Fatal("Failed to configure SMTP:", err)
+	}
+	baseURL := os.Getenv("PUBLIC_URL")
+	if baseURL == "" {
+		baseURL = serverAddr
+	}
+	api.SetMailer(mailer, strings.TrimRight(baseURL, "/"))
+	api.StartMailWorker(time.Minute)
+	hlog.Info("Email notifications sent through " + host)
+}
+
+// initBlobStore 初始化附件存储。s3 模式从环境变量读取 S3_ENDPOINT、S3_BUCKET、S3_REGION、
+// S3_ACCESS_KEY_ID 和 S3_SECRET_ACCESS_KEY
+func initBlobStore(storageType, storageDir string, maxUploadMB int64) {
+	limits := internal.DefaultAttachmentLimits
+	limits.MaxSize = maxUploadMB << 20
+	api.SetAttachmentLimits(limits)
+
+	switch storageType {
+	case "local":
+		store, err := internal.NewLocalBlobStore(storageDir)
+		if err != nil {
+			hlog.Fatal("Failed to create attachment directory:", err)
+		}
+		api.SetBlobStore(store)
+		hlog.Debug("Attachments stored in " + storageDir)
+	case "s3":
+		endpoint, bucket := os.Getenv("S3_ENDPOINT"), os.Getenv("S3_BUCKET")
+		if endpoint == "" || bucket == "" {
+			hlog.Fatal("S3_ENDPOINT and S3_BUCKET must be set for s3 storage")
+		}
+		api.SetBlobStore(internal.NewS3BlobStore(endpoint, bucket, os.Getenv("S3_REGION"),
+			os.Getenv("S3_ACCESS_KEY_ID"), os.Getenv("S3_SECRET_ACCESS_KEY")))
+		hlog.Debug("Attachments stored in S3 bucket " + bucket)
+	default:
+		hlog.Fatal("Unknown storage type: " + storageType)
+	}
+}
+
+// withMaxBody 放宽请求体大小限制，使其能容纳附件上传
+func withMaxBody(maxUploadMB int64) config.Option {
+	return server.WithMaxRequestBodySize(int((maxUploadMB + 1) << 20))
+}
+
 func withTLS(crtPath, keyPath, caPath string) config.Option {
 
 	// load server certificate